@@ -0,0 +1,211 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             v3.21.12
+// source: faucet.proto
+
+package faucetv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// FaucetServiceClient is the client API for FaucetService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type FaucetServiceClient interface {
+	// Claim queues a payout to an address or name.
+	Claim(ctx context.Context, in *ClaimRequest, opts ...grpc.CallOption) (*ClaimResponse, error)
+	// GetClaim returns the current status of a claim.
+	GetClaim(ctx context.Context, in *GetClaimRequest, opts ...grpc.CallOption) (*ClaimStatus, error)
+	// WatchClaim streams the status of a claim until it is final.
+	WatchClaim(ctx context.Context, in *GetClaimRequest, opts ...grpc.CallOption) (FaucetService_WatchClaimClient, error)
+}
+
+type faucetServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewFaucetServiceClient(cc grpc.ClientConnInterface) FaucetServiceClient {
+	return &faucetServiceClient{cc}
+}
+
+func (c *faucetServiceClient) Claim(ctx context.Context, in *ClaimRequest, opts ...grpc.CallOption) (*ClaimResponse, error) {
+	out := new(ClaimResponse)
+	err := c.cc.Invoke(ctx, "/faucet.v1.FaucetService/Claim", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *faucetServiceClient) GetClaim(ctx context.Context, in *GetClaimRequest, opts ...grpc.CallOption) (*ClaimStatus, error) {
+	out := new(ClaimStatus)
+	err := c.cc.Invoke(ctx, "/faucet.v1.FaucetService/GetClaim", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *faucetServiceClient) WatchClaim(ctx context.Context, in *GetClaimRequest, opts ...grpc.CallOption) (FaucetService_WatchClaimClient, error) {
+	stream, err := c.cc.NewStream(ctx, &FaucetService_ServiceDesc.Streams[0], "/faucet.v1.FaucetService/WatchClaim", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &faucetServiceWatchClaimClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type FaucetService_WatchClaimClient interface {
+	Recv() (*ClaimStatus, error)
+	grpc.ClientStream
+}
+
+type faucetServiceWatchClaimClient struct {
+	grpc.ClientStream
+}
+
+func (x *faucetServiceWatchClaimClient) Recv() (*ClaimStatus, error) {
+	m := new(ClaimStatus)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// FaucetServiceServer is the server API for FaucetService service.
+// All implementations must embed UnimplementedFaucetServiceServer
+// for forward compatibility
+type FaucetServiceServer interface {
+	// Claim queues a payout to an address or name.
+	Claim(context.Context, *ClaimRequest) (*ClaimResponse, error)
+	// GetClaim returns the current status of a claim.
+	GetClaim(context.Context, *GetClaimRequest) (*ClaimStatus, error)
+	// WatchClaim streams the status of a claim until it is final.
+	WatchClaim(*GetClaimRequest, FaucetService_WatchClaimServer) error
+	mustEmbedUnimplementedFaucetServiceServer()
+}
+
+// UnimplementedFaucetServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedFaucetServiceServer struct {
+}
+
+func (UnimplementedFaucetServiceServer) Claim(context.Context, *ClaimRequest) (*ClaimResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Claim not implemented")
+}
+func (UnimplementedFaucetServiceServer) GetClaim(context.Context, *GetClaimRequest) (*ClaimStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetClaim not implemented")
+}
+func (UnimplementedFaucetServiceServer) WatchClaim(*GetClaimRequest, FaucetService_WatchClaimServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchClaim not implemented")
+}
+func (UnimplementedFaucetServiceServer) mustEmbedUnimplementedFaucetServiceServer() {}
+
+// UnsafeFaucetServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to FaucetServiceServer will
+// result in compilation errors.
+type UnsafeFaucetServiceServer interface {
+	mustEmbedUnimplementedFaucetServiceServer()
+}
+
+func RegisterFaucetServiceServer(s grpc.ServiceRegistrar, srv FaucetServiceServer) {
+	s.RegisterService(&FaucetService_ServiceDesc, srv)
+}
+
+func _FaucetService_Claim_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ClaimRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FaucetServiceServer).Claim(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/faucet.v1.FaucetService/Claim",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FaucetServiceServer).Claim(ctx, req.(*ClaimRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FaucetService_GetClaim_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetClaimRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FaucetServiceServer).GetClaim(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/faucet.v1.FaucetService/GetClaim",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FaucetServiceServer).GetClaim(ctx, req.(*GetClaimRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FaucetService_WatchClaim_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GetClaimRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FaucetServiceServer).WatchClaim(m, &faucetServiceWatchClaimServer{stream})
+}
+
+type FaucetService_WatchClaimServer interface {
+	Send(*ClaimStatus) error
+	grpc.ServerStream
+}
+
+type faucetServiceWatchClaimServer struct {
+	grpc.ServerStream
+}
+
+func (x *faucetServiceWatchClaimServer) Send(m *ClaimStatus) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// FaucetService_ServiceDesc is the grpc.ServiceDesc for FaucetService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var FaucetService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "faucet.v1.FaucetService",
+	HandlerType: (*FaucetServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Claim",
+			Handler:    _FaucetService_Claim_Handler,
+		},
+		{
+			MethodName: "GetClaim",
+			Handler:    _FaucetService_GetClaim_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchClaim",
+			Handler:       _FaucetService_WatchClaim_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "faucet.proto",
+}
@@ -0,0 +1,5 @@
+// Package faucetv1 is the gRPC API of the faucet, generated from faucet.proto
+// with the HTTP routes of faucet.yaml served through grpc-gateway
+package faucetv1
+
+//go:generate protoc -I . --go_out=paths=source_relative:. --go-grpc_out=paths=source_relative:. --grpc-gateway_out=paths=source_relative,grpc_api_configuration=faucet.yaml:. faucet.proto
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+	"github.com/chainflag/eth-faucet/pkg/client"
+)
+
+type claimOptions struct {
+	address string
+	url     string
+	apiKey  string
+	wait    time.Duration
+}
+
+// runClaim implements "eth-faucet claim", which requests funds from a running
+// faucet the way its frontend does, solving the proof of work challenge in
+// place of the captcha, and waits until the payout is final
+func runClaim(args []string) error {
+	var opts claimOptions
+	fs := flag.NewFlagSet("claim", flag.ExitOnError)
+	fs.StringVar(&opts.address, "address", "", "Address to fund")
+	fs.StringVar(&opts.url, "url", "http://localhost:8080", "Base URL of the faucet")
+	fs.StringVar(&opts.apiKey, "apikey", os.Getenv("FAUCET_API_KEY"), "API key to claim with instead of solving a challenge")
+	fs.DurationVar(&opts.wait, "wait", 5*time.Minute, "Maximum time to wait for the payout, 0 to return once queued")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if !chain.IsValidAddress(opts.address, true) {
+		return fmt.Errorf("invalid address %q", opts.address)
+	}
+
+	ctx := context.Background()
+	if opts.wait > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.wait)
+		defer cancel()
+	}
+	return claimFunds(ctx, opts, os.Stdout)
+}
+
+func claimFunds(ctx context.Context, opts claimOptions, out io.Writer) error {
+	var clientOpts []client.Option
+	if opts.apiKey != "" {
+		clientOpts = append(clientOpts, client.WithAPIKey(opts.apiKey))
+	}
+	faucet := client.New(opts.url, clientOpts...)
+
+	info, err := faucet.Info(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch faucet info: %w", err)
+	}
+	if info.Paused {
+		return errors.New("the faucet is not accepting claims right now")
+	}
+	if info.SignIn {
+		return errors.New("the faucet requires signing in with the recipient address, claim through its website")
+	}
+
+	var claimOpts []client.ClaimOption
+	switch {
+	case opts.apiKey != "":
+		// The API key the client sends along skips the captcha
+	case info.PowDifficulty > 0:
+		challenge, err := faucet.Challenge(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to fetch proof of work challenge: %w", err)
+		}
+		fmt.Fprintf(out, "Solving proof of work challenge of difficulty %d\n", challenge.Difficulty)
+		nonce, err := challenge.Solve(ctx, opts.address)
+		if err != nil {
+			return err
+		}
+		claimOpts = append(claimOpts, client.WithProofOfWork(challenge.Seed, nonce))
+	case info.CaptchaProvider == "hcaptcha":
+		return errors.New("the faucet requires hCaptcha, claim with an API key instead")
+	}
+
+	claim, err := faucet.Claim(ctx, client.ClaimRequest{Address: opts.address}, claimOpts...)
+	if err != nil {
+		return fmt.Errorf("claim rejected: %w", err)
+	}
+	fmt.Fprintf(out, "Claim %s queued for %s %s on %s\n", claim.ClaimID, info.Payout, info.Symbol, info.Network)
+	if opts.wait <= 0 {
+		return nil
+	}
+
+	status, err := faucet.WaitForConfirmation(ctx, claim.ClaimID)
+	if errors.Is(err, client.ErrClaimFailed) {
+		return fmt.Errorf("payout failed: %s", status.Error)
+	} else if err != nil {
+		return fmt.Errorf("stopped waiting for payout: %w", err)
+	}
+	fmt.Fprintf(out, "Payout %s: %s\n", status.Status, status.TxHash)
+	return nil
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// loadConfigFile applies a YAML file whose nested keys mirror the command-line
+// flags, e.g. faucet: {amount: 2} sets -faucet.amount. Flags given on the command
+// line take precedence, and flags missing from the file fall back to their defaults
+func loadConfigFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var tree map[string]interface{}
+	if err := yaml.Unmarshal(data, &tree); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	values := make(map[string]string)
+	flattenConfig("", tree, values)
+
+	for name := range values {
+		if flag.Lookup(name) == nil {
+			return fmt.Errorf("%s: unknown config key %q", path, name)
+		}
+	}
+
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	var setErr error
+	flag.VisitAll(func(f *flag.Flag) {
+		if explicit[f.Name] || setErr != nil {
+			return
+		}
+		value, ok := values[f.Name]
+		if !ok {
+			value = f.DefValue
+		}
+		if err := f.Value.Set(value); err != nil {
+			setErr = fmt.Errorf("%s: invalid value %q for %s: %w", path, value, f.Name, err)
+		}
+	})
+	return setErr
+}
+
+func flattenConfig(prefix string, node interface{}, values map[string]string) {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			name := key
+			if prefix != "" {
+				name = prefix + "." + key
+			}
+			flattenConfig(name, child, values)
+		}
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = fmt.Sprint(item)
+		}
+		values[prefix] = strings.Join(items, ",")
+	case nil:
+		values[prefix] = ""
+	default:
+		values[prefix] = fmt.Sprint(v)
+	}
+}
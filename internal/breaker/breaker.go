@@ -0,0 +1,82 @@
+package breaker
+
+import (
+	"sync"
+	"time"
+)
+
+// Breaker stops calls to a failing service for a cooldown after a number of
+// consecutive failures, then lets a single trial call through and closes
+// again once one succeeds
+type Breaker struct {
+	mutex     sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+	trial     bool
+}
+
+func New(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{threshold: threshold, cooldown: cooldown}
+}
+
+// Allow reports whether a call may be made, taking the trial call once the
+// cooldown is over
+func (b *Breaker) Allow() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.failures < b.threshold {
+		return true
+	}
+	if b.trial || time.Now().Before(b.openUntil) {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+// Available reports whether a call would be let through, without taking the trial
+func (b *Breaker) Available() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.failures < b.threshold || (!b.trial && !time.Now().Before(b.openUntil))
+}
+
+// Open reports whether calls are currently refused
+func (b *Breaker) Open() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.failures >= b.threshold
+}
+
+// Success resets the count of failures and reports whether it closed the breaker
+func (b *Breaker) Success() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	closed := b.failures >= b.threshold
+	b.failures = 0
+	b.trial = false
+	return closed
+}
+
+// Failure counts a failed call, opening the breaker at the threshold or
+// again if the trial call failed. It reports whether the breaker just
+// reached the threshold, rather than a trial having failed
+func (b *Breaker) Failure() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.failures++
+	b.trial = false
+	if b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+	return b.failures == b.threshold
+}
+
+// Abandon gives the trial back when the caller gave up on it
+func (b *Breaker) Abandon() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.trial = false
+}
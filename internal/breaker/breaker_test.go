@@ -0,0 +1,61 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	b := New(2, time.Hour)
+
+	b.Failure()
+	if !b.Allow() || b.Open() {
+		t.Fatal("breaker opened before the threshold")
+	}
+	// A success resets the count of failures in a row
+	b.Success()
+	b.Failure()
+	if !b.Allow() || b.Open() {
+		t.Fatal("breaker opened on failures that were not in a row")
+	}
+	if !b.Failure() {
+		t.Error("Failure() at the threshold did not report opening the breaker")
+	}
+	if b.Allow() || !b.Open() {
+		t.Fatal("breaker not open at the threshold")
+	}
+
+	// Half open once the cooldown is over, letting a single trial through
+	b.openUntil = time.Now()
+	if !b.Allow() {
+		t.Fatal("trial call refused after the cooldown")
+	}
+	if b.Allow() {
+		t.Error("second call let through while the trial is in flight")
+	}
+	b.Abandon()
+	if !b.Available() || !b.Allow() {
+		t.Fatal("trial call refused after the previous one was abandoned")
+	}
+	if b.Failure() {
+		t.Error("Failure() of the trial reported reaching the threshold again")
+	}
+	if b.Allow() || !b.Open() {
+		t.Fatal("breaker not open again after a failed trial")
+	}
+	if b.openUntil.Before(time.Now().Add(59 * time.Minute)) {
+		t.Errorf("breaker open until %v after a failed trial, want a new cooldown", b.openUntil)
+	}
+
+	// A successful trial closes it
+	b.openUntil = time.Now()
+	if !b.Allow() {
+		t.Fatal("trial call refused after the cooldown")
+	}
+	if !b.Success() {
+		t.Error("Success() of the trial did not report closing the breaker")
+	}
+	if !b.Allow() || !b.Allow() || b.Open() {
+		t.Error("breaker not closed after a successful trial")
+	}
+}
@@ -0,0 +1,149 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	log "github.com/sirupsen/logrus"
+)
+
+// AddressCodec is implemented by tx builders of chains whose addresses are not
+// hex, converting them from and to the 20 byte accounts the server works with
+type AddressCodec interface {
+	ParseAddress(address string) (common.Address, error)
+	FormatAddress(account common.Address) string
+}
+
+// UnsignedTx is a payout built by a chain adapter. SignBytes are what the
+// funder key signs and Raw the encoding of the tx without its signature
+type UnsignedTx struct {
+	Sequence  uint64
+	SignBytes []byte
+	Raw       []byte
+}
+
+// SignedTx is a payout ready to be broadcast
+type SignedTx struct {
+	Hash     common.Hash
+	Sequence uint64
+	Raw      []byte
+}
+
+// ChainAdapter is the payout layer of a chain that is not EVM compatible.
+// Values are given in wei, i.e. with 18 decimals, whatever the decimals of the
+// chain's coin, and accounts as the 20 bytes of their address
+type ChainAdapter interface {
+	AddressCodec
+	// Funder returns the account payouts are sent from
+	Funder() common.Address
+	// Balance returns the balance of the funder
+	Balance(ctx context.Context) (*big.Int, error)
+	BuildTx(ctx context.Context, to common.Address, value *big.Int) (*UnsignedTx, error)
+	Sign(ctx context.Context, tx *UnsignedTx) (*SignedTx, error)
+	// Broadcast sends tx to the network, returning ErrNonceUsed if its
+	// sequence was taken by another tx
+	Broadcast(ctx context.Context, tx *SignedTx) error
+	Confirm(ctx context.Context, hash common.Hash, confirmations uint64) (TxState, error)
+}
+
+// AdapterTxBuild pays out through a chain adapter, so that the faucet server
+// and its checks work the same on any chain
+type AdapterTxBuild struct {
+	adapter ChainAdapter
+	dryRun  bool
+	mutex   sync.Mutex
+	sent    map[common.Hash]*SignedTx
+}
+
+// NewAdapterTxBuilder builds, signs and broadcasts payouts one at a time, so
+// that their sequence numbers follow each other. Dry runs are signed but not
+// broadcast
+func NewAdapterTxBuilder(adapter ChainAdapter, dryRun bool) *AdapterTxBuild {
+	return &AdapterTxBuild{adapter: adapter, dryRun: dryRun, sent: make(map[common.Hash]*SignedTx)}
+}
+
+func (b *AdapterTxBuild) Sender() common.Address {
+	return b.adapter.Funder()
+}
+
+func (b *AdapterTxBuild) Transfer(ctx context.Context, to string, value *big.Int) (common.Hash, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	unsigned, err := b.adapter.BuildTx(ctx, common.HexToAddress(to), value)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	tx, err := b.adapter.Sign(ctx, unsigned)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if b.dryRun {
+		log.WithFields(log.Fields{
+			"txHash":   tx.Hash,
+			"sequence": tx.Sequence,
+			"to":       b.adapter.FormatAddress(common.HexToAddress(to)),
+			"value":    value,
+		}).Info("Dry run, tx not broadcast")
+		return tx.Hash, nil
+	}
+	if err := b.adapter.Broadcast(ctx, tx); err != nil {
+		return common.Hash{}, err
+	}
+	b.sent[tx.Hash] = tx
+	return tx.Hash, nil
+}
+
+func (b *AdapterTxBuild) ParseAddress(address string) (common.Address, error) {
+	return b.adapter.ParseAddress(address)
+}
+
+func (b *AdapterTxBuild) FormatAddress(account common.Address) string {
+	return b.adapter.FormatAddress(account)
+}
+
+// BalanceAt returns the balance of the funder, the only account the adapter knows the balance of
+func (b *AdapterTxBuild) BalanceAt(ctx context.Context, account common.Address, _ *big.Int) (*big.Int, error) {
+	if account != b.adapter.Funder() {
+		return nil, errors.New("only the balance of the funder is available")
+	}
+	return b.adapter.Balance(ctx)
+}
+
+// Confirm reports the state of the tx sent as hash, which is never replaced
+func (b *AdapterTxBuild) Confirm(ctx context.Context, hash common.Hash, confirmations uint64) (TxState, common.Hash, error) {
+	state, err := b.adapter.Confirm(ctx, hash, confirmations)
+	if err == nil && state != TxPending && state != TxDropped {
+		b.mutex.Lock()
+		delete(b.sent, hash)
+		b.mutex.Unlock()
+	}
+	return state, hash, err
+}
+
+// Resend broadcasts a dropped tx again as it was signed
+func (b *AdapterTxBuild) Resend(ctx context.Context, hash common.Hash) (common.Hash, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	tx, ok := b.sent[hash]
+	if !ok {
+		return common.Hash{}, ErrNonceUsed
+	}
+	if err := b.adapter.Broadcast(ctx, tx); err != nil {
+		if errors.Is(err, ErrNonceUsed) {
+			delete(b.sent, hash)
+		}
+		return common.Hash{}, err
+	}
+	return hash, nil
+}
+
+// Check verifies the adapter can still send payouts, if it knows how to
+func (b *AdapterTxBuild) Check(ctx context.Context) error {
+	if checker, ok := b.adapter.(HealthChecker); ok {
+		return checker.Check(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// disperseABI is the payout function of the Disperse contract (disperse.app) and compatible multisend contracts
+const disperseABI = `[{"name":"disperseEther","type":"function","stateMutability":"payable","inputs":[{"name":"recipients","type":"address[]"},{"name":"values","type":"uint256[]"}],"outputs":[]}]`
+
+var (
+	errNoMultisend = errors.New("multisend contract is not configured")
+	disperse, _    = abi.JSON(strings.NewReader(disperseABI))
+)
+
+// BatchTxBuilder sends several payouts in a single multisend transaction
+type BatchTxBuilder interface {
+	TxBuilder
+	BatchTransfer(ctx context.Context, to []string, values []*big.Int) (common.Hash, error)
+}
+
+func (b *TxBuild) BatchTransfer(ctx context.Context, to []string, values []*big.Int) (common.Hash, error) {
+	if b.opts.multisend == nil || b.opts.faucet != nil {
+		return common.Hash{}, errNoMultisend
+	}
+	if len(to) != len(values) {
+		return common.Hash{}, errors.New("recipients and values differ in length")
+	}
+
+	recipients := make([]common.Address, len(to))
+	total := new(big.Int)
+	for i, address := range to {
+		recipients[i] = common.HexToAddress(address)
+		total.Add(total, values[i])
+	}
+	data, err := disperse.Pack("disperseEther", recipients, values)
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	gasLimit, err := b.client.EstimateGas(ctx, ethereum.CallMsg{
+		From:  b.fromAddress,
+		To:    b.opts.multisend,
+		Value: total,
+		Data:  data,
+	})
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return b.send(ctx, b.opts.multisend, total, data, gasLimit)
+}
@@ -0,0 +1,60 @@
+package chain
+
+import (
+	"context"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestTxBuilderBatchTransfer(t *testing.T) {
+	privateKey, _ := crypto.HexToECDSA("976f9f7772781ff6d1c93941129d417c49a209c674056a3cf5e27e225ee55fa8")
+	fromAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
+	simClient := backends.NewSimulatedBackend(
+		core.GenesisAlloc{
+			fromAddress: {Balance: big.NewInt(10000000000000000)},
+		}, 10000000,
+	)
+	defer simClient.Close()
+
+	bgCtx := context.Background()
+	recipients := []string{"0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", "0x0000000000000000000000000000000000000001"}
+	values := []*big.Int{big.NewInt(1000), big.NewInt(2000)}
+	txBuilder := newTxBuild(simClient, NewKeySigner(privateKey), types.NewLondonSigner(big.NewInt(1337)))
+	if _, err := txBuilder.BatchTransfer(bgCtx, recipients, values); err != errNoMultisend {
+		t.Errorf("BatchTransfer() without contract error = %v, want %v", err, errNoMultisend)
+	}
+
+	contract := common.HexToAddress("0xD152f549545093347A162Dce210e7293f1452150")
+	txBuilder = newTxBuild(simClient, NewKeySigner(privateKey), types.NewLondonSigner(big.NewInt(1337)), WithMultisend(contract))
+	txHash, err := txBuilder.BatchTransfer(bgCtx, recipients, values)
+	if err != nil {
+		t.Fatalf("BatchTransfer() error = %v", err)
+	}
+	simClient.Commit()
+
+	tx, _, err := simClient.TransactionByHash(bgCtx, txHash)
+	if err != nil {
+		t.Fatalf("could not get batch tx: %v", err)
+	}
+	if *tx.To() != contract {
+		t.Errorf("tx sent to %v, want %v", tx.To(), contract)
+	}
+	if tx.Value().Cmp(big.NewInt(3000)) != 0 {
+		t.Errorf("tx value = %v, want 3000", tx.Value())
+	}
+	args, err := disperse.Methods["disperseEther"].Inputs.Unpack(tx.Data()[4:])
+	if err != nil {
+		t.Fatalf("could not decode calldata: %v", err)
+	}
+	want := []common.Address{common.HexToAddress(recipients[0]), common.HexToAddress(recipients[1])}
+	if !reflect.DeepEqual(args[0], want) || !reflect.DeepEqual(args[1], values) {
+		t.Errorf("calldata = %v, want %v %v", args, want, values)
+	}
+}
@@ -0,0 +1,109 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+type TxState string
+
+const (
+	TxPending   TxState = "pending"
+	TxMined     TxState = "mined"
+	TxConfirmed TxState = "confirmed"
+	TxReverted  TxState = "reverted"
+	TxDropped   TxState = "dropped"
+)
+
+// ErrNonceUsed means a dropped tx cannot be resent because its nonce was taken by another tx
+var ErrNonceUsed = errors.New("nonce of dropped tx is already used")
+
+// Confirmer is implemented by tx builders able to follow sent txs until they are confirmed
+type Confirmer interface {
+	Confirm(ctx context.Context, hash common.Hash, confirmations uint64) (TxState, common.Hash, error)
+	Resend(ctx context.Context, hash common.Hash) (common.Hash, error)
+}
+
+// Replacer is implemented by tx builders that replace stalled txs with a higher gas price
+type Replacer interface {
+	// OnReplace registers fn to be told about every replaced tx. It must be
+	// called before any payout is sent
+	OnReplace(fn func(replaced, replacement common.Hash))
+}
+
+func (b *TxBuild) OnReplace(fn func(replaced, replacement common.Hash)) {
+	b.nonces.mutex.Lock()
+	defer b.nonces.mutex.Unlock()
+	b.nonces.onReplace = fn
+}
+
+// Confirm reports the state of the tx sent as hash, following the replacements of
+// stalled txs, along with the hash of the version that was mined or is pending
+func (b *TxBuild) Confirm(ctx context.Context, hash common.Hash, confirmations uint64) (TxState, common.Hash, error) {
+	versions := b.nonces.Versions(hash)
+	for _, version := range versions {
+		receipt, err := b.client.TransactionReceipt(ctx, version)
+		if errors.Is(err, ethereum.NotFound) {
+			continue
+		} else if err != nil {
+			return "", hash, err
+		}
+
+		if receipt.Status == types.ReceiptStatusFailed {
+			return TxReverted, version, nil
+		}
+		head, err := b.client.HeaderByNumber(ctx, nil)
+		if err != nil {
+			return "", hash, err
+		}
+		if new(big.Int).Sub(head.Number, receipt.BlockNumber).Uint64()+1 < confirmations {
+			return TxMined, version, nil
+		}
+		return TxConfirmed, version, nil
+	}
+
+	for i := len(versions) - 1; i >= 0; i-- {
+		if _, _, err := b.client.TransactionByHash(ctx, versions[i]); err == nil {
+			return TxPending, versions[i], nil
+		} else if !errors.Is(err, ethereum.NotFound) {
+			return "", hash, err
+		}
+	}
+	return TxDropped, versions[len(versions)-1], nil
+}
+
+// Resend broadcasts a dropped tx again with the same nonce and a higher gas price
+func (b *TxBuild) Resend(ctx context.Context, hash common.Hash) (common.Hash, error) {
+	unlock, err := lockAccount(ctx, b.nonces.locker, b.fromAddress)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	defer unlock()
+
+	tx, ok := b.nonces.Pending(hash)
+	if !ok {
+		return common.Hash{}, ErrNonceUsed
+	}
+	confirmed, err := b.client.NonceAt(ctx, b.fromAddress, nil)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if tx.Nonce() < confirmed {
+		return common.Hash{}, ErrNonceUsed
+	}
+
+	resent, err := b.sign(bumpGas(tx, b.nonces.gasBump))
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if err := b.client.SendTransaction(ctx, resent); err != nil {
+		return common.Hash{}, err
+	}
+	b.nonces.Track(resent)
+	return resent.Hash(), nil
+}
@@ -0,0 +1,63 @@
+package chain
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestTxBuilderConfirm(t *testing.T) {
+	privateKey, _ := crypto.HexToECDSA("976f9f7772781ff6d1c93941129d417c49a209c674056a3cf5e27e225ee55fa8")
+	fromAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
+	simClient := backends.NewSimulatedBackend(
+		core.GenesisAlloc{
+			fromAddress: {Balance: big.NewInt(10000000000000000)},
+		}, 10000000,
+	)
+	defer simClient.Close()
+
+	bgCtx := context.Background()
+	locker := &mutexLocker{}
+	txBuilder := newTxBuild(simClient, NewKeySigner(privateKey), types.NewLondonSigner(big.NewInt(1337)), WithLocker(locker))
+	txHash, err := txBuilder.Transfer(bgCtx, "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", big.NewInt(1000))
+	if err != nil {
+		t.Fatalf("Transfer() error = %v", err)
+	}
+	assertState := func(want TxState) {
+		t.Helper()
+		state, _, err := txBuilder.Confirm(bgCtx, txHash, 2)
+		if err != nil {
+			t.Fatalf("Confirm() error = %v", err)
+		}
+		if state != want {
+			t.Errorf("Confirm() state = %s, want %s", state, want)
+		}
+	}
+
+	assertState(TxPending)
+	simClient.Rollback()
+	assertState(TxDropped)
+
+	resentHash, err := txBuilder.Resend(bgCtx, txHash)
+	if err != nil {
+		t.Fatalf("Resend() error = %v", err)
+	}
+	if locker.locks != 2 {
+		t.Errorf("lock taken %d times for a transfer and a resend, want 2", locker.locks)
+	}
+	simClient.Commit()
+	assertState(TxMined)
+	simClient.Commit()
+	assertState(TxConfirmed)
+	if _, version, _ := txBuilder.Confirm(bgCtx, txHash, 2); version != resentHash {
+		t.Errorf("Confirm() version = %v, want resent tx %v", version, resentHash)
+	}
+	if _, err := txBuilder.Resend(bgCtx, txHash); err != ErrNonceUsed {
+		t.Errorf("Resend() of a mined tx error = %v, want %v", err, ErrNonceUsed)
+	}
+}
@@ -0,0 +1,398 @@
+package chain
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"golang.org/x/crypto/ripemd160"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	// cosmosDropTimeout is how long a broadcast tx may be missing from the chain before it counts as dropped
+	cosmosDropTimeout = 2 * time.Minute
+	// cosmosWrongSequence is the code the SDK rejects txs with an unexpected sequence with
+	cosmosWrongSequence = 32
+	// signModeDirect signs the protobuf encoding of the tx
+	signModeDirect = 1
+)
+
+var errNotFound = errors.New("not found")
+
+// CosmosAdapter pays out on Cosmos SDK chains with bank sends signed by a
+// secp256k1 funder key, talking to the REST API of a node
+type CosmosAdapter struct {
+	endpoint string
+	http     *http.Client
+	signer   Signer
+	pubKey   []byte
+	funder   common.Address
+	chainID  string
+	prefix   string
+	denom    string
+	decimals int
+	gasLimit uint64
+	fee      *big.Int
+
+	mutex    sync.Mutex
+	synced   bool
+	number   uint64
+	sequence uint64
+	sentAt   map[common.Hash]time.Time
+}
+
+// NewCosmosAdapter pays out denom, a coin with the given decimals, from the
+// account of signer on the chain chainID, whose addresses start with prefix.
+// Every payout may use up to gasLimit gas and pays fee in denom
+func NewCosmosAdapter(endpoint, chainID string, signer Signer, prefix, denom string, decimals int, gasLimit uint64, fee *big.Int) (*CosmosAdapter, error) {
+	if decimals < 0 || decimals > 18 {
+		return nil, fmt.Errorf("invalid coin decimals %d", decimals)
+	}
+	// The key only reveals its public key through a signature, even if held in a KMS
+	ctx, cancel := context.WithTimeout(context.Background(), signTimeout)
+	defer cancel()
+	hash := crypto.Keccak256Hash([]byte(chainID))
+	sig, err := signer.SignHash(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := crypto.SigToPub(hash.Bytes(), sig)
+	if err != nil {
+		return nil, err
+	}
+	pubKey := crypto.CompressPubkey(pub)
+
+	return &CosmosAdapter{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		http:     &http.Client{Timeout: 10 * time.Second},
+		signer:   signer,
+		pubKey:   pubKey,
+		funder:   cosmosAccount(pubKey),
+		chainID:  chainID,
+		prefix:   prefix,
+		denom:    denom,
+		decimals: decimals,
+		gasLimit: gasLimit,
+		fee:      fee,
+		sentAt:   make(map[common.Hash]time.Time),
+	}, nil
+}
+
+// cosmosAccount returns the account of a compressed secp256k1 public key
+func cosmosAccount(pubKey []byte) common.Address {
+	sha := sha256.Sum256(pubKey)
+	hasher := ripemd160.New()
+	hasher.Write(sha[:])
+	return common.BytesToAddress(hasher.Sum(nil))
+}
+
+func (c *CosmosAdapter) ParseAddress(address string) (common.Address, error) {
+	hrp, data, err := DecodeBech32(address)
+	if err != nil {
+		return common.Address{}, err
+	}
+	if hrp != c.prefix || len(data) != common.AddressLength {
+		return common.Address{}, fmt.Errorf("not a %s account address", c.prefix)
+	}
+	return common.BytesToAddress(data), nil
+}
+
+func (c *CosmosAdapter) FormatAddress(account common.Address) string {
+	address, _ := EncodeBech32(c.prefix, account.Bytes())
+	return address
+}
+
+func (c *CosmosAdapter) Funder() common.Address {
+	return c.funder
+}
+
+func (c *CosmosAdapter) Balance(ctx context.Context) (*big.Int, error) {
+	var resp struct {
+		Balance struct {
+			Amount string `json:"amount"`
+		} `json:"balance"`
+	}
+	path := fmt.Sprintf("/cosmos/bank/v1beta1/balances/%s/by_denom?denom=%s", c.FormatAddress(c.funder), c.denom)
+	if err := c.call(ctx, "GET", path, nil, &resp); err != nil {
+		return nil, err
+	}
+	amount, ok := new(big.Int).SetString(resp.Balance.Amount, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid balance %q", resp.Balance.Amount)
+	}
+	return amount.Mul(amount, c.unit()), nil
+}
+
+// unit is the number of wei one base unit of the coin is worth
+func (c *CosmosAdapter) unit() *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(18-c.decimals)), nil)
+}
+
+// BuildTx encodes a bank send of value to the account, with the next sequence of the funder
+func (c *CosmosAdapter) BuildTx(ctx context.Context, to common.Address, value *big.Int) (*UnsignedTx, error) {
+	amount := new(big.Int).Quo(value, c.unit())
+	if amount.Sign() <= 0 {
+		return nil, fmt.Errorf("payout of %s wei is less than 1%s", value, c.denom)
+	}
+	number, sequence, err := c.nextSequence(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var send []byte
+	send = protowire.AppendTag(send, 1, protowire.BytesType)
+	send = protowire.AppendString(send, c.FormatAddress(c.funder))
+	send = protowire.AppendTag(send, 2, protowire.BytesType)
+	send = protowire.AppendString(send, c.FormatAddress(to))
+	send = protowire.AppendTag(send, 3, protowire.BytesType)
+	send = protowire.AppendBytes(send, encodeCoin(c.denom, amount))
+	var body []byte
+	body = protowire.AppendTag(body, 1, protowire.BytesType)
+	body = protowire.AppendBytes(body, encodeAny("/cosmos.bank.v1beta1.MsgSend", send))
+
+	var pubKey, single, modeInfo, signerInfo, fee, authInfo []byte
+	pubKey = protowire.AppendTag(pubKey, 1, protowire.BytesType)
+	pubKey = protowire.AppendBytes(pubKey, c.pubKey)
+	single = protowire.AppendTag(single, 1, protowire.VarintType)
+	single = protowire.AppendVarint(single, signModeDirect)
+	modeInfo = protowire.AppendTag(modeInfo, 1, protowire.BytesType)
+	modeInfo = protowire.AppendBytes(modeInfo, single)
+	signerInfo = protowire.AppendTag(signerInfo, 1, protowire.BytesType)
+	signerInfo = protowire.AppendBytes(signerInfo, encodeAny("/cosmos.crypto.secp256k1.PubKey", pubKey))
+	signerInfo = protowire.AppendTag(signerInfo, 2, protowire.BytesType)
+	signerInfo = protowire.AppendBytes(signerInfo, modeInfo)
+	signerInfo = appendUint(signerInfo, 3, sequence)
+	if c.fee != nil && c.fee.Sign() > 0 {
+		fee = protowire.AppendTag(fee, 1, protowire.BytesType)
+		fee = protowire.AppendBytes(fee, encodeCoin(c.denom, c.fee))
+	}
+	fee = appendUint(fee, 2, c.gasLimit)
+	authInfo = protowire.AppendTag(authInfo, 1, protowire.BytesType)
+	authInfo = protowire.AppendBytes(authInfo, signerInfo)
+	authInfo = protowire.AppendTag(authInfo, 2, protowire.BytesType)
+	authInfo = protowire.AppendBytes(authInfo, fee)
+
+	// TxRaw and SignDoc share their first two fields
+	var raw []byte
+	raw = protowire.AppendTag(raw, 1, protowire.BytesType)
+	raw = protowire.AppendBytes(raw, body)
+	raw = protowire.AppendTag(raw, 2, protowire.BytesType)
+	raw = protowire.AppendBytes(raw, authInfo)
+	signDoc := append([]byte(nil), raw...)
+	signDoc = protowire.AppendTag(signDoc, 3, protowire.BytesType)
+	signDoc = protowire.AppendString(signDoc, c.chainID)
+	signDoc = appendUint(signDoc, 4, number)
+	return &UnsignedTx{Sequence: sequence, SignBytes: signDoc, Raw: raw}, nil
+}
+
+func (c *CosmosAdapter) Sign(ctx context.Context, tx *UnsignedTx) (*SignedTx, error) {
+	ctx, cancel := context.WithTimeout(ctx, signTimeout)
+	defer cancel()
+	sig, err := c.signer.SignHash(ctx, sha256.Sum256(tx.SignBytes))
+	if err != nil {
+		return nil, err
+	}
+	// Cosmos signatures are [R || S] without the recovery ID
+	raw := protowire.AppendTag(append([]byte(nil), tx.Raw...), 3, protowire.BytesType)
+	raw = protowire.AppendBytes(raw, sig[:64])
+	return &SignedTx{Hash: sha256.Sum256(raw), Sequence: tx.Sequence, Raw: raw}, nil
+}
+
+func (c *CosmosAdapter) Broadcast(ctx context.Context, tx *SignedTx) error {
+	body, _ := json.Marshal(map[string]string{
+		"tx_bytes": base64.StdEncoding.EncodeToString(tx.Raw),
+		"mode":     "BROADCAST_MODE_SYNC",
+	})
+	var resp struct {
+		TxResponse struct {
+			Code   int    `json:"code"`
+			RawLog string `json:"raw_log"`
+		} `json:"tx_response"`
+	}
+	err := c.call(ctx, "POST", "/cosmos/tx/v1beta1/txs", body, &resp)
+	if err == nil && resp.TxResponse.Code != 0 {
+		err = fmt.Errorf("tx rejected with code %d: %s", resp.TxResponse.Code, resp.TxResponse.RawLog)
+		if resp.TxResponse.Code == cosmosWrongSequence {
+			err = fmt.Errorf("%w: %s", ErrNonceUsed, resp.TxResponse.RawLog)
+		}
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err != nil {
+		// A rejected tx leaves the sequence unused, so resync with the node
+		c.synced = false
+		return err
+	}
+	c.sentAt[tx.Hash] = time.Now()
+	if tx.Sequence >= c.sequence {
+		c.sequence = tx.Sequence + 1
+	}
+	return nil
+}
+
+// Confirm reports a tx missing from the chain for long as dropped
+func (c *CosmosAdapter) Confirm(ctx context.Context, hash common.Hash, confirmations uint64) (TxState, error) {
+	var resp struct {
+		TxResponse struct {
+			Height string `json:"height"`
+			Code   int    `json:"code"`
+		} `json:"tx_response"`
+	}
+	err := c.call(ctx, "GET", "/cosmos/tx/v1beta1/txs/"+strings.ToUpper(hash.Hex()[2:]), nil, &resp)
+	if errors.Is(err, errNotFound) {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		if sentAt, ok := c.sentAt[hash]; ok && time.Since(sentAt) < cosmosDropTimeout {
+			return TxPending, nil
+		}
+		return TxDropped, nil
+	} else if err != nil {
+		return "", err
+	}
+
+	c.mutex.Lock()
+	delete(c.sentAt, hash)
+	c.mutex.Unlock()
+	if resp.TxResponse.Code != 0 {
+		return TxReverted, nil
+	}
+	height, err := strconv.ParseUint(resp.TxResponse.Height, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid tx height %q", resp.TxResponse.Height)
+	}
+	head, err := c.latestHeight(ctx)
+	if err != nil {
+		return "", err
+	}
+	if head < height || head-height+1 < confirmations {
+		return TxMined, nil
+	}
+	return TxConfirmed, nil
+}
+
+// Check verifies that the node responds and serves the chain the adapter signs for
+func (c *CosmosAdapter) Check(ctx context.Context) error {
+	var resp struct {
+		NodeInfo struct {
+			Network string `json:"network"`
+		} `json:"default_node_info"`
+	}
+	if err := c.call(ctx, "GET", "/cosmos/base/tendermint/v1beta1/node_info", nil, &resp); err != nil {
+		return fmt.Errorf("node unreachable: %w", err)
+	}
+	if resp.NodeInfo.Network != c.chainID {
+		return fmt.Errorf("chain ID mismatch: node serves %s, expected %s", resp.NodeInfo.Network, c.chainID)
+	}
+	return nil
+}
+
+func (c *CosmosAdapter) latestHeight(ctx context.Context) (uint64, error) {
+	var resp struct {
+		Block struct {
+			Header struct {
+				Height string `json:"height"`
+			} `json:"header"`
+		} `json:"block"`
+	}
+	if err := c.call(ctx, "GET", "/cosmos/base/tendermint/v1beta1/blocks/latest", nil, &resp); err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(resp.Block.Header.Height, 10, 64)
+}
+
+// nextSequence returns the account number of the funder and the sequence of
+// its next tx, fetched from the node after a failed broadcast
+func (c *CosmosAdapter) nextSequence(ctx context.Context) (uint64, uint64, error) {
+	c.mutex.Lock()
+	synced := c.synced
+	c.mutex.Unlock()
+	if !synced {
+		var resp struct {
+			Account struct {
+				AccountNumber string `json:"account_number"`
+				Sequence      string `json:"sequence"`
+			} `json:"account"`
+		}
+		if err := c.call(ctx, "GET", "/cosmos/auth/v1beta1/accounts/"+c.FormatAddress(c.funder), nil, &resp); err != nil {
+			return 0, 0, fmt.Errorf("failed to read funder account: %w", err)
+		}
+		number, err := strconv.ParseUint(resp.Account.AccountNumber, 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid account number %q", resp.Account.AccountNumber)
+		}
+		sequence, err := strconv.ParseUint(resp.Account.Sequence, 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid account sequence %q", resp.Account.Sequence)
+		}
+		c.mutex.Lock()
+		c.number, c.sequence, c.synced = number, sequence, true
+		c.mutex.Unlock()
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.number, c.sequence, nil
+}
+
+// call sends a request to the REST API of the node and decodes its JSON response into v
+func (c *CosmosAdapter) call(ctx context.Context, method, path string, body []byte, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return errNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, bytes.TrimSpace(message))
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func encodeCoin(denom string, amount *big.Int) []byte {
+	var coin []byte
+	coin = protowire.AppendTag(coin, 1, protowire.BytesType)
+	coin = protowire.AppendString(coin, denom)
+	coin = protowire.AppendTag(coin, 2, protowire.BytesType)
+	return protowire.AppendString(coin, amount.String())
+}
+
+func encodeAny(typeURL string, value []byte) []byte {
+	var packed []byte
+	packed = protowire.AppendTag(packed, 1, protowire.BytesType)
+	packed = protowire.AppendString(packed, typeURL)
+	packed = protowire.AppendTag(packed, 2, protowire.BytesType)
+	return protowire.AppendBytes(packed, value)
+}
+
+// appendUint appends a uint64 field, leaving it out if zero like proto3 does
+func appendUint(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
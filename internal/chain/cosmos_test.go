@@ -0,0 +1,179 @@
+package chain
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestBech32(t *testing.T) {
+	for _, valid := range []string{"A12UEL5L", "abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw", "split1checkupstagehandshakeupstreamerranterredcaperred2y9e3w"} {
+		hrp, data, err := DecodeBech32(valid)
+		if err != nil {
+			t.Errorf("DecodeBech32(%q) error = %v", valid, err)
+			continue
+		}
+		if encoded, _ := EncodeBech32(hrp, data); encoded != strings.ToLower(valid) {
+			t.Errorf("EncodeBech32() = %q, want %q", encoded, strings.ToLower(valid))
+		}
+	}
+	for _, invalid := range []string{"a12UEL5L", "abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxx", "1nwldj5", "x1b4n0q5v"} {
+		if _, _, err := DecodeBech32(invalid); err == nil {
+			t.Errorf("DecodeBech32(%q) accepted an invalid string", invalid)
+		}
+	}
+}
+
+// fakeCosmosNode serves the REST routes the adapter uses and keeps the txs broadcast to it
+type fakeCosmosNode struct {
+	mutex    sync.Mutex
+	sequence uint64
+	height   int
+	txs      map[string]int
+	raw      [][]byte
+}
+
+func (n *fakeCosmosNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/cosmos/auth/v1beta1/accounts/"):
+		fmt.Fprintf(w, `{"account":{"account_number":"7","sequence":"%d"}}`, n.sequence)
+	case strings.HasPrefix(r.URL.Path, "/cosmos/bank/v1beta1/balances/"):
+		fmt.Fprint(w, `{"balance":{"denom":"uatom","amount":"2500000"}}`)
+	case r.URL.Path == "/cosmos/base/tendermint/v1beta1/blocks/latest":
+		fmt.Fprintf(w, `{"block":{"header":{"height":"%d"}}}`, n.height)
+	case r.URL.Path == "/cosmos/tx/v1beta1/txs":
+		var req struct {
+			TxBytes string `json:"tx_bytes"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		raw, _ := base64.StdEncoding.DecodeString(req.TxBytes)
+		n.raw = append(n.raw, raw)
+		n.sequence++
+		hash := sha256.Sum256(raw)
+		n.txs[strings.ToUpper(common.Bytes2Hex(hash[:]))] = n.height
+		fmt.Fprint(w, `{"tx_response":{"code":0}}`)
+	case strings.HasPrefix(r.URL.Path, "/cosmos/tx/v1beta1/txs/"):
+		height, ok := n.txs[strings.TrimPrefix(r.URL.Path, "/cosmos/tx/v1beta1/txs/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, `{"tx_response":{"height":"%d","code":0}}`, height)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// fields returns the length delimited fields of a protobuf message by number
+func fields(t *testing.T, b []byte) map[protowire.Number][]byte {
+	t.Helper()
+	out := make(map[protowire.Number][]byte)
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		b = b[n:]
+		if typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			b = b[n:]
+			continue
+		}
+		value, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			t.Fatalf("invalid protobuf message")
+		}
+		out[num] = value
+		b = b[n:]
+	}
+	return out
+}
+
+func TestCosmosAdapter(t *testing.T) {
+	privateKey, _ := crypto.HexToECDSA("976f9f7772781ff6d1c93941129d417c49a209c674056a3cf5e27e225ee55fa8")
+	node := &fakeCosmosNode{sequence: 3, height: 100, txs: make(map[string]int)}
+	srv := httptest.NewServer(node)
+	defer srv.Close()
+
+	adapter, err := NewCosmosAdapter(srv.URL, "theta-testnet-001", NewKeySigner(privateKey), "cosmos", "uatom", 6, 200000, big.NewInt(5000))
+	if err != nil {
+		t.Fatalf("NewCosmosAdapter() error = %v", err)
+	}
+	funder := adapter.FormatAddress(adapter.Funder())
+	if account, err := adapter.ParseAddress(funder); err != nil || account != adapter.Funder() {
+		t.Errorf("ParseAddress(%q) = %v, %v", funder, account, err)
+	}
+	osmo, _ := EncodeBech32("osmo", adapter.Funder().Bytes())
+	if _, err := adapter.ParseAddress(osmo); err == nil {
+		t.Errorf("ParseAddress() accepted an address of another chain")
+	}
+
+	builder := NewAdapterTxBuilder(adapter, false)
+	bgCtx := context.Background()
+	if balance, err := builder.BalanceAt(bgCtx, builder.Sender(), nil); err != nil || balance.Cmp(EtherToWei(2)) <= 0 {
+		t.Errorf("BalanceAt() = %v, %v, want 2.5 ATOM in wei", balance, err)
+	}
+	recipient := common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
+	hash, err := builder.Transfer(bgCtx, recipient.Hex(), EtherToWei(1))
+	if err != nil {
+		t.Fatalf("Transfer() error = %v", err)
+	}
+	if _, err := builder.Transfer(bgCtx, recipient.Hex(), EtherToWei(1)); err != nil {
+		t.Fatalf("second Transfer() error = %v", err)
+	}
+
+	// The tx must carry a signature of its sign doc by the funder key, with the account number and sequence
+	tx := fields(t, node.raw[0])
+	if sha256.Sum256(node.raw[0]) != hash {
+		t.Errorf("Transfer() hash = %v, want the SHA-256 of the tx bytes", hash)
+	}
+	var signDoc []byte
+	signDoc = protowire.AppendTag(signDoc, 1, protowire.BytesType)
+	signDoc = protowire.AppendBytes(signDoc, tx[1])
+	signDoc = protowire.AppendTag(signDoc, 2, protowire.BytesType)
+	signDoc = protowire.AppendBytes(signDoc, tx[2])
+	signDoc = protowire.AppendTag(signDoc, 3, protowire.BytesType)
+	signDoc = protowire.AppendString(signDoc, "theta-testnet-001")
+	signDoc = appendUint(signDoc, 4, 7)
+	digest := sha256.Sum256(signDoc)
+	if !crypto.VerifySignature(crypto.CompressPubkey(&privateKey.PublicKey), digest[:], tx[3]) {
+		t.Error("tx signature does not verify against the funder key")
+	}
+	send := fields(t, fields(t, fields(t, tx[1])[1])[2])
+	if string(send[2]) != adapter.FormatAddress(recipient) {
+		t.Errorf("MsgSend to_address = %s, want %s", send[2], adapter.FormatAddress(recipient))
+	}
+	if coin := fields(t, send[3]); string(coin[1]) != "uatom" || string(coin[2]) != "1000000" {
+		t.Errorf("MsgSend amount = %s%s, want 1000000uatom", coin[2], coin[1])
+	}
+	signerInfo := fields(t, fields(t, node.raw[1])[2])[1]
+	if sequence := signerInfo[len(signerInfo)-1]; sequence != 4 {
+		t.Errorf("sequence of the second tx = %d, want 4", sequence)
+	}
+
+	assertState := func(hash common.Hash, want TxState) {
+		t.Helper()
+		state, _, err := builder.Confirm(bgCtx, hash, 2)
+		if err != nil {
+			t.Fatalf("Confirm() error = %v", err)
+		}
+		if state != want {
+			t.Errorf("Confirm() state = %s, want %s", state, want)
+		}
+	}
+	assertState(hash, TxMined)
+	node.height++
+	assertState(hash, TxConfirmed)
+	assertState(common.HexToHash("0x01"), TxDropped)
+}
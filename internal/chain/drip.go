@@ -0,0 +1,99 @@
+package chain
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// DefaultDripMethod is the faucet contract method called when none is configured
+const DefaultDripMethod = "drip(address)"
+
+// FaucetContract is implemented by tx builders paying out through a faucet
+// contract, which holds the funds while the funder accounts only pay for gas
+type FaucetContract interface {
+	Faucet() (common.Address, bool)
+}
+
+// DripMethod is a faucet contract method taking the recipient and, optionally, the amount
+type DripMethod struct {
+	method    abi.Method
+	hasAmount bool
+}
+
+// ParseDripMethod parses a method signature such as drip(address) or
+// drip(address,uint256). The first argument receives the recipient and
+// the second, if any, the payout amount in wei
+func ParseDripMethod(signature string) (*DripMethod, error) {
+	signature = strings.ReplaceAll(signature, " ", "")
+	open := strings.Index(signature, "(")
+	if open < 1 || !strings.HasSuffix(signature, ")") {
+		return nil, fmt.Errorf("invalid method signature %q, want e.g. %s", signature, DefaultDripMethod)
+	}
+	name := signature[:open]
+	params := strings.Split(signature[open+1:len(signature)-1], ",")
+	if len(params) > 2 || params[0] != "address" || len(params) == 2 && params[1] != "uint256" {
+		return nil, fmt.Errorf("method %q must take the recipient address and optionally a uint256 amount", signature)
+	}
+
+	inputs := make(abi.Arguments, len(params))
+	for i, param := range params {
+		typ, err := abi.NewType(param, "", nil)
+		if err != nil {
+			return nil, fmt.Errorf("method %q: %w", signature, err)
+		}
+		inputs[i] = abi.Argument{Type: typ}
+	}
+	return &DripMethod{
+		method:    abi.NewMethod(name, name, abi.Function, "nonpayable", false, false, inputs, nil),
+		hasAmount: len(params) == 2,
+	}, nil
+}
+
+func (m *DripMethod) String() string {
+	return m.method.Sig
+}
+
+func (m *DripMethod) pack(to common.Address, value *big.Int) ([]byte, error) {
+	args := []interface{}{to}
+	if m.hasAmount {
+		args = append(args, value)
+	}
+	data, err := m.method.Inputs.Pack(args...)
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte{}, m.method.ID...), data...), nil
+}
+
+// Faucet returns the faucet contract payouts are sent through, if any
+func (b *TxBuild) Faucet() (common.Address, bool) {
+	if b.opts.faucet == nil {
+		return common.Address{}, false
+	}
+	return *b.opts.faucet, true
+}
+
+// drip calls the faucet contract to pay out to the recipient. The contract
+// sends the funds and may refuse the call to enforce its own limits, which
+// is caught by the gas estimation before anything is broadcast
+func (b *TxBuild) drip(ctx context.Context, to common.Address, value *big.Int) (common.Hash, error) {
+	data, err := b.opts.dripMethod.pack(to, value)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	gasLimit, err := b.client.EstimateGas(ctx, ethereum.CallMsg{
+		From: b.fromAddress,
+		To:   b.opts.faucet,
+		Data: data,
+	})
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("payout would fail: %s rejected by faucet contract: %w", b.opts.dripMethod, err)
+	}
+	return b.send(ctx, b.opts.faucet, new(big.Int), data, gasLimit)
+}
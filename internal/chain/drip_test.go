@@ -0,0 +1,69 @@
+package chain
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestParseDripMethod(t *testing.T) {
+	for _, signature := range []string{"drip(address)", "drip(address, uint256)", "requestFunds(address)"} {
+		if _, err := ParseDripMethod(signature); err != nil {
+			t.Errorf("ParseDripMethod(%q) error = %v", signature, err)
+		}
+	}
+	for _, signature := range []string{"", "drip", "(address)", "drip()", "drip(uint256)", "drip(address,address)", "drip(address,uint8)", "drip(address,uint256,bytes)"} {
+		if _, err := ParseDripMethod(signature); err == nil {
+			t.Errorf("ParseDripMethod(%q) succeeded, want error", signature)
+		}
+	}
+}
+
+func TestTxBuilderDrip(t *testing.T) {
+	privateKey, _ := crypto.HexToECDSA("976f9f7772781ff6d1c93941129d417c49a209c674056a3cf5e27e225ee55fa8")
+	fromAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
+	simClient := backends.NewSimulatedBackend(
+		core.GenesisAlloc{
+			fromAddress: {Balance: big.NewInt(10000000000000000)},
+		}, 10000000,
+	)
+	defer simClient.Close()
+
+	bgCtx := context.Background()
+	contract := common.HexToAddress("0xD152f549545093347A162Dce210e7293f1452150")
+	recipient := common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
+	method, _ := ParseDripMethod("drip(address,uint256)")
+	txBuilder := newTxBuild(simClient, NewKeySigner(privateKey), types.NewLondonSigner(big.NewInt(1337)), WithFaucetContract(contract, method))
+	if faucet, ok := txBuilder.Faucet(); !ok || faucet != contract {
+		t.Errorf("Faucet() = %v %v, want %v", faucet, ok, contract)
+	}
+	txHash, err := txBuilder.Transfer(bgCtx, recipient.Hex(), big.NewInt(1000))
+	if err != nil {
+		t.Fatalf("Transfer() error = %v", err)
+	}
+	simClient.Commit()
+
+	tx, _, err := simClient.TransactionByHash(bgCtx, txHash)
+	if err != nil {
+		t.Fatalf("could not get drip tx: %v", err)
+	}
+	if *tx.To() != contract || tx.Value().Sign() != 0 {
+		t.Errorf("tx sent %v to %v, want a call to %v", tx.Value(), tx.To(), contract)
+	}
+	args, err := method.method.Inputs.Unpack(tx.Data()[4:])
+	if err != nil {
+		t.Fatalf("could not decode calldata: %v", err)
+	}
+	if args[0] != recipient || args[1].(*big.Int).Cmp(big.NewInt(1000)) != 0 {
+		t.Errorf("calldata = %v, want %v 1000", args, recipient)
+	}
+	if _, err := txBuilder.BatchTransfer(bgCtx, []string{recipient.Hex()}, []*big.Int{big.NewInt(1000)}); err == nil {
+		t.Error("BatchTransfer() succeeded through a faucet contract")
+	}
+}
@@ -0,0 +1,85 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// DefaultENSRegistry is the address of the ENS registry on Ethereum mainnet
+const DefaultENSRegistry = "0x00000000000C2E074eC69A0bFb2997BA6C7d2e1e"
+
+var (
+	resolverSelector = crypto.Keccak256([]byte("resolver(bytes32)"))[:4]
+	addrSelector     = crypto.Keccak256([]byte("addr(bytes32)"))[:4]
+
+	ErrNameNotFound = errors.New("name does not resolve to an address")
+)
+
+// NameResolver resolves ENS style names, e.g. alice.eth or bob.fuse, through
+// a registry following the ENS interface
+type NameResolver struct {
+	client   bind.ContractCaller
+	registry common.Address
+}
+
+func NewNameResolver(client bind.ContractCaller, registry common.Address) *NameResolver {
+	return &NameResolver{client: client, registry: registry}
+}
+
+// IsName reports whether value looks like a domain name rather than an address
+func IsName(value string) bool {
+	return strings.Contains(value, ".") && !Has0xPrefix(value)
+}
+
+func (r *NameResolver) Resolve(ctx context.Context, name string) (common.Address, error) {
+	node := NameHash(name)
+	resolver, err := r.callAddress(ctx, r.registry, resolverSelector, node)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to look up resolver: %w", err)
+	}
+	if resolver == (common.Address{}) {
+		return common.Address{}, ErrNameNotFound
+	}
+
+	address, err := r.callAddress(ctx, resolver, addrSelector, node)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to resolve address: %w", err)
+	}
+	if address == (common.Address{}) {
+		return common.Address{}, ErrNameNotFound
+	}
+	return address, nil
+}
+
+func (r *NameResolver) callAddress(ctx context.Context, contract common.Address, selector []byte, node common.Hash) (common.Address, error) {
+	data := append(append([]byte{}, selector...), node.Bytes()...)
+	out, err := r.client.CallContract(ctx, ethereum.CallMsg{To: &contract, Data: data}, nil)
+	if err != nil {
+		return common.Address{}, err
+	}
+	if len(out) < 32 {
+		return common.Address{}, nil
+	}
+	return common.BytesToAddress(out[12:32]), nil
+}
+
+// NameHash implements the EIP-137 namehash of a name, which is lowercased
+// but not otherwise normalized
+func NameHash(name string) common.Hash {
+	var node common.Hash
+	if name == "" {
+		return node
+	}
+	labels := strings.Split(strings.ToLower(name), ".")
+	for i := len(labels) - 1; i >= 0; i-- {
+		node = crypto.Keccak256Hash(node.Bytes(), crypto.Keccak256([]byte(labels[i])))
+	}
+	return node
+}
@@ -0,0 +1,70 @@
+package chain
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestNameHash(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "", want: "0x0000000000000000000000000000000000000000000000000000000000000000"},
+		{name: "eth", want: "0x93cdeb708b7545dc668eb9280176169d1c33cfd8ed6f04690a0bcc88a93fc4ae"},
+		{name: "foo.eth", want: "0xde9b09fd7c5f901e23a3f19fecc54828e9c848539801e86591bd9801b019f84f"},
+		{name: "Foo.ETH", want: "0xde9b09fd7c5f901e23a3f19fecc54828e9c848539801e86591bd9801b019f84f"},
+	}
+	for _, tt := range tests {
+		if got := NameHash(tt.name); got.Hex() != tt.want {
+			t.Errorf("NameHash(%q) = %s, want %s", tt.name, got.Hex(), tt.want)
+		}
+	}
+}
+
+// registryCaller answers registry and resolver calls for a single name
+type registryCaller struct {
+	registry, resolver, address common.Address
+	node                        common.Hash
+}
+
+func (c *registryCaller) CodeAt(_ context.Context, _ common.Address, _ *big.Int) ([]byte, error) {
+	return nil, nil
+}
+
+func (c *registryCaller) CallContract(_ context.Context, call ethereum.CallMsg, _ *big.Int) ([]byte, error) {
+	if !bytes.Equal(call.Data[4:], c.node.Bytes()) {
+		return make([]byte, 32), nil
+	}
+	switch {
+	case *call.To == c.registry && bytes.Equal(call.Data[:4], resolverSelector):
+		return common.LeftPadBytes(c.resolver.Bytes(), 32), nil
+	case *call.To == c.resolver && bytes.Equal(call.Data[:4], addrSelector):
+		return common.LeftPadBytes(c.address.Bytes(), 32), nil
+	}
+	return nil, errors.New("execution reverted")
+}
+
+func TestNameResolver(t *testing.T) {
+	caller := &registryCaller{
+		registry: common.HexToAddress(DefaultENSRegistry),
+		resolver: common.HexToAddress("0x4976fb03C32e5B8cfe2b6cCB31c09Ba78EBaBa41"),
+		address:  common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"),
+		node:     NameHash("alice.eth"),
+	}
+	resolver := NewNameResolver(caller, caller.registry)
+
+	got, err := resolver.Resolve(context.Background(), "alice.eth")
+	if err != nil || got != caller.address {
+		t.Errorf("Resolve() = %s, %v, want %s", got, err, caller.address)
+	}
+	if _, err := resolver.Resolve(context.Background(), "bob.eth"); !errors.Is(err, ErrNameNotFound) {
+		t.Errorf("Resolve() error = %v, want %v", err, ErrNameNotFound)
+	}
+}
@@ -0,0 +1,392 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	minRPCBackoff     = time.Second
+	maxRPCBackoff     = 2 * time.Minute
+	rpcHealthInterval = 15 * time.Second
+	rpcHealthTimeout  = 5 * time.Second
+	// maxBlockLag is how far an endpoint may fall behind the best head before it is avoided
+	maxBlockLag = 10
+	// rpcLimitExceeded is the JSON-RPC error code providers answer with once a rate limit is hit
+	rpcLimitExceeded = -32005
+)
+
+// rpcClient is what the failover client needs from each endpoint
+type rpcClient interface {
+	Client
+	FeeHistoryReader
+	BlockReader
+	chainIDReader
+	pendingBalanceReader
+}
+
+type rpcEndpoint struct {
+	name     string
+	client   rpcClient
+	failures int
+	retryAt  time.Time
+	lagging  bool
+}
+
+func (e *rpcEndpoint) available(now time.Time) bool {
+	return !e.lagging && !now.Before(e.retryAt)
+}
+
+// failoverClient sends every call to the first available endpoint in the
+// configured order. Endpoints that fail are skipped with an exponential backoff
+// and endpoints lagging behind the others are skipped until they catch up
+type failoverClient struct {
+	mutex     sync.Mutex
+	endpoints []*rpcEndpoint
+}
+
+// DialFailover connects to every provider, falling back to the next one in the
+// list whenever the current one is unreachable, erroring or out of sync
+func DialFailover(providers []string, opts ...DialOption) (Client, error) {
+	if len(providers) == 0 {
+		return nil, errors.New("at least one RPC provider is required")
+	}
+	if len(providers) == 1 {
+		return Dial(providers[0], opts...)
+	}
+
+	endpoints := make([]*rpcEndpoint, len(providers))
+	for i, provider := range providers {
+		client, err := Dial(provider, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", endpointName(provider), err)
+		}
+		endpoints[i] = &rpcEndpoint{name: endpointName(provider), client: client.(rpcClient)}
+	}
+	c := newFailoverClient(endpoints)
+	go c.monitor(context.Background(), rpcHealthInterval)
+	return c, nil
+}
+
+func newFailoverClient(endpoints []*rpcEndpoint) *failoverClient {
+	return &failoverClient{endpoints: endpoints}
+}
+
+// endpointName identifies a provider in logs without the API key many of them carry in the URL
+func endpointName(provider string) string {
+	if u, err := url.Parse(provider); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return "ipc"
+}
+
+// candidates returns the endpoints to try in order. If none is available the
+// one coming out of backoff first is tried rather than failing outright
+func (c *failoverClient) candidates() []*rpcEndpoint {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	now := time.Now()
+	var available []*rpcEndpoint
+	for _, e := range c.endpoints {
+		if e.available(now) {
+			available = append(available, e)
+		}
+	}
+	if len(available) > 0 {
+		return available
+	}
+	next := c.endpoints[0]
+	for _, e := range c.endpoints[1:] {
+		if e.retryAt.Before(next.retryAt) {
+			next = e
+		}
+	}
+	return []*rpcEndpoint{next}
+}
+
+func (c *failoverClient) markFailed(e *rpcEndpoint, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	e.failures++
+	backoff := minRPCBackoff << (e.failures - 1)
+	if backoff > maxRPCBackoff || backoff <= 0 {
+		backoff = maxRPCBackoff
+	}
+	e.retryAt = time.Now().Add(backoff)
+	log.WithError(err).WithFields(log.Fields{
+		"endpoint": e.name,
+		"backoff":  backoff,
+	}).Warn("RPC endpoint failed, failing over")
+}
+
+func (c *failoverClient) markHealthy(e *rpcEndpoint) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	e.failures = 0
+	e.retryAt = time.Time{}
+}
+
+// call runs fn against the candidates in order until one of them answers.
+// Errors the node answered with, such as a reverted call, are returned as is
+func (c *failoverClient) call(ctx context.Context, fn func(rpcClient) error) error {
+	var err error
+	for _, e := range c.candidates() {
+		if err = fn(e.client); !isEndpointFailure(ctx, err) {
+			return err
+		}
+		c.markFailed(e, err)
+	}
+	return err
+}
+
+// isEndpointFailure reports whether err is the fault of the endpoint rather
+// than of the request, so that another endpoint may answer it
+func isEndpointFailure(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil || errors.Is(err, ethereum.NotFound) {
+		return false
+	}
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) {
+		return rpcErr.ErrorCode() == rpcLimitExceeded
+	}
+	return true
+}
+
+// monitor polls the head of every endpoint, taking endpoints that failed
+// out of backoff once they answer and avoiding those that fall behind
+func (c *failoverClient) monitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		c.checkHealth(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *failoverClient) checkHealth(ctx context.Context) {
+	heads := make([]uint64, len(c.endpoints))
+	errs := make([]error, len(c.endpoints))
+	var wg sync.WaitGroup
+	for i, e := range c.endpoints {
+		wg.Add(1)
+		go func(i int, e *rpcEndpoint) {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, rpcHealthTimeout)
+			defer cancel()
+			header, err := e.client.HeaderByNumber(checkCtx, nil)
+			if err == nil {
+				heads[i] = header.Number.Uint64()
+			}
+			errs[i] = err
+		}(i, e)
+	}
+	wg.Wait()
+
+	var best uint64
+	for _, head := range heads {
+		if head > best {
+			best = head
+		}
+	}
+	for i, e := range c.endpoints {
+		if errs[i] != nil {
+			if ctx.Err() == nil {
+				c.markFailed(e, errs[i])
+			}
+			continue
+		}
+		c.markHealthy(e)
+		c.mutex.Lock()
+		lagging := heads[i]+maxBlockLag < best
+		if lagging && !e.lagging {
+			log.WithFields(log.Fields{
+				"endpoint": e.name,
+				"head":     heads[i],
+				"best":     best,
+			}).Warn("RPC endpoint is lagging behind, failing over")
+		}
+		e.lagging = lagging
+		c.mutex.Unlock()
+	}
+}
+
+// NetworkAvailable reports whether any endpoint can currently be reached
+func (c *failoverClient) NetworkAvailable() bool {
+	for _, e := range c.endpoints {
+		if status, ok := e.client.(NetworkStatus); !ok || status.NetworkAvailable() {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *failoverClient) ChainID(ctx context.Context) (chainID *big.Int, err error) {
+	err = c.call(ctx, func(client rpcClient) error {
+		chainID, err = client.ChainID(ctx)
+		return err
+	})
+	return chainID, err
+}
+
+func (c *failoverClient) HeaderByNumber(ctx context.Context, number *big.Int) (header *types.Header, err error) {
+	err = c.call(ctx, func(client rpcClient) error {
+		header, err = client.HeaderByNumber(ctx, number)
+		return err
+	})
+	return header, err
+}
+
+func (c *failoverClient) BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (balance *big.Int, err error) {
+	err = c.call(ctx, func(client rpcClient) error {
+		balance, err = client.BalanceAt(ctx, account, blockNumber)
+		return err
+	})
+	return balance, err
+}
+
+func (c *failoverClient) PendingBalanceAt(ctx context.Context, account common.Address) (balance *big.Int, err error) {
+	err = c.call(ctx, func(client rpcClient) error {
+		balance, err = client.PendingBalanceAt(ctx, account)
+		return err
+	})
+	return balance, err
+}
+
+func (c *failoverClient) StorageAt(ctx context.Context, account common.Address, key common.Hash, blockNumber *big.Int) (value []byte, err error) {
+	err = c.call(ctx, func(client rpcClient) error {
+		value, err = client.StorageAt(ctx, account, key, blockNumber)
+		return err
+	})
+	return value, err
+}
+
+func (c *failoverClient) CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) (code []byte, err error) {
+	err = c.call(ctx, func(client rpcClient) error {
+		code, err = client.CodeAt(ctx, account, blockNumber)
+		return err
+	})
+	return code, err
+}
+
+func (c *failoverClient) PendingCodeAt(ctx context.Context, account common.Address) (code []byte, err error) {
+	err = c.call(ctx, func(client rpcClient) error {
+		code, err = client.PendingCodeAt(ctx, account)
+		return err
+	})
+	return code, err
+}
+
+func (c *failoverClient) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (nonce uint64, err error) {
+	err = c.call(ctx, func(client rpcClient) error {
+		nonce, err = client.NonceAt(ctx, account, blockNumber)
+		return err
+	})
+	return nonce, err
+}
+
+func (c *failoverClient) PendingNonceAt(ctx context.Context, account common.Address) (nonce uint64, err error) {
+	err = c.call(ctx, func(client rpcClient) error {
+		nonce, err = client.PendingNonceAt(ctx, account)
+		return err
+	})
+	return nonce, err
+}
+
+func (c *failoverClient) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) (out []byte, err error) {
+	err = c.call(ctx, func(client rpcClient) error {
+		out, err = client.CallContract(ctx, msg, blockNumber)
+		return err
+	})
+	return out, err
+}
+
+func (c *failoverClient) SuggestGasPrice(ctx context.Context) (price *big.Int, err error) {
+	err = c.call(ctx, func(client rpcClient) error {
+		price, err = client.SuggestGasPrice(ctx)
+		return err
+	})
+	return price, err
+}
+
+func (c *failoverClient) SuggestGasTipCap(ctx context.Context) (tip *big.Int, err error) {
+	err = c.call(ctx, func(client rpcClient) error {
+		tip, err = client.SuggestGasTipCap(ctx)
+		return err
+	})
+	return tip, err
+}
+
+func (c *failoverClient) BlockByNumber(ctx context.Context, number *big.Int) (block *types.Block, err error) {
+	err = c.call(ctx, func(client rpcClient) error {
+		block, err = client.BlockByNumber(ctx, number)
+		return err
+	})
+	return block, err
+}
+
+func (c *failoverClient) FeeHistory(ctx context.Context, blockCount uint64, lastBlock *big.Int, rewardPercentiles []float64) (history *ethereum.FeeHistory, err error) {
+	err = c.call(ctx, func(client rpcClient) error {
+		history, err = client.FeeHistory(ctx, blockCount, lastBlock, rewardPercentiles)
+		return err
+	})
+	return history, err
+}
+
+func (c *failoverClient) EstimateGas(ctx context.Context, msg ethereum.CallMsg) (gas uint64, err error) {
+	err = c.call(ctx, func(client rpcClient) error {
+		gas, err = client.EstimateGas(ctx, msg)
+		return err
+	})
+	return gas, err
+}
+
+// SendTransaction treats a tx the next endpoint already knows as sent, since
+// the failed endpoint may have relayed it before the connection broke
+func (c *failoverClient) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	attempt := 0
+	return c.call(ctx, func(client rpcClient) error {
+		err := client.SendTransaction(ctx, tx)
+		if attempt > 0 && err != nil && isKnownTx(err) {
+			err = nil
+		}
+		attempt++
+		return err
+	})
+}
+
+func isKnownTx(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "already known") || strings.Contains(msg, "known transaction")
+}
+
+func (c *failoverClient) TransactionByHash(ctx context.Context, hash common.Hash) (tx *types.Transaction, pending bool, err error) {
+	err = c.call(ctx, func(client rpcClient) error {
+		tx, pending, err = client.TransactionByHash(ctx, hash)
+		return err
+	})
+	return tx, pending, err
+}
+
+func (c *failoverClient) TransactionReceipt(ctx context.Context, hash common.Hash) (receipt *types.Receipt, err error) {
+	err = c.call(ctx, func(client rpcClient) error {
+		receipt, err = client.TransactionReceipt(ctx, hash)
+		return err
+	})
+	return receipt, err
+}
@@ -0,0 +1,144 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+type jsonError struct {
+	code int
+	msg  string
+}
+
+func (e *jsonError) Error() string  { return e.msg }
+func (e *jsonError) ErrorCode() int { return e.code }
+
+type fakeEndpoint struct {
+	rpcClient
+	head    int64
+	err     error
+	sendErr error
+	calls   int
+}
+
+func (f *fakeEndpoint) HeaderByNumber(_ context.Context, _ *big.Int) (*types.Header, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &types.Header{Number: big.NewInt(f.head)}, nil
+}
+
+func (f *fakeEndpoint) BalanceAt(_ context.Context, _ common.Address, _ *big.Int) (*big.Int, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	return big.NewInt(f.head), nil
+}
+
+func (f *fakeEndpoint) PendingBalanceAt(_ context.Context, _ common.Address) (*big.Int, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	return big.NewInt(f.head + 1), nil
+}
+
+func (f *fakeEndpoint) SendTransaction(_ context.Context, _ *types.Transaction) error {
+	return f.sendErr
+}
+
+func newFakeFailover(fakes ...*fakeEndpoint) *failoverClient {
+	endpoints := make([]*rpcEndpoint, len(fakes))
+	for i, f := range fakes {
+		endpoints[i] = &rpcEndpoint{name: "node", client: f}
+	}
+	return newFailoverClient(endpoints)
+}
+
+func TestFailoverClient(t *testing.T) {
+	primary := &fakeEndpoint{head: 1, err: errors.New("connection refused")}
+	secondary := &fakeEndpoint{head: 2}
+	c := newFakeFailover(primary, secondary)
+	ctx := context.Background()
+
+	balance, err := c.BalanceAt(ctx, common.Address{}, nil)
+	if err != nil || balance.Int64() != 2 {
+		t.Fatalf("BalanceAt() = %v, %v, want the secondary's answer", balance, err)
+	}
+	if _, err := c.BalanceAt(ctx, common.Address{}, nil); err != nil {
+		t.Fatalf("BalanceAt() error = %v", err)
+	}
+	if primary.calls != 1 {
+		t.Errorf("primary called %d times, want 1 while it backs off", primary.calls)
+	}
+
+	// The primary comes back once a health check reaches it
+	primary.err = nil
+	primary.head = 2
+	c.checkHealth(ctx)
+	if balance, _ := c.BalanceAt(ctx, common.Address{}, nil); balance.Int64() != 2 || primary.calls != 2 {
+		t.Errorf("primary not used again after recovering, calls = %d", primary.calls)
+	}
+
+	// Errors the node answered with are not the endpoint's fault
+	primary.err = &jsonError{code: 3, msg: "execution reverted"}
+	if _, err := c.BalanceAt(ctx, common.Address{}, nil); err != primary.err {
+		t.Errorf("BalanceAt() error = %v, want %v", err, primary.err)
+	}
+	if secondary.calls != 2 {
+		t.Errorf("secondary called %d times, want 2", secondary.calls)
+	}
+}
+
+func TestFailoverClientPendingBalance(t *testing.T) {
+	primary := &fakeEndpoint{head: 1, err: errors.New("connection refused")}
+	secondary := &fakeEndpoint{head: 2}
+	var client Client = newFakeFailover(primary, secondary)
+
+	// checkCost asks for the pending balance whenever the client offers it
+	reader, ok := client.(pendingBalanceReader)
+	if !ok {
+		t.Fatal("failover client does not read pending balances")
+	}
+	balance, err := reader.PendingBalanceAt(context.Background(), common.Address{})
+	if err != nil || balance.Int64() != 3 {
+		t.Errorf("PendingBalanceAt() = %v, %v, want the secondary's pending balance", balance, err)
+	}
+}
+
+func TestFailoverClientLagging(t *testing.T) {
+	primary := &fakeEndpoint{head: 100}
+	secondary := &fakeEndpoint{head: 200}
+	c := newFakeFailover(primary, secondary)
+	ctx := context.Background()
+
+	c.checkHealth(ctx)
+	if balance, _ := c.BalanceAt(ctx, common.Address{}, nil); balance.Int64() != 200 {
+		t.Errorf("BalanceAt() = %v, want the endpoint in sync", balance)
+	}
+	primary.head = 195
+	c.checkHealth(ctx)
+	if balance, _ := c.BalanceAt(ctx, common.Address{}, nil); balance.Int64() != 195 {
+		t.Errorf("BalanceAt() = %v, want the primary after catching up", balance)
+	}
+}
+
+func TestFailoverClientSendKnownTx(t *testing.T) {
+	primary := &fakeEndpoint{sendErr: errors.New("EOF")}
+	secondary := &fakeEndpoint{sendErr: &jsonError{code: -32000, msg: "already known"}}
+	c := newFakeFailover(primary, secondary)
+	if err := c.SendTransaction(context.Background(), types.NewTx(&types.LegacyTx{})); err != nil {
+		t.Errorf("SendTransaction() error = %v, want nil for a tx relayed before the failure", err)
+	}
+
+	c = newFakeFailover(secondary)
+	if err := c.SendTransaction(context.Background(), types.NewTx(&types.LegacyTx{})); err == nil {
+		t.Error("SendTransaction() error = nil, want the error of the only attempt")
+	}
+}
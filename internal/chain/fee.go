@@ -0,0 +1,61 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum"
+)
+
+var errNoFeeHistory = errors.New("fee history is not available")
+
+type FeeHistoryReader interface {
+	FeeHistory(ctx context.Context, blockCount uint64, lastBlock *big.Int, rewardPercentiles []float64) (*ethereum.FeeHistory, error)
+}
+
+// FeeOracle suggests EIP-1559 fees from the priority fees paid in recent blocks
+type FeeOracle struct {
+	client     FeeHistoryReader
+	blocks     uint64
+	percentile float64
+}
+
+func NewFeeOracle(client FeeHistoryReader, blocks uint64, percentile float64) *FeeOracle {
+	if blocks == 0 {
+		blocks = 1
+	}
+	return &FeeOracle{
+		client:     client,
+		blocks:     blocks,
+		percentile: percentile,
+	}
+}
+
+// SuggestFees returns the priority fee and a fee cap that stays valid if the base fee doubles
+func (o *FeeOracle) SuggestFees(ctx context.Context) (gasTipCap, gasFeeCap *big.Int, err error) {
+	history, err := o.client.FeeHistory(ctx, o.blocks, nil, []float64{o.percentile})
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(history.BaseFee) == 0 || history.BaseFee[len(history.BaseFee)-1] == nil {
+		return nil, nil, errNoFeeHistory
+	}
+
+	var rewards []*big.Int
+	for _, reward := range history.Reward {
+		if len(reward) > 0 && reward[0] != nil {
+			rewards = append(rewards, reward[0])
+		}
+	}
+	gasTipCap = big.NewInt(0)
+	if len(rewards) > 0 {
+		sort.Slice(rewards, func(i, j int) bool { return rewards[i].Cmp(rewards[j]) < 0 })
+		gasTipCap = rewards[len(rewards)/2]
+	}
+
+	baseFee := history.BaseFee[len(history.BaseFee)-1]
+	gasFeeCap = new(big.Int).Add(new(big.Int).Mul(baseFee, big.NewInt(2)), gasTipCap)
+	return gasTipCap, gasFeeCap, nil
+}
@@ -0,0 +1,68 @@
+package chain
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+)
+
+type mockFeeHistory struct {
+	history *ethereum.FeeHistory
+}
+
+func (m *mockFeeHistory) FeeHistory(_ context.Context, _ uint64, _ *big.Int, _ []float64) (*ethereum.FeeHistory, error) {
+	return m.history, nil
+}
+
+func TestFeeOracleSuggestFees(t *testing.T) {
+	tests := []struct {
+		name       string
+		history    *ethereum.FeeHistory
+		wantTipCap *big.Int
+		wantFeeCap *big.Int
+		wantErr    bool
+	}{
+		{
+			name: "median reward",
+			history: &ethereum.FeeHistory{
+				Reward:  [][]*big.Int{{big.NewInt(3)}, {big.NewInt(1)}, {big.NewInt(2)}},
+				BaseFee: []*big.Int{big.NewInt(90), big.NewInt(95), big.NewInt(100), big.NewInt(110)},
+			},
+			wantTipCap: big.NewInt(2),
+			wantFeeCap: big.NewInt(222),
+		},
+		{
+			name: "empty blocks",
+			history: &ethereum.FeeHistory{
+				BaseFee: []*big.Int{big.NewInt(100)},
+			},
+			wantTipCap: big.NewInt(0),
+			wantFeeCap: big.NewInt(200),
+		},
+		{
+			name:    "pre-london",
+			history: &ethereum.FeeHistory{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oracle := NewFeeOracle(&mockFeeHistory{history: tt.history}, 3, 50)
+			gotTipCap, gotFeeCap, err := oracle.SuggestFees(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SuggestFees() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if gotTipCap.Cmp(tt.wantTipCap) != 0 {
+				t.Errorf("SuggestFees() gasTipCap = %v, want %v", gotTipCap, tt.wantTipCap)
+			}
+			if gotFeeCap.Cmp(tt.wantFeeCap) != 0 {
+				t.Errorf("SuggestFees() gasFeeCap = %v, want %v", gotFeeCap, tt.wantFeeCap)
+			}
+		})
+	}
+}
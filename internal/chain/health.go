@@ -0,0 +1,103 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	log "github.com/sirupsen/logrus"
+)
+
+var errChainMismatch = errors.New("chain ID mismatch")
+
+type syncProgressReader interface {
+	SyncProgress(ctx context.Context) (*ethereum.SyncProgress, error)
+}
+
+// HealthChecker is implemented by tx builders able to verify they can still send payouts
+type HealthChecker interface {
+	Check(ctx context.Context) error
+}
+
+// Check verifies that the node responds, that it serves the chain the builder
+// signs for and that the funder key produces valid signatures
+func (b *TxBuild) Check(ctx context.Context) error {
+	if _, err := b.client.HeaderByNumber(ctx, nil); err != nil {
+		return fmt.Errorf("rpc node unreachable: %w", err)
+	}
+	if reader, ok := b.client.(chainIDReader); ok {
+		chainID, err := reader.ChainID(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to read chain ID: %w", err)
+		}
+		if chainID.Cmp(b.signer.ChainID()) != 0 {
+			return fmt.Errorf("chain ID mismatch: node serves %s, expected %s", chainID, b.signer.ChainID())
+		}
+	}
+
+	tx, err := b.sign(&types.LegacyTx{To: &common.Address{}, Gas: 21000})
+	if err != nil {
+		return fmt.Errorf("funder key cannot sign: %w", err)
+	}
+	if sender, err := types.Sender(b.signer, tx); err != nil || sender != b.fromAddress {
+		return fmt.Errorf("funder key produced an invalid signature")
+	}
+	return nil
+}
+
+// WarmUp connects to the endpoints of client before the first claim and
+// verifies that they serve chainID, unless it is nil, and are done syncing.
+// Endpoints that are not ready are logged and failed over from. It errors if
+// an endpoint serves another chain or if none is ready
+func WarmUp(ctx context.Context, client Client, chainID *big.Int) error {
+	failover, ok := client.(*failoverClient)
+	if !ok {
+		return checkEndpoint(ctx, client, chainID)
+	}
+	ready := 0
+	for _, e := range failover.endpoints {
+		err := checkEndpoint(ctx, e.client, chainID)
+		switch {
+		case errors.Is(err, errChainMismatch):
+			return fmt.Errorf("%s: %w", e.name, err)
+		case err != nil:
+			failover.markFailed(e, err)
+		default:
+			ready++
+		}
+	}
+	if ready == 0 {
+		return errors.New("no RPC endpoint is ready")
+	}
+	log.WithField("endpoints", ready).Info("RPC endpoints are ready")
+	return nil
+}
+
+func checkEndpoint(ctx context.Context, client Client, chainID *big.Int) error {
+	if _, err := client.HeaderByNumber(ctx, nil); err != nil {
+		return fmt.Errorf("rpc node unreachable: %w", err)
+	}
+	if reader, ok := client.(chainIDReader); ok && chainID != nil {
+		id, err := reader.ChainID(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to read chain ID: %w", err)
+		}
+		if id.Cmp(chainID) != 0 {
+			return fmt.Errorf("%w: node serves %s, expected %s", errChainMismatch, id, chainID)
+		}
+	}
+	if reader, ok := client.(syncProgressReader); ok {
+		progress, err := reader.SyncProgress(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to read sync status: %w", err)
+		}
+		if progress != nil {
+			return fmt.Errorf("node is syncing, at block %d of %d", progress.CurrentBlock, progress.HighestBlock)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+type chainIDBackend struct {
+	*backends.SimulatedBackend
+	chainID *big.Int
+}
+
+func (b *chainIDBackend) ChainID(_ context.Context) (*big.Int, error) {
+	return b.chainID, nil
+}
+
+func TestTxBuilderCheck(t *testing.T) {
+	privateKey, _ := crypto.HexToECDSA("976f9f7772781ff6d1c93941129d417c49a209c674056a3cf5e27e225ee55fa8")
+	simClient := backends.NewSimulatedBackend(core.GenesisAlloc{}, 10000000)
+	defer simClient.Close()
+
+	tests := []struct {
+		name    string
+		chainID int64
+		wantErr bool
+	}{
+		{name: "matching chain", chainID: 1337},
+		{name: "mismatched chain", chainID: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &chainIDBackend{SimulatedBackend: simClient, chainID: big.NewInt(tt.chainID)}
+			txBuilder := newTxBuild(client, NewKeySigner(privateKey), types.NewLondonSigner(big.NewInt(1337)))
+			if err := txBuilder.Check(context.Background()); (err != nil) != tt.wantErr {
+				t.Errorf("Check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+type warmUpEndpoint struct {
+	fakeEndpoint
+	chainID int64
+	syncing bool
+}
+
+func (e *warmUpEndpoint) ChainID(_ context.Context) (*big.Int, error) {
+	return big.NewInt(e.chainID), nil
+}
+
+func (e *warmUpEndpoint) SyncProgress(_ context.Context) (*ethereum.SyncProgress, error) {
+	if e.syncing {
+		return &ethereum.SyncProgress{CurrentBlock: 5, HighestBlock: 10}, nil
+	}
+	return nil, nil
+}
+
+func TestWarmUp(t *testing.T) {
+	down := &warmUpEndpoint{fakeEndpoint: fakeEndpoint{err: errors.New("connection refused")}, chainID: 1337}
+	syncing := &warmUpEndpoint{chainID: 1337, syncing: true}
+	ready := &warmUpEndpoint{chainID: 1337}
+	other := &warmUpEndpoint{chainID: 1}
+	failover := func(endpoints ...*warmUpEndpoint) *failoverClient {
+		fakes := make([]*rpcEndpoint, len(endpoints))
+		for i, e := range endpoints {
+			fakes[i] = &rpcEndpoint{name: "node", client: e}
+		}
+		return newFailoverClient(fakes)
+	}
+
+	tests := []struct {
+		name    string
+		client  Client
+		chainID *big.Int
+		wantErr bool
+	}{
+		{name: "ready node", client: ready, chainID: big.NewInt(1337)},
+		{name: "syncing node", client: syncing, chainID: big.NewInt(1337), wantErr: true},
+		{name: "unknown chain", client: other},
+		{name: "one endpoint ready", client: failover(down, syncing, ready), chainID: big.NewInt(1337)},
+		{name: "no endpoint ready", client: failover(down, syncing), chainID: big.NewInt(1337), wantErr: true},
+		{name: "endpoint on another chain", client: failover(ready, other), chainID: big.NewInt(1337), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := WarmUp(context.Background(), tt.client, tt.chainID); (err != nil) != tt.wantErr {
+				t.Errorf("WarmUp() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	c := failover(syncing, ready)
+	WarmUp(context.Background(), c, big.NewInt(1337))
+	if candidates := c.candidates(); len(candidates) != 1 || candidates[0].client != ready {
+		t.Error("syncing endpoint not failed over from after the warm-up")
+	}
+}
@@ -0,0 +1,273 @@
+package chain
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var kmsClient = &http.Client{Timeout: 10 * time.Second}
+
+// awsKMSSigner signs with an ECC_SECG_P256K1 key in AWS KMS, authenticating with
+// the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN variables
+type awsKMSSigner struct {
+	endpoint     string
+	region       string
+	keyID        string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	address      common.Address
+}
+
+func NewAWSKMSSigner(ctx context.Context, region, keyID string) (Signer, error) {
+	if region == "" {
+		return nil, errors.New("missing AWS region")
+	}
+	s := &awsKMSSigner{
+		endpoint:     fmt.Sprintf("https://kms.%s.amazonaws.com", region),
+		region:       region,
+		keyID:        keyID,
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if s.accessKey == "" || s.secretKey == "" {
+		return nil, errors.New("missing AWS credentials")
+	}
+	return s, s.init(ctx)
+}
+
+func (s *awsKMSSigner) init(ctx context.Context) error {
+	var resp struct {
+		PublicKey []byte
+	}
+	if err := s.call(ctx, "GetPublicKey", map[string]string{"KeyId": s.keyID}, &resp); err != nil {
+		return err
+	}
+	pub, err := parsePublicKeyDER(resp.PublicKey)
+	if err != nil {
+		return err
+	}
+	s.address = crypto.PubkeyToAddress(*pub)
+	return nil
+}
+
+func (s *awsKMSSigner) Address() common.Address {
+	return s.address
+}
+
+func (s *awsKMSSigner) SignHash(ctx context.Context, hash common.Hash) ([]byte, error) {
+	req := map[string]interface{}{
+		"KeyId":            s.keyID,
+		"Message":          hash.Bytes(),
+		"MessageType":      "DIGEST",
+		"SigningAlgorithm": "ECDSA_SHA_256",
+	}
+	var resp struct {
+		Signature []byte
+	}
+	if err := s.call(ctx, "Sign", req, &resp); err != nil {
+		return nil, err
+	}
+	return signatureFromDER(resp.Signature, hash, s.address)
+}
+
+func (s *awsKMSSigner) call(ctx context.Context, action string, body, out interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", s.endpoint+"/", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService."+action)
+	s.sign(req, payload, time.Now().UTC())
+	return doKMS(req, out)
+}
+
+// sign adds an AWS Signature Version 4 to the request
+func (s *awsKMSSigner) sign(req *http.Request, payload []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if s.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(req.Header.Get(name))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method, "/", "", canonicalHeaders.String(), signedHeaders, sha256Hex(payload),
+	}, "\n")
+	scope := date + "/" + s.region + "/kms/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	for _, part := range []string{s.region, "kms", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature))
+}
+
+const (
+	gcpKMSEndpoint   = "https://cloudkms.googleapis.com/v1/"
+	gcpMetadataToken = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+)
+
+// gcpKMSSigner signs with an EC_SIGN_SECP256K1_SHA256 key version in Google Cloud KMS,
+// authenticating with GOOGLE_OAUTH_ACCESS_TOKEN or the metadata server of the instance
+type gcpKMSSigner struct {
+	mutex    sync.Mutex
+	endpoint string
+	name     string
+	token    string
+	expiry   time.Time
+	address  common.Address
+}
+
+func NewGCPKMSSigner(ctx context.Context, keyVersion string) (Signer, error) {
+	s := &gcpKMSSigner{endpoint: gcpKMSEndpoint, name: keyVersion}
+	return s, s.init(ctx)
+}
+
+func (s *gcpKMSSigner) init(ctx context.Context) error {
+	var resp struct {
+		Pem string `json:"pem"`
+	}
+	if err := s.call(ctx, "GET", s.name+"/publicKey", nil, &resp); err != nil {
+		return err
+	}
+	block, _ := pem.Decode([]byte(resp.Pem))
+	if block == nil {
+		return errors.New("invalid public key pem")
+	}
+	pub, err := parsePublicKeyDER(block.Bytes)
+	if err != nil {
+		return err
+	}
+	s.address = crypto.PubkeyToAddress(*pub)
+	return nil
+}
+
+func (s *gcpKMSSigner) Address() common.Address {
+	return s.address
+}
+
+func (s *gcpKMSSigner) SignHash(ctx context.Context, hash common.Hash) ([]byte, error) {
+	req := map[string]interface{}{
+		"digest": map[string][]byte{"sha256": hash.Bytes()},
+	}
+	var resp struct {
+		Signature []byte `json:"signature"`
+	}
+	if err := s.call(ctx, "POST", s.name+":asymmetricSign", req, &resp); err != nil {
+		return nil, err
+	}
+	return signatureFromDER(resp.Signature, hash, s.address)
+}
+
+func (s *gcpKMSSigner) call(ctx context.Context, method, path string, body, out interface{}) error {
+	token, err := s.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+	var payload []byte
+	if body != nil {
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, s.endpoint+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	return doKMS(req, out)
+}
+
+func (s *gcpKMSSigner) accessToken(ctx context.Context) (string, error) {
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		return token, nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.token != "" && time.Now().Before(s.expiry) {
+		return s.token, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", gcpMetadataToken, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	var resp struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := doKMS(req, &resp); err != nil {
+		return "", fmt.Errorf("failed to fetch GCP access token: %w", err)
+	}
+	s.token = resp.AccessToken
+	// Refresh a minute early so a token never expires mid request
+	s.expiry = time.Now().Add(time.Duration(resp.ExpiresIn)*time.Second - time.Minute)
+	return s.token, nil
+}
+
+func doKMS(req *http.Request, out interface{}) error {
+	resp, err := kmsClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var body bytes.Buffer
+		body.ReadFrom(resp.Body)
+		return fmt.Errorf("%s returned status %d: %s", req.URL.Host, resp.StatusCode, strings.TrimSpace(body.String()))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,127 @@
+package chain
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// kmsKey mimics a KMS service: its public key is DER encoded and its signatures
+// are ASN.1 with S left in the upper half of the curve
+type kmsKey struct {
+	key *ecdsa.PrivateKey
+}
+
+func (k kmsKey) publicKeyDER() []byte {
+	der, _ := asn1.Marshal(struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}{
+		Algorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}},
+		PublicKey: asn1.BitString{Bytes: crypto.FromECDSAPub(&k.key.PublicKey), BitLength: 65 * 8},
+	})
+	return der
+}
+
+func (k kmsKey) signDER(digest []byte) []byte {
+	sig, _ := crypto.Sign(digest, k.key)
+	s := new(big.Int).SetBytes(sig[32:64])
+	s.Sub(crypto.S256().Params().N, s)
+	der, _ := asn1.Marshal(struct{ R, S *big.Int }{new(big.Int).SetBytes(sig[:32]), s})
+	return der
+}
+
+func TestAWSKMSSigner(t *testing.T) {
+	privateKey, _ := crypto.GenerateKey()
+	key := kmsKey{privateKey}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		var req struct {
+			KeyId   string
+			Message []byte
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		switch r.Header.Get("X-Amz-Target") {
+		case "TrentService.GetPublicKey":
+			json.NewEncoder(w).Encode(map[string][]byte{"PublicKey": key.publicKeyDER()})
+		case "TrentService.Sign":
+			json.NewEncoder(w).Encode(map[string][]byte{"Signature": key.signDER(req.Message)})
+		}
+	}))
+	defer srv.Close()
+
+	signer := &awsKMSSigner{endpoint: srv.URL, region: "eu-west-1", keyID: "alias/faucet", accessKey: "AKID", secretKey: "secret"}
+	if err := signer.init(context.Background()); err != nil {
+		t.Fatalf("init() error = %v", err)
+	}
+	testRemoteSigner(t, signer, crypto.PubkeyToAddress(privateKey.PublicKey))
+}
+
+func TestGCPKMSSigner(t *testing.T) {
+	t.Setenv("GOOGLE_OAUTH_ACCESS_TOKEN", "token")
+	privateKey, _ := crypto.GenerateKey()
+	key := kmsKey{privateKey}
+	name := "projects/p/locations/global/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/" + name + "/publicKey":
+			block := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: key.publicKeyDER()})
+			json.NewEncoder(w).Encode(map[string]string{"pem": string(block)})
+		case "/" + name + ":asymmetricSign":
+			var req struct {
+				Digest struct {
+					Sha256 []byte `json:"sha256"`
+				} `json:"digest"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+			json.NewEncoder(w).Encode(map[string][]byte{"signature": key.signDER(req.Digest.Sha256)})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	signer := &gcpKMSSigner{endpoint: srv.URL + "/", name: name}
+	if err := signer.init(context.Background()); err != nil {
+		t.Fatalf("init() error = %v", err)
+	}
+	testRemoteSigner(t, signer, crypto.PubkeyToAddress(privateKey.PublicKey))
+}
+
+func testRemoteSigner(t *testing.T, signer Signer, want common.Address) {
+	if signer.Address() != want {
+		t.Fatalf("Address() = %s, want %s", signer.Address(), want)
+	}
+
+	txBuilder := newTxBuild(nil, signer, types.NewLondonSigner(big.NewInt(1337)))
+	tx, err := txBuilder.sign(&types.DynamicFeeTx{ChainID: big.NewInt(1337), Gas: 21000, GasTipCap: big.NewInt(1), GasFeeCap: big.NewInt(2)})
+	if err != nil {
+		t.Fatalf("sign() error = %v", err)
+	}
+	from, err := types.Sender(txBuilder.signer, tx)
+	if err != nil || from != want {
+		t.Errorf("types.Sender() = %s, %v, want %s", from, err, want)
+	}
+	if _, _, s := tx.RawSignatureValues(); s.Cmp(secp256k1HalfN) > 0 {
+		t.Error("signature S is not normalized")
+	}
+}
@@ -0,0 +1,143 @@
+package chain
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/go-redis/redis/v8"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// lockLease bounds how long a crashed instance can hold up the others
+	lockLease = 30 * time.Second
+	// lockRetry is how often a held lock is polled
+	lockRetry = 50 * time.Millisecond
+	// lockRenewal is how often the lease is extended while the lock is held
+	lockRenewal = lockLease / 3
+)
+
+// Locker serializes nonce assignment and broadcast for an account across
+// faucet instances sharing the same funder key
+type Locker interface {
+	Lock(ctx context.Context, account common.Address) (unlock func(), err error)
+}
+
+// lockAccount takes the lock on account, if there is a locker
+func lockAccount(ctx context.Context, locker Locker, account common.Address) (func(), error) {
+	if locker == nil {
+		return func() {}, nil
+	}
+	return locker.Lock(ctx, account)
+}
+
+// releaseScript deletes the lock only if it still holds our token, so that an
+// instance whose lease ran out can not release the lock of another one
+var releaseScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0`)
+
+// renewScript extends the lease only if the lock still holds our token
+var renewScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return 0`)
+
+// RedisLocker takes leases on a key per account in Redis
+type RedisLocker struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisLocker connects to the Redis server at url, e.g. redis://localhost:6379/0
+func NewRedisLocker(url string) (*RedisLocker, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	client := redis.NewClient(opts)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return newRedisLocker(client), nil
+}
+
+func newRedisLocker(client redis.UniversalClient) *RedisLocker {
+	return &RedisLocker{client: client, prefix: "eth-faucet:nonce-lock:"}
+}
+
+// Lock waits until it holds the lease on account or ctx is done. The lease is
+// renewed until unlock is called, so that slow broadcasts keep the lock, while
+// the lock of a crashed instance still runs out after lockLease
+func (l *RedisLocker) Lock(ctx context.Context, account common.Address) (func(), error) {
+	key := l.prefix + strings.ToLower(account.Hex())
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+	value := hex.EncodeToString(token)
+
+	ticker := time.NewTicker(lockRetry)
+	defer ticker.Stop()
+	for {
+		ok, err := l.client.SetNX(ctx, key, value, lockLease).Result()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return nil, errors.New("timed out waiting for the nonce lock")
+		case <-ticker.C:
+		}
+	}
+
+	held, release := context.WithCancel(context.Background())
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		l.renew(held, key, value, account)
+	}()
+	return func() {
+		release()
+		<-renewed
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := releaseScript.Run(ctx, l.client, []string{key}, value).Err(); err != nil {
+			log.WithError(err).WithField("account", account).Warn("Failed to release nonce lock")
+		}
+	}, nil
+}
+
+// renew extends the lease on key every lockRenewal until ctx is done
+func (l *RedisLocker) renew(ctx context.Context, key, value string, account common.Address) {
+	ticker := time.NewTicker(lockRenewal)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			renewed, err := renewScript.Run(ctx, l.client, []string{key}, value, lockLease.Milliseconds()).Int()
+			if err != nil && ctx.Err() == nil {
+				log.WithError(err).WithField("account", account).Warn("Failed to renew nonce lock")
+			} else if err == nil && renewed == 0 {
+				log.WithField("account", account).Error("Nonce lock lease ran out while held")
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package chain
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// mutexLocker stands in for Redis as the lock shared by several builders
+type mutexLocker struct {
+	mutex sync.Mutex
+	locks int
+}
+
+func (l *mutexLocker) Lock(_ context.Context, _ common.Address) (func(), error) {
+	l.mutex.Lock()
+	l.locks++
+	return l.mutex.Unlock, nil
+}
+
+func TestTxBuilderSharedLock(t *testing.T) {
+	privateKey, _ := crypto.HexToECDSA("976f9f7772781ff6d1c93941129d417c49a209c674056a3cf5e27e225ee55fa8")
+	fromAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
+	simClient := backends.NewSimulatedBackend(
+		core.GenesisAlloc{
+			fromAddress: {Balance: big.NewInt(10000000000000000)},
+		}, 10000000,
+	)
+	defer simClient.Close()
+
+	locker := &mutexLocker{}
+	fees := &mockFeeHistory{history: &ethereum.FeeHistory{
+		Reward:  [][]*big.Int{{big.NewInt(1000000000)}},
+		BaseFee: []*big.Int{big.NewInt(1000000000), big.NewInt(1000000000)},
+	}}
+	// Two instances funding from the same account
+	var builders []*TxBuild
+	for i := 0; i < 2; i++ {
+		builder := newTxBuild(simClient, NewKeySigner(privateKey), types.NewLondonSigner(big.NewInt(1337)), WithLocker(locker))
+		builder.feeOracle = NewFeeOracle(fees, 1, 50)
+		builders = append(builders, builder)
+	}
+
+	bgCtx := context.Background()
+	for i, builder := range append(builders, builders...) {
+		if _, err := builder.Transfer(bgCtx, "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", big.NewInt(1000)); err != nil {
+			t.Fatalf("transfer %d failed: %v", i, err)
+		}
+	}
+	simClient.Commit()
+
+	nonce, err := simClient.NonceAt(bgCtx, fromAddress, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nonce != 4 {
+		t.Errorf("nonce = %d after 4 transfers, want 4", nonce)
+	}
+	if locker.locks != 4 {
+		t.Errorf("lock taken %d times, want 4", locker.locks)
+	}
+}
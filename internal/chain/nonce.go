@@ -0,0 +1,418 @@
+package chain
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// minGasBump is the price increase most clients require before they accept a replacement tx
+	minGasBump = 10
+	// replacementRetention is how long the hash of a replaced tx can still be resolved to its successor
+	replacementRetention = 24 * time.Hour
+	// cleanupInterval is how often confirmed txs are forgotten when stalled txs are not replaced
+	cleanupInterval = time.Minute
+)
+
+type pendingTx struct {
+	tx     *types.Transaction
+	sentAt time.Time
+}
+
+type replacedTx struct {
+	hash common.Hash
+	at   time.Time
+}
+
+type NonceManager struct {
+	mutex   sync.Mutex
+	client  Client
+	address common.Address
+	nonce   uint64
+	// released holds the nonces below nonce whose txs were not sent, which
+	// are handed out again before the sequence moves on
+	released     map[uint64]struct{}
+	pending      map[uint64]*pendingTx
+	replacements map[common.Hash]replacedTx
+	stallTimeout time.Duration
+	gasBump      int64
+	// maxFee caps the fee per gas stalled txs are bumped to, if set
+	maxFee *big.Int
+	sign   func(types.TxData) (*types.Transaction, error)
+	// onReplace is told about every stalled tx that was replaced
+	onReplace func(replaced, replacement common.Hash)
+	// locker is held while replacements are broadcast, if set
+	locker Locker
+}
+
+func NewNonceManager(client Client, address common.Address, stallTimeout time.Duration, gasBump int64, sign func(types.TxData) (*types.Transaction, error)) *NonceManager {
+	if gasBump < minGasBump {
+		gasBump = minGasBump
+	}
+	return &NonceManager{
+		client:       client,
+		address:      address,
+		released:     make(map[uint64]struct{}),
+		pending:      make(map[uint64]*pendingTx),
+		replacements: make(map[common.Hash]replacedTx),
+		stallTimeout: stallTimeout,
+		gasBump:      gasBump,
+		sign:         sign,
+	}
+}
+
+// Next takes the lowest released nonce, or else the next one of the sequence
+func (m *NonceManager) Next() uint64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if nonce, ok := m.lowestReleased(); ok {
+		delete(m.released, nonce)
+		return nonce
+	}
+	nonce := m.nonce
+	m.nonce++
+	return nonce
+}
+
+// Peek returns the nonce Next would hand out without taking it
+func (m *NonceManager) Peek() uint64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if nonce, ok := m.lowestReleased(); ok {
+		return nonce
+	}
+	return m.nonce
+}
+
+func (m *NonceManager) lowestReleased() (uint64, bool) {
+	lowest, found := uint64(0), false
+	for nonce := range m.released {
+		if !found || nonce < lowest {
+			lowest, found = nonce, true
+		}
+	}
+	return lowest, found
+}
+
+// Release gives back a nonce whose tx was not sent. The last nonce taken
+// moves the sequence back, an earlier one is handed out again by Next so
+// that the txs sent with the later ones do not wait behind a gap
+func (m *NonceManager) Release(nonce uint64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	switch {
+	case nonce >= m.nonce:
+	case nonce+1 == m.nonce:
+		m.nonce = nonce
+		// Released nonces right below it now end the sequence as well
+		for {
+			if _, ok := m.released[m.nonce-1]; !ok || m.nonce == 0 {
+				break
+			}
+			m.nonce--
+			delete(m.released, m.nonce)
+		}
+	default:
+		m.released[nonce] = struct{}{}
+	}
+}
+
+// dropReleased forgets the released nonces below nonce, which the node no longer accepts
+func (m *NonceManager) dropReleased(below uint64) {
+	for nonce := range m.released {
+		if nonce < below {
+			delete(m.released, nonce)
+		}
+	}
+}
+
+func (m *NonceManager) Sync(ctx context.Context) {
+	nonce, err := m.client.PendingNonceAt(ctx, m.address)
+	if err != nil {
+		log.WithError(err).WithField("address", m.address).Error("Failed to refresh nonce")
+		return
+	}
+
+	m.mutex.Lock()
+	m.nonce = nonce
+	m.released = make(map[uint64]struct{})
+	m.mutex.Unlock()
+}
+
+// CatchUp moves the sequence forward to the pending nonce of the node, which is
+// ahead when other instances sent txs from the same account
+func (m *NonceManager) CatchUp(ctx context.Context) error {
+	nonce, err := m.client.PendingNonceAt(ctx, m.address)
+	if err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if nonce > m.nonce {
+		m.nonce = nonce
+	}
+	m.dropReleased(nonce)
+	return nil
+}
+
+func (m *NonceManager) Track(tx *types.Transaction) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if previous, ok := m.pending[tx.Nonce()]; ok && previous.tx.Hash() != tx.Hash() && samePayload(previous.tx, tx) {
+		m.replacements[previous.tx.Hash()] = replacedTx{hash: tx.Hash(), at: time.Now()}
+	}
+	m.pending[tx.Nonce()] = &pendingTx{tx: tx, sentAt: time.Now()}
+}
+
+// Versions returns the hash followed by the hashes of the txs that replaced it
+func (m *NonceManager) Versions(hash common.Hash) []common.Hash {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	versions := []common.Hash{hash}
+	for {
+		next, ok := m.replacements[versions[len(versions)-1]]
+		if !ok {
+			return versions
+		}
+		versions = append(versions, next.hash)
+	}
+}
+
+// Pending returns the latest version of a tx that is still awaiting confirmation
+func (m *NonceManager) Pending(hash common.Hash) (*types.Transaction, bool) {
+	versions := m.Versions(hash)
+	latest := versions[len(versions)-1]
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, p := range m.pending {
+		if p.tx.Hash() == latest {
+			return p.tx, true
+		}
+	}
+	return nil, false
+}
+
+// PendingCount returns the number of sent txs that are not confirmed yet
+func (m *NonceManager) PendingCount() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return len(m.pending)
+}
+
+// Knows reports whether the tx was sent through this nonce manager and is still tracked
+func (m *NonceManager) Knows(hash common.Hash) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, ok := m.replacements[hash]; ok {
+		return true
+	}
+	for _, p := range m.pending {
+		if p.tx.Hash() == hash {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *NonceManager) Run(ctx context.Context) {
+	interval := cleanupInterval
+	if m.stallTimeout > 0 {
+		interval = m.stallTimeout / 2
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.replaceStalled(ctx)
+		}
+	}
+}
+
+func (m *NonceManager) replaceStalled(ctx context.Context) {
+	confirmed, err := m.client.NonceAt(ctx, m.address, nil)
+	if err != nil {
+		log.WithError(err).Error("Failed to fetch confirmed nonce")
+		return
+	}
+
+	var stalled []*types.Transaction
+	var lowest *pendingTx
+	m.mutex.Lock()
+	for nonce, p := range m.pending {
+		if nonce < confirmed {
+			delete(m.pending, nonce)
+			continue
+		}
+		if lowest == nil || nonce < lowest.tx.Nonce() {
+			lowest = p
+		}
+		if m.stallTimeout > 0 && time.Since(p.sentAt) >= m.stallTimeout {
+			stalled = append(stalled, p.tx)
+		}
+	}
+	m.dropReleased(confirmed)
+	for hash, r := range m.replacements {
+		if time.Since(r.at) >= replacementRetention {
+			delete(m.replacements, hash)
+		}
+	}
+	m.mutex.Unlock()
+	// A tx that waits above the confirmed nonce for long may be held back by
+	// a gap left by a nonce that was taken but never sent
+	gapTimeout := m.stallTimeout
+	if gapTimeout <= 0 {
+		gapTimeout = cleanupInterval
+	}
+	waiting := lowest != nil && confirmed < lowest.tx.Nonce() && time.Since(lowest.sentAt) >= gapTimeout
+	if len(stalled) == 0 && !waiting {
+		return
+	}
+
+	unlock, err := lockAccount(ctx, m.locker, m.address)
+	if err != nil {
+		log.WithError(err).Error("Failed to lock the funder to replace stalled txs")
+		return
+	}
+	defer unlock()
+	if waiting {
+		// The node accepts txs up to its pending nonce in sequence, which falls
+		// short of the tracked tx if there is a gap. It is filled rather than
+		// bumping the txs behind it
+		pendingNonce, err := m.client.PendingNonceAt(ctx, m.address)
+		if err != nil {
+			log.WithError(err).Error("Failed to fetch pending nonce")
+			return
+		}
+		if pendingNonce < lowest.tx.Nonce() {
+			m.fillGap(ctx, pendingNonce, lowest.tx)
+			return
+		}
+	}
+	for _, tx := range stalled {
+		bumped := bumpGas(tx, m.gasBump)
+		if feeCap := types.NewTx(bumped).GasFeeCap(); m.maxFee != nil && feeCap.Cmp(m.maxFee) > 0 {
+			log.WithFields(log.Fields{
+				"nonce":  tx.Nonce(),
+				"txHash": tx.Hash(),
+				"fee":    feeCap,
+			}).Warn("Stalled transaction not replaced as the bumped fee exceeds the fee cap")
+			continue
+		}
+		replacement, err := m.sign(bumped)
+		if err != nil {
+			log.WithError(err).Error("Failed to sign replacement tx")
+			continue
+		}
+		if err := m.client.SendTransaction(ctx, replacement); err != nil {
+			log.WithError(err).WithField("txHash", tx.Hash()).Error("Failed to replace stalled tx")
+			continue
+		}
+
+		m.Track(replacement)
+		log.WithFields(log.Fields{
+			"nonce":  tx.Nonce(),
+			"txHash": tx.Hash(),
+			"newTx":  replacement.Hash(),
+		}).Warn("Replaced stalled transaction")
+		m.mutex.Lock()
+		onReplace := m.onReplace
+		m.mutex.Unlock()
+		if onReplace != nil {
+			onReplace(tx.Hash(), replacement.Hash())
+		}
+	}
+}
+
+// fillGap sends 0 value txs to the funder itself with the nonces from
+// start up to the one of next, at the fees of next
+func (m *NonceManager) fillGap(ctx context.Context, start uint64, next *types.Transaction) {
+	for nonce := start; nonce < next.Nonce(); nonce++ {
+		m.mutex.Lock()
+		delete(m.released, nonce)
+		m.mutex.Unlock()
+		filler, err := m.sign(selfSend(next, m.address, nonce))
+		if err != nil {
+			log.WithError(err).Error("Failed to sign tx filling a nonce gap")
+			return
+		}
+		if err := m.client.SendTransaction(ctx, filler); err != nil {
+			log.WithError(err).WithField("nonce", nonce).Error("Failed to fill nonce gap")
+			return
+		}
+		m.Track(filler)
+		log.WithFields(log.Fields{
+			"nonce":  nonce,
+			"txHash": filler.Hash(),
+		}).Warn("Filled nonce gap holding back pending transactions")
+	}
+}
+
+// selfSend returns a 0 value tx to the funder at the fees of template
+func selfSend(template *types.Transaction, to common.Address, nonce uint64) types.TxData {
+	if template.Type() == types.DynamicFeeTxType {
+		return &types.DynamicFeeTx{
+			ChainID:   template.ChainId(),
+			Nonce:     nonce,
+			To:        &to,
+			Value:     new(big.Int),
+			Gas:       21000,
+			GasTipCap: template.GasTipCap(),
+			GasFeeCap: template.GasFeeCap(),
+		}
+	}
+	return &types.LegacyTx{
+		Nonce:    nonce,
+		To:       &to,
+		Value:    new(big.Int),
+		Gas:      21000,
+		GasPrice: template.GasPrice(),
+	}
+}
+
+func samePayload(a, b *types.Transaction) bool {
+	if a.To() == nil || b.To() == nil {
+		return false
+	}
+	return *a.To() == *b.To() && a.Value().Cmp(b.Value()) == 0 && bytes.Equal(a.Data(), b.Data())
+}
+
+func bumpGas(tx *types.Transaction, percent int64) types.TxData {
+	if tx.Type() == types.DynamicFeeTxType {
+		return &types.DynamicFeeTx{
+			ChainID:   tx.ChainId(),
+			Nonce:     tx.Nonce(),
+			To:        tx.To(),
+			Value:     tx.Value(),
+			Gas:       tx.Gas(),
+			GasTipCap: bumpPrice(tx.GasTipCap(), percent),
+			GasFeeCap: bumpPrice(tx.GasFeeCap(), percent),
+			Data:      tx.Data(),
+		}
+	}
+	return &types.LegacyTx{
+		Nonce:    tx.Nonce(),
+		To:       tx.To(),
+		Value:    tx.Value(),
+		Gas:      tx.Gas(),
+		GasPrice: bumpPrice(tx.GasPrice(), percent),
+		Data:     tx.Data(),
+	}
+}
+
+func bumpPrice(price *big.Int, percent int64) *big.Int {
+	bumped := new(big.Int).Mul(price, big.NewInt(100+percent))
+	return bumped.Div(bumped, big.NewInt(100))
+}
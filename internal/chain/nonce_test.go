@@ -0,0 +1,200 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestNonceManagerReplaceStalled(t *testing.T) {
+	privateKey, _ := crypto.HexToECDSA("976f9f7772781ff6d1c93941129d417c49a209c674056a3cf5e27e225ee55fa8")
+	fromAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
+	simClient := backends.NewSimulatedBackend(
+		core.GenesisAlloc{
+			fromAddress: {Balance: big.NewInt(10000000000000000)},
+		}, 10000000,
+	)
+	defer simClient.Close()
+
+	locker := &mutexLocker{}
+	txBuilder := newTxBuild(simClient, NewKeySigner(privateKey), types.NewEIP155Signer(big.NewInt(1337)), WithStallTimeout(1), WithGasBump(20), WithLocker(locker))
+	bgCtx := context.Background()
+	toAddress := common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
+	txHash, err := txBuilder.Transfer(bgCtx, toAddress.Hex(), big.NewInt(1000))
+	if err != nil {
+		t.Fatalf("could not add tx to pending block: %v", err)
+	}
+	// Drop the pending tx as an RPC node evicting it from the mempool would
+	simClient.Rollback()
+
+	var replaced, replacedBy common.Hash
+	txBuilder.OnReplace(func(old, replacement common.Hash) {
+		replaced, replacedBy = old, replacement
+	})
+	txBuilder.nonces.replaceStalled(bgCtx)
+	simClient.Commit()
+	if locker.locks != 2 {
+		t.Errorf("lock taken %d times for a transfer and its replacement, want 2", locker.locks)
+	}
+
+	block, err := simClient.BlockByNumber(bgCtx, big.NewInt(1))
+	if err != nil {
+		t.Fatalf("could not get block at height 1: %v", err)
+	}
+	if len(block.Transactions()) != 1 {
+		t.Fatalf("expected 1 replacement tx, got %d", len(block.Transactions()))
+	}
+	replacement := block.Transactions()[0]
+	if replacement.Hash() == txHash {
+		t.Errorf("expected stalled tx %v to be replaced", txHash)
+	}
+	if replacement.Nonce() != 0 {
+		t.Errorf("expected replacement nonce 0, got %d", replacement.Nonce())
+	}
+	if replaced != txHash || replacedBy != replacement.Hash() {
+		t.Errorf("replacement reported as %v -> %v, want %v -> %v", replaced, replacedBy, txHash, replacement.Hash())
+	}
+}
+
+func TestNonceManagerRelease(t *testing.T) {
+	m := NewNonceManager(nil, common.Address{}, 0, 0, nil)
+	first, second := m.Next(), m.Next()
+	m.Release(first)
+	if next := m.Next(); next != first {
+		t.Errorf("nonce after releasing an earlier one = %d, want it handed out again as %d", next, first)
+	}
+	if next := m.Next(); next != second+1 {
+		t.Errorf("nonce after reusing the released one = %d, want %d", next, second+1)
+	}
+	m.Release(first)
+	m.Release(second + 1)
+	m.Release(second)
+	if next := m.Peek(); next != first {
+		t.Errorf("nonce after releasing every one = %d, want the sequence back at %d", next, first)
+	}
+}
+
+// futureQueue holds txs above the pending nonce until the ones before them
+// are sent, as the future queue of a node does
+type futureQueue struct {
+	*backends.SimulatedBackend
+	queued map[uint64]*types.Transaction
+	fail   error
+}
+
+func (q *futureQueue) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	if q.fail != nil {
+		err := q.fail
+		q.fail = nil
+		return err
+	}
+	from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+	if err != nil {
+		return err
+	}
+	if nonce, _ := q.PendingNonceAt(ctx, from); tx.Nonce() > nonce {
+		q.queued[tx.Nonce()] = tx
+		return nil
+	}
+	if err := q.SimulatedBackend.SendTransaction(ctx, tx); err != nil {
+		return err
+	}
+	for next := tx.Nonce() + 1; q.queued[next] != nil; next++ {
+		queued := q.queued[next]
+		delete(q.queued, next)
+		if err := q.SimulatedBackend.SendTransaction(ctx, queued); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestNonceGap(t *testing.T) {
+	privateKey, _ := crypto.HexToECDSA("976f9f7772781ff6d1c93941129d417c49a209c674056a3cf5e27e225ee55fa8")
+	fromAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
+	sim := backends.NewSimulatedBackend(core.GenesisAlloc{fromAddress: {Balance: big.NewInt(10000000000000000)}}, 10000000)
+	defer sim.Close()
+	node := &futureQueue{SimulatedBackend: sim, queued: make(map[uint64]*types.Transaction)}
+	txBuilder := newTxBuild(node, NewKeySigner(privateKey), types.NewEIP155Signer(big.NewInt(1337)), WithStallTimeout(1))
+	ctx := context.Background()
+	to := common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B").Hex()
+
+	// Worker A takes nonce 0, worker B sends with nonce 1, then A fails
+	held := txBuilder.nonces.Next()
+	if _, err := txBuilder.Transfer(ctx, to, big.NewInt(1000)); err != nil {
+		t.Fatalf("Transfer() of worker B error = %v", err)
+	}
+	node.fail = errors.New("connection reset by peer")
+	txBuilder.nonces.Release(held)
+	if _, err := txBuilder.Transfer(ctx, to, big.NewInt(1000)); err == nil {
+		t.Fatal("Transfer() succeeded while the node was failing")
+	}
+	// The next payout takes the nonce A gave back, releasing B's tx
+	if _, err := txBuilder.Transfer(ctx, to, big.NewInt(1000)); err != nil {
+		t.Fatalf("Transfer() after the failure error = %v", err)
+	}
+	sim.Commit()
+	if block, _ := sim.BlockByNumber(ctx, big.NewInt(1)); len(block.Transactions()) != 2 {
+		t.Fatalf("%d txs mined after the gap was reused, want 2", len(block.Transactions()))
+	}
+
+	// A nonce that was taken and lost leaves a gap that is filled by a self send
+	txBuilder.nonces.Next()
+	if _, err := txBuilder.Transfer(ctx, to, big.NewInt(1000)); err != nil {
+		t.Fatalf("Transfer() above the gap error = %v", err)
+	}
+	txBuilder.nonces.replaceStalled(ctx)
+	sim.Commit()
+	block, _ := sim.BlockByNumber(ctx, big.NewInt(2))
+	if len(block.Transactions()) != 2 {
+		t.Fatalf("%d txs mined after filling the gap, want 2", len(block.Transactions()))
+	}
+	filler := block.Transactions()[0]
+	if filler.Nonce() != 2 || *filler.To() != fromAddress || filler.Value().Sign() != 0 {
+		t.Errorf("gap filled with tx %d to %s of %s, want a 0 value self send with nonce 2", filler.Nonce(), filler.To(), filler.Value())
+	}
+}
+
+func TestIsNonceError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{err: errors.New("nonce too low"), want: true},
+		{err: errors.New("Nonce too high"), want: true},
+		{err: errors.New("replacement transaction underpriced"), want: true},
+		{err: errors.New("insufficient funds for gas * price + value"), want: false},
+		{err: context.DeadlineExceeded, want: false},
+	}
+	for _, tt := range tests {
+		if got := isNonceError(tt.err); got != tt.want {
+			t.Errorf("isNonceError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestBumpPrice(t *testing.T) {
+	tests := []struct {
+		name    string
+		price   *big.Int
+		percent int64
+		want    *big.Int
+	}{
+		{name: "10 percent", price: big.NewInt(1000), percent: 10, want: big.NewInt(1100)},
+		{name: "rounds down", price: big.NewInt(15), percent: 10, want: big.NewInt(16)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := bumpPrice(tt.price, tt.percent); got.Cmp(tt.want) != 0 {
+				t.Errorf("bumpPrice() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
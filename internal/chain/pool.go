@@ -0,0 +1,147 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+type Selection string
+
+const (
+	RoundRobin   Selection = "roundrobin"
+	LeastPending Selection = "leastpending"
+)
+
+// ParseSelection validates the name of a funder selection strategy
+func ParseSelection(name string) (Selection, error) {
+	switch s := Selection(name); s {
+	case RoundRobin, LeastPending:
+		return s, nil
+	default:
+		return "", fmt.Errorf("unknown funder selection %q", name)
+	}
+}
+
+// MultiSender is implemented by tx builders paying out from several funder accounts
+type MultiSender interface {
+	Senders() []common.Address
+}
+
+// ChainIdentifier is implemented by tx builders that know the chain they pay out on
+type ChainIdentifier interface {
+	ChainID() *big.Int
+}
+
+// TxBuilderPool spreads payouts over several funder accounts, each with its own nonce sequence
+type TxBuilderPool struct {
+	mutex     sync.Mutex
+	builders  []*TxBuild
+	selection Selection
+	next      int
+}
+
+// NewTxBuilderPool returns a plain tx builder for a single key, or a pool selecting
+// a funder per payout with the given strategy for several keys
+func NewTxBuilderPool(client Client, keys []Signer, chainID *big.Int, selection Selection, opts ...Option) (TxBuilder, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("at least one funder key is required")
+	}
+	if len(keys) == 1 {
+		return NewTxBuilder(client, keys[0], chainID, opts...)
+	}
+
+	pool := &TxBuilderPool{selection: selection}
+	for _, key := range keys {
+		builder, err := NewTxBuilder(client, key, chainID, opts...)
+		if err != nil {
+			return nil, err
+		}
+		pool.builders = append(pool.builders, builder.(*TxBuild))
+	}
+	return pool, nil
+}
+
+// Sender returns the first funder account
+func (p *TxBuilderPool) Sender() common.Address {
+	return p.builders[0].Sender()
+}
+
+func (p *TxBuilderPool) Faucet() (common.Address, bool) {
+	return p.builders[0].Faucet()
+}
+
+func (p *TxBuilderPool) Senders() []common.Address {
+	senders := make([]common.Address, len(p.builders))
+	for i, b := range p.builders {
+		senders[i] = b.Sender()
+	}
+	return senders
+}
+
+func (p *TxBuilderPool) ChainID() *big.Int {
+	return p.builders[0].ChainID()
+}
+
+func (p *TxBuilderPool) Transfer(ctx context.Context, to string, value *big.Int) (common.Hash, error) {
+	return p.pick().Transfer(ctx, to, value)
+}
+
+func (p *TxBuilderPool) BatchTransfer(ctx context.Context, to []string, values []*big.Int) (common.Hash, error) {
+	return p.pick().BatchTransfer(ctx, to, values)
+}
+
+func (p *TxBuilderPool) Confirm(ctx context.Context, hash common.Hash, confirmations uint64) (TxState, common.Hash, error) {
+	return p.owner(hash).Confirm(ctx, hash, confirmations)
+}
+
+func (p *TxBuilderPool) Resend(ctx context.Context, hash common.Hash) (common.Hash, error) {
+	return p.owner(hash).Resend(ctx, hash)
+}
+
+func (p *TxBuilderPool) OnReplace(fn func(replaced, replacement common.Hash)) {
+	for _, b := range p.builders {
+		b.OnReplace(fn)
+	}
+}
+
+func (p *TxBuilderPool) Check(ctx context.Context) error {
+	for _, b := range p.builders {
+		if err := b.Check(ctx); err != nil {
+			return fmt.Errorf("%s: %w", b.Sender().Hex(), err)
+		}
+	}
+	return nil
+}
+
+func (p *TxBuilderPool) pick() *TxBuild {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.selection == LeastPending {
+		best := p.builders[0]
+		for _, b := range p.builders[1:] {
+			if b.nonces.PendingCount() < best.nonces.PendingCount() {
+				best = b
+			}
+		}
+		return best
+	}
+
+	b := p.builders[p.next]
+	p.next = (p.next + 1) % len(p.builders)
+	return b
+}
+
+// owner returns the builder that sent the tx, receipts of unknown txs can be looked up by any builder
+func (p *TxBuilderPool) owner(hash common.Hash) *TxBuild {
+	for _, b := range p.builders {
+		if b.nonces.Knows(hash) {
+			return b
+		}
+	}
+	return p.builders[0]
+}
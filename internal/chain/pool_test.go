@@ -0,0 +1,73 @@
+package chain
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestTxBuilderPool(t *testing.T) {
+	var keys []Signer
+	alloc := core.GenesisAlloc{}
+	for i := 0; i < 2; i++ {
+		key, _ := crypto.GenerateKey()
+		keys = append(keys, NewKeySigner(key))
+		alloc[crypto.PubkeyToAddress(key.PublicKey)] = core.GenesisAccount{Balance: big.NewInt(10000000000000000)}
+	}
+	simClient := backends.NewSimulatedBackend(alloc, 10000000)
+	defer simClient.Close()
+
+	tests := []struct {
+		name      string
+		selection Selection
+	}{
+		{name: "round robin", selection: RoundRobin},
+		{name: "least pending", selection: LeastPending},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder, err := NewTxBuilderPool(simClient, keys, big.NewInt(1337), tt.selection)
+			if err != nil {
+				t.Fatalf("NewTxBuilderPool() error = %v", err)
+			}
+			pool := builder.(*TxBuilderPool)
+
+			bgCtx := context.Background()
+			senders := make(map[string]bool)
+			for i := 0; i < 2; i++ {
+				txHash, err := pool.Transfer(bgCtx, "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", big.NewInt(1000))
+				if err != nil {
+					t.Fatalf("Transfer() error = %v", err)
+				}
+				simClient.Commit()
+				tx, _, err := simClient.TransactionByHash(bgCtx, txHash)
+				if err != nil {
+					t.Fatalf("TransactionByHash() error = %v", err)
+				}
+				sender, _ := types.Sender(types.NewLondonSigner(big.NewInt(1337)), tx)
+				senders[sender.Hex()] = true
+
+				if state, _, err := pool.Confirm(bgCtx, txHash, 1); err != nil || state != TxConfirmed {
+					t.Errorf("Confirm() = %s, %v", state, err)
+				}
+			}
+			if len(senders) != 2 {
+				t.Errorf("payouts sent from %d funders, want 2", len(senders))
+			}
+		})
+	}
+}
+
+func TestParseSelection(t *testing.T) {
+	if _, err := ParseSelection("leastpending"); err != nil {
+		t.Errorf("ParseSelection() error = %v", err)
+	}
+	if _, err := ParseSelection("random"); err == nil {
+		t.Errorf("ParseSelection() accepted an unknown strategy")
+	}
+}
@@ -0,0 +1,50 @@
+package chain
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	decimalsSelector        = crypto.Keccak256([]byte("decimals()"))[:4]
+	latestRoundDataSelector = crypto.Keccak256([]byte("latestRoundData()"))[:4]
+)
+
+// LatestPrice returns the latest answer of a Chainlink style price feed, which
+// implements AggregatorV3Interface, and when it was updated
+func LatestPrice(ctx context.Context, client bind.ContractCaller, feed common.Address) (*big.Rat, time.Time, error) {
+	out, err := client.CallContract(ctx, ethereum.CallMsg{To: &feed, Data: decimalsSelector}, nil)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if len(out) < 32 {
+		return nil, time.Time{}, fmt.Errorf("%s does not implement decimals", feed.Hex())
+	}
+	decimals := new(big.Int).SetBytes(out[:32])
+	if !decimals.IsInt64() || decimals.Int64() > 77 {
+		return nil, time.Time{}, fmt.Errorf("%s has invalid decimals %s", feed.Hex(), decimals)
+	}
+
+	out, err = client.CallContract(ctx, ethereum.CallMsg{To: &feed, Data: latestRoundDataSelector}, nil)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if len(out) < 5*32 {
+		return nil, time.Time{}, fmt.Errorf("%s does not implement latestRoundData", feed.Hex())
+	}
+	answer := math.S256(new(big.Int).SetBytes(out[32:64]))
+	if answer.Sign() <= 0 {
+		return nil, time.Time{}, fmt.Errorf("%s answered a price of %s", feed.Hex(), answer)
+	}
+	updatedAt := new(big.Int).SetBytes(out[96:128])
+	unit := new(big.Int).Exp(big.NewInt(10), decimals, nil)
+	return new(big.Rat).SetFrac(answer, unit), time.Unix(updatedAt.Int64(), 0), nil
+}
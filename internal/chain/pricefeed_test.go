@@ -0,0 +1,57 @@
+package chain
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+)
+
+type feedCaller struct {
+	decimals  int64
+	answer    *big.Int
+	updatedAt int64
+}
+
+func (c *feedCaller) CodeAt(_ context.Context, _ common.Address, _ *big.Int) ([]byte, error) {
+	return nil, nil
+}
+
+func (c *feedCaller) CallContract(_ context.Context, call ethereum.CallMsg, _ *big.Int) ([]byte, error) {
+	switch {
+	case bytes.Equal(call.Data, decimalsSelector):
+		return common.LeftPadBytes(big.NewInt(c.decimals).Bytes(), 32), nil
+	case bytes.Equal(call.Data, latestRoundDataSelector):
+		var out []byte
+		for _, word := range []*big.Int{big.NewInt(7), c.answer, big.NewInt(c.updatedAt), big.NewInt(c.updatedAt), big.NewInt(7)} {
+			out = append(out, math.U256Bytes(new(big.Int).Set(word))...)
+		}
+		return out, nil
+	}
+	return nil, nil
+}
+
+func TestLatestPrice(t *testing.T) {
+	feed := common.HexToAddress("0x1")
+	caller := &feedCaller{decimals: 8, answer: big.NewInt(3125000), updatedAt: 1700000000}
+	price, updatedAt, err := LatestPrice(context.Background(), caller, feed)
+	if err != nil {
+		t.Fatalf("LatestPrice() error = %v", err)
+	}
+	if price.FloatString(5) != "0.03125" || !updatedAt.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("LatestPrice() = %s at %v, want 0.03125 at 1700000000", price.FloatString(5), updatedAt.Unix())
+	}
+
+	caller.answer = big.NewInt(-1)
+	if _, _, err := LatestPrice(context.Background(), caller, feed); err == nil {
+		t.Error("LatestPrice() accepted a negative answer")
+	}
+	if _, _, err := LatestPrice(context.Background(), &tokenCaller{}, feed); err == nil {
+		t.Error("LatestPrice() of a contract without a feed succeeded")
+	}
+}
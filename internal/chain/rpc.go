@@ -0,0 +1,129 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/chainflag/eth-faucet/internal/breaker"
+)
+
+// ErrNetworkUnavailable is returned without reaching the node while the
+// circuit breaker of its endpoint is open
+var ErrNetworkUnavailable = errors.New("network unavailable")
+
+// NetworkStatus is implemented by clients that know whether their node can
+// currently be reached
+type NetworkStatus interface {
+	NetworkAvailable() bool
+}
+
+type dialOptions struct {
+	maxIdleConns     int
+	idleTimeout      time.Duration
+	breakerThreshold int
+	breakerCooldown  time.Duration
+}
+
+type DialOption func(*dialOptions)
+
+// WithConnPool sets how many idle keep-alive connections are kept open to an
+// HTTP endpoint and for how long
+func WithConnPool(maxIdle int, idleTimeout time.Duration) DialOption {
+	return func(o *dialOptions) {
+		o.maxIdleConns = maxIdle
+		o.idleTimeout = idleTimeout
+	}
+}
+
+// WithCircuitBreaker makes calls to an HTTP endpoint fail fast with
+// ErrNetworkUnavailable for cooldown once threshold calls in a row failed.
+// A zero threshold disables the breaker
+func WithCircuitBreaker(threshold int, cooldown time.Duration) DialOption {
+	return func(o *dialOptions) {
+		o.breakerThreshold = threshold
+		o.breakerCooldown = cooldown
+	}
+}
+
+// Dial connects to provider, reusing keep-alive connections to HTTP
+// endpoints rather than opening one per call
+func Dial(provider string, opts ...DialOption) (Client, error) {
+	o := &dialOptions{maxIdleConns: 16, idleTimeout: 90 * time.Second}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if !strings.HasPrefix(provider, "http://") && !strings.HasPrefix(provider, "https://") {
+		log.WithField("endpoint", endpointName(provider)).Warn("Connection pooling and the circuit breaker only apply to HTTP endpoints, dialing without them")
+		client, err := ethclient.Dial(provider)
+		if err != nil {
+			return nil, err
+		}
+		return &tracedClient{Client: client}, nil
+	}
+
+	transport := &breakerTransport{name: endpointName(provider), base: newRPCTransport(o)}
+	if o.breakerThreshold > 0 {
+		transport.breaker = breaker.New(o.breakerThreshold, o.breakerCooldown)
+	}
+	conn, err := rpc.DialHTTPWithClient(provider, &http.Client{Transport: transport})
+	if err != nil {
+		return nil, err
+	}
+	return &tracedClient{Client: ethclient.NewClient(conn), breaker: transport.breaker}, nil
+}
+
+func newRPCTransport(o *dialOptions) *http.Transport {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}
+	return &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		DialContext:         dialer.DialContext,
+		ForceAttemptHTTP2:   true,
+		MaxIdleConns:        o.maxIdleConns,
+		MaxIdleConnsPerHost: o.maxIdleConns,
+		IdleConnTimeout:     o.idleTimeout,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+}
+
+// breakerTransport counts failed round trips to the node, so that a node that
+// is down fails calls right away instead of letting each of them time out
+type breakerTransport struct {
+	name    string
+	base    http.RoundTripper
+	breaker *breaker.Breaker
+}
+
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.breaker == nil {
+		return t.base.RoundTrip(req)
+	}
+	if !t.breaker.Allow() {
+		return nil, ErrNetworkUnavailable
+	}
+	resp, err := t.base.RoundTrip(req)
+	switch {
+	case err == nil && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests:
+		if t.breaker.Success() {
+			log.WithField("endpoint", t.name).Info("RPC endpoint is reachable again, closing its circuit breaker")
+		}
+	case errors.Is(req.Context().Err(), context.Canceled):
+		t.breaker.Abandon()
+	default:
+		cause := err
+		if cause == nil {
+			cause = errors.New(resp.Status)
+		}
+		if t.breaker.Failure() {
+			log.WithError(cause).WithField("endpoint", t.name).Error("RPC endpoint keeps failing, opening its circuit breaker")
+		}
+	}
+	return resp, err
+}
@@ -0,0 +1,56 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	healthy := false
+	calls := 0
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if !healthy {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x539"}`))
+	}))
+	defer node.Close()
+
+	client, err := Dial(node.URL, WithCircuitBreaker(2, 200*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	traced := client.(*tracedClient)
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if _, err := traced.ChainID(ctx); err == nil {
+			t.Fatal("ChainID() of a failing node succeeded")
+		}
+	}
+	if traced.NetworkAvailable() {
+		t.Error("network available after the breaker opened")
+	}
+	if _, err := traced.ChainID(ctx); !errors.Is(err, ErrNetworkUnavailable) || calls != 2 {
+		t.Errorf("ChainID() error = %v after %d calls, want ErrNetworkUnavailable without reaching the node", err, calls)
+	}
+
+	// A successful trial once the cooldown is over closes the breaker again
+	healthy = true
+	time.Sleep(200 * time.Millisecond)
+	if !traced.NetworkAvailable() {
+		t.Error("network unavailable after the cooldown")
+	}
+	if chainID, err := traced.ChainID(ctx); err != nil || chainID.Int64() != 1337 {
+		t.Fatalf("ChainID() = %v, %v, want 1337", chainID, err)
+	}
+	if traced.breaker.Open() {
+		t.Error("breaker still open after a successful call")
+	}
+}
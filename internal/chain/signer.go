@@ -0,0 +1,78 @@
+package chain
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Signer holds a funder key, either in memory or in a remote key management service
+type Signer interface {
+	Address() common.Address
+	// SignHash returns the 65 byte [R || S || V] signature of hash
+	SignHash(ctx context.Context, hash common.Hash) ([]byte, error)
+}
+
+type keySigner struct {
+	key     *ecdsa.PrivateKey
+	address common.Address
+}
+
+// NewKeySigner signs with a private key held in memory, e.g. read from a keystore file
+func NewKeySigner(key *ecdsa.PrivateKey) Signer {
+	return &keySigner{key: key, address: crypto.PubkeyToAddress(key.PublicKey)}
+}
+
+func (s *keySigner) Address() common.Address {
+	return s.address
+}
+
+func (s *keySigner) SignHash(_ context.Context, hash common.Hash) ([]byte, error) {
+	return crypto.Sign(hash.Bytes(), s.key)
+}
+
+var secp256k1HalfN = new(big.Int).Rsh(crypto.S256().Params().N, 1)
+
+// parsePublicKeyDER decodes a secp256k1 key in the SubjectPublicKeyInfo format returned by KMS services
+func parsePublicKeyDER(der []byte) (*ecdsa.PublicKey, error) {
+	var info struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	return crypto.UnmarshalPubkey(info.PublicKey.Bytes)
+}
+
+// signatureFromDER converts an ASN.1 ECDSA signature of hash into the Ethereum
+// format, normalizing S to the lower half of the curve and recovering V
+func signatureFromDER(der []byte, hash common.Hash, address common.Address) ([]byte, error) {
+	var sig struct {
+		R, S *big.Int
+	}
+	if _, err := asn1.Unmarshal(der, &sig); err != nil {
+		return nil, fmt.Errorf("invalid signature: %w", err)
+	}
+	if sig.S.Cmp(secp256k1HalfN) > 0 {
+		sig.S.Sub(crypto.S256().Params().N, sig.S)
+	}
+
+	out := make([]byte, 65)
+	sig.R.FillBytes(out[:32])
+	sig.S.FillBytes(out[32:64])
+	for v := byte(0); v < 2; v++ {
+		out[64] = v
+		if pub, err := crypto.SigToPub(hash.Bytes(), out); err == nil && crypto.PubkeyToAddress(*pub) == address {
+			return out, nil
+		}
+	}
+	return nil, errors.New("signature does not match the signer key")
+}
@@ -0,0 +1,30 @@
+package chain
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// balanceOfSelector is shared by ERC-20 tokens and ERC-721 NFTs, which both
+// return the holdings of an account as a uint256
+var balanceOfSelector = crypto.Keccak256([]byte("balanceOf(address)"))[:4]
+
+// TokenBalance returns the balance of holder in the ERC-20 or ERC-721 token
+// contract, in the smallest unit of the token or as a number of NFTs
+func TokenBalance(ctx context.Context, client bind.ContractCaller, token, holder common.Address) (*big.Int, error) {
+	data := append(append([]byte{}, balanceOfSelector...), common.LeftPadBytes(holder.Bytes(), 32)...)
+	out, err := client.CallContract(ctx, ethereum.CallMsg{To: &token, Data: data}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(out) < 32 {
+		return nil, fmt.Errorf("%s does not implement balanceOf", token.Hex())
+	}
+	return new(big.Int).SetBytes(out[:32]), nil
+}
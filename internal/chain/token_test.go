@@ -0,0 +1,49 @@
+package chain
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+type tokenCaller struct {
+	token   common.Address
+	holder  common.Address
+	balance *big.Int
+}
+
+func (c *tokenCaller) CodeAt(_ context.Context, _ common.Address, _ *big.Int) ([]byte, error) {
+	return nil, nil
+}
+
+func (c *tokenCaller) CallContract(_ context.Context, call ethereum.CallMsg, _ *big.Int) ([]byte, error) {
+	if *call.To != c.token {
+		return nil, nil
+	}
+	if !bytes.Equal(call.Data[:4], balanceOfSelector) || common.BytesToAddress(call.Data[4:]) != c.holder {
+		return make([]byte, 32), nil
+	}
+	return common.LeftPadBytes(c.balance.Bytes(), 32), nil
+}
+
+func TestTokenBalance(t *testing.T) {
+	token := common.HexToAddress("0x1")
+	holder := common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
+	caller := &tokenCaller{token: token, holder: holder, balance: big.NewInt(3)}
+
+	balance, err := TokenBalance(context.Background(), caller, token, holder)
+	if err != nil {
+		t.Fatalf("TokenBalance() error = %v", err)
+	}
+	if balance.Cmp(big.NewInt(3)) != 0 {
+		t.Errorf("TokenBalance() = %v, want 3", balance)
+	}
+
+	if _, err := TokenBalance(context.Background(), caller, common.HexToAddress("0x2"), holder); err == nil {
+		t.Error("TokenBalance() of an account without code succeeded")
+	}
+}
@@ -0,0 +1,166 @@
+package chain
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/chainflag/eth-faucet/internal/breaker"
+)
+
+var tracer = otel.Tracer("github.com/chainflag/eth-faucet/internal/chain")
+
+// endSpan records err on the span before ending it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// tracedClient records a span for every JSON-RPC call made on the payout path
+type tracedClient struct {
+	*ethclient.Client
+	breaker *breaker.Breaker
+}
+
+// NetworkAvailable reports whether the circuit breaker of the endpoint lets calls through
+func (c *tracedClient) NetworkAvailable() bool {
+	return c.breaker == nil || c.breaker.Available()
+}
+
+func traceRPC(ctx context.Context, method string, call func(context.Context) error) error {
+	ctx, span := tracer.Start(ctx, method, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("rpc.system", "jsonrpc"), attribute.String("rpc.method", method)))
+	err := call(ctx)
+	endSpan(span, err)
+	return err
+}
+
+func (c *tracedClient) ChainID(ctx context.Context) (chainID *big.Int, err error) {
+	err = traceRPC(ctx, "eth_chainId", func(ctx context.Context) error {
+		chainID, err = c.Client.ChainID(ctx)
+		return err
+	})
+	return chainID, err
+}
+
+func (c *tracedClient) HeaderByNumber(ctx context.Context, number *big.Int) (header *types.Header, err error) {
+	err = traceRPC(ctx, "eth_getBlockByNumber", func(ctx context.Context) error {
+		header, err = c.Client.HeaderByNumber(ctx, number)
+		return err
+	})
+	return header, err
+}
+
+func (c *tracedClient) BlockByNumber(ctx context.Context, number *big.Int) (block *types.Block, err error) {
+	err = traceRPC(ctx, "eth_getBlockByNumber", func(ctx context.Context) error {
+		block, err = c.Client.BlockByNumber(ctx, number)
+		return err
+	})
+	return block, err
+}
+
+func (c *tracedClient) BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (balance *big.Int, err error) {
+	err = traceRPC(ctx, "eth_getBalance", func(ctx context.Context) error {
+		balance, err = c.Client.BalanceAt(ctx, account, blockNumber)
+		return err
+	})
+	return balance, err
+}
+
+func (c *tracedClient) PendingBalanceAt(ctx context.Context, account common.Address) (balance *big.Int, err error) {
+	err = traceRPC(ctx, "eth_getBalance", func(ctx context.Context) error {
+		balance, err = c.Client.PendingBalanceAt(ctx, account)
+		return err
+	})
+	return balance, err
+}
+
+func (c *tracedClient) CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) (code []byte, err error) {
+	err = traceRPC(ctx, "eth_getCode", func(ctx context.Context) error {
+		code, err = c.Client.CodeAt(ctx, account, blockNumber)
+		return err
+	})
+	return code, err
+}
+
+func (c *tracedClient) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (nonce uint64, err error) {
+	err = traceRPC(ctx, "eth_getTransactionCount", func(ctx context.Context) error {
+		nonce, err = c.Client.NonceAt(ctx, account, blockNumber)
+		return err
+	})
+	return nonce, err
+}
+
+func (c *tracedClient) PendingNonceAt(ctx context.Context, account common.Address) (nonce uint64, err error) {
+	err = traceRPC(ctx, "eth_getTransactionCount", func(ctx context.Context) error {
+		nonce, err = c.Client.PendingNonceAt(ctx, account)
+		return err
+	})
+	return nonce, err
+}
+
+func (c *tracedClient) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) (out []byte, err error) {
+	err = traceRPC(ctx, "eth_call", func(ctx context.Context) error {
+		out, err = c.Client.CallContract(ctx, msg, blockNumber)
+		return err
+	})
+	return out, err
+}
+
+func (c *tracedClient) SuggestGasPrice(ctx context.Context) (price *big.Int, err error) {
+	err = traceRPC(ctx, "eth_gasPrice", func(ctx context.Context) error {
+		price, err = c.Client.SuggestGasPrice(ctx)
+		return err
+	})
+	return price, err
+}
+
+func (c *tracedClient) FeeHistory(ctx context.Context, blockCount uint64, lastBlock *big.Int, rewardPercentiles []float64) (history *ethereum.FeeHistory, err error) {
+	err = traceRPC(ctx, "eth_feeHistory", func(ctx context.Context) error {
+		history, err = c.Client.FeeHistory(ctx, blockCount, lastBlock, rewardPercentiles)
+		return err
+	})
+	return history, err
+}
+
+func (c *tracedClient) EstimateGas(ctx context.Context, msg ethereum.CallMsg) (gas uint64, err error) {
+	err = traceRPC(ctx, "eth_estimateGas", func(ctx context.Context) error {
+		gas, err = c.Client.EstimateGas(ctx, msg)
+		return err
+	})
+	return gas, err
+}
+
+func (c *tracedClient) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	return traceRPC(ctx, "eth_sendRawTransaction", func(ctx context.Context) error {
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String("tx.hash", tx.Hash().Hex()))
+		return c.Client.SendTransaction(ctx, tx)
+	})
+}
+
+func (c *tracedClient) TransactionByHash(ctx context.Context, hash common.Hash) (tx *types.Transaction, pending bool, err error) {
+	err = traceRPC(ctx, "eth_getTransactionByHash", func(ctx context.Context) error {
+		tx, pending, err = c.Client.TransactionByHash(ctx, hash)
+		return err
+	})
+	return tx, pending, err
+}
+
+func (c *tracedClient) TransactionReceipt(ctx context.Context, hash common.Hash) (receipt *types.Receipt, err error) {
+	err = traceRPC(ctx, "eth_getTransactionReceipt", func(ctx context.Context) error {
+		receipt, err = c.Client.TransactionReceipt(ctx, hash)
+		return err
+	})
+	return receipt, err
+}
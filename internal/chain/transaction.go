@@ -2,17 +2,29 @@ package chain
 
 import (
 	"context"
-	"crypto/ecdsa"
+	"errors"
+	"fmt"
 	"math/big"
 	"strings"
-	"sync/atomic"
+	"time"
 
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/crypto"
-	"github.com/ethereum/go-ethereum/ethclient"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// signTimeout bounds signing with a remote key management service
+const signTimeout = 10 * time.Second
+
+var (
+	// ErrFeeCapExceeded is returned when the network fee is above the configured cap
+	ErrFeeCapExceeded = errors.New("network fee exceeds the fee cap")
+	// ErrInsufficientFunds is returned when the funder cannot cover a payout and its fee
+	ErrInsufficientFunds = errors.New("funder balance does not cover the payout and its fee")
 )
 
 type TxBuilder interface {
@@ -20,84 +32,366 @@ type TxBuilder interface {
 	Transfer(ctx context.Context, to string, value *big.Int) (common.Hash, error)
 }
 
+type Client interface {
+	bind.ContractCaller
+	bind.ContractTransactor
+	ethereum.ChainStateReader
+	ethereum.TransactionReader
+}
+
+// BlockReader is implemented by clients that can fetch whole blocks
+type BlockReader interface {
+	BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error)
+}
+
+type chainIDReader interface {
+	ChainID(ctx context.Context) (*big.Int, error)
+}
+
+type pendingBalanceReader interface {
+	PendingBalanceAt(ctx context.Context, account common.Address) (*big.Int, error)
+}
+
+type options struct {
+	stallTimeout  time.Duration
+	gasBump       int64
+	legacyTx      bool
+	feeBlocks     uint64
+	feePercentile float64
+	multisend     *common.Address
+	dryRun        bool
+	locker        Locker
+	maxFee        *big.Int
+	faucet        *common.Address
+	dripMethod    *DripMethod
+}
+
+type Option func(*options)
+
+// WithStallTimeout sets how long a tx may stay pending before it is replaced with a higher gas price
+func WithStallTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.stallTimeout = timeout
+	}
+}
+
+// WithGasBump sets the percentage by which the gas price of a stalled tx is raised
+func WithGasBump(percent int64) Option {
+	return func(o *options) {
+		o.gasBump = percent
+	}
+}
+
+// WithLegacyTx forces legacy gas pricing even if the chain supports EIP-1559
+func WithLegacyTx(legacy bool) Option {
+	return func(o *options) {
+		o.legacyTx = legacy
+	}
+}
+
+// WithFeeHistory sets the number of recent blocks and the reward percentile used by the fee oracle
+func WithFeeHistory(blocks uint64, percentile float64) Option {
+	return func(o *options) {
+		o.feeBlocks = blocks
+		o.feePercentile = percentile
+	}
+}
+
+// WithMultisend sets the disperse contract used to send batched payouts
+func WithMultisend(contract common.Address) Option {
+	return func(o *options) {
+		o.multisend = &contract
+	}
+}
+
+// WithDryRun makes the builder price, sign and simulate payouts with
+// eth_estimateGas without broadcasting them or using up nonces
+func WithDryRun(dryRun bool) Option {
+	return func(o *options) {
+		o.dryRun = dryRun
+	}
+}
+
+// WithLocker makes the builder hold a lock on the funder account while it
+// assigns a nonce and broadcasts, so that several faucet instances can share it
+func WithLocker(locker Locker) Option {
+	return func(o *options) {
+		o.locker = locker
+	}
+}
+
+// WithMaxFee caps the fee per gas payouts may pay, in wei. Payouts are
+// refused while the network asks for more, and stalled txs are not bumped above it
+func WithMaxFee(maxFee *big.Int) Option {
+	return func(o *options) {
+		o.maxFee = maxFee
+	}
+}
+
+// WithFaucetContract makes the builder pay out by calling method on a faucet
+// contract holding the funds instead of transferring from the funder account
+func WithFaucetContract(contract common.Address, method *DripMethod) Option {
+	return func(o *options) {
+		o.faucet = &contract
+		o.dripMethod = method
+	}
+}
+
 type TxBuild struct {
-	client      bind.ContractTransactor
-	privateKey  *ecdsa.PrivateKey
+	client      Client
+	key         Signer
 	signer      types.Signer
 	fromAddress common.Address
-	nonce       uint64
+	nonces      *NonceManager
+	feeOracle   *FeeOracle
+	opts        options
 }
 
-func NewTxBuilder(provider string, privateKey *ecdsa.PrivateKey, chainID *big.Int) (TxBuilder, error) {
-	client, err := ethclient.Dial(provider)
-	if err != nil {
-		return nil, err
-	}
-
+func NewTxBuilder(client Client, key Signer, chainID *big.Int, opts ...Option) (TxBuilder, error) {
 	if chainID == nil {
-		chainID, err = client.ChainID(context.Background())
-		if err != nil {
+		reader, ok := client.(chainIDReader)
+		if !ok {
+			return nil, errors.New("chain ID is required")
+		}
+		var err error
+		if chainID, err = reader.ChainID(context.Background()); err != nil {
 			return nil, err
 		}
 	}
 
-	txBuilder := &TxBuild{
-		client:      client,
-		privateKey:  privateKey,
-		signer:      types.NewEIP155Signer(chainID),
-		fromAddress: crypto.PubkeyToAddress(privateKey.PublicKey),
+	txBuilder := newTxBuild(client, key, types.NewLondonSigner(chainID), opts...)
+	if reader, ok := client.(FeeHistoryReader); ok && !txBuilder.opts.legacyTx && supportsDynamicFee(client) {
+		txBuilder.feeOracle = NewFeeOracle(reader, txBuilder.opts.feeBlocks, txBuilder.opts.feePercentile)
 	}
-	txBuilder.refreshNonce(context.Background())
+	txBuilder.nonces.Sync(context.Background())
+	go txBuilder.nonces.Run(context.Background())
 
 	return txBuilder, nil
 }
 
+func newTxBuild(client Client, key Signer, signer types.Signer, opts ...Option) *TxBuild {
+	o := options{gasBump: minGasBump, feeBlocks: 20, feePercentile: 50}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	b := &TxBuild{
+		client:      client,
+		key:         key,
+		signer:      signer,
+		fromAddress: key.Address(),
+		opts:        o,
+	}
+	b.nonces = NewNonceManager(client, b.fromAddress, o.stallTimeout, o.gasBump, b.sign)
+	b.nonces.maxFee = o.maxFee
+	if !o.dryRun {
+		b.nonces.locker = o.locker
+	}
+	return b
+}
+
 func (b *TxBuild) Sender() common.Address {
 	return b.fromAddress
 }
 
+// ChainID returns the ID of the chain the builder signs payouts for
+func (b *TxBuild) ChainID() *big.Int {
+	return b.signer.ChainID()
+}
+
 func (b *TxBuild) Transfer(ctx context.Context, to string, value *big.Int) (common.Hash, error) {
-	gasLimit := uint64(21000)
-	gasPrice, err := b.client.SuggestGasPrice(ctx)
+	toAddress := common.HexToAddress(to)
+	if b.opts.faucet != nil {
+		return b.drip(ctx, toAddress, value)
+	}
+	// Recipients may be contracts whose receive function needs more than 21000 gas
+	gasLimit, err := b.client.EstimateGas(ctx, ethereum.CallMsg{
+		From:  b.fromAddress,
+		To:    &toAddress,
+		Value: value,
+	})
 	if err != nil {
-		return common.Hash{}, err
+		return common.Hash{}, fmt.Errorf("payout would fail: %w", err)
 	}
+	return b.send(ctx, &toAddress, value, nil, gasLimit)
+}
 
-	toAddress := common.HexToAddress(to)
-	unsignedTx := types.NewTx(&types.LegacyTx{
-		Nonce:    b.getAndIncrementNonce(),
-		To:       &toAddress,
-		Value:    value,
-		Gas:      gasLimit,
-		GasPrice: gasPrice,
-	})
+func (b *TxBuild) send(ctx context.Context, to *common.Address, value *big.Int, data []byte, gasLimit uint64) (txHash common.Hash, err error) {
+	ctx, span := tracer.Start(ctx, "chain.send", trace.WithAttributes(
+		attribute.String("tx.from", b.fromAddress.Hex()),
+		attribute.String("tx.to", to.Hex()),
+		attribute.String("tx.value", value.String()),
+	))
+	defer func() { endSpan(span, err) }()
 
-	signedTx, err := types.SignTx(unsignedTx, b.signer, b.privateKey)
+	if b.opts.locker != nil && !b.opts.dryRun {
+		unlock, err := b.opts.locker.Lock(ctx, b.fromAddress)
+		if err != nil {
+			return common.Hash{}, err
+		}
+		defer unlock()
+		if err := b.nonces.CatchUp(ctx); err != nil {
+			return common.Hash{}, err
+		}
+	}
+
+	txData, err := b.buildTx(ctx, to, value, data, gasLimit)
 	if err != nil {
 		return common.Hash{}, err
 	}
 
+	_, signSpan := tracer.Start(ctx, "chain.sign")
+	signedTx, err := b.sign(txData)
+	endSpan(signSpan, err)
+	if err != nil {
+		if !b.opts.dryRun {
+			b.nonces.Release(types.NewTx(txData).Nonce())
+		}
+		return common.Hash{}, err
+	}
+	span.SetAttributes(attribute.Int64("tx.nonce", int64(signedTx.Nonce())), attribute.String("tx.hash", signedTx.Hash().Hex()))
+
+	if b.opts.dryRun {
+		span.SetAttributes(attribute.Bool("tx.dry_run", true))
+		return b.simulate(ctx, signedTx)
+	}
 	if err = b.client.SendTransaction(ctx, signedTx); err != nil {
-		log.Error("failed to send tx", "tx hash", signedTx.Hash().String(), "err", err)
-		if strings.Contains(err.Error(), "nonce") {
-			b.refreshNonce(context.Background())
+		log.WithError(err).WithField("txHash", signedTx.Hash()).Error("Failed to send tx")
+		// Only a nonce error says the sequence is off. Resyncing on other
+		// errors would hand out again the nonces other workers are sending
+		// with, so the nonce is given back to be taken by the next tx
+		if isNonceError(err) {
+			b.nonces.Sync(context.Background())
+		} else {
+			b.nonces.Release(signedTx.Nonce())
 		}
 		return common.Hash{}, err
 	}
+	b.nonces.Track(signedTx)
 
 	return signedTx.Hash(), nil
 }
 
-func (b *TxBuild) getAndIncrementNonce() uint64 {
-	return atomic.AddUint64(&b.nonce, 1) - 1
+func (b *TxBuild) buildTx(ctx context.Context, to *common.Address, value *big.Int, data []byte, gasLimit uint64) (types.TxData, error) {
+	if b.feeOracle != nil {
+		gasTipCap, gasFeeCap, err := b.feeOracle.SuggestFees(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if err := b.checkCost(ctx, value, gasLimit, gasFeeCap); err != nil {
+			return nil, err
+		}
+		return &types.DynamicFeeTx{
+			ChainID:   b.signer.ChainID(),
+			Nonce:     b.nextNonce(),
+			To:        to,
+			Value:     value,
+			Gas:       gasLimit,
+			GasTipCap: gasTipCap,
+			GasFeeCap: gasFeeCap,
+			Data:      data,
+		}, nil
+	}
+
+	gasPrice, err := b.client.SuggestGasPrice(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.checkCost(ctx, value, gasLimit, gasPrice); err != nil {
+		return nil, err
+	}
+	return &types.LegacyTx{
+		Nonce:    b.nextNonce(),
+		To:       to,
+		Value:    value,
+		Gas:      gasLimit,
+		GasPrice: gasPrice,
+		Data:     data,
+	}, nil
+}
+
+// checkCost refuses a payout whose fee per gas is above the cap, or that
+// the funder cannot afford at the most it may be charged. It runs before a
+// nonce is taken so that refused payouts leave no gap in the sequence
+func (b *TxBuild) checkCost(ctx context.Context, value *big.Int, gasLimit uint64, feePerGas *big.Int) error {
+	if b.opts.maxFee != nil && feePerGas.Cmp(b.opts.maxFee) > 0 {
+		return fmt.Errorf("%w: %s wei per gas asked, %s allowed", ErrFeeCapExceeded, feePerGas, b.opts.maxFee)
+	}
+
+	var balance *big.Int
+	var err error
+	if reader, ok := b.client.(pendingBalanceReader); ok {
+		balance, err = reader.PendingBalanceAt(ctx, b.fromAddress)
+	} else {
+		balance, err = b.client.BalanceAt(ctx, b.fromAddress, nil)
+	}
+	if err != nil {
+		return err
+	}
+	cost := new(big.Int).Mul(feePerGas, new(big.Int).SetUint64(gasLimit))
+	cost.Add(cost, value)
+	if balance.Cmp(cost) < 0 {
+		return fmt.Errorf("%w: %s wei needed, %s wei held", ErrInsufficientFunds, cost, balance)
+	}
+	return nil
 }
 
-func (b *TxBuild) refreshNonce(ctx context.Context) {
-	nonce, err := b.client.PendingNonceAt(ctx, b.Sender())
+// isNonceError reports whether a node rejected a tx for a nonce out of sequence
+func isNonceError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "nonce too low") || strings.Contains(msg, "nonce too high") ||
+		strings.Contains(msg, "invalid nonce") || strings.Contains(msg, "replacement transaction underpriced")
+}
+
+// nextNonce takes the next nonce of the sequence, or only looks at it on a dry run
+func (b *TxBuild) nextNonce() uint64 {
+	if b.opts.dryRun {
+		return b.nonces.Peek()
+	}
+	return b.nonces.Next()
+}
+
+// simulate executes the signed tx against the latest state, which fails like
+// the broadcast would if the funder cannot cover it or the call reverts
+func (b *TxBuild) simulate(ctx context.Context, tx *types.Transaction) (common.Hash, error) {
+	msg := ethereum.CallMsg{
+		From:      b.fromAddress,
+		To:        tx.To(),
+		GasFeeCap: tx.GasFeeCap(),
+		GasTipCap: tx.GasTipCap(),
+		Value:     tx.Value(),
+		Data:      tx.Data(),
+	}
+	if tx.Type() == types.LegacyTxType {
+		msg.GasPrice, msg.GasFeeCap, msg.GasTipCap = tx.GasPrice(), nil, nil
+	}
+	gas, err := b.client.EstimateGas(ctx, msg)
 	if err != nil {
-		log.Error("failed to refresh nonce", "address", b.Sender(), "err", err)
-		return
+		return common.Hash{}, fmt.Errorf("dry run failed: %w", err)
 	}
+	log.WithFields(log.Fields{
+		"txHash": tx.Hash(),
+		"nonce":  tx.Nonce(),
+		"to":     tx.To(),
+		"value":  tx.Value(),
+		"gas":    gas,
+	}).Info("Dry run, tx not broadcast")
+	return tx.Hash(), nil
+}
+
+func (b *TxBuild) sign(data types.TxData) (*types.Transaction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), signTimeout)
+	defer cancel()
+
+	tx := types.NewTx(data)
+	sig, err := b.key.SignHash(ctx, b.signer.Hash(tx))
+	if err != nil {
+		return nil, err
+	}
+	return tx.WithSignature(b.signer, sig)
+}
 
-	b.nonce = nonce
+func supportsDynamicFee(client Client) bool {
+	header, err := client.HeaderByNumber(context.Background(), nil)
+	return err == nil && header.BaseFee != nil
 }
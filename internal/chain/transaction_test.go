@@ -2,11 +2,13 @@ package chain
 
 import (
 	"context"
+	"errors"
 	"math/big"
 	"reflect"
 	"testing"
 
 	"github.com/agiledragon/gomonkey/v2"
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core"
@@ -29,12 +31,7 @@ func TestTxBuilder(t *testing.T) {
 	})
 	defer patches.Reset()
 
-	txBuilder := &TxBuild{
-		client:      simClient,
-		privateKey:  privateKey,
-		signer:      types.NewEIP155Signer(big.NewInt(1337)),
-		fromAddress: crypto.PubkeyToAddress(privateKey.PublicKey),
-	}
+	txBuilder := newTxBuild(simClient, NewKeySigner(privateKey), types.NewEIP155Signer(big.NewInt(1337)))
 	bgCtx := context.Background()
 	toAddress := common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
 	value := big.NewInt(1000)
@@ -60,3 +57,116 @@ func TestTxBuilder(t *testing.T) {
 		t.Errorf("expected balance for to address not received. expected: %v actual: %v", value, bal)
 	}
 }
+
+func TestTxBuilderDynamicFee(t *testing.T) {
+	privateKey, _ := crypto.HexToECDSA("976f9f7772781ff6d1c93941129d417c49a209c674056a3cf5e27e225ee55fa8")
+	fromAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
+	simClient := backends.NewSimulatedBackend(
+		core.GenesisAlloc{
+			fromAddress: {Balance: big.NewInt(10000000000000000)},
+		}, 10000000,
+	)
+	defer simClient.Close()
+
+	txBuilder := newTxBuild(simClient, NewKeySigner(privateKey), types.NewLondonSigner(big.NewInt(1337)))
+	txBuilder.feeOracle = NewFeeOracle(&mockFeeHistory{history: &ethereum.FeeHistory{
+		Reward:  [][]*big.Int{{big.NewInt(1000000000)}},
+		BaseFee: []*big.Int{big.NewInt(1000000000), big.NewInt(1000000000)},
+	}}, 1, 50)
+	bgCtx := context.Background()
+	txHash, err := txBuilder.Transfer(bgCtx, "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", big.NewInt(1000))
+	if err != nil {
+		t.Fatalf("could not add tx to pending block: %v", err)
+	}
+	simClient.Commit()
+
+	tx, _, err := simClient.TransactionByHash(bgCtx, txHash)
+	if err != nil {
+		t.Fatalf("could not get tx %v: %v", txHash, err)
+	}
+	if tx.Type() != types.DynamicFeeTxType {
+		t.Errorf("expected dynamic fee tx, got type %d", tx.Type())
+	}
+	if tx.GasFeeCap().Cmp(big.NewInt(3000000000)) != 0 {
+		t.Errorf("expected gas fee cap 3000000000, got %v", tx.GasFeeCap())
+	}
+}
+
+func TestTxBuilderDryRun(t *testing.T) {
+	privateKey, _ := crypto.HexToECDSA("976f9f7772781ff6d1c93941129d417c49a209c674056a3cf5e27e225ee55fa8")
+	fromAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
+	simClient := backends.NewSimulatedBackend(
+		core.GenesisAlloc{
+			fromAddress: {Balance: big.NewInt(10000000000000000)},
+		}, 10000000,
+	)
+	defer simClient.Close()
+
+	txBuilder := newTxBuild(simClient, NewKeySigner(privateKey), types.NewLondonSigner(big.NewInt(1337)), WithDryRun(true))
+	txBuilder.feeOracle = NewFeeOracle(&mockFeeHistory{history: &ethereum.FeeHistory{
+		Reward:  [][]*big.Int{{big.NewInt(1000000000)}},
+		BaseFee: []*big.Int{big.NewInt(1000000000), big.NewInt(1000000000)},
+	}}, 1, 50)
+	bgCtx := context.Background()
+	first, err := txBuilder.Transfer(bgCtx, "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", big.NewInt(1000))
+	if err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	second, err := txBuilder.Transfer(bgCtx, "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", big.NewInt(1000))
+	if err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	if first != second {
+		t.Errorf("dry run used up a nonce, hashes %v and %v differ", first, second)
+	}
+	simClient.Commit()
+	if _, _, err := simClient.TransactionByHash(bgCtx, first); err == nil {
+		t.Errorf("dry run tx %v was broadcast", first)
+	}
+
+	if _, err := txBuilder.Transfer(bgCtx, "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", big.NewInt(20000000000000000)); err == nil {
+		t.Error("dry run of a payout above the funder balance succeeded")
+	}
+}
+
+func TestTxBuilderPreflight(t *testing.T) {
+	privateKey, _ := crypto.HexToECDSA("976f9f7772781ff6d1c93941129d417c49a209c674056a3cf5e27e225ee55fa8")
+	fromAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
+	// Enough for the payout and 21000 gas at 2 gwei, but not at 3 gwei
+	simClient := backends.NewSimulatedBackend(
+		core.GenesisAlloc{
+			fromAddress: {Balance: big.NewInt(21000*2000000000 + 1000)},
+		}, 10000000,
+	)
+	defer simClient.Close()
+
+	feeOracle := func(baseFee int64) *FeeOracle {
+		return NewFeeOracle(&mockFeeHistory{history: &ethereum.FeeHistory{
+			Reward:  [][]*big.Int{{big.NewInt(0)}},
+			BaseFee: []*big.Int{big.NewInt(baseFee), big.NewInt(baseFee)},
+		}}, 1, 50)
+	}
+	bgCtx := context.Background()
+	to := "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"
+
+	capped := newTxBuild(simClient, NewKeySigner(privateKey), types.NewLondonSigner(big.NewInt(1337)), WithMaxFee(big.NewInt(1500000000)))
+	capped.feeOracle = feeOracle(1000000000)
+	if _, err := capped.Transfer(bgCtx, to, big.NewInt(1000)); !errors.Is(err, ErrFeeCapExceeded) {
+		t.Errorf("Transfer() above the fee cap error = %v, want %v", err, ErrFeeCapExceeded)
+	}
+
+	txBuilder := newTxBuild(simClient, NewKeySigner(privateKey), types.NewLondonSigner(big.NewInt(1337)))
+	txBuilder.feeOracle = feeOracle(1500000000)
+	nonce := txBuilder.nonces.Peek()
+	if _, err := txBuilder.Transfer(bgCtx, to, big.NewInt(1000)); !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("Transfer() beyond the balance error = %v, want %v", err, ErrInsufficientFunds)
+	}
+	if txBuilder.nonces.Peek() != nonce {
+		t.Error("refused payout used up a nonce")
+	}
+
+	txBuilder.feeOracle = feeOracle(1000000000)
+	if _, err := txBuilder.Transfer(bgCtx, to, big.NewInt(1000)); err != nil {
+		t.Errorf("Transfer() within the balance error = %v", err)
+	}
+}
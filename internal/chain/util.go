@@ -1,7 +1,9 @@
 package chain
 
 import (
+	"fmt"
 	"math/big"
+	"strings"
 
 	"github.com/ethereum/go-ethereum/common"
 )
@@ -11,6 +13,34 @@ func EtherToWei(amount int64) *big.Int {
 	return new(big.Int).Mul(big.NewInt(amount), ether)
 }
 
+// ParseEther converts a decimal amount of Ether such as "0.05" to Wei
+func ParseEther(amount string) (*big.Int, error) {
+	wei, err := ParseUnits(amount, 18)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ether amount %q", amount)
+	}
+	return wei, nil
+}
+
+// ParseUnits converts a decimal amount of a token with the given number of
+// decimals, such as "1.5" with 6 decimals, to its smallest unit
+func ParseUnits(amount string, decimals int) (*big.Int, error) {
+	r, ok := new(big.Rat).SetString(amount)
+	if !ok || r.Sign() < 0 || decimals < 0 {
+		return nil, fmt.Errorf("invalid amount %q", amount)
+	}
+	unit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+	r.Mul(r, new(big.Rat).SetInt(unit))
+	return new(big.Int).Quo(r.Num(), r.Denom()), nil
+}
+
+// FormatEther renders an amount of Wei as a decimal number of Ether
+func FormatEther(wei *big.Int) string {
+	r := new(big.Rat).SetFrac(wei, EtherToWei(1))
+	s := strings.TrimRight(r.FloatString(18), "0")
+	return strings.TrimSuffix(s, ".")
+}
+
 func Has0xPrefix(str string) bool {
 	return len(str) >= 2 && str[0] == '0' && (str[1] == 'x' || str[1] == 'X')
 }
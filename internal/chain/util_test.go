@@ -48,3 +48,48 @@ func TestEtherToWei(t *testing.T) {
 		})
 	}
 }
+
+func TestParseEther(t *testing.T) {
+	tests := []struct {
+		name    string
+		amount  string
+		want    *big.Int
+		wantErr bool
+	}{
+		{name: "integer", amount: "2", want: EtherToWei(2)},
+		{name: "fraction", amount: "0.05", want: big.NewInt(50000000000000000)},
+		{name: "below wei", amount: "0.0000000000000000001", want: big.NewInt(0)},
+		{name: "negative", amount: "-1", wantErr: true},
+		{name: "invalid", amount: "one", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseEther(tt.amount)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseEther() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got.Cmp(tt.want) != 0 {
+				t.Errorf("ParseEther() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatEther(t *testing.T) {
+	tests := []struct {
+		name string
+		wei  *big.Int
+		want string
+	}{
+		{name: "integer", wei: EtherToWei(3), want: "3"},
+		{name: "fraction", wei: big.NewInt(50000000000000000), want: "0.05"},
+		{name: "zero", wei: big.NewInt(0), want: "0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FormatEther(tt.wei); got != tt.want {
+				t.Errorf("FormatEther() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
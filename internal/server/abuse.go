@@ -0,0 +1,130 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+const eventAddressReported = "address.reported"
+
+type abuseReportRequest struct {
+	Address string `json:"address"`
+	Reason  string `json:"reason"`
+}
+
+type abuseReportResponse struct {
+	Address string                  `json:"address"`
+	Claims  []exportedClaimResponse `json:"flagged_claims"`
+}
+
+// abuseReportEventData is the payload of a report to the webhooks
+type abuseReportEventData struct {
+	Partner string                  `json:"partner"`
+	Address string                  `json:"address"`
+	Reason  string                  `json:"reason,omitempty"`
+	Claims  []exportedClaimResponse `json:"flagged_claims"`
+}
+
+// AbuseReports lets partners report addresses they caught abusing the faucet.
+// A reported address is denylisted right away and its claims within window
+// are flagged in the claim store for a clawback. Reports are emitted to the
+// webhooks and to the fraud webhooks, which receive nothing else
+type AbuseReports struct {
+	partners *ClaimTokens
+	denylist *AccessList
+	claims   *ClaimStore
+	webhooks *Webhooks
+	fraud    *Webhooks
+	window   time.Duration
+}
+
+func NewAbuseReports(partners *ClaimTokens, denylist *AccessList, claims *ClaimStore, webhooks, fraud *Webhooks, window time.Duration) *AbuseReports {
+	return &AbuseReports{
+		partners: partners,
+		denylist: denylist,
+		claims:   claims,
+		webhooks: webhooks,
+		fraud:    fraud,
+		window:   window,
+	}
+}
+
+func (a *AbuseReports) Enabled() bool {
+	return a.partners.Enabled()
+}
+
+// Run delivers reports to the fraud webhooks until ctx is done
+func (a *AbuseReports) Run(ctx context.Context) {
+	if a.fraud.Enabled() {
+		a.fraud.Run(ctx)
+	}
+}
+
+// Report denylists address and flags its recent claims on behalf of partner,
+// returning the flagged claims
+func (a *AbuseReports) Report(partner, address, reason string) ([]exportedClaimResponse, error) {
+	if err := a.denylist.Add(address); err != nil {
+		return nil, err
+	}
+	var since time.Time
+	if a.window > 0 {
+		since = time.Now().Add(-a.window)
+	}
+	flagged, err := a.claims.Flag(address, since, partner, reason)
+	if err != nil {
+		return nil, err
+	}
+
+	data := abuseReportEventData{Partner: partner, Address: address, Reason: reason, Claims: []exportedClaimResponse{}}
+	for _, claim := range flagged {
+		data.Claims = append(data.Claims, newExportedClaimResponse(claim))
+	}
+	a.webhooks.emit(eventAddressReported, data)
+	a.fraud.emit(eventAddressReported, data)
+	log.WithFields(log.Fields{
+		"partner": partner,
+		"address": address,
+		"reason":  reason,
+		"claims":  len(flagged),
+	}).Warn("Address reported for abuse")
+	return data.Claims, nil
+}
+
+// handleReport takes the abuse reports of partners authenticated with their secret
+func (a *AbuseReports) handleReport() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.NotFound(w, r)
+			return
+		}
+		partner, ok := a.partners.authenticate(r)
+		if !ok {
+			renderLocalized(w, r, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		var req abuseReportRequest
+		if err := decodeJSONBody(r, &req); err != nil {
+			renderError(w, r, err)
+			return
+		}
+		if !chain.IsValidAddress(req.Address, false) {
+			renderLocalized(w, r, http.StatusBadRequest, "invalid_address")
+			return
+		}
+		address := common.HexToAddress(req.Address).Hex()
+		flagged, err := a.Report(partner, address, req.Reason)
+		if err != nil {
+			log.WithError(err).WithField("address", address).Error("Failed to act on abuse report")
+			renderLocalized(w, r, http.StatusInternalServerError, "internal_error")
+			return
+		}
+		renderJSON(w, abuseReportResponse{Address: address, Claims: flagged}, http.StatusOK)
+	}
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+func TestAbuseReports(t *testing.T) {
+	address := "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"
+	store, _ := LoadClaimStore("", nil, 0)
+	now := time.Now()
+	store.Add(address, claimRecord{ClaimID: "recent", Amount: chain.EtherToWei(1), ClaimedAt: now.Add(-time.Hour), Status: ClaimConfirmed})
+	store.Add(address, claimRecord{ClaimID: "old", Amount: chain.EtherToWei(1), ClaimedAt: now.Add(-30 * 24 * time.Hour), Status: ClaimConfirmed})
+	path := filepath.Join(t.TempDir(), "denylist.txt")
+	denylist, _ := LoadAccessList(path)
+	fraud := NewWebhooks([]string{"http://127.0.0.1:1"}, "", nil)
+	reports := NewAbuseReports(NewClaimTokens(map[string]string{"acme": "s3cret"}), denylist, store, NewWebhooks(nil, "", nil), fraud, 7*24*time.Hour)
+
+	report := func(secret, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/api/partner/reports", strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+secret)
+		rec := httptest.NewRecorder()
+		reports.handleReport().ServeHTTP(rec, r)
+		return rec
+	}
+	if rec := report("wrong", `{"address":"`+address+`"}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("status of a report with a wrong secret = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if rec := report("s3cret", `{"address":"0x1234"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("status of a report of an invalid address = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	rec := report("s3cret", `{"address":"`+strings.ToLower(address)+`","reason":"sybil farm"}`)
+	var resp abuseReportResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if rec.Code != http.StatusOK || resp.Address != address || len(resp.Claims) != 1 || resp.Claims[0].ClaimID != "recent" {
+		t.Fatalf("report = %d %+v, want the recent claim of %s flagged", rec.Code, resp, address)
+	}
+	if !denylist.ContainsAddress(address) {
+		t.Error("reported address was not denylisted")
+	}
+	if err := denylist.Reload(); err != nil || !denylist.ContainsAddress(address) {
+		t.Errorf("reported address not kept in the denylist file across a reload, error = %v", err)
+	}
+	filter, _ := parseClaimFilter(url.Values{"reported": {"true"}})
+	reported := store.Export(filter)
+	if len(reported) != 1 || reported[0].ReportedBy != "acme" || reported[0].Report != "sybil farm" {
+		t.Errorf("reported claims = %+v, want the recent claim reported by acme", reported)
+	}
+	filter, _ = parseClaimFilter(url.Values{"reported": {"false"}})
+	if unreported := store.Export(filter); len(unreported) != 1 || unreported[0].ReportedBy != "" {
+		t.Errorf("unreported claims = %+v, want the old claim only", unreported)
+	}
+	select {
+	case event := <-fraud.endpoints[0].events:
+		data := event.Data.(abuseReportEventData)
+		if event.Type != eventAddressReported || data.Partner != "acme" || len(data.Claims) != 1 {
+			t.Errorf("fraud event = %s %+v, want a report by acme with 1 claim", event.Type, data)
+		}
+	default:
+		t.Error("no report was emitted to the fraud webhooks")
+	}
+}
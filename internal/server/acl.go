@@ -0,0 +1,249 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+const (
+	reasonDeniedAddress  = "denied_address"
+	reasonDeniedIP       = "denied_ip"
+	reasonNotAllowlisted = "not_allowlisted"
+)
+
+// AccessList holds addresses and IP ranges, optionally backed by a file with one entry per line
+type AccessList struct {
+	mutex     sync.RWMutex
+	path      string
+	addresses map[common.Address]struct{}
+	networks  map[string]*net.IPNet
+}
+
+func LoadAccessList(path string) (*AccessList, error) {
+	l := &AccessList{path: path}
+	if err := l.Reload(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Reload replaces the entries with the current content of the backing file
+func (l *AccessList) Reload() error {
+	addresses := make(map[common.Address]struct{})
+	networks := make(map[string]*net.IPNet)
+	if err := readAccessList(l.path, addresses, networks); err != nil {
+		return err
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.addresses = addresses
+	l.networks = networks
+	return nil
+}
+
+func (l *AccessList) Add(entry string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if err := l.add(entry); err != nil {
+		return err
+	}
+	return l.save()
+}
+
+func (l *AccessList) Remove(entry string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if chain.IsValidAddress(entry, false) {
+		delete(l.addresses, common.HexToAddress(entry))
+	} else if network, err := parseNetwork(entry); err == nil {
+		delete(l.networks, network.String())
+	} else {
+		return err
+	}
+	return l.save()
+}
+
+func (l *AccessList) Entries() []string {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	entries := make([]string, 0, len(l.addresses)+len(l.networks))
+	for address := range l.addresses {
+		entries = append(entries, address.Hex())
+	}
+	for network := range l.networks {
+		entries = append(entries, network)
+	}
+	sort.Strings(entries)
+	return entries
+}
+
+func (l *AccessList) Len() int {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	return len(l.addresses) + len(l.networks)
+}
+
+func (l *AccessList) ContainsAddress(address string) bool {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	_, ok := l.addresses[common.HexToAddress(address)]
+	return ok
+}
+
+func (l *AccessList) ContainsIP(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	for _, network := range l.networks {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *AccessList) add(entry string) error {
+	return addEntry(entry, l.addresses, l.networks)
+}
+
+func addEntry(entry string, addresses map[common.Address]struct{}, networks map[string]*net.IPNet) error {
+	if chain.IsValidAddress(entry, false) {
+		addresses[common.HexToAddress(entry)] = struct{}{}
+		return nil
+	}
+	network, err := parseNetwork(entry)
+	if err != nil {
+		return err
+	}
+	networks[network.String()] = network
+	return nil
+}
+
+func readAccessList(path string, addresses map[common.Address]struct{}, networks map[string]*net.IPNet) error {
+	if path == "" {
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		entry := strings.TrimSpace(scanner.Text())
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		if err := addEntry(entry, addresses, networks); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return scanner.Err()
+}
+
+func (l *AccessList) save() error {
+	if l.path == "" {
+		return nil
+	}
+
+	var sb strings.Builder
+	for address := range l.addresses {
+		sb.WriteString(address.Hex() + "\n")
+	}
+	for network := range l.networks {
+		sb.WriteString(network + "\n")
+	}
+	return os.WriteFile(l.path, []byte(sb.String()), 0644)
+}
+
+func parseNetwork(entry string) (*net.IPNet, error) {
+	if !strings.Contains(entry, "/") {
+		ip := net.ParseIP(entry)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid address or IP range %q", entry)
+		}
+		bits := 128
+		if ip.To4() != nil {
+			bits = 32
+		}
+		entry = fmt.Sprintf("%s/%d", ip, bits)
+	}
+
+	_, network, err := net.ParseCIDR(entry)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address or IP range %q", entry)
+	}
+	return network, nil
+}
+
+type AccessControl struct {
+	proxies   *Proxies
+	denylist  *AccessList
+	allowlist *AccessList
+}
+
+// NewAccessControl rejects claims matching the denylist and, when an allowlist
+// is given, every claim whose address or IP is not on it
+func NewAccessControl(proxies *Proxies, denylist, allowlist *AccessList) *AccessControl {
+	return &AccessControl{
+		proxies:   proxies,
+		denylist:  denylist,
+		allowlist: allowlist,
+	}
+}
+
+func (a *AccessControl) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	address, err := readAddress(r)
+	if err != nil {
+		// Malformed requests are reported by the limiter
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	clientIP := a.proxies.ClientIP(r)
+	var reason string
+	switch {
+	case a.denylist.ContainsAddress(address):
+		reason = reasonDeniedAddress
+	case a.denylist.ContainsIP(clientIP):
+		reason = reasonDeniedIP
+	case a.allowlist != nil && !a.allowlist.ContainsAddress(address) && !a.allowlist.ContainsIP(clientIP):
+		reason = reasonNotAllowlisted
+	}
+	if reason == "" {
+		if a.allowlist != nil {
+			r = r.WithContext(withAllowlisted(r.Context()))
+		}
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	requestLog(r.Context()).WithFields(log.Fields{
+		"address":  address,
+		"clientIP": clientIP,
+		"reason":   reason,
+	}).Warn("Claim rejected by access control")
+	flagClaim(r, reason)
+	renderLocalized(w, r, http.StatusForbidden, reason)
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAccessList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "denylist.txt")
+	content := "# known abusers\n0xab5801a7d398351b8be11c439e05c5b3259aec9b\n10.0.0.0/8\n2001:db8::1\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := LoadAccessList(path)
+	if err != nil {
+		t.Fatalf("LoadAccessList() error = %v", err)
+	}
+	tests := []struct {
+		name string
+		got  bool
+		want bool
+	}{
+		{name: "listed address", got: list.ContainsAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"), want: true},
+		{name: "unlisted address", got: list.ContainsAddress("0x0000000000000000000000000000000000000001"), want: false},
+		{name: "ip in range", got: list.ContainsIP("10.1.2.3"), want: true},
+		{name: "ip outside range", got: list.ContainsIP("192.168.1.1"), want: false},
+		{name: "listed ipv6", got: list.ContainsIP("2001:db8::1"), want: true},
+		{name: "invalid ip", got: list.ContainsIP("invalid"), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("got %v, want %v", tt.got, tt.want)
+			}
+		})
+	}
+
+	if err := list.Add("192.168.0.0/16"); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if err := list.Remove("10.0.0.0/8"); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if err := list.Add("not an entry"); err == nil {
+		t.Errorf("Add() accepted an invalid entry")
+	}
+
+	reloaded, err := LoadAccessList(path)
+	if err != nil {
+		t.Fatalf("LoadAccessList() error = %v", err)
+	}
+	want := []string{"0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", "192.168.0.0/16", "2001:db8::1/128"}
+	if got := reloaded.Entries(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Entries() = %v, want %v", got, want)
+	}
+}
+
+func TestAccessListReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "denylist.txt")
+	if err := os.WriteFile(path, []byte("10.0.0.0/8\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	list, err := LoadAccessList(path)
+	if err != nil {
+		t.Fatalf("LoadAccessList() error = %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte("not an entry\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := list.Reload(); err == nil {
+		t.Errorf("Reload() accepted an invalid entry")
+	}
+	if !list.ContainsIP("10.1.2.3") {
+		t.Errorf("failed Reload() dropped the previous entries")
+	}
+
+	if err := os.WriteFile(path, []byte("192.168.0.0/16\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := list.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	want := []string{"192.168.0.0/16"}
+	if got := list.Entries(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Entries() = %v, want %v", got, want)
+	}
+}
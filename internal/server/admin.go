@@ -0,0 +1,389 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+type accessListRequest struct {
+	Entry string `json:"entry"`
+}
+
+type accessListResponse struct {
+	Entries []string `json:"entries"`
+}
+
+type apiKeyRequest struct {
+	Name  string `json:"name"`
+	Quota int    `json:"quota"`
+}
+
+type frontendRequest struct {
+	Origin string `json:"origin"`
+	APIKey string `json:"api_key"`
+	Quota  int    `json:"quota"`
+	Amount string `json:"amount"`
+}
+
+type bypassTokenRequest struct {
+	ID      string `json:"id"`
+	Note    string `json:"note"`
+	Address string `json:"address"`
+	TTL     string `json:"ttl"`
+	Uses    int    `json:"uses"`
+}
+
+type bypassTokenResponse struct {
+	BypassToken
+	Token string `json:"token"`
+}
+
+type clusterRequest struct {
+	ID string `json:"id"`
+}
+
+type exportedClaimResponse struct {
+	ClaimID   string    `json:"claim_id"`
+	Address   string    `json:"address"`
+	Amount    string    `json:"amount"`
+	ClaimedAt time.Time `json:"claimed_at"`
+	IP        string    `json:"ip"`
+	ChainID   string    `json:"chain_id"`
+	Status    string    `json:"status"`
+	TxHash    string    `json:"tx_hash"`
+	Purpose   string    `json:"purpose,omitempty"`
+	// ReportedBy and Report tell who reported the address for abuse and why
+	ReportedBy string `json:"reported_by,omitempty"`
+	Report     string `json:"report,omitempty"`
+}
+
+type apiKeyResponse struct {
+	Name      string    `json:"name"`
+	Key       string    `json:"key,omitempty"`
+	Quota     int       `json:"quota"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func adminAuth(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		expected := []byte("Bearer " + token)
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			renderLocalized(w, r, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func renderError(w http.ResponseWriter, r *http.Request, err error) {
+	var mr *malformedRequest
+	if errors.As(err, &mr) {
+		resp := localizedResponse(w, r, mr.code, mr.args...)
+		resp.Field = mr.field
+		renderJSON(w, resp, mr.status)
+	} else {
+		renderLocalized(w, r, http.StatusInternalServerError, "internal_error")
+	}
+}
+
+func handleAccessList(list *AccessList) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			renderJSON(w, accessListResponse{Entries: list.Entries()}, http.StatusOK)
+			return
+		}
+
+		var req accessListRequest
+		if err := decodeJSONBody(r, &req); err != nil {
+			renderError(w, r, err)
+			return
+		}
+
+		var err error
+		switch r.Method {
+		case "POST":
+			err = list.Add(req.Entry)
+		case "DELETE":
+			err = list.Remove(req.Entry)
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			renderJSON(w, claimResponse{Message: err.Error()}, http.StatusBadRequest)
+			return
+		}
+		renderJSON(w, accessListResponse{Entries: list.Entries()}, http.StatusOK)
+	}
+}
+
+func handleAPIKeys(keys *APIKeys) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			list := keys.List()
+			resp := make([]apiKeyResponse, len(list))
+			for i, key := range list {
+				resp[i] = apiKeyResponse{Name: key.Name, Quota: key.Quota, CreatedAt: key.CreatedAt}
+			}
+			renderJSON(w, resp, http.StatusOK)
+			return
+		}
+
+		var req apiKeyRequest
+		if err := decodeJSONBody(r, &req); err != nil {
+			renderError(w, r, err)
+			return
+		}
+
+		switch r.Method {
+		case "POST":
+			secret, err := keys.Issue(req.Name, req.Quota)
+			if err != nil {
+				renderJSON(w, claimResponse{Message: err.Error()}, http.StatusBadRequest)
+				return
+			}
+			key, _ := keys.Lookup(secret)
+			renderJSON(w, apiKeyResponse{Name: key.Name, Key: secret, Quota: key.Quota, CreatedAt: key.CreatedAt}, http.StatusOK)
+		case "DELETE":
+			if err := keys.Revoke(req.Name); err != nil {
+				renderJSON(w, claimResponse{Message: err.Error()}, http.StatusNotFound)
+				return
+			}
+			renderJSON(w, claimResponse{Message: "api key revoked"}, http.StatusOK)
+		default:
+			http.NotFound(w, r)
+		}
+	}
+}
+
+func handleFrontends(frontends *Frontends, apiKeys *APIKeys) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			renderJSON(w, frontends.List(), http.StatusOK)
+			return
+		}
+
+		var req frontendRequest
+		if err := decodeJSONBody(r, &req); err != nil {
+			renderError(w, r, err)
+			return
+		}
+
+		switch r.Method {
+		case "POST":
+			if _, ok := apiKeys.ByName(req.APIKey); !ok && req.APIKey != "" {
+				renderJSON(w, claimResponse{Message: fmt.Sprintf("api key %q not found", req.APIKey)}, http.StatusBadRequest)
+				return
+			}
+			if err := frontends.Register(req.Origin, req.APIKey, req.Quota, req.Amount); err != nil {
+				renderJSON(w, claimResponse{Message: err.Error()}, http.StatusBadRequest)
+				return
+			}
+		case "DELETE":
+			if err := frontends.Remove(req.Origin); err != nil {
+				renderJSON(w, claimResponse{Message: err.Error()}, http.StatusNotFound)
+				return
+			}
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		renderJSON(w, frontends.List(), http.StatusOK)
+	}
+}
+
+// handleBypassTokens lists, issues and revokes bypass tokens. Issued tokens
+// are valid for one claim within an hour unless uses and ttl say otherwise
+func handleBypassTokens(exemptions *Exemptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			renderJSON(w, exemptions.Tokens(), http.StatusOK)
+			return
+		}
+
+		var req bypassTokenRequest
+		if err := decodeJSONBody(r, &req); err != nil {
+			renderError(w, r, err)
+			return
+		}
+
+		switch r.Method {
+		case "POST":
+			ttl, uses := time.Hour, 1
+			if req.TTL != "" {
+				var err error
+				if ttl, err = time.ParseDuration(req.TTL); err != nil {
+					renderJSON(w, claimResponse{Message: fmt.Sprintf("invalid ttl %q", req.TTL)}, http.StatusBadRequest)
+					return
+				}
+			}
+			if req.Uses != 0 {
+				uses = req.Uses
+			}
+			secret, token, err := exemptions.Issue(req.Note, req.Address, ttl, uses)
+			if err != nil {
+				renderJSON(w, claimResponse{Message: err.Error()}, http.StatusBadRequest)
+				return
+			}
+			log.WithFields(log.Fields{
+				"bypassToken": token.ID,
+				"note":        token.Note,
+				"address":     token.Address,
+				"uses":        token.Uses,
+				"expiresAt":   token.ExpiresAt,
+			}).Info("Bypass token issued")
+			renderJSON(w, bypassTokenResponse{BypassToken: token, Token: secret}, http.StatusOK)
+		case "DELETE":
+			if err := exemptions.Revoke(req.ID); err != nil {
+				renderJSON(w, claimResponse{Message: err.Error()}, http.StatusNotFound)
+				return
+			}
+			log.WithField("bypassToken", req.ID).Info("Bypass token revoked")
+			renderJSON(w, exemptions.Tokens(), http.StatusOK)
+		default:
+			http.NotFound(w, r)
+		}
+	}
+}
+
+// handleClusters lists the clusters of addresses found evading the limits and
+// dismisses those found in error
+func handleClusters(clustering *Clustering) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			renderJSON(w, clustering.Clusters(), http.StatusOK)
+		case "DELETE":
+			var req clusterRequest
+			if err := decodeJSONBody(r, &req); err != nil {
+				renderError(w, r, err)
+				return
+			}
+			if !clustering.Dismiss(req.ID) {
+				renderJSON(w, claimResponse{Message: fmt.Sprintf("cluster %q not found", req.ID)}, http.StatusNotFound)
+				return
+			}
+			renderJSON(w, clustering.Clusters(), http.StatusOK)
+		default:
+			http.NotFound(w, r)
+		}
+	}
+}
+
+// handleClaimsExport streams the claims kept in the claim store as CSV or a
+// JSON array, filtered by the query parameters
+func handleClaimsExport(store *ClaimStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.NotFound(w, r)
+			return
+		}
+
+		query := r.URL.Query()
+		filter, err := parseClaimFilter(query)
+		if err != nil {
+			renderJSON(w, claimResponse{Message: err.Error()}, http.StatusBadRequest)
+			return
+		}
+		format := query.Get("format")
+		if format == "" {
+			format = "json"
+		}
+		if format != "json" && format != "csv" {
+			renderJSON(w, claimResponse{Message: fmt.Sprintf("unknown export format %q", format)}, http.StatusBadRequest)
+			return
+		}
+
+		claims := store.Export(filter)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="claims.%s"`, format))
+		if format == "csv" {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			out := csv.NewWriter(w)
+			out.Write([]string{"claim_id", "address", "amount", "claimed_at", "ip", "chain_id", "status", "tx_hash", "purpose", "reported_by", "report"})
+			for _, claim := range claims {
+				resp := newExportedClaimResponse(claim)
+				out.Write([]string{resp.ClaimID, resp.Address, resp.Amount, resp.ClaimedAt.Format(time.RFC3339), resp.IP, resp.ChainID, resp.Status, resp.TxHash, resp.Purpose, resp.ReportedBy, resp.Report})
+			}
+			out.Flush()
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("["))
+		for i, claim := range claims {
+			if i > 0 {
+				w.Write([]byte(","))
+			}
+			data, _ := json.Marshal(newExportedClaimResponse(claim))
+			w.Write(data)
+		}
+		w.Write([]byte("]\n"))
+	}
+}
+
+// parseClaimFilter reads the export filter from the query, with from and to
+// given as RFC 3339 times or dates
+func parseClaimFilter(query url.Values) (claimFilter, error) {
+	filter := claimFilter{
+		Address: query.Get("address"),
+		IP:      query.Get("ip"),
+		Status:  ClaimStatus(query.Get("status")),
+		ChainID: query.Get("chain"),
+		Purpose: query.Get("purpose"),
+	}
+	if reported := query.Get("reported"); reported != "" {
+		value, err := strconv.ParseBool(reported)
+		if err != nil {
+			return filter, fmt.Errorf("invalid reported filter %q", reported)
+		}
+		filter.Reported = &value
+	}
+	// a date alone as the upper bound includes the whole of that day
+	for _, bound := range []struct {
+		name string
+		time *time.Time
+		day  time.Duration
+	}{{"from", &filter.From, 0}, {"to", &filter.To, 24 * time.Hour}} {
+		value := query.Get(bound.name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			if t, err = time.Parse("2006-01-02", value); err != nil {
+				return filter, fmt.Errorf("invalid %s time %q", bound.name, value)
+			}
+			t = t.Add(bound.day)
+		}
+		*bound.time = t
+	}
+	return filter, nil
+}
+
+func newExportedClaimResponse(claim exportedClaim) exportedClaimResponse {
+	return exportedClaimResponse{
+		ClaimID:    claim.ClaimID,
+		Address:    common.HexToAddress(claim.Address).Hex(),
+		Amount:     chain.FormatEther(claim.Amount),
+		ClaimedAt:  claim.ClaimedAt.UTC(),
+		IP:         claim.IP,
+		ChainID:    claim.ChainID,
+		Status:     string(claim.Status),
+		TxHash:     claim.TxHash,
+		Purpose:    claim.Purpose,
+		ReportedBy: claim.ReportedBy,
+		Report:     claim.Report,
+	}
+}
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	apiKeyHeader = "X-API-Key"
+	apiKeyPrefix = "fk_"
+	apiKeyWindow = 24 * time.Hour
+)
+
+// APIKey lets a client claim without captcha or sign in, up to Quota claims per day
+type APIKey struct {
+	Name      string    `json:"name"`
+	Hash      string    `json:"hash"`
+	Quota     int       `json:"quota"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type apiKeyCtxKey struct{}
+
+func withAPIKey(r *http.Request, key APIKey) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), apiKeyCtxKey{}, key))
+}
+
+// requestAPIKey returns the API key the request was authenticated with, if any
+func requestAPIKey(ctx context.Context) (APIKey, bool) {
+	key, ok := ctx.Value(apiKeyCtxKey{}).(APIKey)
+	return key, ok
+}
+
+// APIKeys holds the issued keys by the hash of their secret, optionally backed by a JSON file
+type APIKeys struct {
+	mutex sync.RWMutex
+	path  string
+	keys  map[string]APIKey
+}
+
+func LoadAPIKeys(path string) (*APIKeys, error) {
+	k := &APIKeys{path: path, keys: make(map[string]APIKey)}
+	if path == "" {
+		return k, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return k, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var keys []APIKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, key := range keys {
+		k.keys[key.Hash] = key
+	}
+	return k, nil
+}
+
+// Issue creates a key and returns its secret, which is not stored and cannot be recovered
+func (k *APIKeys) Issue(name string, quota int) (string, error) {
+	if name == "" {
+		return "", errors.New("name is required")
+	}
+	if quota <= 0 {
+		return "", errors.New("quota must be positive")
+	}
+	id, err := newRandomID()
+	if err != nil {
+		return "", err
+	}
+	secret := apiKeyPrefix + id
+
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	for _, key := range k.keys {
+		if key.Name == name {
+			return "", fmt.Errorf("api key %q already exists", name)
+		}
+	}
+	k.keys[hashAPIKey(secret)] = APIKey{Name: name, Hash: hashAPIKey(secret), Quota: quota, CreatedAt: time.Now()}
+	return secret, k.save()
+}
+
+func (k *APIKeys) Revoke(name string) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	for hash, key := range k.keys {
+		if key.Name == name {
+			delete(k.keys, hash)
+			return k.save()
+		}
+	}
+	return fmt.Errorf("api key %q not found", name)
+}
+
+// ByName returns the key issued under name
+func (k *APIKeys) ByName(name string) (APIKey, bool) {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+	for _, key := range k.keys {
+		if key.Name == name {
+			return key, true
+		}
+	}
+	return APIKey{}, false
+}
+
+func (k *APIKeys) List() []APIKey {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+	return k.list()
+}
+
+func (k *APIKeys) list() []APIKey {
+	keys := make([]APIKey, 0, len(k.keys))
+	for _, key := range k.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Name < keys[j].Name })
+	return keys
+}
+
+func (k *APIKeys) Lookup(secret string) (APIKey, bool) {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+	key, ok := k.keys[hashAPIKey(secret)]
+	return key, ok
+}
+
+// ServeHTTP authenticates requests carrying an API key, requests without one pass through unchanged
+func (k *APIKeys) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	secret := r.Header.Get(apiKeyHeader)
+	if secret == "" {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	key, ok := k.Lookup(secret)
+	if !ok {
+		renderLocalized(w, r, http.StatusUnauthorized, "invalid_api_key")
+		return
+	}
+	next.ServeHTTP(w, withAPIKey(r, key))
+}
+
+func (k *APIKeys) save() error {
+	if k.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(k.list(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(k.path, data, 0600)
+}
+
+func hashAPIKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
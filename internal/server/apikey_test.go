@@ -0,0 +1,80 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/urfave/negroni"
+)
+
+func TestAPIKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "apikeys.json")
+	keys, err := LoadAPIKeys(path)
+	if err != nil {
+		t.Fatalf("LoadAPIKeys() error = %v", err)
+	}
+	secret, err := keys.Issue("ci", 5)
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	if _, err := keys.Issue("ci", 5); err == nil {
+		t.Errorf("Issue() accepted a duplicate name")
+	}
+	if _, err := keys.Issue("zero", 0); err == nil {
+		t.Errorf("Issue() accepted a zero quota")
+	}
+
+	reloaded, err := LoadAPIKeys(path)
+	if err != nil {
+		t.Fatalf("LoadAPIKeys() error = %v", err)
+	}
+	if key, ok := reloaded.Lookup(secret); !ok || key.Name != "ci" || key.Quota != 5 {
+		t.Errorf("Lookup() = %+v, %v", key, ok)
+	}
+	if _, ok := reloaded.Lookup("fk_unknown"); ok {
+		t.Errorf("Lookup() found an unknown key")
+	}
+
+	if err := reloaded.Revoke("ci"); err != nil {
+		t.Fatalf("Revoke() error = %v", err)
+	}
+	if _, ok := reloaded.Lookup(secret); ok {
+		t.Errorf("Lookup() found a revoked key")
+	}
+}
+
+func TestAPIKeyQuota(t *testing.T) {
+	keys, _ := LoadAPIKeys("")
+	secret, _ := keys.Issue("ci", 2)
+	limiter := NewLimiter(nil, time.Hour, 0, 0, 0)
+	handler := negroni.New(keys, limiter, negroni.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	tests := []struct {
+		name string
+		key  string
+		want int
+	}{
+		{name: "first keyed claim", key: secret, want: http.StatusOK},
+		{name: "keyed claims skip the address cooldown", key: secret, want: http.StatusOK},
+		{name: "quota used up", key: secret, want: http.StatusTooManyRequests},
+		{name: "invalid key", key: "fk_invalid", want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := bytes.NewBufferString(`{"address":"0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"}`)
+			req := httptest.NewRequest("POST", "/api/claim", body)
+			req.Header.Set(apiKeyHeader, tt.key)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+type balanceReader interface {
+	BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error)
+}
+
+// BalanceMonitor polls the combined balance of the funder accounts, refuses claims
+// once it falls below the minimum and raises an alert the first time it drops under each limit
+type BalanceMonitor struct {
+	mutex      sync.RWMutex
+	client     balanceReader
+	accounts   []common.Address
+	symbol     string
+	interval   time.Duration
+	minBalance *big.Int
+	limits     []*big.Int
+	alerted    []bool
+	notifier   Notifier
+	balance    *big.Int
+}
+
+func NewBalanceMonitor(client balanceReader, accounts []common.Address, symbol string, interval time.Duration, minBalance *big.Int, limits []*big.Int, notifier Notifier) *BalanceMonitor {
+	sort.Slice(limits, func(i, j int) bool { return limits[i].Cmp(limits[j]) > 0 })
+	return &BalanceMonitor{
+		client:     client,
+		accounts:   accounts,
+		symbol:     symbol,
+		interval:   interval,
+		minBalance: minBalance,
+		limits:     limits,
+		alerted:    make([]bool, len(limits)),
+		notifier:   notifier,
+	}
+}
+
+func (m *BalanceMonitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		m.poll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Balance returns the last polled balance, or nil if it has not been fetched yet
+func (m *BalanceMonitor) Balance() *big.Int {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.balance
+}
+
+func (m *BalanceMonitor) Empty() bool {
+	balance := m.Balance()
+	return balance != nil && balance.Cmp(m.minBalance) < 0
+}
+
+func (m *BalanceMonitor) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	if m.Empty() {
+		renderLocalized(w, r, http.StatusServiceUnavailable, "faucet_empty")
+		return
+	}
+	next.ServeHTTP(w, r)
+}
+
+func (m *BalanceMonitor) poll(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	balance := new(big.Int)
+	for _, account := range m.accounts {
+		accountBalance, err := m.client.BalanceAt(ctx, account, nil)
+		if err != nil {
+			log.WithError(err).WithField("account", account).Error("Failed to fetch faucet balance")
+			return
+		}
+		balance.Add(balance, accountBalance)
+	}
+
+	m.mutex.Lock()
+	m.balance = balance
+	var crossed *big.Int
+	for i, limit := range m.limits {
+		if balance.Cmp(limit) >= 0 {
+			// Rearm the alert once the faucet has been refilled
+			m.alerted[i] = false
+		} else if !m.alerted[i] {
+			m.alerted[i] = true
+			crossed = limit
+		}
+	}
+	m.mutex.Unlock()
+
+	if crossed == nil {
+		return
+	}
+	funder := m.accounts[0].Hex()
+	if len(m.accounts) > 1 {
+		funder = fmt.Sprintf("%d funder accounts", len(m.accounts))
+	}
+	message := fmt.Sprintf("Faucet %s balance is %s %s, below the alert limit of %s %s",
+		funder, chain.FormatEther(balance), m.symbol, chain.FormatEther(crossed), m.symbol)
+	log.WithField("balance", balance).Warn(message)
+	if err := m.notifier.Notify(ctx, message); err != nil {
+		log.WithError(err).Error("Failed to send low balance alert")
+	}
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+type recordingNotifier struct {
+	messages []string
+}
+
+func (n *recordingNotifier) Notify(_ context.Context, message string) error {
+	n.messages = append(n.messages, message)
+	return nil
+}
+
+func TestBalanceMonitor(t *testing.T) {
+	account := common.HexToAddress("0x0000000000000000000000000000000000000001")
+	simClient := backends.NewSimulatedBackend(
+		core.GenesisAlloc{
+			account: {Balance: chain.EtherToWei(5)},
+		}, 10000000,
+	)
+	defer simClient.Close()
+
+	notifier := &recordingNotifier{}
+	limits := []*big.Int{chain.EtherToWei(1), chain.EtherToWei(10), chain.EtherToWei(20)}
+	monitor := NewBalanceMonitor(simClient, []common.Address{account}, "ETH", time.Minute, chain.EtherToWei(6), limits, notifier)
+	if monitor.Empty() {
+		t.Errorf("Empty() = true before the first poll")
+	}
+
+	monitor.poll(context.Background())
+	monitor.poll(context.Background())
+	if got := monitor.Balance(); got.Cmp(chain.EtherToWei(5)) != 0 {
+		t.Errorf("Balance() = %v, want %v", got, chain.EtherToWei(5))
+	}
+	if !monitor.Empty() {
+		t.Errorf("Empty() = false with balance below the minimum")
+	}
+	if len(notifier.messages) != 1 {
+		t.Fatalf("expected 1 alert, got %d", len(notifier.messages))
+	}
+	want := "Faucet 0x0000000000000000000000000000000000000001 balance is 5 ETH, below the alert limit of 10 ETH"
+	if notifier.messages[0] != want {
+		t.Errorf("alert = %q, want %q", notifier.messages[0], want)
+	}
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+)
+
+// budgetExhausted is returned when a claim would exceed the payouts allowed
+// by the global budget, or by the budget of purpose if set, until resetAt
+type budgetExhausted struct {
+	resetAt time.Time
+	purpose string
+}
+
+func (e *budgetExhausted) Error() string {
+	if e.purpose != "" {
+		return fmt.Sprintf("payout budget of %s exhausted until %s", e.purpose, e.resetAt.UTC().Format(time.RFC3339))
+	}
+	return fmt.Sprintf("payout budget exhausted until %s", e.resetAt.UTC().Format(time.RFC3339))
+}
+
+// budgetWindow counts the payouts of the current period, which starts on the
+// hour or at midnight UTC and resets with the next one
+type budgetWindow struct {
+	period    time.Duration
+	maxClaims int
+	maxAmount *big.Int
+	start     time.Time
+	claims    int
+	amount    *big.Int
+}
+
+func (w *budgetWindow) enabled() bool {
+	return w.maxClaims > 0 || w.maxAmount != nil
+}
+
+func (w *budgetWindow) roll(now time.Time) {
+	if start := now.Truncate(w.period); !start.Equal(w.start) {
+		w.start = start
+		w.claims = 0
+		w.amount = new(big.Int)
+	}
+}
+
+func (w *budgetWindow) fits(amount *big.Int) bool {
+	if w.maxClaims > 0 && w.claims >= w.maxClaims {
+		return false
+	}
+	if w.maxAmount != nil && new(big.Int).Add(w.amount, amount).Cmp(w.maxAmount) > 0 {
+		return false
+	}
+	return true
+}
+
+// Budget bounds the total number and amount of payouts per hour and per day
+// across all claimants, limiting the damage when the sybil defenses fail
+type Budget struct {
+	mutex   sync.Mutex
+	windows []*budgetWindow
+}
+
+func NewBudget(hourlyClaims int, hourlyAmount *big.Int, dailyClaims int, dailyAmount *big.Int) *Budget {
+	b := &Budget{}
+	for _, w := range []*budgetWindow{
+		{period: time.Hour, maxClaims: hourlyClaims, maxAmount: hourlyAmount},
+		{period: 24 * time.Hour, maxClaims: dailyClaims, maxAmount: dailyAmount},
+	} {
+		if w.enabled() {
+			b.windows = append(b.windows, w)
+		}
+	}
+	return b
+}
+
+func (b *Budget) Enabled() bool {
+	return len(b.windows) > 0
+}
+
+// Reserve counts a payout of amount against every window, or returns a
+// *budgetExhausted if any of them has no room left for it. The returned
+// time identifies the reservation to Release
+func (b *Budget) Reserve(amount *big.Int) (time.Time, error) {
+	now := time.Now()
+	if !b.Enabled() {
+		return now, nil
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	var exhausted *budgetExhausted
+	for _, w := range b.windows {
+		w.roll(now)
+		if !w.fits(amount) {
+			resetAt := w.start.Add(w.period)
+			if exhausted == nil || resetAt.After(exhausted.resetAt) {
+				exhausted = &budgetExhausted{resetAt: resetAt}
+			}
+		}
+	}
+	if exhausted != nil {
+		return now, exhausted
+	}
+	for _, w := range b.windows {
+		w.claims++
+		w.amount.Add(w.amount, amount)
+	}
+	return now, nil
+}
+
+// Release undoes a reservation whose claim could not be queued or whose
+// payout failed. Windows that have reset since the reservation are left alone
+func (b *Budget) Release(amount *big.Int, reservedAt time.Time) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for _, w := range b.windows {
+		if reservedAt.Before(w.start) {
+			continue
+		}
+		w.claims--
+		w.amount.Sub(w.amount, amount)
+	}
+}
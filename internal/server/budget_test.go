@@ -0,0 +1,53 @@
+package server
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestBudget(t *testing.T) {
+	budget := NewBudget(3, big.NewInt(10), 0, big.NewInt(100))
+
+	var reservations []time.Time
+	for i := 0; i < 2; i++ {
+		reservedAt, err := budget.Reserve(big.NewInt(4))
+		if err != nil {
+			t.Fatalf("reserve %d: %v", i, err)
+		}
+		reservations = append(reservations, reservedAt)
+	}
+	_, err := budget.Reserve(big.NewInt(4))
+	var exhausted *budgetExhausted
+	if !errors.As(err, &exhausted) {
+		t.Fatalf("err = %v, want budget exhausted by the hourly amount", err)
+	}
+	if wait := time.Until(exhausted.resetAt); wait <= 0 || wait > time.Hour {
+		t.Errorf("reset in %s, want within the hour", wait)
+	}
+	if _, err := budget.Reserve(big.NewInt(2)); err != nil {
+		t.Errorf("reserve within the amount left: %v", err)
+	}
+	if _, err := budget.Reserve(big.NewInt(0)); err == nil {
+		t.Error("reserve beyond the hourly claims succeeded")
+	}
+
+	budget.Release(big.NewInt(4), reservations[0])
+	if _, err := budget.Reserve(big.NewInt(4)); err != nil {
+		t.Errorf("reserve after release: %v", err)
+	}
+
+	// A new hour resets the hourly window but not the daily one
+	for _, w := range budget.windows {
+		if w.period == time.Hour {
+			w.start = w.start.Add(-time.Hour)
+		}
+	}
+	if _, err := budget.Reserve(big.NewInt(10)); err != nil {
+		t.Errorf("reserve in the next hour: %v", err)
+	}
+	if claims := budget.windows[1].claims; claims != 4 {
+		t.Errorf("daily claims = %d, want 4", claims)
+	}
+}
@@ -0,0 +1,360 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/negroni"
+)
+
+const (
+	// CanaryLog only logs and counts the claims a policy would reject
+	CanaryLog = "log"
+	// CanaryEnforce rejects the claims a policy rejects
+	CanaryEnforce = "enforce"
+
+	PolicyLimiter     = "limiter"
+	PolicyRisk        = "risk"
+	PolicyEligibility = "eligibility"
+)
+
+// PolicySpec is a candidate anti-abuse rule rolled out to Percent of the
+// claims in Mode. Kind picks the rule and the fields that configure it
+type PolicySpec struct {
+	Name    string  `json:"name"`
+	Version string  `json:"version"`
+	Kind    string  `json:"kind"`
+	Percent float64 `json:"percent"`
+	Mode    string  `json:"mode"`
+	// Minutes, Claims, LimitMode and SubnetMinutes configure a limiter
+	Minutes       int    `json:"minutes,omitempty"`
+	Claims        int    `json:"claims,omitempty"`
+	LimitMode     string `json:"limit_mode,omitempty"`
+	SubnetMinutes int    `json:"subnet_minutes,omitempty"`
+	// CaptchaScore and DenyScore configure a risk engine
+	CaptchaScore int `json:"captcha_score,omitempty"`
+	DenyScore    int `json:"deny_score,omitempty"`
+	// MinScore configures the eligibility threshold of the reputation scorer
+	MinScore float64 `json:"min_score,omitempty"`
+}
+
+func (p PolicySpec) id() string {
+	return p.Name + "@" + p.Version
+}
+
+// rule returns the spec without its rollout, to tell whether a reloaded
+// spec still describes the same rule
+func (p PolicySpec) rule() PolicySpec {
+	p.Percent, p.Mode = 0, ""
+	return p
+}
+
+func (p PolicySpec) validate() error {
+	switch {
+	case p.Name == "" || p.Version == "":
+		return errors.New("canary policies need a name and a version")
+	case p.Percent < 0 || p.Percent > 100:
+		return fmt.Errorf("policy %s: percent must be between 0 and 100", p.id())
+	case p.Mode != CanaryLog && p.Mode != CanaryEnforce:
+		return fmt.Errorf("policy %s: mode must be log or enforce", p.id())
+	}
+	switch p.Kind {
+	case PolicyLimiter:
+		if p.Minutes <= 0 && p.SubnetMinutes <= 0 {
+			return fmt.Errorf("policy %s: a limiter needs minutes or subnet_minutes", p.id())
+		}
+		if p.Claims < 0 || (p.LimitMode != "" && p.LimitMode != LimitFixed && p.LimitMode != LimitSliding && p.LimitMode != LimitBucket) {
+			return fmt.Errorf("policy %s: invalid limit mode or claims", p.id())
+		}
+	case PolicyRisk:
+		if p.CaptchaScore <= 0 && p.DenyScore <= 0 {
+			return fmt.Errorf("policy %s: a risk policy needs a captcha_score or deny_score", p.id())
+		}
+	case PolicyEligibility:
+		if p.MinScore <= 0 {
+			return fmt.Errorf("policy %s: an eligibility policy needs a min_score", p.id())
+		}
+	default:
+		return fmt.Errorf("policy %s: kind must be limiter, risk or eligibility", p.id())
+	}
+	return nil
+}
+
+// canaryKey marks the context a policy runs in log mode in, so that the log
+// lines of the policy are not mistaken for those of an enforced one
+type canaryKey struct{}
+
+func requestCanary(ctx context.Context) (string, bool) {
+	policy, ok := ctx.Value(canaryKey{}).(string)
+	return policy, ok
+}
+
+// canaryPolicy is a candidate rule along with its counts
+type canaryPolicy struct {
+	mutex   sync.RWMutex
+	spec    PolicySpec
+	handler negroni.Handler
+
+	sampled    uint64
+	challenged uint64
+	rejections counterVec
+}
+
+func (p *canaryPolicy) current() PolicySpec {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.spec
+}
+
+// applies reports whether the claim to address falls within the rollout. The
+// hash of the address keeps a claimant in or out as the percentage grows
+func (p *canaryPolicy) applies(spec PolicySpec, address string) bool {
+	h := fnv.New32a()
+	h.Write([]byte(spec.id() + ":" + strings.ToLower(address)))
+	return float64(h.Sum32()%10000) < spec.Percent*100
+}
+
+func (p *canaryPolicy) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	spec := p.current()
+	address, _ := readAddress(r)
+	if !p.applies(spec, address) {
+		next.ServeHTTP(w, r)
+		return
+	}
+	atomic.AddUint64(&p.sampled, 1)
+
+	// In log mode the policy answers into a buffer, and neither its rejection
+	// nor its flags reach the stats and webhooks. Claims it lets through are
+	// served as usual, and their status is passed on for it to roll back
+	// what it counted of those that failed
+	shadow := negroni.NewResponseWriter(newBufferedResponse())
+	passed := false
+	pass := func(_ http.ResponseWriter, policyReq *http.Request) {
+		passed = true
+		if strictCaptcha(policyReq.Context()) && !strictCaptcha(r.Context()) {
+			atomic.AddUint64(&p.challenged, 1)
+		}
+		if spec.Mode == CanaryEnforce {
+			next.ServeHTTP(w, policyReq)
+			return
+		}
+		next.ServeHTTP(w, r)
+		status := http.StatusOK
+		if rw, ok := w.(negroni.ResponseWriter); ok && rw.Status() != 0 {
+			status = rw.Status()
+		}
+		shadow.WriteHeader(status)
+	}
+	if spec.Mode == CanaryEnforce {
+		p.handler.ServeHTTP(w, r, pass)
+		if !passed {
+			code := "unknown"
+			if rejected, ok := r.Context().Value(rejectionKey{}).(*rejection); ok && rejected.code != "" {
+				code = rejected.code
+			}
+			p.rejections.Inc(code)
+		}
+		return
+	}
+
+	rejected := &rejection{}
+	ctx := context.WithValue(r.Context(), canaryKey{}, spec.id())
+	ctx = context.WithValue(ctx, rejectionKey{}, rejected)
+	ctx = context.WithValue(ctx, flagsKey{}, &claimFlags{})
+	p.handler.ServeHTTP(shadow, r.WithContext(ctx), pass)
+	if passed {
+		return
+	}
+	code := rejected.code
+	if code == "" {
+		code = "unknown"
+	}
+	p.rejections.Inc(code)
+	requestLog(ctx).WithFields(log.Fields{
+		"address": address,
+		"code":    code,
+	}).Info("Canary policy would have rejected claim")
+	next.ServeHTTP(w, r)
+}
+
+// CanaryPolicies rolls candidate limiter, risk and eligibility rules out to a
+// percentage of the claims, either only logging and counting the claims they
+// would reject or rejecting them, so that their false positives can be
+// measured before they apply to everyone. The policies are read from a JSON
+// file, reloaded on SIGHUP, and keep their state across reloads as long as
+// only their percent and mode change
+type CanaryPolicies struct {
+	mutex    sync.RWMutex
+	path     string
+	build    func(PolicySpec) (negroni.Handler, error)
+	policies []*canaryPolicy
+}
+
+// LoadCanaryPolicies reads the policies in path, which may be empty for
+// none, and builds their rules with build
+func LoadCanaryPolicies(path string, build func(PolicySpec) (negroni.Handler, error)) (*CanaryPolicies, error) {
+	c := &CanaryPolicies{path: path, build: build}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *CanaryPolicies) Enabled() bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return len(c.policies) > 0
+}
+
+// Reload reads the policies again, carrying the state and counts of those
+// whose rule did not change over
+func (c *CanaryPolicies) Reload() error {
+	if c.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		return err
+	}
+	var specs []PolicySpec
+	if err := json.Unmarshal(data, &specs); err != nil {
+		return fmt.Errorf("%s: %w", c.path, err)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	existing := make(map[string]*canaryPolicy)
+	for _, p := range c.policies {
+		existing[p.spec.id()] = p
+	}
+	seen := make(map[string]bool)
+	var policies []*canaryPolicy
+	for _, spec := range specs {
+		if err := spec.validate(); err != nil {
+			return err
+		}
+		if seen[spec.id()] {
+			return fmt.Errorf("duplicate policy %s", spec.id())
+		}
+		seen[spec.id()] = true
+		if p, ok := existing[spec.id()]; ok && p.current().rule() == spec.rule() {
+			p.mutex.Lock()
+			p.spec = spec
+			p.mutex.Unlock()
+			policies = append(policies, p)
+			continue
+		}
+		handler, err := c.build(spec)
+		if err != nil {
+			return fmt.Errorf("policy %s: %w", spec.id(), err)
+		}
+		policies = append(policies, &canaryPolicy{spec: spec, handler: handler})
+	}
+	c.policies = policies
+	return nil
+}
+
+func (c *CanaryPolicies) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	c.mutex.RLock()
+	policies := c.policies
+	c.mutex.RUnlock()
+	serveCanaries(policies, w, r, next)
+}
+
+func serveCanaries(policies []*canaryPolicy, w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	if len(policies) == 0 {
+		next.ServeHTTP(w, r)
+		return
+	}
+	policies[0].ServeHTTP(w, r, func(w http.ResponseWriter, r *http.Request) {
+		serveCanaries(policies[1:], w, r, next)
+	})
+}
+
+type canaryPolicyResponse struct {
+	PolicySpec
+	Sampled    uint64         `json:"sampled"`
+	Challenged uint64         `json:"challenged"`
+	Rejections map[string]int `json:"rejections"`
+}
+
+// Policies returns the policies with their counts since they were loaded
+func (c *CanaryPolicies) Policies() []canaryPolicyResponse {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	resp := make([]canaryPolicyResponse, 0, len(c.policies))
+	for _, p := range c.policies {
+		policy := canaryPolicyResponse{
+			PolicySpec: p.current(),
+			Sampled:    atomic.LoadUint64(&p.sampled),
+			Challenged: atomic.LoadUint64(&p.challenged),
+			Rejections: make(map[string]int),
+		}
+		p.rejections.mutex.Lock()
+		for code, count := range p.rejections.counts {
+			policy.Rejections[code] = int(count)
+		}
+		p.rejections.mutex.Unlock()
+		resp = append(resp, policy)
+	}
+	return resp
+}
+
+func (c *CanaryPolicies) writeMetrics(w io.Writer) {
+	policies := c.Policies()
+	if len(policies) == 0 {
+		return
+	}
+	labels := func(p canaryPolicyResponse) string {
+		return fmt.Sprintf("policy=%q,version=%q", p.Name, p.Version)
+	}
+	fmt.Fprint(w, "# HELP faucet_policy_rollout_percent Percentage of claims a canary policy applies to\n# TYPE faucet_policy_rollout_percent gauge\n")
+	for _, p := range policies {
+		fmt.Fprintf(w, "faucet_policy_rollout_percent{%s} %g\n", labels(p), p.Percent)
+	}
+	fmt.Fprint(w, "# HELP faucet_policy_enforced Whether a canary policy rejects claims rather than only logging them\n# TYPE faucet_policy_enforced gauge\n")
+	for _, p := range policies {
+		fmt.Fprintf(w, "faucet_policy_enforced{%s} %g\n", labels(p), boolGauge(p.Mode == CanaryEnforce))
+	}
+	fmt.Fprint(w, "# HELP faucet_policy_claims_total Claims a canary policy applied to\n# TYPE faucet_policy_claims_total counter\n")
+	for _, p := range policies {
+		fmt.Fprintf(w, "faucet_policy_claims_total{%s} %d\n", labels(p), p.Sampled)
+	}
+	fmt.Fprint(w, "# HELP faucet_policy_challenges_total Claims a canary policy required a captcha for\n# TYPE faucet_policy_challenges_total counter\n")
+	for _, p := range policies {
+		fmt.Fprintf(w, "faucet_policy_challenges_total{%s} %d\n", labels(p), p.Challenged)
+	}
+	fmt.Fprint(w, "# HELP faucet_policy_rejections_total Claims a canary policy rejected, or would have in log mode, by error code\n# TYPE faucet_policy_rejections_total counter\n")
+	for _, p := range policies {
+		codes := make([]string, 0, len(p.Rejections))
+		for code := range p.Rejections {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes)
+		for _, code := range codes {
+			fmt.Fprintf(w, "faucet_policy_rejections_total{%s,code=%q} %d\n", labels(p), code, p.Rejections[code])
+		}
+	}
+}
+
+// handlePolicies lists the canary policies with their counts
+func (c *CanaryPolicies) handlePolicies() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.NotFound(w, r)
+			return
+		}
+		renderJSON(w, c.Policies(), http.StatusOK)
+	}
+}
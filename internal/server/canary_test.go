@@ -0,0 +1,109 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/urfave/negroni"
+)
+
+func TestCanaryPolicies(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policies.json")
+	writePolicies := func(mode string, percent int) {
+		policies := fmt.Sprintf(`[{"name":"hourly","version":"v2","kind":"limiter","minutes":60,"mode":%q,"percent":%d}]`, mode, percent)
+		if err := os.WriteFile(path, []byte(policies), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	builds := 0
+	writePolicies(CanaryLog, 100)
+	canaries, err := LoadCanaryPolicies(path, func(spec PolicySpec) (negroni.Handler, error) {
+		builds++
+		return NewLimiter(nil, time.Duration(spec.Minutes)*time.Minute, 0, 0, 0), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := negroni.New(canaries, negroni.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+	claim := func() (int, string) {
+		body := bytes.NewBufferString(`{"address":"0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"}`)
+		rejected := &rejection{}
+		req := httptest.NewRequest("POST", "/api/claim", body)
+		req = req.WithContext(context.WithValue(req.Context(), rejectionKey{}, rejected))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code, rejected.code
+	}
+
+	for i := 0; i < 2; i++ {
+		if code, rejected := claim(); code != http.StatusOK || rejected != "" {
+			t.Fatalf("claim %d in log mode = %d %q, want %d without a rejection", i, code, rejected, http.StatusOK)
+		}
+	}
+	writePolicies(CanaryEnforce, 100)
+	if err := canaries.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if code, rejected := claim(); code != http.StatusTooManyRequests || rejected == "" {
+		t.Errorf("claim in enforce mode = %d %q, want %d with a rejection", code, rejected, http.StatusTooManyRequests)
+	}
+	if builds != 1 {
+		t.Errorf("policy built %d times, want its limiter kept when only the mode changes", builds)
+	}
+	writePolicies(CanaryEnforce, 0)
+	if err := canaries.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := claim(); code != http.StatusOK {
+		t.Errorf("claim outside the rollout = %d, want %d", code, http.StatusOK)
+	}
+
+	policies := canaries.Policies()
+	if len(policies) != 1 || policies[0].Sampled != 3 || policies[0].Rejections["rate_limited"] != 2 {
+		t.Fatalf("policies = %+v, want 3 sampled claims and 2 rate_limited rejections", policies)
+	}
+	var metrics bytes.Buffer
+	canaries.writeMetrics(&metrics)
+	for _, want := range []string{
+		`faucet_policy_claims_total{policy="hourly",version="v2"} 3`,
+		`faucet_policy_rejections_total{policy="hourly",version="v2",code="rate_limited"} 2`,
+		`faucet_policy_enforced{policy="hourly",version="v2"} 1`,
+		`faucet_policy_rollout_percent{policy="hourly",version="v2"} 0`,
+	} {
+		if !strings.Contains(metrics.String(), want) {
+			t.Errorf("metrics = %s, want %s", metrics.String(), want)
+		}
+	}
+}
+
+func TestCanaryPolicySampling(t *testing.T) {
+	p := &canaryPolicy{}
+	spec := PolicySpec{Name: "risk", Version: "v1", Percent: 25}
+	sampled := 0
+	for i := 0; i < 1000; i++ {
+		address := fmt.Sprintf("0x%040x", i*7919)
+		if p.applies(spec, address) {
+			sampled++
+			if !p.applies(spec, strings.ToUpper(address)) {
+				t.Fatalf("%s sampled but not in another case", address)
+			}
+		}
+	}
+	if sampled < 150 || sampled > 350 {
+		t.Errorf("%d of 1000 claims sampled at 25%%, want about 250", sampled)
+	}
+	spec.Percent = 0
+	if p.applies(spec, "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B") {
+		t.Error("claim sampled at 0%")
+	}
+}
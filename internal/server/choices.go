@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+type cooldownWeightKey struct{}
+
+// requestCooldownWeight returns the factor the cooldowns of the claim are
+// multiplied by, 1 unless it picked a larger payout
+func requestCooldownWeight(ctx context.Context) float64 {
+	if weight, ok := ctx.Value(cooldownWeightKey{}).(float64); ok && weight > 1 {
+		return weight
+	}
+	return 1
+}
+
+// PayoutChoices lets claims pick their base payout among fixed amounts, which
+// the payout policy scales its tiers and fiat payout to. The smallest amount is
+// subject to the configured cooldowns and API key quotas, larger ones to
+// cooldowns longer and quota use larger in proportion to their amount
+type PayoutChoices struct {
+	amounts []*big.Int
+}
+
+func ParsePayoutChoices(values []string) (*PayoutChoices, error) {
+	c := &PayoutChoices{}
+	for _, value := range values {
+		amount, err := chain.ParseEther(value)
+		if err != nil || amount.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid payout choice %q", value)
+		}
+		c.amounts = append(c.amounts, amount)
+	}
+	sort.Slice(c.amounts, func(i, j int) bool { return c.amounts[i].Cmp(c.amounts[j]) < 0 })
+	return c, nil
+}
+
+func (c *PayoutChoices) Enabled() bool {
+	return c != nil && len(c.amounts) > 0
+}
+
+// Amounts returns the choices in Ethers, smallest first
+func (c *PayoutChoices) Amounts() []string {
+	if !c.Enabled() {
+		return nil
+	}
+	amounts := make([]string, len(c.amounts))
+	for i, amount := range c.amounts {
+		amounts[i] = chain.FormatEther(amount)
+	}
+	return amounts
+}
+
+// choose returns the choice equal to value in Ethers, or the smallest one if
+// value is empty, along with the weight of its cooldowns
+func (c *PayoutChoices) choose(value string) (*big.Int, float64, bool) {
+	if value == "" {
+		return c.amounts[0], 1, true
+	}
+	amount, err := chain.ParseEther(value)
+	if err != nil {
+		return nil, 0, false
+	}
+	for _, choice := range c.amounts {
+		if choice.Cmp(amount) == 0 {
+			weight, _ := new(big.Rat).SetFrac(choice, c.amounts[0]).Float64()
+			return choice, weight, true
+		}
+	}
+	return nil, 0, false
+}
+
+// ServeHTTP bases the payout of the claim on the amount it picked and weighs
+// the cooldowns the limiter applies to it. Claims whose base payout a frontend
+// fixed keep it
+func (c *PayoutChoices) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	if !c.Enabled() || payoutBase(r.Context()) != nil {
+		next.ServeHTTP(w, r)
+		return
+	}
+	var claimReq claimRequest
+	if err := decodeJSONBody(r, &claimReq); err != nil {
+		renderError(w, r, err)
+		return
+	}
+	amount, weight, ok := c.choose(claimReq.Amount)
+	if !ok {
+		renderLocalized(w, r, http.StatusBadRequest, "invalid_amount", strings.Join(c.Amounts(), ", "))
+		return
+	}
+	ctx := withPayoutBase(r.Context(), amount)
+	next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, cooldownWeightKey{}, weight)))
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/urfave/negroni"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+func TestPayoutChoices(t *testing.T) {
+	if _, err := ParsePayoutChoices([]string{"0.1", "-1"}); err == nil {
+		t.Error("ParsePayoutChoices() accepted a negative amount")
+	}
+	choices, err := ParsePayoutChoices([]string{"1", "0.1", "0.5"})
+	if err != nil {
+		t.Fatalf("ParsePayoutChoices() error = %v", err)
+	}
+	if got := strings.Join(choices.Amounts(), ","); got != "0.1,0.5,1" {
+		t.Errorf("Amounts() = %s, want 0.1,0.5,1", got)
+	}
+
+	var paid string
+	limiter := NewLimiter(nil, time.Hour, 0, 0, 0)
+	handler := negroni.New(choices, limiter, negroni.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paid = chain.FormatEther(payoutBase(r.Context()))
+		w.WriteHeader(http.StatusOK)
+	})))
+	claim := func(address, amount, ip string) *httptest.ResponseRecorder {
+		body := `{"address":"` + address + `"}`
+		if amount != "" {
+			body = `{"address":"` + address + `","amount":"` + amount + `"}`
+		}
+		r := httptest.NewRequest("POST", "/api/claim", strings.NewReader(body))
+		r.RemoteAddr = ip + ":1234"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec
+	}
+
+	if rec := claim("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", "0.3", "10.0.0.1"); rec.Code != http.StatusBadRequest {
+		t.Errorf("status of a claim of another amount = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if rec := claim("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", "", "10.0.0.1"); rec.Code != http.StatusOK || paid != "0.1" {
+		t.Errorf("claim without an amount = %d paying %s, want %d paying 0.1", rec.Code, paid, http.StatusOK)
+	}
+	if rec := claim("0x0000000000000000000000000000000000000001", "1.0", "10.0.0.2"); rec.Code != http.StatusOK || paid != "1" {
+		t.Errorf("claim of 1 = %d paying %s, want %d paying 1", rec.Code, paid, http.StatusOK)
+	}
+
+	// The cooldown of the largest payout is ten times the configured one
+	if rec := claim("0x0000000000000000000000000000000000000001", "", "10.0.0.3"); rec.Header().Get("Retry-After") != "36000" {
+		t.Errorf("Retry-After after a claim of 1 = %q, want 36000", rec.Header().Get("Retry-After"))
+	}
+	if rec := claim("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", "", "10.0.0.4"); rec.Header().Get("Retry-After") != "3600" {
+		t.Errorf("Retry-After after a claim of 0.1 = %q, want 3600", rec.Header().Get("Retry-After"))
+	}
+
+	// API key claims use up the quota in proportion to the payout too
+	keys, _ := LoadAPIKeys("")
+	secret, _ := keys.Issue("ci", 12)
+	handler = negroni.New(keys, choices, limiter, negroni.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+	keyClaim := func(amount string) *httptest.ResponseRecorder {
+		body := `{"address":"0x0000000000000000000000000000000000000002","amount":"` + amount + `"}`
+		r := httptest.NewRequest("POST", "/api/claim", strings.NewReader(body))
+		r.Header.Set(apiKeyHeader, secret)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec
+	}
+	if rec := keyClaim("1"); rec.Code != http.StatusOK || rec.Header().Get("RateLimit-Remaining") != "2" {
+		t.Errorf("api key claim of 1 = %d with %s remaining, want %d with 2", rec.Code, rec.Header().Get("RateLimit-Remaining"), http.StatusOK)
+	}
+	if rec := keyClaim("0.5"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("api key claim of 0.5 over the quota = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if rec := keyClaim("0.1"); rec.Code != http.StatusOK {
+		t.Errorf("api key claim of 0.1 within the quota = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
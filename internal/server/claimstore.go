@@ -0,0 +1,340 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var errClaimCapReached = errors.New("claim cap reached")
+
+type claimRecord struct {
+	Amount    *big.Int    `json:"amount"`
+	ClaimedAt time.Time   `json:"claimed_at"`
+	ClaimID   string      `json:"claim_id,omitempty"`
+	IP        string      `json:"ip,omitempty"`
+	ChainID   string      `json:"chain_id,omitempty"`
+	Status    ClaimStatus `json:"status,omitempty"`
+	TxHash    string      `json:"tx_hash,omitempty"`
+	Purpose   string      `json:"purpose,omitempty"`
+	// ReportedBy names the partner that reported the address for abuse
+	// after the claim, Report being the reason given, so that the payout
+	// can be clawed back
+	ReportedBy string `json:"reported_by,omitempty"`
+	Report     string `json:"report,omitempty"`
+}
+
+type clientIPKey struct{}
+
+// withClientIP records the IP a claim was made from in its claim record
+func withClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+func requestClientIP(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	return ip
+}
+
+// ClaimStore keeps the claims paid to every address, optionally backed by a JSON file.
+// Claims older than retention are pruned, a zero retention keeps them forever
+type ClaimStore struct {
+	mutex     sync.Mutex
+	path      string
+	key       []byte
+	retention time.Duration
+	records   map[string][]claimRecord
+}
+
+func LoadClaimStore(path string, key []byte, retention time.Duration) (*ClaimStore, error) {
+	c := &ClaimStore{path: path, key: key, retention: retention, records: make(map[string][]claimRecord)}
+	if path == "" {
+		return c, nil
+	}
+
+	data, err := readState(path, key)
+	if err != nil {
+		return nil, err
+	} else if data == nil {
+		return c, nil
+	}
+	if err := json.Unmarshal(data, &c.records); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	c.prune()
+	return c, nil
+}
+
+// Persistent reports whether claims survive a restart
+func (c *ClaimStore) Persistent() bool {
+	return c.path != ""
+}
+
+// History returns the claims of address that are still retained
+func (c *ClaimStore) History(address string) []claimRecord {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return append([]claimRecord(nil), c.records[strings.ToLower(address)]...)
+}
+
+func (c *ClaimStore) Add(address string, record claimRecord) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	key := strings.ToLower(address)
+	c.records[key] = append(c.records[key], record)
+	c.prune()
+	return c.save()
+}
+
+// Remove drops the claim of address made at the given time
+func (c *ClaimStore) Remove(address string, claimedAt time.Time) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	key := strings.ToLower(address)
+	records := c.records[key]
+	for i, record := range records {
+		if record.ClaimedAt.Equal(claimedAt) {
+			c.records[key] = append(records[:i:i], records[i+1:]...)
+			break
+		}
+	}
+	if len(c.records[key]) == 0 {
+		delete(c.records, key)
+	}
+	return c.save()
+}
+
+// Update applies fn to the claim of address made at the given time
+func (c *ClaimStore) Update(address string, claimedAt time.Time, fn func(*claimRecord)) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	records := c.records[strings.ToLower(address)]
+	for i := range records {
+		if records[i].ClaimedAt.Equal(claimedAt) {
+			fn(&records[i])
+			return c.save()
+		}
+	}
+	return nil
+}
+
+// ClaimFinished records the final status and transaction of a claim
+func (c *ClaimStore) ClaimFinished(claim Claim) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	records := c.records[strings.ToLower(claim.Address)]
+	for i := len(records) - 1; i >= 0; i-- {
+		if records[i].ClaimID != claim.ID {
+			continue
+		}
+		records[i].Status = claim.Status
+		if claim.Status != ClaimFailed {
+			records[i].TxHash = claim.TxHash.Hex()
+		}
+		// The queue is locked while claims finish, so the file is written after
+		go func() {
+			c.mutex.Lock()
+			defer c.mutex.Unlock()
+			if err := c.save(); err != nil {
+				log.WithError(err).Error("Failed to save claim status")
+			}
+		}()
+		return
+	}
+}
+
+// Flag marks the claims of address made since the given time as reported for
+// abuse by partner and returns them
+func (c *ClaimStore) Flag(address string, since time.Time, partner, reason string) ([]exportedClaim, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	key := strings.ToLower(address)
+	var flagged []exportedClaim
+	for i, record := range c.records[key] {
+		if record.ClaimedAt.Before(since) {
+			continue
+		}
+		c.records[key][i].ReportedBy = partner
+		c.records[key][i].Report = reason
+		flagged = append(flagged, exportedClaim{Address: key, claimRecord: c.records[key][i]})
+	}
+	if len(flagged) == 0 {
+		return nil, nil
+	}
+	return flagged, c.save()
+}
+
+// claimFilter selects the claims to export, zero fields match every claim.
+// Reported selects the reported claims if true and the others if false
+type claimFilter struct {
+	From     time.Time
+	To       time.Time
+	Address  string
+	IP       string
+	Status   ClaimStatus
+	ChainID  string
+	Purpose  string
+	Reported *bool
+}
+
+func (f claimFilter) match(address string, record claimRecord) bool {
+	switch {
+	case !f.From.IsZero() && record.ClaimedAt.Before(f.From):
+		return false
+	case !f.To.IsZero() && !record.ClaimedAt.Before(f.To):
+		return false
+	case f.Address != "" && !strings.EqualFold(f.Address, address):
+		return false
+	case f.IP != "" && f.IP != record.IP:
+		return false
+	case f.Status != "" && f.Status != record.Status:
+		return false
+	case f.ChainID != "" && f.ChainID != record.ChainID:
+		return false
+	case f.Purpose != "" && f.Purpose != record.Purpose:
+		return false
+	case f.Reported != nil && *f.Reported != (record.ReportedBy != ""):
+		return false
+	}
+	return true
+}
+
+// exportedClaim is a claim record along with the address it was paid to
+type exportedClaim struct {
+	Address string
+	claimRecord
+}
+
+// Export returns the retained claims matching filter, oldest first
+func (c *ClaimStore) Export(filter claimFilter) []exportedClaim {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var claims []exportedClaim
+	for address, records := range c.records {
+		for _, record := range records {
+			if filter.match(address, record) {
+				claims = append(claims, exportedClaim{Address: address, claimRecord: record})
+			}
+		}
+	}
+	sort.Slice(claims, func(i, j int) bool {
+		return claims[i].ClaimedAt.Before(claims[j].ClaimedAt)
+	})
+	return claims
+}
+
+func (c *ClaimStore) prune() {
+	if c.retention <= 0 {
+		return
+	}
+	cutoff := time.Now().Add(-c.retention)
+	for address, records := range c.records {
+		kept := records[:0]
+		for _, record := range records {
+			if record.ClaimedAt.After(cutoff) {
+				kept = append(kept, record)
+			}
+		}
+		if len(kept) == 0 {
+			delete(c.records, address)
+		} else {
+			c.records[address] = kept
+		}
+	}
+}
+
+func (c *ClaimStore) save() error {
+	if c.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(c.records)
+	if err != nil {
+		return err
+	}
+	return writeState(c.path, c.key, data)
+}
+
+// Allowance is what an address may still claim, nil fields are unlimited
+type Allowance struct {
+	Claims *int
+	Amount *big.Int
+}
+
+// ClaimCap limits the number of claims and the total amount paid to an address
+// within period, or over its lifetime if period is zero
+type ClaimCap struct {
+	mutex     sync.Mutex
+	store     *ClaimStore
+	maxClaims int
+	maxAmount *big.Int
+	period    time.Duration
+}
+
+func NewClaimCap(store *ClaimStore, maxClaims int, maxAmount *big.Int, period time.Duration) *ClaimCap {
+	return &ClaimCap{store: store, maxClaims: maxClaims, maxAmount: maxAmount, period: period}
+}
+
+func (c *ClaimCap) Enabled() bool {
+	return c.maxClaims > 0 || c.maxAmount != nil
+}
+
+// Reserve records a claim of amount, reduced to the amount left in the allowance
+// of address, and returns the record with the allowance left after it
+func (c *ClaimCap) Reserve(address string, amount *big.Int) (claimRecord, *Allowance, error) {
+	record := claimRecord{Amount: amount, ClaimedAt: time.Now()}
+	if !c.Enabled() && !c.store.Persistent() {
+		return record, nil, nil
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	claims, total := 0, new(big.Int)
+	for _, r := range c.store.History(address) {
+		if r.Status == ClaimFailed {
+			continue
+		}
+		if c.period <= 0 || time.Since(r.ClaimedAt) < c.period {
+			claims++
+			total.Add(total, r.Amount)
+		}
+	}
+
+	var allowance *Allowance
+	if c.Enabled() {
+		allowance = &Allowance{}
+		if c.maxClaims > 0 {
+			if claims >= c.maxClaims {
+				return record, nil, errClaimCapReached
+			}
+			left := c.maxClaims - claims - 1
+			allowance.Claims = &left
+		}
+		if c.maxAmount != nil {
+			left := new(big.Int).Sub(c.maxAmount, total)
+			if left.Sign() <= 0 {
+				return record, nil, errClaimCapReached
+			}
+			if left.Cmp(amount) < 0 {
+				record.Amount = new(big.Int).Set(left)
+			}
+			allowance.Amount = left.Sub(left, record.Amount)
+		}
+	}
+	return record, allowance, c.store.Add(address, record)
+}
+
+// Release undoes a reservation whose claim could not be queued
+func (c *ClaimCap) Release(address string, record claimRecord) error {
+	if !c.Enabled() && !c.store.Persistent() {
+		return nil
+	}
+	return c.store.Remove(address, record.ClaimedAt)
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestClaimCap(t *testing.T) {
+	address := "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"
+	tests := []struct {
+		name       string
+		maxClaims  int
+		maxAmount  int64
+		wantAmount []int64
+		wantClaims []int
+	}{
+		{name: "claims", maxClaims: 2, wantAmount: []int64{3, 3}, wantClaims: []int{1, 0}},
+		{name: "amount", maxAmount: 5, wantAmount: []int64{3, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "claims.json")
+			store, err := LoadClaimStore(path, nil, 0)
+			if err != nil {
+				t.Fatalf("LoadClaimStore() error = %v", err)
+			}
+			var maxAmount *big.Int
+			if tt.maxAmount > 0 {
+				maxAmount = big.NewInt(tt.maxAmount)
+			}
+			claimCap := NewClaimCap(store, tt.maxClaims, maxAmount, 0)
+
+			for i, want := range tt.wantAmount {
+				record, allowance, err := claimCap.Reserve(address, big.NewInt(3))
+				if err != nil {
+					t.Fatalf("Reserve() error = %v", err)
+				}
+				if record.Amount.Int64() != want {
+					t.Errorf("Reserve() amount = %s, want %d", record.Amount, want)
+				}
+				if tt.wantClaims != nil && *allowance.Claims != tt.wantClaims[i] {
+					t.Errorf("Reserve() claims left = %d, want %d", *allowance.Claims, tt.wantClaims[i])
+				}
+			}
+
+			reloaded, err := LoadClaimStore(path, nil, 0)
+			if err != nil {
+				t.Fatalf("LoadClaimStore() error = %v", err)
+			}
+			if _, _, err := NewClaimCap(reloaded, tt.maxClaims, maxAmount, 0).Reserve(address, big.NewInt(3)); !errors.Is(err, errClaimCapReached) {
+				t.Errorf("Reserve() after restart error = %v, want %v", err, errClaimCapReached)
+			}
+		})
+	}
+}
+
+func TestClaimCapFailedPayout(t *testing.T) {
+	address := "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"
+	store, _ := LoadClaimStore("", nil, 0)
+	claimCap := NewClaimCap(store, 1, nil, 0)
+	record, _, err := claimCap.Reserve(address, big.NewInt(1))
+	if err != nil {
+		t.Fatalf("Reserve() error = %v", err)
+	}
+	if _, _, err := claimCap.Reserve(address, big.NewInt(1)); !errors.Is(err, errClaimCapReached) {
+		t.Fatalf("Reserve() over the cap error = %v, want %v", err, errClaimCapReached)
+	}
+	store.Update(address, record.ClaimedAt, func(r *claimRecord) {
+		r.Status = ClaimFailed
+	})
+	if _, _, err := claimCap.Reserve(address, big.NewInt(1)); err != nil {
+		t.Errorf("Reserve() after a failed payout error = %v, want the claim to not count", err)
+	}
+	if history := store.History(address); len(history) != 2 {
+		t.Errorf("history has %d claims, want the failed claim kept", len(history))
+	}
+}
+
+func TestClaimCapPeriod(t *testing.T) {
+	address := "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"
+	store, _ := LoadClaimStore("", nil, time.Hour)
+	store.Add(address, claimRecord{Amount: big.NewInt(1), ClaimedAt: time.Now().Add(-2 * time.Hour)})
+	claimCap := NewClaimCap(store, 1, nil, time.Hour)
+
+	record, _, err := claimCap.Reserve(address, big.NewInt(1))
+	if err != nil {
+		t.Fatalf("Reserve() error = %v, want claims outside the period to be ignored", err)
+	}
+	if _, _, err := claimCap.Reserve(address, big.NewInt(1)); !errors.Is(err, errClaimCapReached) {
+		t.Errorf("Reserve() error = %v, want %v", err, errClaimCapReached)
+	}
+
+	claimCap.Release(address, record)
+	if _, _, err := claimCap.Reserve(address, big.NewInt(1)); err != nil {
+		t.Errorf("Reserve() after Release() error = %v", err)
+	}
+}
+
+func TestClaimsExport(t *testing.T) {
+	store, err := LoadClaimStore("", nil, 0)
+	if err != nil {
+		t.Fatalf("LoadClaimStore() error = %v", err)
+	}
+	day := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	claims := []struct {
+		address string
+		ip      string
+		at      time.Time
+	}{
+		{"0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", "10.0.0.1", day},
+		{"0x0000000000000000000000000000000000000001", "10.0.0.2", day.Add(time.Hour)},
+		{"0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", "10.0.0.1", day.Add(48 * time.Hour)},
+	}
+	for i, c := range claims {
+		store.Add(c.address, claimRecord{Amount: big.NewInt(1e18), ClaimedAt: c.at})
+		store.Update(c.address, c.at, func(r *claimRecord) {
+			r.ClaimID, r.IP, r.ChainID, r.Status = strconv.Itoa(i), c.ip, "122", ClaimQueued
+		})
+	}
+	store.ClaimFinished(Claim{ID: "0", Address: claims[0].address, Status: ClaimConfirmed, TxHash: common.HexToHash("0x01")})
+
+	export := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handleClaimsExport(store).ServeHTTP(rec, httptest.NewRequest("GET", "/admin/claims/export?"+query, nil))
+		return rec
+	}
+
+	rec := export("from=2024-03-01&to=2024-03-01&address=0xab5801a7d398351b8be11c439e05c5b3259aec9b&format=csv")
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("read csv: %v", err)
+	}
+	if len(rows) != 2 || rows[1][0] != "0" || rows[1][1] != claims[0].address || rows[1][2] != "1" || rows[1][6] != "confirmed" {
+		t.Errorf("csv export = %v, want the first claim", rows)
+	}
+
+	var resp []exportedClaimResponse
+	if err := json.NewDecoder(export("ip=10.0.0.1&status=queued&chain=122").Body).Decode(&resp); err != nil {
+		t.Fatalf("decode json: %v", err)
+	}
+	if len(resp) != 1 || resp[0].ClaimID != "2" || !resp[0].ClaimedAt.Equal(claims[2].at) {
+		t.Errorf("json export = %+v, want the last claim", resp)
+	}
+
+	for query, want := range map[string]int{"to=2024-03-01": 2, "to=2024-03-01T13:00:00Z": 1, "from=2024-03-02": 1} {
+		var resp []exportedClaimResponse
+		if err := json.NewDecoder(export(query).Body).Decode(&resp); err != nil {
+			t.Fatalf("decode json: %v", err)
+		}
+		if len(resp) != want {
+			t.Errorf("export of %s = %d claims, want %d", query, len(resp), want)
+		}
+	}
+
+	if rec := export("from=yesterday"); rec.Code != http.StatusBadRequest {
+		t.Errorf("status of invalid time = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,270 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jellydator/ttlcache/v2"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/negroni"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+const (
+	claimTokenHeader     = "X-Claim-Token"
+	defaultClaimTokenTTL = 15 * time.Minute
+	maxClaimTokenTTL     = 24 * time.Hour
+)
+
+var (
+	errClaimTokenInvalid = errors.New("invalid claim token")
+	errClaimTokenUsed    = errors.New("claim token already used")
+)
+
+// claimToken is the signed content of a claim token
+type claimToken struct {
+	Partner string `json:"p"`
+	Address string `json:"a"`
+	Expiry  int64  `json:"e"`
+	Nonce   string `json:"n"`
+}
+
+type claimTokenRequest struct {
+	Address string `json:"address"`
+	TTL     string `json:"ttl"`
+}
+
+type claimTokenResponse struct {
+	Token     string    `json:"token"`
+	Address   string    `json:"address"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type partnerKey struct{}
+
+// requestPartner returns the partner whose claim token authorized the claim made with ctx, if any
+func requestPartner(ctx context.Context) (string, bool) {
+	partner, ok := ctx.Value(partnerKey{}).(string)
+	return partner, ok
+}
+
+// ParsePartnerSecrets reads the shared secrets of partner services given as name=secret
+func ParsePartnerSecrets(entries []string) (map[string]string, error) {
+	secrets := make(map[string]string)
+	for _, entry := range entries {
+		i := strings.Index(entry, "=")
+		if i <= 0 || i == len(entry)-1 {
+			return nil, errors.New("partner secrets must be given as name=secret")
+		}
+		name := strings.TrimSpace(entry[:i])
+		if _, ok := secrets[name]; ok {
+			return nil, fmt.Errorf("duplicate partner %q", name)
+		}
+		secrets[name] = entry[i+1:]
+	}
+	return secrets, nil
+}
+
+// ClaimTokens lets trusted partner services, e.g. an onboarding backend that
+// verified its users, mint one-time tokens that stand in for the captcha of a
+// claim to a given address until they expire. Tokens are signed with the secret
+// of the partner, and the used ones are remembered in memory until they expire
+type ClaimTokens struct {
+	mutex   sync.Mutex
+	secrets map[string][]byte
+	used    *ttlcache.Cache
+}
+
+func NewClaimTokens(secrets map[string]string) *ClaimTokens {
+	used := ttlcache.NewCache()
+	used.SkipTTLExtensionOnHit(true)
+	c := &ClaimTokens{secrets: make(map[string][]byte), used: used}
+	for name, secret := range secrets {
+		c.secrets[name] = []byte(secret)
+	}
+	return c
+}
+
+func (c *ClaimTokens) Enabled() bool {
+	return len(c.secrets) > 0
+}
+
+// authenticate returns the partner whose secret the request carries as bearer token
+func (c *ClaimTokens) authenticate(r *http.Request) (string, bool) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return "", false
+	}
+	given := []byte(strings.TrimPrefix(auth, "Bearer "))
+	names := make([]string, 0, len(c.secrets))
+	for name := range c.secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	partner, found := "", false
+	for _, name := range names {
+		if subtle.ConstantTimeCompare(given, c.secrets[name]) == 1 {
+			partner, found = name, true
+		}
+	}
+	return partner, found
+}
+
+// Mint returns a token for one claim to address by partner within ttl
+func (c *ClaimTokens) Mint(partner, address string, ttl time.Duration) (string, time.Time, error) {
+	secret, ok := c.secrets[partner]
+	if !ok {
+		return "", time.Time{}, fmt.Errorf("unknown partner %q", partner)
+	}
+	if !chain.IsValidAddress(address, true) {
+		return "", time.Time{}, fmt.Errorf("invalid address %q", address)
+	}
+	if ttl <= 0 || ttl > maxClaimTokenTTL {
+		return "", time.Time{}, fmt.Errorf("ttl must be positive and at most %s", maxClaimTokenTTL)
+	}
+	nonce, err := newRandomID()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expiresAt := time.Now().Add(ttl).Truncate(time.Second)
+	payload, err := json.Marshal(claimToken{Partner: partner, Address: strings.ToLower(address), Expiry: expiresAt.Unix(), Nonce: nonce})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	encoding := base64.RawURLEncoding
+	return encoding.EncodeToString(payload) + "." + encoding.EncodeToString(signClaimToken(secret, payload)), expiresAt, nil
+}
+
+// use verifies a token for a claim to address and marks it used
+func (c *ClaimTokens) use(token, address string) (claimToken, error) {
+	var claim claimToken
+	i := strings.Index(token, ".")
+	if i < 0 {
+		return claim, errClaimTokenInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(token[:i])
+	if err != nil {
+		return claim, errClaimTokenInvalid
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(token[i+1:])
+	if err != nil {
+		return claim, errClaimTokenInvalid
+	}
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&claim); err != nil {
+		return claim, errClaimTokenInvalid
+	}
+	secret, ok := c.secrets[claim.Partner]
+	if !ok || !hmac.Equal(mac, signClaimToken(secret, payload)) {
+		return claim, errClaimTokenInvalid
+	}
+	ttl := time.Until(time.Unix(claim.Expiry, 0))
+	if ttl <= 0 || !strings.EqualFold(claim.Address, address) {
+		return claim, errClaimTokenInvalid
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, err := c.used.Get(claim.Nonce); err == nil {
+		return claim, errClaimTokenUsed
+	}
+	c.used.SetWithTTL(claim.Nonce, true, ttl)
+	return claim, nil
+}
+
+// release lets a token whose claim did not go through be used again
+func (c *ClaimTokens) release(claim claimToken) {
+	c.used.Remove(claim.Nonce)
+}
+
+func signClaimToken(secret, payload []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+func (c *ClaimTokens) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	token := r.Header.Get(claimTokenHeader)
+	if token == "" || !c.Enabled() {
+		next.ServeHTTP(w, r)
+		return
+	}
+	address, err := readAddress(r)
+	if err != nil {
+		// Malformed requests are reported by the limiter
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	claim, err := c.use(token, address)
+	if err != nil {
+		code := "invalid_claim_token"
+		if errors.Is(err, errClaimTokenUsed) {
+			code = "claim_token_used"
+		}
+		requestLog(r.Context()).WithFields(log.Fields{
+			"address": address,
+			"partner": claim.Partner,
+		}).Warn("Claim rejected with an invalid claim token")
+		renderLocalized(w, r, http.StatusUnauthorized, code)
+		return
+	}
+	next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), partnerKey{}, claim.Partner)))
+	if w.(negroni.ResponseWriter).Status() != http.StatusOK {
+		c.release(claim)
+	}
+}
+
+// handleMint mints claim tokens for partners authenticated with their secret
+func (c *ClaimTokens) handleMint() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.NotFound(w, r)
+			return
+		}
+		partner, ok := c.authenticate(r)
+		if !ok {
+			renderLocalized(w, r, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		var req claimTokenRequest
+		if err := decodeJSONBody(r, &req); err != nil {
+			renderError(w, r, err)
+			return
+		}
+		ttl := defaultClaimTokenTTL
+		if req.TTL != "" {
+			var err error
+			if ttl, err = time.ParseDuration(req.TTL); err != nil {
+				renderJSON(w, claimResponse{Message: fmt.Sprintf("invalid ttl %q", req.TTL)}, http.StatusBadRequest)
+				return
+			}
+		}
+		token, expiresAt, err := c.Mint(partner, req.Address, ttl)
+		if err != nil {
+			renderJSON(w, claimResponse{Message: err.Error()}, http.StatusBadRequest)
+			return
+		}
+		log.WithFields(log.Fields{
+			"partner":   partner,
+			"address":   req.Address,
+			"expiresAt": expiresAt,
+		}).Info("Claim token minted")
+		renderJSON(w, claimTokenResponse{Token: token, Address: req.Address, ExpiresAt: expiresAt}, http.StatusOK)
+	}
+}
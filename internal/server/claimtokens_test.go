@@ -0,0 +1,96 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/urfave/negroni"
+)
+
+func TestParsePartnerSecrets(t *testing.T) {
+	secrets, err := ParsePartnerSecrets([]string{"onboarding=s3cr=t", "quests=abc"})
+	if err != nil || secrets["onboarding"] != "s3cr=t" || secrets["quests"] != "abc" {
+		t.Errorf("ParsePartnerSecrets() = %v, %v", secrets, err)
+	}
+	for _, entries := range [][]string{{"onboarding"}, {"=abc"}, {"onboarding="}, {"a=1", "a=2"}} {
+		if _, err := ParsePartnerSecrets(entries); err == nil {
+			t.Errorf("ParsePartnerSecrets(%v) accepted invalid secrets", entries)
+		}
+	}
+}
+
+func TestClaimTokens(t *testing.T) {
+	tokens := NewClaimTokens(map[string]string{"onboarding": "s3cret", "quests": "0ther"})
+	mint := func(secret, body string) (*httptest.ResponseRecorder, claimTokenResponse) {
+		req := httptest.NewRequest("POST", "/api/partner/tokens", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+secret)
+		rec := httptest.NewRecorder()
+		tokens.handleMint().ServeHTTP(rec, req)
+		var resp claimTokenResponse
+		json.NewDecoder(rec.Body).Decode(&resp)
+		return rec, resp
+	}
+	if rec, _ := mint("wrong", `{"address":"0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("status of mint with a wrong secret = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if rec, _ := mint("s3cret", `{"address":"0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B","ttl":"48h"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("status of mint with a too long ttl = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	rec, minted := mint("s3cret", `{"address":"0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"}`)
+	if rec.Code != http.StatusOK || minted.Token == "" || time.Until(minted.ExpiresAt) > defaultClaimTokenTTL {
+		t.Fatalf("mint = %d %+v", rec.Code, minted)
+	}
+
+	var partner string
+	fail := false
+	handler := negroni.New(tokens, negroni.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		partner, _ = requestPartner(r.Context())
+		if fail {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})))
+	claim := func(address, token string) int {
+		partner = ""
+		req := httptest.NewRequest("POST", "/api/claim", bytes.NewBufferString(`{"address":"`+address+`"}`))
+		req.Header.Set(claimTokenHeader, token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := claim("0x0000000000000000000000000000000000000001", minted.Token); code != http.StatusUnauthorized {
+		t.Errorf("status of token for another address = %d, want %d", code, http.StatusUnauthorized)
+	}
+	fail = true
+	claim("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", minted.Token)
+	fail = false
+	if code := claim("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", minted.Token); code != http.StatusOK || partner != "onboarding" {
+		t.Errorf("claim with token = %d by %q, want %d by onboarding", code, partner, http.StatusOK)
+	}
+	if code := claim("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", minted.Token); code != http.StatusUnauthorized {
+		t.Errorf("status of replayed token = %d, want %d", code, http.StatusUnauthorized)
+	}
+
+	// A token whose payload was altered, or signed with the secret of another partner, is rejected
+	_, other := mint("0ther", `{"address":"0x0000000000000000000000000000000000000002"}`)
+	mintedParts, otherParts := strings.Split(minted.Token, "."), strings.Split(other.Token, ".")
+	for name, token := range map[string]string{
+		"altered": otherParts[0] + "." + mintedParts[1],
+		"swapped": mintedParts[0] + "." + otherParts[1],
+		"garbage": "not-a-token",
+	} {
+		if code := claim("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", token); code != http.StatusUnauthorized {
+			t.Errorf("status of %s token = %d, want %d", name, code, http.StatusUnauthorized)
+		}
+	}
+	if code := claim("0x0000000000000000000000000000000000000003", ""); code != http.StatusOK || partner != "" {
+		t.Errorf("claim without token = %d by %q, want %d by no partner", code, partner, http.StatusOK)
+	}
+}
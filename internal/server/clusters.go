@@ -0,0 +1,409 @@
+package server
+
+import (
+	"context"
+	"math/big"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+const (
+	// ClusterCooldown rejects the claims of a cluster until its cooldown ends
+	ClusterCooldown = "cooldown"
+	// ClusterDeny adds the members of a cluster to the denylist
+	ClusterDeny = "deny"
+)
+
+const (
+	clusterIP    = "ip"
+	clusterSweep = "sweep"
+
+	// maxScanBlocks caps the blocks scanned for sweeps in one run
+	maxScanBlocks = 500
+	// maxFreshNonce is the most transactions a throwaway address sends, the sweep
+	maxFreshNonce = 1
+)
+
+// Cluster is a group of addresses found to be claimed by the same party,
+// either from one IP or swept to one address. Key is that IP or address
+type Cluster struct {
+	ID         string    `json:"id"`
+	Kind       string    `json:"kind"`
+	Key        string    `json:"key"`
+	Addresses  []string  `json:"addresses"`
+	IPs        []string  `json:"ips"`
+	DetectedAt time.Time `json:"detected_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	Until      time.Time `json:"until,omitempty"`
+}
+
+type clusterReader interface {
+	NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error)
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+}
+
+type sweep struct {
+	to common.Address
+	at time.Time
+}
+
+// Clustering looks through the claims of the last window for addresses
+// claimed by the same party to evade the limits: size or more fresh addresses
+// claimed from one IP, or size or more claimed addresses that swept their funds
+// to one address. Sweeps are only found if the client can fetch blocks. The
+// members of a cluster are put on cooldown or added to the denylist
+type Clustering struct {
+	mutex     sync.Mutex
+	claims    *ClaimStore
+	client    clusterReader
+	proxies   *Proxies
+	denylist  *AccessList
+	faucet    map[common.Address]bool
+	interval  time.Duration
+	window    time.Duration
+	size      int
+	action    string
+	cooldown  time.Duration
+	clusters  map[string]*Cluster
+	dismissed map[string]time.Time
+	cooldowns map[string]time.Time
+	sweeps    map[common.Address]sweep
+	nextBlock *big.Int
+}
+
+// NewClustering checks the claims every interval. Transfers to the faucet
+// accounts are not taken for sweeps
+func NewClustering(claims *ClaimStore, client clusterReader, proxies *Proxies, denylist *AccessList, faucet []common.Address,
+	interval, window time.Duration, size int, action string, cooldown time.Duration) *Clustering {
+	c := &Clustering{
+		claims:    claims,
+		client:    client,
+		proxies:   proxies,
+		denylist:  denylist,
+		faucet:    make(map[common.Address]bool),
+		interval:  interval,
+		window:    window,
+		size:      size,
+		action:    action,
+		cooldown:  cooldown,
+		clusters:  make(map[string]*Cluster),
+		dismissed: make(map[string]time.Time),
+		cooldowns: make(map[string]time.Time),
+		sweeps:    make(map[common.Address]sweep),
+	}
+	for _, account := range faucet {
+		c.faucet[account] = true
+	}
+	return c
+}
+
+func (c *Clustering) Enabled() bool {
+	return c.interval > 0
+}
+
+func (c *Clustering) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.check(ctx)
+		}
+	}
+}
+
+func (c *Clustering) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	address, err := readAddress(r)
+	if !c.Enabled() || err != nil {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	clientIP := c.proxies.ClientIP(r)
+	if !c.coolingDown(address) && !c.coolingDown(clientIP) {
+		next.ServeHTTP(w, r)
+		return
+	}
+	requestLog(r.Context()).WithFields(log.Fields{
+		"address":  address,
+		"clientIP": clientIP,
+	}).Warn("Claim rejected by cluster cooldown")
+	flagClaim(r, "cluster_cooldown")
+	renderLocalized(w, r, http.StatusForbidden, "cluster_cooldown")
+}
+
+func (c *Clustering) coolingDown(entry string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	until, ok := c.cooldowns[strings.ToLower(entry)]
+	return ok && time.Now().Before(until)
+}
+
+// Clusters returns the clusters found, the most recent first
+func (c *Clustering) Clusters() []Cluster {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	clusters := make([]Cluster, 0, len(c.clusters))
+	for _, cluster := range c.clusters {
+		clusters = append(clusters, *cluster)
+	}
+	sort.Slice(clusters, func(i, j int) bool { return clusters[i].UpdatedAt.After(clusters[j].UpdatedAt) })
+	return clusters
+}
+
+// Dismiss drops a cluster found in error and lifts its cooldown. Its members
+// are only clustered again for claims made after the dismissal, and stay on
+// the denylist until removed from it
+func (c *Clustering) Dismiss(id string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.clusters[id]; !ok {
+		return false
+	}
+	delete(c.clusters, id)
+	c.dismissed[id] = time.Now()
+	c.updateCooldowns()
+	return true
+}
+
+func (c *Clustering) check(ctx context.Context) {
+	now := time.Now()
+	claims := c.claims.Export(claimFilter{From: now.Add(-c.window)})
+	if len(claims) == 0 {
+		return
+	}
+	if err := c.scanSweeps(ctx, claims); err != nil {
+		log.WithError(err).Warn("Failed to scan blocks for swept claims")
+	}
+
+	byIP := make(map[string][]exportedClaim)
+	byDestination := make(map[common.Address][]exportedClaim)
+	c.mutex.Lock()
+	for _, claim := range claims {
+		if claim.IP != "" {
+			byIP[claim.IP] = append(byIP[claim.IP], claim)
+		}
+		if sweep, ok := c.sweeps[common.HexToAddress(claim.Address)]; ok {
+			byDestination[sweep.to] = append(byDestination[sweep.to], claim)
+		}
+	}
+	c.mutex.Unlock()
+
+	for ip, claims := range byIP {
+		if claims = c.since(clusterIP+":"+ip, claims); distinctAddresses(claims) >= c.size {
+			if claims = c.fresh(ctx, claims); distinctAddresses(claims) >= c.size {
+				c.found(clusterIP, ip, claims, now)
+			}
+		}
+	}
+	for destination, claims := range byDestination {
+		key := strings.ToLower(destination.Hex())
+		if claims = c.since(clusterSweep+":"+key, claims); distinctAddresses(claims) >= c.size {
+			c.found(clusterSweep, key, claims, now)
+		}
+	}
+	c.prune(now)
+}
+
+// since returns the claims made after the cluster was last dismissed
+func (c *Clustering) since(id string, claims []exportedClaim) []exportedClaim {
+	c.mutex.Lock()
+	dismissedAt, ok := c.dismissed[id]
+	c.mutex.Unlock()
+	if !ok {
+		return claims
+	}
+	var kept []exportedClaim
+	for _, claim := range claims {
+		if claim.ClaimedAt.After(dismissedAt) {
+			kept = append(kept, claim)
+		}
+	}
+	return kept
+}
+
+// fresh returns the claims of addresses that sent no more than a sweep, those
+// that cannot be checked are kept
+func (c *Clustering) fresh(ctx context.Context, claims []exportedClaim) []exportedClaim {
+	if c.client == nil {
+		return claims
+	}
+	var kept []exportedClaim
+	for _, claim := range claims {
+		nonceCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		nonce, err := c.client.NonceAt(nonceCtx, common.HexToAddress(claim.Address), nil)
+		cancel()
+		if err != nil || nonce <= maxFreshNonce {
+			kept = append(kept, claim)
+		}
+	}
+	return kept
+}
+
+// scanSweeps records the transfers sent by claimed addresses in the blocks
+// mined since the last scan
+func (c *Clustering) scanSweeps(ctx context.Context, claims []exportedClaim) error {
+	blocks, ok := c.client.(chain.BlockReader)
+	if !ok {
+		return nil
+	}
+	header, err := c.client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return err
+	}
+	head := header.Number
+	if c.nextBlock == nil {
+		c.nextBlock = new(big.Int).Sub(head, big.NewInt(maxScanBlocks-1))
+		if c.nextBlock.Sign() < 0 {
+			c.nextBlock.SetInt64(0)
+		}
+	}
+
+	claimed := make(map[common.Address]bool, len(claims))
+	for _, claim := range claims {
+		claimed[common.HexToAddress(claim.Address)] = true
+	}
+	for scanned := 0; c.nextBlock.Cmp(head) <= 0 && scanned < maxScanBlocks; scanned++ {
+		block, err := blocks.BlockByNumber(ctx, c.nextBlock)
+		if err != nil {
+			return err
+		}
+		at := time.Unix(int64(block.Time()), 0)
+		for _, tx := range block.Transactions() {
+			if tx.To() == nil || c.faucet[*tx.To()] {
+				continue
+			}
+			from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+			if err != nil || !claimed[from] {
+				continue
+			}
+			c.mutex.Lock()
+			c.sweeps[from] = sweep{to: *tx.To(), at: at}
+			c.mutex.Unlock()
+		}
+		c.nextBlock = new(big.Int).Add(c.nextBlock, big.NewInt(1))
+	}
+	return nil
+}
+
+// found records the cluster of the claims and acts on the members that are new to it
+func (c *Clustering) found(kind, key string, claims []exportedClaim, now time.Time) {
+	id := kind + ":" + key
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	cluster, ok := c.clusters[id]
+	if !ok {
+		cluster = &Cluster{ID: id, Kind: kind, Key: key, DetectedAt: now}
+	}
+
+	var addresses, ips []string
+	for _, claim := range claims {
+		if !containsString(cluster.Addresses, claim.Address) && !containsString(addresses, claim.Address) {
+			addresses = append(addresses, claim.Address)
+		}
+		if claim.IP != "" && !containsString(cluster.IPs, claim.IP) && !containsString(ips, claim.IP) {
+			ips = append(ips, claim.IP)
+		}
+	}
+	if len(addresses) == 0 {
+		return
+	}
+	cluster.Addresses = append(cluster.Addresses, addresses...)
+	cluster.IPs = append(cluster.IPs, ips...)
+	cluster.UpdatedAt = now
+	if c.action == ClusterCooldown {
+		cluster.Until = now.Add(c.cooldown)
+	}
+	c.clusters[id] = cluster
+
+	log.WithFields(log.Fields{
+		"cluster":   id,
+		"addresses": strings.Join(addresses, ","),
+		"action":    c.action,
+	}).Warn("Found a cluster of addresses evading the limits")
+	if c.action == ClusterDeny {
+		// The IPs of sweep clusters may well be shared, only the IP of an IP cluster is denied
+		if kind == clusterIP {
+			addresses = append(addresses, key)
+		}
+		for _, entry := range addresses {
+			if err := c.denylist.Add(entry); err != nil {
+				log.WithError(err).WithField("entry", entry).Error("Failed to denylist clustered entry")
+			}
+		}
+	}
+	c.updateCooldowns()
+}
+
+// prune forgets the clusters and sweeps that are over
+func (c *Clustering) prune(now time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	cutoff := now.Add(-c.window)
+	for id, cluster := range c.clusters {
+		if cluster.UpdatedAt.Before(cutoff) && now.After(cluster.Until) {
+			delete(c.clusters, id)
+		}
+	}
+	for id, dismissedAt := range c.dismissed {
+		if dismissedAt.Before(cutoff) {
+			delete(c.dismissed, id)
+		}
+	}
+	for address, sweep := range c.sweeps {
+		if sweep.at.Before(cutoff) {
+			delete(c.sweeps, address)
+		}
+	}
+	c.updateCooldowns()
+}
+
+func (c *Clustering) updateCooldowns() {
+	cooldowns := make(map[string]time.Time)
+	cool := func(entry string, until time.Time) {
+		entry = strings.ToLower(entry)
+		if until.After(cooldowns[entry]) {
+			cooldowns[entry] = until
+		}
+	}
+	for _, cluster := range c.clusters {
+		if cluster.Until.IsZero() {
+			continue
+		}
+		for _, address := range cluster.Addresses {
+			cool(address, cluster.Until)
+		}
+		if cluster.Kind == clusterIP {
+			cool(cluster.Key, cluster.Until)
+		}
+	}
+	c.cooldowns = cooldowns
+}
+
+func distinctAddresses(claims []exportedClaim) int {
+	addresses := make(map[string]bool)
+	for _, claim := range claims {
+		addresses[strings.ToLower(claim.Address)] = true
+	}
+	return len(addresses)
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+type fakeChain struct {
+	nonces map[common.Address]uint64
+	blocks []*types.Block
+}
+
+func (f *fakeChain) NonceAt(_ context.Context, account common.Address, _ *big.Int) (uint64, error) {
+	return f.nonces[account], nil
+}
+
+func (f *fakeChain) HeaderByNumber(_ context.Context, _ *big.Int) (*types.Header, error) {
+	return f.blocks[len(f.blocks)-1].Header(), nil
+}
+
+func (f *fakeChain) BlockByNumber(_ context.Context, number *big.Int) (*types.Block, error) {
+	return f.blocks[number.Int64()], nil
+}
+
+func TestClusteringByIP(t *testing.T) {
+	store, _ := LoadClaimStore("", nil, 0)
+	now := time.Now()
+	addresses := []string{
+		"0x0000000000000000000000000000000000000001",
+		"0x0000000000000000000000000000000000000002",
+		"0x0000000000000000000000000000000000000003",
+		"0x0000000000000000000000000000000000000004",
+	}
+	for i, address := range addresses {
+		store.Add(address, claimRecord{Amount: big.NewInt(1), ClaimedAt: now.Add(-time.Duration(i) * time.Minute), IP: "203.0.113.7"})
+	}
+	store.Add("0x0000000000000000000000000000000000000005", claimRecord{Amount: big.NewInt(1), ClaimedAt: now, IP: "198.51.100.1"})
+	// An address with a history of its own is not a throwaway one
+	client := &fakeChain{
+		nonces: map[common.Address]uint64{common.HexToAddress(addresses[3]): 40},
+		blocks: []*types.Block{types.NewBlockWithHeader(&types.Header{Number: big.NewInt(0)})},
+	}
+
+	denylist, _ := LoadAccessList("")
+	clustering := NewClustering(store, client, nil, denylist, nil, time.Minute, time.Hour, 3, ClusterCooldown, time.Hour)
+	clustering.check(context.Background())
+
+	clusters := clustering.Clusters()
+	if len(clusters) != 1 || clusters[0].ID != "ip:203.0.113.7" || len(clusters[0].Addresses) != 3 {
+		t.Fatalf("Clusters() = %+v, want the three fresh addresses of 203.0.113.7", clusters)
+	}
+	claim := func(address, ip string) int {
+		r := httptest.NewRequest("POST", "/api/claim", strings.NewReader(`{"address":"`+address+`"}`))
+		r.RemoteAddr = ip + ":1234"
+		rec := httptest.NewRecorder()
+		clustering.ServeHTTP(rec, r, func(w http.ResponseWriter, r *http.Request) {})
+		return rec.Code
+	}
+	if code := claim(addresses[0], "192.0.2.1"); code != http.StatusForbidden {
+		t.Errorf("status of clustered address = %d, want %d", code, http.StatusForbidden)
+	}
+	if code := claim("0x0000000000000000000000000000000000000009", "203.0.113.7"); code != http.StatusForbidden {
+		t.Errorf("status of clustered IP = %d, want %d", code, http.StatusForbidden)
+	}
+	if code := claim(addresses[3], "192.0.2.1"); code != http.StatusOK {
+		t.Errorf("status of address with a history = %d, want %d", code, http.StatusOK)
+	}
+	if denylist.Len() != 0 {
+		t.Errorf("cooldown action denylisted %v", denylist.Entries())
+	}
+
+	if !clustering.Dismiss("ip:203.0.113.7") {
+		t.Fatal("Dismiss() did not find the cluster")
+	}
+	clustering.check(context.Background())
+	if clusters := clustering.Clusters(); len(clusters) != 0 {
+		t.Errorf("Clusters() = %+v after dismissal, want none", clusters)
+	}
+	if code := claim(addresses[0], "203.0.113.7"); code != http.StatusOK {
+		t.Errorf("status of dismissed cluster = %d, want %d", code, http.StatusOK)
+	}
+}
+
+func TestClusteringBySweep(t *testing.T) {
+	store, _ := LoadClaimStore("", nil, 0)
+	faucet, destination := common.HexToAddress("0xfa"), common.HexToAddress("0xde")
+	signer := types.NewEIP155Signer(big.NewInt(1337))
+	var txs []*types.Transaction
+	var keys []*ecdsa.PrivateKey
+	for i := 0; i < 4; i++ {
+		key, _ := crypto.GenerateKey()
+		keys = append(keys, key)
+		address := crypto.PubkeyToAddress(key.PublicKey)
+		// Each claim from an IP of its own
+		store.Add(address.Hex(), claimRecord{Amount: big.NewInt(1), ClaimedAt: time.Now(), IP: "192.0.2." + string(rune('1'+i))})
+		to := destination
+		if i == 3 {
+			to = faucet
+		}
+		tx, _ := types.SignTx(types.NewTransaction(0, to, big.NewInt(1), 21000, big.NewInt(1), nil), signer, key)
+		txs = append(txs, tx)
+	}
+	genesis := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(0), Time: uint64(time.Now().Unix())})
+	block := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(1), Time: uint64(time.Now().Unix())}).WithBody(txs, nil)
+	client := &fakeChain{blocks: []*types.Block{genesis, block}}
+
+	denylist, _ := LoadAccessList("")
+	clustering := NewClustering(store, client, nil, denylist, []common.Address{faucet}, time.Minute, time.Hour, 3, ClusterDeny, time.Hour)
+	clustering.check(context.Background())
+
+	clusters := clustering.Clusters()
+	if len(clusters) != 1 || clusters[0].ID != "sweep:"+strings.ToLower(destination.Hex()) || len(clusters[0].Addresses) != 3 {
+		t.Fatalf("Clusters() = %+v, want the three addresses swept to %s", clusters, destination.Hex())
+	}
+	for i, key := range keys {
+		address := crypto.PubkeyToAddress(key.PublicKey).Hex()
+		if denied := denylist.ContainsAddress(address); denied != (i < 3) {
+			t.Errorf("address %d denylisted = %v, want %v", i, denied, i < 3)
+		}
+	}
+	if denylist.ContainsIP("192.0.2.1") {
+		t.Error("IP of a sweep cluster denylisted")
+	}
+	if !clusters[0].Until.IsZero() {
+		t.Errorf("deny action set a cooldown until %v", clusters[0].Until)
+	}
+}
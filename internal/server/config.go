@@ -1,25 +1,286 @@
 package server
 
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
 type Config struct {
-	network         string
-	symbol          string
-	httpPort        int
-	interval        int
-	payout          int
-	proxyCount      int
-	hcaptchaSiteKey string
-	hcaptchaSecret  string
+	Network            string
+	Symbol             string
+	HTTPPort           int
+	TLSCert            string
+	TLSKey             string
+	TLSDomains         []string
+	TLSCacheDir        string
+	TLSEmail           string
+	TLSRedirectPort    int
+	HSTSMaxAge         time.Duration
+	HSTSSubdomains     bool
+	FrameOptions       string
+	GRPCPort           int
+	Interval           int
+	LimitMode          string
+	LimitClaims        int
+	IPv4Prefix         int
+	IPv6Prefix         int
+	SubnetInterval     int
+	LimiterStatePath   string
+	LimiterSnapshot    time.Duration
+	StateKey           string
+	ThrottleRate       float64
+	ThrottleBurst      int
+	IdempotencyTTL     time.Duration
+	ClaimStorePath     string
+	CapClaims          int
+	CapAmount          string
+	CapPeriod          time.Duration
+	Payout             int
+	PayoutTiersPath    string
+	PayoutFiat         string
+	PayoutFiatMax      string
+	PayoutChoices      []string
+	Purposes           []string
+	PriceCurrency      string
+	PriceFeed          string
+	PriceCoin          string
+	PriceProvider      string
+	PriceInterval      time.Duration
+	ProxyCount         int
+	TrustedProxies     []string
+	ProxyHeader        string
+	HcaptchaSiteKey    string
+	HcaptchaSecret     string
+	CaptchaCacheTTL    time.Duration
+	CaptchaFailMode    string
+	CaptchaFailOpenTTL time.Duration
+	PowDifficulty      int
+	GithubClientID     string
+	GithubClientSecret string
+	OAuthRedirectURL   string
+	PassportAPIKey     string
+	PassportScorerID   string
+	ScoreWebhook       string
+	MinScore           float64
+	ReducedPayout      string
+	RejectContracts    bool
+	MaxClaimerBalance  string
+	ScoreCacheTTL      time.Duration
+	RiskCaptchaScore   int
+	RiskDenyScore      int
+	TarpitScore        int
+	TarpitDelay        time.Duration
+	TarpitJitter       time.Duration
+	TarpitMode         string
+	DenylistPath       string
+	AllowlistPath      string
+	ExemptListPath     string
+	CanaryPoliciesPath string
+	GeoIPPath          string
+	GeoBlock           []string
+	GeoCaptcha         []string
+	GeoReduce          []string
+	GeoReducedPayout   string
+	ASNPath            string
+	ASNBlock           []string
+	ASNStrict          []string
+	ASNStrictInterval  int
+	AdminToken         string
+	APIKeysPath        string
+	PartnerSecrets     []string
+	AbuseWebhooks      []string
+	AbuseWindow        time.Duration
+	FrontendsPath      string
+	SubscriptionsPath  string
+	TopUpInterval      time.Duration
+	TopUpCooldown      time.Duration
+	ClusterInterval    time.Duration
+	ClusterWindow      time.Duration
+	ClusterSize        int
+	ClusterAction      string
+	ClusterCooldown    time.Duration
+	BalanceInterval    time.Duration
+	MinBalance         string
+	BalanceAlerts      []string
+	AlertWebhook       string
+	TelegramToken      string
+	TelegramChatID     string
+	TelegramBotToken   string
+	ExplorerURL        string
+	ExplorerTemplates  []string
+	EmailSMTP          string
+	EmailSendgridKey   string
+	EmailFrom          string
+	EmailTemplate      string
+	ENSProvider        string
+	ENSRegistry        string
+	ENSCacheTTL        time.Duration
+	GateToken          string
+	GateMinBalance     string
+	GateDecimals       int
+	GateProvider       string
+	GateCacheTTL       time.Duration
+	QueueWorkers       int
+	QueueSize          int
+	QueueWeights       []string
+	QueueMaxWait       time.Duration
+	BatchSize          int
+	BatchWindow        time.Duration
+	Confirmations      uint64
+	ConfirmInterval    time.Duration
+	CorsOrigins        []string
+	CorsMethods        []string
+	CorsHeaders        []string
+	CorsCredentials    bool
+	DryRun             bool
+	WebhookURLs        []string
+	WebhookSecret      string
+	HourlyBudget       string
+	HourlyBudgetClaims int
+	DailyBudget        string
+	DailyBudgetClaims  int
+	SIWEDomain         string
+	MaintenanceCron    string
+	MaintenanceLength  time.Duration
+	MaintenanceMessage string
+}
+
+// Validate reports the first setting that is out of range
+func (c *Config) Validate() error {
+	switch {
+	case c.HTTPPort <= 0 || c.HTTPPort > 65535:
+		return fmt.Errorf("invalid http port %d", c.HTTPPort)
+	case (c.TLSCert == "") != (c.TLSKey == ""):
+		return errors.New("tls certificate and key files must be given together")
+	case c.TLSCert != "" && len(c.TLSDomains) > 0:
+		return errors.New("tls certificate files and Let's Encrypt domains are mutually exclusive")
+	case c.TLSRedirectPort < 0 || c.TLSRedirectPort > 65535 || c.TLSRedirectPort == c.HTTPPort:
+		return fmt.Errorf("invalid http redirect port %d", c.TLSRedirectPort)
+	case c.TLSRedirectPort > 0 && c.TLSCert == "" && len(c.TLSDomains) == 0:
+		return errors.New("redirecting to https requires a tls certificate or Let's Encrypt domains")
+	case len(c.TLSDomains) > 0 && c.HTTPPort != 443 && c.TLSRedirectPort != 80:
+		return errors.New("verifying Let's Encrypt domains requires an http port of 443 or a redirect port of 80")
+	case c.HSTSMaxAge < 0:
+		return errors.New("hsts max age must not be negative")
+	case c.FrameOptions != "" && c.FrameOptions != "DENY" && c.FrameOptions != "SAMEORIGIN":
+		return fmt.Errorf("unknown frame options %q", c.FrameOptions)
+	case c.LimiterSnapshot < 0:
+		return errors.New("limiter snapshot interval must not be negative")
+	case c.LimiterSnapshot > 0 && c.LimiterStatePath == "":
+		return errors.New("limiter snapshots require a limiter state file")
+	case c.IdempotencyTTL < 0:
+		return errors.New("idempotency ttl must not be negative")
+	case c.GRPCPort < 0 || c.GRPCPort > 65535 || c.GRPCPort == c.HTTPPort:
+		return fmt.Errorf("invalid grpc port %d", c.GRPCPort)
+	case c.Payout <= 0:
+		return errors.New("payout amount must be positive")
+	case c.Interval < 0 || c.SubnetInterval < 0 || c.ASNStrictInterval < 0:
+		return errors.New("rate limit intervals must not be negative")
+	case c.LimitMode != "" && c.LimitMode != LimitFixed && c.LimitMode != LimitSliding && c.LimitMode != LimitBucket:
+		return fmt.Errorf("unknown rate limit mode %q", c.LimitMode)
+	case c.LimitClaims < 0:
+		return errors.New("rate limit claims must not be negative")
+	case c.ThrottleRate < 0 || c.ThrottleBurst < 0:
+		return errors.New("throttle rate and burst must not be negative")
+	case c.IPv4Prefix < 0 || c.IPv4Prefix > 32:
+		return fmt.Errorf("invalid IPv4 prefix length %d", c.IPv4Prefix)
+	case c.IPv6Prefix < 0 || c.IPv6Prefix > 128:
+		return fmt.Errorf("invalid IPv6 prefix length %d", c.IPv6Prefix)
+	case c.CapClaims < 0 || c.CapPeriod < 0:
+		return errors.New("claim cap and period must not be negative")
+	case c.HourlyBudgetClaims < 0 || c.DailyBudgetClaims < 0:
+		return errors.New("budget claim counts must not be negative")
+	case c.RiskCaptchaScore < 0 || c.RiskCaptchaScore > 100 || c.RiskDenyScore < 0 || c.RiskDenyScore > 100:
+		return errors.New("risk score thresholds must be between 0 and 100")
+	case c.PayoutFiat != "" && c.PriceFeed == "" && c.PriceCoin == "":
+		return errors.New("payouts in fiat require a price feed or CoinGecko coin")
+	case c.PayoutFiat != "" && c.PayoutFiatMax == "":
+		return errors.New("payouts in fiat require a maximum payout in the token")
+	case c.PriceFeed != "" && !chain.IsValidAddress(c.PriceFeed, false):
+		return fmt.Errorf("invalid price feed address %q", c.PriceFeed)
+	case c.PayoutFiat != "" && c.PriceInterval <= 0:
+		return errors.New("price refresh interval must be positive")
+	case c.PayoutFiat != "" && c.PriceFeed == "" && c.PriceInterval >= maxQuoteAge:
+		return fmt.Errorf("CoinGecko prices must be refreshed more often than every %s", maxQuoteAge)
+	case c.AbuseWindow < 0:
+		return errors.New("abuse report window must not be negative")
+	case len(c.PartnerSecrets) > 0 && c.DenylistPath == "":
+		return errors.New("abuse reports of partners require a denylist file to keep the reported addresses in")
+	case c.TarpitScore < 0 || c.TarpitScore > 100:
+		return errors.New("tarpit score threshold must be between 0 and 100")
+	case c.TarpitDelay < 0 || c.TarpitJitter < 0:
+		return errors.New("tarpit delay and jitter must not be negative")
+	case c.TarpitMode != "" && c.TarpitMode != TarpitFake && c.TarpitMode != TarpitError:
+		return fmt.Errorf("unknown tarpit mode %q", c.TarpitMode)
+	case c.ENSProvider != "" && !chain.IsValidAddress(c.ENSRegistry, false):
+		return fmt.Errorf("invalid name registry address %q", c.ENSRegistry)
+	case c.GateToken != "" && !chain.IsValidAddress(c.GateToken, false):
+		return fmt.Errorf("invalid gating token address %q", c.GateToken)
+	case c.GateDecimals < 0:
+		return fmt.Errorf("invalid gating token decimals %d", c.GateDecimals)
+	case c.CaptchaFailMode != "" && c.CaptchaFailMode != CaptchaFailClosed && c.CaptchaFailMode != CaptchaFailOpen && c.CaptchaFailMode != CaptchaFailPow:
+		return fmt.Errorf("unknown captcha fail mode %q", c.CaptchaFailMode)
+	case c.CaptchaFailMode == CaptchaFailPow && c.PowDifficulty <= 0:
+		return errors.New("falling back to proof of work requires a proof of work difficulty")
+	case c.CaptchaFailOpenTTL < 0:
+		return errors.New("captcha fail open cooldown must not be negative")
+	case c.PowDifficulty < 0 || c.PowDifficulty > 256:
+		return fmt.Errorf("invalid proof of work difficulty %d", c.PowDifficulty)
+	case c.BalanceInterval <= 0:
+		return errors.New("balance poll interval must be positive")
+	case c.QueueWorkers <= 0 || c.QueueSize <= 0:
+		return errors.New("queue workers and size must be positive")
+	case c.TopUpInterval < 0 || c.TopUpCooldown < 0:
+		return errors.New("top-up interval and cooldown must not be negative")
+	case c.ClusterInterval < 0 || c.ClusterWindow < 0 || c.ClusterCooldown < 0:
+		return errors.New("clustering interval, window and cooldown must not be negative")
+	case c.ClusterInterval > 0 && c.ClusterSize < 2:
+		return fmt.Errorf("invalid cluster size %d", c.ClusterSize)
+	case c.ClusterInterval > 0 && c.ClusterAction != ClusterCooldown && c.ClusterAction != ClusterDeny:
+		return fmt.Errorf("unknown cluster action %q", c.ClusterAction)
+	case c.ClusterInterval > 0 && c.ClaimStorePath == "":
+		return errors.New("address clustering requires a claim store")
+	case c.QueueMaxWait < 0:
+		return errors.New("queue max wait must not be negative")
+	case c.Confirmations > 0 && c.ConfirmInterval <= 0:
+		return errors.New("confirmation poll interval must be positive when tracking is enabled")
+	case c.BatchSize > 1 && c.BatchWindow <= 0:
+		return errors.New("batch window must be positive when batching is enabled")
+	}
+	if gates := c.botBypasses(); c.TelegramBotToken != "" && len(gates) > 0 {
+		return fmt.Errorf("claims through the Telegram bot would skip %s, which it can not enforce", strings.Join(gates, ", "))
+	}
+	return nil
 }
 
-func NewConfig(network, symbol string, httpPort, interval, payout, proxyCount int, hcaptchaSiteKey, hcaptchaSecret string) *Config {
-	return &Config{
-		network:         network,
-		symbol:          symbol,
-		httpPort:        httpPort,
-		interval:        interval,
-		payout:          payout,
-		proxyCount:      proxyCount,
-		hcaptchaSiteKey: hcaptchaSiteKey,
-		hcaptchaSecret:  hcaptchaSecret,
+// botBypasses returns the configured claim gates the Telegram bot can not
+// enforce, since its claims come with neither an IP, a signature nor a captcha
+func (c *Config) botBypasses() []string {
+	var gates []string
+	if c.SIWEDomain != "" {
+		gates = append(gates, "Sign-In with Ethereum")
+	}
+	if c.GateToken != "" {
+		gates = append(gates, "token gating")
+	}
+	if c.MinScore > 0 && (c.PassportAPIKey != "" || c.ScoreWebhook != "") {
+		gates = append(gates, "reputation scoring")
+	}
+	if c.RiskCaptchaScore > 0 || c.RiskDenyScore > 0 || c.TarpitScore > 0 {
+		gates = append(gates, "risk scoring")
+	}
+	if c.ClusterInterval > 0 {
+		gates = append(gates, "address clustering")
+	}
+	if len(c.GeoBlock) > 0 || len(c.GeoCaptcha) > 0 || len(c.GeoReduce) > 0 || len(c.ASNBlock) > 0 || len(c.ASNStrict) > 0 {
+		gates = append(gates, "country and ASN policies")
+	}
+	if c.CanaryPoliciesPath != "" {
+		gates = append(gates, "canary policies")
 	}
+	return gates
 }
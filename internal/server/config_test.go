@@ -0,0 +1,56 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConfigValidate(t *testing.T) {
+	valid := Config{HTTPPort: 8080, Payout: 1, Interval: 1440, QueueWorkers: 4, QueueSize: 256, BalanceInterval: time.Minute}
+	tests := []struct {
+		name    string
+		modify  func(c *Config)
+		wantErr bool
+	}{
+		{name: "valid", modify: func(c *Config) {}},
+		{name: "invalid port", modify: func(c *Config) { c.HTTPPort = 70000 }, wantErr: true},
+		{name: "zero payout", modify: func(c *Config) { c.Payout = 0 }, wantErr: true},
+		{name: "negative interval", modify: func(c *Config) { c.SubnetInterval = -1 }, wantErr: true},
+		{name: "sliding window", modify: func(c *Config) { c.LimitMode, c.LimitClaims = LimitSliding, 3 }},
+		{name: "unknown limit mode", modify: func(c *Config) { c.LimitMode = "token" }, wantErr: true},
+		{name: "ipv4 prefix too long", modify: func(c *Config) { c.IPv4Prefix = 33 }, wantErr: true},
+		{name: "ipv6 prefix", modify: func(c *Config) { c.IPv6Prefix = 48 }},
+		{name: "no balance interval", modify: func(c *Config) { c.BalanceInterval = 0 }, wantErr: true},
+		{name: "telegram bot", modify: func(c *Config) { c.TelegramBotToken = "token" }},
+		{name: "telegram bot with risk scoring", modify: func(c *Config) { c.TelegramBotToken, c.RiskDenyScore = "token", 80 }, wantErr: true},
+		{name: "telegram bot with sign in", modify: func(c *Config) { c.TelegramBotToken, c.SIWEDomain = "token", "faucet.fuse.io" }, wantErr: true},
+		{name: "no queue workers", modify: func(c *Config) { c.QueueWorkers = 0 }, wantErr: true},
+		{name: "tls key without certificate", modify: func(c *Config) { c.TLSKey = "key.pem" }, wantErr: true},
+		{name: "tls files and domains", modify: func(c *Config) { c.TLSCert, c.TLSKey, c.TLSDomains = "cert.pem", "key.pem", []string{"faucet.fuse.io"} }, wantErr: true},
+		{name: "redirect without tls", modify: func(c *Config) { c.TLSRedirectPort = 80 }, wantErr: true},
+		{name: "let's encrypt", modify: func(c *Config) { c.TLSDomains, c.TLSRedirectPort = []string{"faucet.fuse.io"}, 80 }},
+		{name: "let's encrypt on 443", modify: func(c *Config) { c.TLSDomains, c.HTTPPort = []string{"faucet.fuse.io"}, 443 }},
+		{name: "let's encrypt unreachable", modify: func(c *Config) { c.TLSDomains, c.TLSRedirectPort = []string{"faucet.fuse.io"}, 8081 }, wantErr: true},
+		{name: "fiat payout", modify: func(c *Config) {
+			c.PayoutFiat, c.PayoutFiatMax, c.PriceCoin, c.PriceInterval = "0.05", "10", "fuse-network-token", time.Minute
+		}},
+		{name: "fiat payout without maximum", modify: func(c *Config) {
+			c.PayoutFiat, c.PriceCoin, c.PriceInterval = "0.05", "fuse-network-token", time.Minute
+		}, wantErr: true},
+		{name: "stale CoinGecko prices", modify: func(c *Config) {
+			c.PayoutFiat, c.PayoutFiatMax, c.PriceCoin, c.PriceInterval = "0.05", "10", "fuse-network-token", time.Hour
+		}, wantErr: true},
+		{name: "partners without denylist", modify: func(c *Config) { c.PartnerSecrets = []string{"acme=secret"} }, wantErr: true},
+		{name: "partners", modify: func(c *Config) { c.PartnerSecrets, c.DenylistPath = []string{"acme=secret"}, "denylist.txt" }},
+		{name: "unknown frame options", modify: func(c *Config) { c.FrameOptions = "ALLOW-FROM https://fuse.io" }, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := valid
+			tt.modify(&cfg)
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+const (
+	// dropThreshold is the number of polls a tx has to be missing before it counts as dropped
+	dropThreshold   = 3
+	maxResends      = 3
+	maxClaimRetries = 2
+)
+
+var (
+	errTxDropped  = errors.New("transaction was dropped")
+	errTxReverted = errors.New("transaction reverted")
+)
+
+// trackedTx holds the claims paid out by one tx. Everything but claims is only
+// touched by the polling goroutine
+type trackedTx struct {
+	claims  []*Claim
+	status  ClaimStatus
+	hash    common.Hash
+	misses  int
+	resends int
+}
+
+type confirmationTracker struct {
+	mutex         sync.Mutex
+	queue         *Queue
+	confirmer     chain.Confirmer
+	confirmations uint64
+	interval      time.Duration
+	txs           map[common.Hash]*trackedTx
+	done          chan struct{}
+	once          sync.Once
+}
+
+func newConfirmationTracker(queue *Queue, confirmer chain.Confirmer, confirmations uint64, interval time.Duration) *confirmationTracker {
+	return &confirmationTracker{
+		queue:         queue,
+		confirmer:     confirmer,
+		confirmations: confirmations,
+		interval:      interval,
+		txs:           make(map[common.Hash]*trackedTx),
+		done:          make(chan struct{}),
+	}
+}
+
+func (t *confirmationTracker) watch(claim *Claim, hash common.Hash) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	tx, ok := t.txs[hash]
+	if !ok {
+		tx = &trackedTx{status: ClaimBroadcast, hash: hash}
+		t.txs[hash] = tx
+	}
+	tx.claims = append(tx.claims, claim)
+}
+
+func (t *confirmationTracker) stop() {
+	t.once.Do(func() {
+		close(t.done)
+	})
+}
+
+func (t *confirmationTracker) run() {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-ticker.C:
+			t.poll()
+		}
+	}
+}
+
+func (t *confirmationTracker) poll() {
+	t.mutex.Lock()
+	txs := make(map[common.Hash]*trackedTx, len(t.txs))
+	for hash, tx := range t.txs {
+		txs[hash] = tx
+	}
+	t.mutex.Unlock()
+
+	for hash, tx := range txs {
+		t.check(hash, tx)
+	}
+}
+
+func (t *confirmationTracker) check(hash common.Hash, tx *trackedTx) {
+	ctx, cancel := context.WithTimeout(context.Background(), transferTimeout)
+	defer cancel()
+	state, version, err := t.confirmer.Confirm(ctx, hash, t.confirmations)
+	if err != nil {
+		log.WithError(err).WithField("txHash", hash).Warn("Failed to check transaction")
+		return
+	}
+
+	switch state {
+	case chain.TxPending:
+		tx.misses = 0
+		t.setStatus(hash, tx, ClaimBroadcast, version, nil)
+	case chain.TxMined:
+		tx.misses = 0
+		t.setStatus(hash, tx, ClaimMined, version, nil)
+	case chain.TxConfirmed:
+		t.setStatus(hash, tx, ClaimConfirmed, version, nil)
+		t.forget(hash)
+	case chain.TxReverted:
+		t.setStatus(hash, tx, ClaimFailed, version, errTxReverted)
+		t.forget(hash)
+	case chain.TxDropped:
+		if tx.misses++; tx.misses >= dropThreshold {
+			t.retry(ctx, hash, tx)
+		}
+	}
+}
+
+// retry resends a dropped tx with the same nonce, or requeues its claims if the nonce was taken
+func (t *confirmationTracker) retry(ctx context.Context, hash common.Hash, tx *trackedTx) {
+	if tx.resends >= maxResends {
+		t.setStatus(hash, tx, ClaimFailed, tx.hash, errTxDropped)
+		t.forget(hash)
+		return
+	}
+
+	resent, err := t.confirmer.Resend(ctx, hash)
+	if err == nil {
+		tx.resends++
+		tx.misses = 0
+		t.setStatus(hash, tx, ClaimBroadcast, resent, nil)
+		log.WithFields(log.Fields{
+			"txHash": hash,
+			"newTx":  resent,
+		}).Warn("Resent dropped transaction")
+		return
+	}
+	if !errors.Is(err, chain.ErrNonceUsed) {
+		log.WithError(err).WithField("txHash", hash).Error("Failed to resend dropped transaction")
+		return
+	}
+
+	t.forget(hash)
+	for _, claim := range t.claims(tx) {
+		t.queue.requeue(claim)
+	}
+	log.WithField("txHash", hash).Warn("Requeued claims of dropped transaction")
+}
+
+func (t *confirmationTracker) setStatus(hash common.Hash, tx *trackedTx, status ClaimStatus, version common.Hash, err error) {
+	if tx.status == status && tx.hash == version {
+		return
+	}
+	tx.status, tx.hash = status, version
+	for _, claim := range t.claims(tx) {
+		t.queue.update(claim, func(c *Claim) {
+			c.Status = status
+			c.TxHash = version
+			if err != nil {
+				c.Error = err.Error()
+			}
+		})
+	}
+}
+
+func (t *confirmationTracker) claims(tx *trackedTx) []*Claim {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return append([]*Claim(nil), tx.claims...)
+}
+
+func (t *confirmationTracker) forget(hash common.Hash) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	delete(t.txs, hash)
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+)
+
+// exposedHeaders are the response headers scripts of other origins may read
+const exposedHeaders = "X-Request-ID, RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, Retry-After"
+
+// Cors answers cross-origin requests from the allowed origins. An origin may be
+// "*" for any origin or contain a wildcard subdomain such as https://*.example.com
+type Cors struct {
+	origins     []string
+	methods     string
+	headers     string
+	credentials bool
+}
+
+func NewCors(origins, methods, headers []string, credentials bool) *Cors {
+	return &Cors{
+		origins:     origins,
+		methods:     strings.Join(methods, ", "),
+		headers:     strings.Join(headers, ", "),
+		credentials: credentials,
+	}
+}
+
+func (c *Cors) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	origin := r.Header.Get("Origin")
+	if origin == "" || len(c.origins) == 0 {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	w.Header().Add("Vary", "Origin")
+	if !c.allowed(origin) {
+		next.ServeHTTP(w, r)
+		return
+	}
+	// Browsers reject a wildcard origin on credentialed requests, so echo the origin instead
+	if c.origins[0] == "*" && len(c.origins) == 1 && !c.credentials {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	} else {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+	}
+	if c.credentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+		w.Header().Set("Access-Control-Allow-Methods", c.methods)
+		w.Header().Set("Access-Control-Allow-Headers", c.headers)
+		w.Header().Set("Access-Control-Max-Age", "600")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Access-Control-Expose-Headers", exposedHeaders)
+	next.ServeHTTP(w, r)
+}
+
+func (c *Cors) allowed(origin string) bool {
+	for _, allowed := range c.origins {
+		if matchOrigin(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchOrigin(pattern, origin string) bool {
+	if pattern == "*" || strings.EqualFold(pattern, origin) {
+		return true
+	}
+	i := strings.Index(pattern, "*.")
+	if i < 0 {
+		return false
+	}
+	prefix, suffix := strings.ToLower(pattern[:i]), strings.ToLower(pattern[i+1:])
+	origin = strings.ToLower(origin)
+	return strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) &&
+		len(origin) > len(prefix)+len(suffix) && !strings.Contains(origin[len(prefix):len(origin)-len(suffix)], "/")
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/urfave/negroni"
+)
+
+func TestMatchOrigin(t *testing.T) {
+	tests := []struct {
+		pattern string
+		origin  string
+		want    bool
+	}{
+		{pattern: "*", origin: "https://evil.com", want: true},
+		{pattern: "https://app.example.com", origin: "https://app.example.com", want: true},
+		{pattern: "https://app.example.com", origin: "http://app.example.com", want: false},
+		{pattern: "https://*.example.com", origin: "https://a.b.example.com", want: true},
+		{pattern: "https://*.example.com", origin: "https://example.com", want: false},
+		{pattern: "https://*.example.com", origin: "https://evilexample.com", want: false},
+		{pattern: "https://*.example.com", origin: "http://app.example.com", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.origin, func(t *testing.T) {
+			if got := matchOrigin(tt.pattern, tt.origin); got != tt.want {
+				t.Errorf("matchOrigin() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCors(t *testing.T) {
+	cors := NewCors([]string{"https://*.example.com"}, []string{"GET", "POST"}, []string{"Content-Type"}, true)
+	n := negroni.New(cors)
+	n.UseHandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	req := httptest.NewRequest("OPTIONS", "/api/claim", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	rec := httptest.NewRecorder()
+	n.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("preflight status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Errorf("Access-Control-Allow-Origin = %q", got)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Methods"); got != "GET, POST" {
+		t.Errorf("Access-Control-Allow-Methods = %q", got)
+	}
+
+	req = httptest.NewRequest("POST", "/api/claim", nil)
+	req.Header.Set("Origin", "https://evil.com")
+	rec = httptest.NewRecorder()
+	n.ServeHTTP(rec, req)
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("disallowed origin got Access-Control-Allow-Origin = %q", got)
+	}
+}
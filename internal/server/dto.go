@@ -4,44 +4,100 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"io"
 	"net/http"
 	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
 
 	"github.com/chainflag/eth-faucet/internal/chain"
+	"github.com/chainflag/eth-faucet/pkg/client"
+)
+
+// The request and response bodies of the public API are defined in pkg/client
+// so that Go clients decode the same types the server renders
+type (
+	claimRequest        = client.ClaimRequest
+	claimResponse       = client.ClaimResponse
+	progressResponse    = client.Progress
+	dryRunResponse      = client.DryRun
+	allowanceResponse   = client.Allowance
+	claimStatusResponse = client.ClaimStatus
+	infoResponse        = client.Info
+	maintenanceResponse = client.MaintenanceWindow
+	powChallenge        = client.Challenge
 )
 
-type claimRequest struct {
-	Address string `json:"address"`
+func newProgressResponse(progress ClaimProgress, ok bool) *progressResponse {
+	if !ok {
+		return nil
+	}
+	return &progressResponse{
+		QueuePosition:  progress.Position,
+		QueueLength:    progress.Queued,
+		PendingPayouts: progress.Pending,
+		ETASeconds:     int64((progress.ETA + time.Second - 1) / time.Second),
+	}
 }
 
-type claimResponse struct {
-	Message string `json:"msg"`
+func newAllowanceResponse(allowance *Allowance) *allowanceResponse {
+	if allowance == nil {
+		return nil
+	}
+	resp := &allowanceResponse{Claims: allowance.Claims}
+	if allowance.Amount != nil {
+		resp.Amount = chain.FormatEther(allowance.Amount)
+	}
+	return resp
+}
+
+func newClaimStatusResponse(claim Claim, explorer *Explorer) claimStatusResponse {
+	resp := claimStatusResponse{
+		ClaimID:     claim.ID,
+		Address:     claim.Address,
+		Status:      string(claim.Status),
+		ExplorerURL: explorer.claimTxURL(claim),
+		Error:       claim.Error,
+	}
+	if claim.TxHash != (common.Hash{}) {
+		resp.TxHash = claim.TxHash.Hex()
+	}
+	return resp
 }
 
-type infoResponse struct {
-	Account         string `json:"account"`
-	Network         string `json:"network"`
-	Payout          string `json:"payout"`
-	Symbol          string `json:"symbol"`
-	HcaptchaSiteKey string `json:"hcaptcha_sitekey,omitempty"`
+// sameStatus reports whether a and b render the same
+func sameStatus(a, b claimStatusResponse) bool {
+	pa, pb := a.Progress, b.Progress
+	a.Progress, b.Progress = nil, nil
+	return a == b && (pa == pb || pa != nil && pb != nil && *pa == *pb)
 }
 
+type healthResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// malformedRequest is a request rejected for its body, field naming the
+// offending field of the JSON body if the error is about a single one
 type malformedRequest struct {
-	status  int
-	message string
+	status int
+	code   string
+	field  string
+	args   []interface{}
 }
 
 func (mr *malformedRequest) Error() string {
-	return mr.message
+	return localize("en", mr.code, mr.args...)
 }
 
+// decodeJSONBody decodes the JSON object in the body of r into dst, refusing
+// bodies above maxBodySize, unknown fields and anything after the object. The
+// body is kept for the next handlers to decode it again
 func decodeJSONBody(r *http.Request, dst interface{}) error {
-	body, err := io.ReadAll(io.LimitReader(r.Body, 1024))
-	defer r.Body.Close()
+	body, err := readBody(r)
 	if err != nil {
-		return &malformedRequest{status: http.StatusBadRequest, message: "Unable to read request body"}
+		return err
 	}
 
 	dec := json.NewDecoder(bytes.NewReader(body))
@@ -52,41 +108,55 @@ func decodeJSONBody(r *http.Request, dst interface{}) error {
 		var unmarshalTypeError *json.UnmarshalTypeError
 
 		switch {
-		case errors.As(err, &syntaxError):
-			msg := fmt.Sprintf("Request body contains badly-formed JSON (at position %d)", syntaxError.Offset)
-			return &malformedRequest{status: http.StatusBadRequest, message: msg}
-		case errors.Is(err, io.ErrUnexpectedEOF):
-			msg := "Request body contains badly-formed JSON"
-			return &malformedRequest{status: http.StatusBadRequest, message: msg}
+		case errors.As(err, &syntaxError), errors.Is(err, io.ErrUnexpectedEOF):
+			return &malformedRequest{status: http.StatusBadRequest, code: "malformed_json"}
 		case errors.As(err, &unmarshalTypeError):
-			msg := fmt.Sprintf("Request body contains an invalid value for the %q field (at position %d)", unmarshalTypeError.Field, unmarshalTypeError.Offset)
-			return &malformedRequest{status: http.StatusBadRequest, message: msg}
+			return &malformedRequest{status: http.StatusBadRequest, code: "invalid_field", field: unmarshalTypeError.Field, args: []interface{}{unmarshalTypeError.Field}}
 		case strings.HasPrefix(err.Error(), "json: unknown field "):
 			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
-			msg := fmt.Sprintf("Request body contains unknown field %s", fieldName)
-			return &malformedRequest{status: http.StatusBadRequest, message: msg}
+			return &malformedRequest{status: http.StatusBadRequest, code: "unknown_field", field: strings.Trim(fieldName, `"`), args: []interface{}{fieldName}}
 		case errors.Is(err, io.EOF):
-			msg := "Request body must not be empty"
-			return &malformedRequest{status: http.StatusBadRequest, message: msg}
-		case err.Error() == "http: request body too large":
-			msg := "Request body must not be larger than 1MB"
-			return &malformedRequest{status: http.StatusRequestEntityTooLarge, message: msg}
+			return &malformedRequest{status: http.StatusBadRequest, code: "empty_body"}
 		default:
 			return err
 		}
 	}
+	if dec.More() {
+		return &malformedRequest{status: http.StatusBadRequest, code: "malformed_json"}
+	}
+	return nil
+}
 
+// readBody reads the body of r, refusing bodies above maxBodySize, and keeps
+// it for the next handlers to read it again
+func readBody(r *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize+1))
+	r.Body.Close()
+	if err != nil {
+		return nil, &malformedRequest{status: http.StatusBadRequest, code: "unreadable_body"}
+	}
+	if len(body) > maxBodySize {
+		return nil, &malformedRequest{status: http.StatusRequestEntityTooLarge, code: "body_too_large"}
+	}
 	r.Body = io.NopCloser(bytes.NewReader(body))
-	return nil
+	return body, nil
 }
 
 func readAddress(r *http.Request) (string, error) {
+	if address, ok := resolvedAddress(r.Context()); ok {
+		return address, nil
+	}
 	var claimReq claimRequest
 	if err := decodeJSONBody(r, &claimReq); err != nil {
 		return "", err
 	}
-	if !chain.IsValidAddress(claimReq.Address, true) {
-		return "", &malformedRequest{status: http.StatusBadRequest, message: "invalid address"}
+	switch {
+	case claimReq.Address == "":
+		return "", &malformedRequest{status: http.StatusBadRequest, code: "missing_field", field: "address", args: []interface{}{"address"}}
+	case chain.IsValidAddress(claimReq.Address, false) && !chain.IsValidAddress(claimReq.Address, true):
+		return "", &malformedRequest{status: http.StatusBadRequest, code: "invalid_checksum", field: "address"}
+	case !chain.IsValidAddress(claimReq.Address, true):
+		return "", &malformedRequest{status: http.StatusBadRequest, code: "invalid_address", field: "address"}
 	}
 
 	return claimReq.Address, nil
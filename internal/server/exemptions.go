@@ -0,0 +1,221 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/negroni"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+const (
+	bypassTokenHeader = "X-Bypass-Token"
+	bypassTokenPrefix = "fb_"
+	// maxBypassTTL bounds how long a bypass token is valid, as it skips every limit
+	maxBypassTTL = 7 * 24 * time.Hour
+
+	exemptAddress = "address"
+	exemptIP      = "ip"
+	exemptToken   = "bypass_token"
+)
+
+// BypassToken lets a claim skip the rate limits and captcha, e.g. for a user
+// a support case is about, until it expires or its uses run out
+type BypassToken struct {
+	ID        string    `json:"id"`
+	Note      string    `json:"note"`
+	Address   string    `json:"address,omitempty"`
+	Uses      int       `json:"uses"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// exemption tells why a claim skips the rate limits and captcha
+type exemption struct {
+	kind  string
+	token string
+}
+
+type exemptionKey struct{}
+
+func withExemption(r *http.Request, e exemption) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), exemptionKey{}, e))
+}
+
+// requestExemption returns why the claim made with ctx is exempted from the rate limits and captcha, if it is
+func requestExemption(ctx context.Context) (exemption, bool) {
+	e, ok := ctx.Value(exemptionKey{}).(exemption)
+	return e, ok
+}
+
+// Exemptions lets claims from exempt addresses and IP ranges, such as office
+// networks and internal test wallets, and claims with a bypass token skip the
+// rate limits and captcha. Bypass tokens are kept in memory only
+type Exemptions struct {
+	mutex   sync.Mutex
+	proxies *Proxies
+	list    *AccessList
+	tokens  map[string]*BypassToken
+}
+
+// NewExemptions exempts the entries of list, which may be nil, and the claims
+// carrying a bypass token
+func NewExemptions(proxies *Proxies, list *AccessList) *Exemptions {
+	return &Exemptions{proxies: proxies, list: list, tokens: make(map[string]*BypassToken)}
+}
+
+// Issue creates a bypass token valid for ttl and uses claims, optionally only
+// for address, and returns its secret, which is not stored and cannot be recovered
+func (e *Exemptions) Issue(note, address string, ttl time.Duration, uses int) (string, BypassToken, error) {
+	switch {
+	case note == "":
+		return "", BypassToken{}, errors.New("note is required")
+	case address != "" && !chain.IsValidAddress(address, true):
+		return "", BypassToken{}, fmt.Errorf("invalid address %q", address)
+	case ttl <= 0 || ttl > maxBypassTTL:
+		return "", BypassToken{}, fmt.Errorf("ttl must be positive and at most %s", maxBypassTTL)
+	case uses <= 0:
+		return "", BypassToken{}, errors.New("uses must be positive")
+	}
+	id, err := newRandomID()
+	if err != nil {
+		return "", BypassToken{}, err
+	}
+	secret, err := newRandomID()
+	if err != nil {
+		return "", BypassToken{}, err
+	}
+	secret = bypassTokenPrefix + secret
+	now := time.Now()
+	token := BypassToken{ID: id[:8], Note: note, Address: address, Uses: uses, ExpiresAt: now.Add(ttl), CreatedAt: now}
+
+	e.mutex.Lock()
+	e.tokens[hashAPIKey(secret)] = &token
+	e.mutex.Unlock()
+	return secret, token, nil
+}
+
+// Revoke invalidates the bypass token with id
+func (e *Exemptions) Revoke(id string) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	for hash, token := range e.tokens {
+		if token.ID == id {
+			delete(e.tokens, hash)
+			return nil
+		}
+	}
+	return fmt.Errorf("bypass token %q not found", id)
+}
+
+// Tokens returns the bypass tokens that have not expired
+func (e *Exemptions) Tokens() []BypassToken {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.prune(time.Now())
+	tokens := make([]BypassToken, 0, len(e.tokens))
+	for _, token := range e.tokens {
+		tokens = append(tokens, *token)
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].CreatedAt.Before(tokens[j].CreatedAt) })
+	return tokens
+}
+
+func (e *Exemptions) prune(now time.Time) {
+	for hash, token := range e.tokens {
+		if !now.Before(token.ExpiresAt) {
+			delete(e.tokens, hash)
+		}
+	}
+}
+
+// take uses up a claim of the token with secret if it is valid for address
+func (e *Exemptions) take(secret, address string) (BypassToken, bool) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.prune(time.Now())
+	token, ok := e.tokens[hashAPIKey(secret)]
+	if !ok || token.Uses <= 0 || (token.Address != "" && !strings.EqualFold(token.Address, address)) {
+		return BypassToken{}, false
+	}
+	token.Uses--
+	return *token, true
+}
+
+// giveBack returns the use of a token whose claim did not go through
+func (e *Exemptions) giveBack(secret string) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if token, ok := e.tokens[hashAPIKey(secret)]; ok {
+		token.Uses++
+	}
+}
+
+func (e *Exemptions) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	address, err := readAddress(r)
+	if err != nil {
+		// Malformed requests are reported by the limiter
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	clientIP := e.proxies.ClientIP(r)
+	fields := log.Fields{
+		"address":  address,
+		"clientIP": clientIP,
+	}
+	secret := r.Header.Get(bypassTokenHeader)
+	if secret != "" {
+		token, ok := e.take(secret, address)
+		if !ok {
+			requestLog(r.Context()).WithFields(fields).Warn("Claim rejected with an invalid bypass token")
+			renderLocalized(w, r, http.StatusUnauthorized, "invalid_bypass_token")
+			return
+		}
+		fields["exemption"] = exemptToken
+		fields["bypassToken"] = token.ID
+		fields["note"] = token.Note
+		requestLog(r.Context()).WithFields(fields).Info("Claim exempted from rate limits and captcha")
+		next.ServeHTTP(w, withExemption(r, exemption{kind: exemptToken, token: token.ID}))
+		if w.(negroni.ResponseWriter).Status() != http.StatusOK {
+			e.giveBack(secret)
+		}
+		return
+	}
+
+	var kind string
+	switch {
+	case e.list == nil:
+	case e.list.ContainsAddress(address):
+		kind = exemptAddress
+	case e.list.ContainsIP(clientIP):
+		kind = exemptIP
+	}
+	if kind == "" {
+		next.ServeHTTP(w, r)
+		return
+	}
+	fields["exemption"] = kind
+	requestLog(r.Context()).WithFields(fields).Info("Claim exempted from rate limits and captcha")
+	next.ServeHTTP(w, withExemption(r, exemption{kind: kind}))
+}
+
+// exemptionFields adds the log fields recording the exemption of the claim made with ctx
+func exemptionFields(ctx context.Context, fields log.Fields) {
+	e, ok := requestExemption(ctx)
+	if !ok {
+		return
+	}
+	fields["exemption"] = e.kind
+	if e.token != "" {
+		fields["bypassToken"] = e.token
+	}
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/urfave/negroni"
+)
+
+func TestExemptions(t *testing.T) {
+	list, _ := LoadAccessList("")
+	list.Add("0x0000000000000000000000000000000000000001")
+	list.Add("198.51.100.0/24")
+	exemptions := NewExemptions(nil, list)
+	secret, token, err := exemptions.Issue("ticket 42", "0x0000000000000000000000000000000000000003", time.Hour, 1)
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	limiter := NewLimiter(nil, time.Hour, 0, 0, 0)
+	var fail bool
+	handler := negroni.New(exemptions, limiter, negroni.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})))
+	claim := func(address, ip, bypass string) int {
+		body := bytes.NewBufferString(`{"address":"` + address + `"}`)
+		req := httptest.NewRequest("POST", "/api/claim", body)
+		req.RemoteAddr = ip + ":1234"
+		if bypass != "" {
+			req.Header.Set(bypassTokenHeader, bypass)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	tests := []struct {
+		name    string
+		address string
+		ip      string
+		bypass  string
+		want    int
+	}{
+		{name: "exempt address", address: "0x0000000000000000000000000000000000000001", ip: "192.0.2.1", want: http.StatusOK},
+		{name: "exempt address again", address: "0x0000000000000000000000000000000000000001", ip: "192.0.2.1", want: http.StatusOK},
+		{name: "exempt ip", address: "0x0000000000000000000000000000000000000002", ip: "198.51.100.7", want: http.StatusOK},
+		{name: "exempt ip again", address: "0x0000000000000000000000000000000000000002", ip: "198.51.100.7", want: http.StatusOK},
+		{name: "limited claim", address: "0x0000000000000000000000000000000000000003", ip: "192.0.2.3", want: http.StatusOK},
+		{name: "limited claim again", address: "0x0000000000000000000000000000000000000003", ip: "192.0.2.4", want: http.StatusTooManyRequests},
+		{name: "token for another address", address: "0x0000000000000000000000000000000000000004", ip: "192.0.2.5", bypass: secret, want: http.StatusUnauthorized},
+		{name: "bypass token", address: "0x0000000000000000000000000000000000000003", ip: "192.0.2.4", bypass: secret, want: http.StatusOK},
+		{name: "bypass token used up", address: "0x0000000000000000000000000000000000000003", ip: "192.0.2.4", bypass: secret, want: http.StatusUnauthorized},
+		{name: "unknown bypass token", address: "0x0000000000000000000000000000000000000005", ip: "192.0.2.5", bypass: "fb_invalid", want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := claim(tt.address, tt.ip, tt.bypass); got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	// A claim that does not go through gives the use of its token back
+	secret, _, _ = exemptions.Issue("ticket 43", "", time.Hour, 1)
+	fail = true
+	claim("0x0000000000000000000000000000000000000006", "192.0.2.6", secret)
+	fail = false
+	if got := claim("0x0000000000000000000000000000000000000006", "192.0.2.6", secret); got != http.StatusOK {
+		t.Errorf("status after a failed claim = %d, want %d", got, http.StatusOK)
+	}
+
+	if err := exemptions.Revoke(token.ID); err != nil {
+		t.Errorf("Revoke() error = %v", err)
+	}
+	if tokens := exemptions.Tokens(); len(tokens) != 1 || tokens[0].Note != "ticket 43" || tokens[0].Uses != 0 {
+		t.Errorf("Tokens() = %+v, want the used up ticket 43", tokens)
+	}
+	for _, ttl := range []time.Duration{0, 30 * 24 * time.Hour} {
+		if _, _, err := exemptions.Issue("ticket 44", "", ttl, 1); err == nil {
+			t.Errorf("Issue() accepted a ttl of %s", ttl)
+		}
+	}
+}
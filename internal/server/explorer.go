@@ -0,0 +1,67 @@
+package server
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// defaultExplorers link payouts on well known chains when no template is configured
+var defaultExplorers = map[string]string{
+	"1":        "https://etherscan.io/tx/{tx}",
+	"5":        "https://goerli.etherscan.io/tx/{tx}",
+	"122":      "https://explorer.fuse.io/tx/{tx}",
+	"123":      "https://explorer.fusespark.io/tx/{tx}",
+	"11155111": "https://sepolia.etherscan.io/tx/{tx}",
+}
+
+// Explorer builds block explorer links to payout txs from a URL template in
+// which {tx} stands for the tx hash
+type Explorer struct {
+	template string
+}
+
+// NewExplorer picks the template of the chain from templates, given as
+// "<chain ID>=<template>", falling back to baseURL + "/tx/{tx}" and then to
+// the default explorer of the chain
+func NewExplorer(chainID *big.Int, templates []string, baseURL string) (*Explorer, error) {
+	byChain := make(map[string]string, len(templates))
+	for _, entry := range templates {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || !strings.Contains(parts[1], "{tx}") {
+			return nil, fmt.Errorf("invalid explorer template %q, want <chain ID>=<URL with {tx}>", entry)
+		}
+		byChain[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+
+	var id string
+	if chainID != nil {
+		id = chainID.String()
+	}
+	switch {
+	case byChain[id] != "":
+		return &Explorer{template: byChain[id]}, nil
+	case baseURL != "":
+		return &Explorer{template: strings.TrimSuffix(baseURL, "/") + "/tx/{tx}"}, nil
+	default:
+		return &Explorer{template: defaultExplorers[id]}, nil
+	}
+}
+
+// TxURL returns the link to the tx, or an empty string if no explorer is known
+func (e *Explorer) TxURL(hash common.Hash) string {
+	if e == nil || e.template == "" {
+		return ""
+	}
+	return strings.ReplaceAll(e.template, "{tx}", hash.Hex())
+}
+
+// claimTxURL links the payout tx of the claim once it has been broadcast
+func (e *Explorer) claimTxURL(claim Claim) string {
+	if claim.TxHash == (common.Hash{}) || claim.Status == ClaimSimulated || claim.Status == ClaimFailed {
+		return ""
+	}
+	return e.TxURL(claim.TxHash)
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestExplorer(t *testing.T) {
+	hash := common.HexToHash("0x01")
+	tests := []struct {
+		name      string
+		chainID   int64
+		templates []string
+		baseURL   string
+		want      string
+	}{
+		{name: "template", chainID: 122, templates: []string{"1=https://one/{tx}", "122=https://fuse/tx/{tx}?tab=logs"}, baseURL: "https://base", want: "https://fuse/tx/" + hash.Hex() + "?tab=logs"},
+		{name: "base url", chainID: 122, templates: []string{"1=https://one/{tx}"}, baseURL: "https://base/", want: "https://base/tx/" + hash.Hex()},
+		{name: "default", chainID: 122, want: "https://explorer.fuse.io/tx/" + hash.Hex()},
+		{name: "unknown chain", chainID: 31337, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			explorer, err := NewExplorer(big.NewInt(tt.chainID), tt.templates, tt.baseURL)
+			if err != nil {
+				t.Fatalf("NewExplorer() error = %v", err)
+			}
+			if got := explorer.TxURL(hash); got != tt.want {
+				t.Errorf("TxURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := NewExplorer(big.NewInt(1), []string{"1=https://one/"}, ""); err == nil {
+		t.Error("NewExplorer() accepted a template without {tx}")
+	}
+}
@@ -0,0 +1,246 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/urfave/negroni"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+// Frontend is a partner site embedding the faucet, recognized by the Origin
+// header of its claims along with the API key issued to it under the name
+// APIKey. Quota caps its claims per UTC day, 0 meaning no cap, and Amount
+// replaces the base payout in Ethers if set
+type Frontend struct {
+	Origin    string    `json:"origin"`
+	APIKey    string    `json:"api_key"`
+	Quota     int       `json:"quota"`
+	Amount    string    `json:"amount,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// frontendUsage counts the claims of a frontend
+type frontendUsage struct {
+	day   time.Time
+	today int
+	total int
+}
+
+type frontendResponse struct {
+	Frontend
+	ClaimsToday int `json:"claims_today"`
+	ClaimsTotal int `json:"claims_total"`
+}
+
+// Frontends holds the registered partner frontends by origin, optionally
+// backed by a JSON file encrypted with key if set. Usage is kept in memory
+type Frontends struct {
+	mutex     sync.Mutex
+	path      string
+	key       []byte
+	frontends map[string]Frontend
+	usage     map[string]*frontendUsage
+}
+
+func LoadFrontends(path string, key []byte) (*Frontends, error) {
+	f := &Frontends{path: path, key: key, frontends: make(map[string]Frontend), usage: make(map[string]*frontendUsage)}
+	if path == "" {
+		return f, nil
+	}
+
+	data, err := readState(path, key)
+	if err != nil || data == nil {
+		return f, err
+	}
+	var frontends []Frontend
+	if err := json.Unmarshal(data, &frontends); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, frontend := range frontends {
+		frontend.Origin = normalizeOrigin(frontend.Origin)
+		f.frontends[frontend.Origin] = frontend
+	}
+	return f, nil
+}
+
+// normalizeOrigin lowercases origin and strips its trailing slash, as origins are matched
+func normalizeOrigin(origin string) string {
+	return strings.ToLower(strings.TrimSuffix(origin, "/"))
+}
+
+// Register adds a frontend or updates the API key, quota and amount of a registered one
+func (f *Frontends) Register(origin, apiKey string, quota int, amount string) error {
+	origin = normalizeOrigin(origin)
+	if !strings.HasPrefix(origin, "http://") && !strings.HasPrefix(origin, "https://") {
+		return errors.New("origin must be an http or https origin such as https://app.example.com")
+	}
+	if apiKey == "" {
+		return errors.New("api key is required")
+	}
+	if quota < 0 {
+		return errors.New("quota must not be negative")
+	}
+	if amount != "" {
+		if _, err := chain.ParseEther(amount); err != nil {
+			return fmt.Errorf("invalid amount: %w", err)
+		}
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	createdAt := time.Now()
+	if existing, ok := f.frontends[origin]; ok {
+		createdAt = existing.CreatedAt
+	}
+	f.frontends[origin] = Frontend{Origin: origin, APIKey: apiKey, Quota: quota, Amount: amount, CreatedAt: createdAt}
+	return f.save()
+}
+
+func (f *Frontends) Remove(origin string) error {
+	origin = normalizeOrigin(origin)
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if _, ok := f.frontends[origin]; !ok {
+		return fmt.Errorf("frontend %q not found", origin)
+	}
+	delete(f.frontends, origin)
+	delete(f.usage, origin)
+	return f.save()
+}
+
+// List returns the frontends with their usage
+func (f *Frontends) List() []frontendResponse {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	day := today()
+	resp := make([]frontendResponse, 0, len(f.frontends))
+	for _, frontend := range f.list() {
+		r := frontendResponse{Frontend: frontend}
+		if usage, ok := f.usage[frontend.Origin]; ok {
+			r.ClaimsTotal = usage.total
+			if usage.day.Equal(day) {
+				r.ClaimsToday = usage.today
+			}
+		}
+		resp = append(resp, r)
+	}
+	return resp
+}
+
+func (f *Frontends) list() []Frontend {
+	frontends := make([]Frontend, 0, len(f.frontends))
+	for _, frontend := range f.frontends {
+		frontends = append(frontends, frontend)
+	}
+	sort.Slice(frontends, func(i, j int) bool { return frontends[i].Origin < frontends[j].Origin })
+	return frontends
+}
+
+// Lookup returns the frontend registered for origin, which may match a wildcard subdomain
+func (f *Frontends) Lookup(origin string) (Frontend, bool) {
+	if origin == "" {
+		return Frontend{}, false
+	}
+	origin = normalizeOrigin(origin)
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if frontend, ok := f.frontends[origin]; ok {
+		return frontend, true
+	}
+	for pattern, frontend := range f.frontends {
+		if strings.Contains(pattern, "*.") && matchOrigin(pattern, origin) {
+			return frontend, true
+		}
+	}
+	return Frontend{}, false
+}
+
+// Authenticate returns the frontend the request comes from, which requires
+// both its origin and the API key issued to the frontend. Anyone can set an
+// Origin header, so claims without the key are treated as any other claim
+func (f *Frontends) Authenticate(r *http.Request) (Frontend, bool) {
+	frontend, found := f.Lookup(r.Header.Get("Origin"))
+	key, ok := requestAPIKey(r.Context())
+	if !found || !ok || key.Name != frontend.APIKey {
+		return Frontend{}, false
+	}
+	return frontend, true
+}
+
+// reserve counts a claim against the daily quota of the frontend
+func (f *Frontends) reserve(frontend Frontend) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	usage, ok := f.usage[frontend.Origin]
+	if !ok {
+		usage = &frontendUsage{}
+		f.usage[frontend.Origin] = usage
+	}
+	if day := today(); !usage.day.Equal(day) {
+		usage.day, usage.today = day, 0
+	}
+	if frontend.Quota > 0 && usage.today >= frontend.Quota {
+		return false
+	}
+	usage.today++
+	usage.total++
+	return true
+}
+
+// release gives back a claim that did not go through
+func (f *Frontends) release(frontend Frontend) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if usage, ok := f.usage[frontend.Origin]; ok && usage.today > 0 {
+		usage.today--
+		usage.total--
+	}
+}
+
+func (f *Frontends) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	frontend, ok := f.Authenticate(r)
+	if !ok {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	if !f.reserve(frontend) {
+		wait := today().Add(24 * time.Hour).Sub(time.Now())
+		requestLog(r.Context()).WithField("origin", frontend.Origin).Info("Claim rejected by frontend quota")
+		rateLimited(w, r, wait, "frontend_quota_exceeded", frontend.Quota)
+		return
+	}
+	if frontend.Amount != "" {
+		amount, _ := chain.ParseEther(frontend.Amount)
+		r = r.WithContext(withPayoutBase(r.Context(), amount))
+	}
+	next.ServeHTTP(w, r)
+	if w.(negroni.ResponseWriter).Status() != http.StatusOK {
+		f.release(frontend)
+	}
+}
+
+func (f *Frontends) save() error {
+	if f.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(f.list(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeState(f.path, f.key, data)
+}
+
+// today returns the start of the current UTC day, when frontend quotas reset
+func today() time.Time {
+	return time.Now().UTC().Truncate(24 * time.Hour)
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/urfave/negroni"
+)
+
+func TestFrontends(t *testing.T) {
+	keys, _ := LoadAPIKeys("")
+	secret, _ := keys.Issue("app", 100)
+	f, _ := LoadFrontends("", nil)
+	for _, origin := range []string{"", "app.example.com", "ftp://app.example.com"} {
+		if err := f.Register(origin, "app", 1, ""); err == nil {
+			t.Errorf("Register(%q) succeeded, want error", origin)
+		}
+	}
+	if err := f.Register("https://app.example.com", "", 1, ""); err == nil {
+		t.Error("frontend without api key accepted")
+	}
+	if err := f.Register("https://app.example.com", "app", -1, ""); err == nil {
+		t.Error("negative quota accepted")
+	}
+	if err := f.Register("https://app.example.com", "app", 1, "abc"); err == nil {
+		t.Error("invalid amount accepted")
+	}
+	if err := f.Register("https://App.example.com/", "app", 1, "0.5"); err != nil {
+		t.Fatal(err)
+	}
+
+	var status int
+	var base string
+	handler := negroni.New(keys, f, negroni.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		base = ""
+		if amount := payoutBase(r.Context()); amount != nil {
+			base = amount.String()
+		}
+		w.WriteHeader(status)
+	})))
+	claim := func(origin, key string) int {
+		r := httptest.NewRequest("POST", "/api/claim", nil)
+		r.Header.Set("Origin", origin)
+		if key != "" {
+			r.Header.Set(apiKeyHeader, key)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec.Code
+	}
+
+	status = http.StatusBadRequest
+	if code := claim("https://app.example.com", secret); code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", code, http.StatusBadRequest)
+	}
+	status = http.StatusOK
+	if code := claim("https://app.example.com", secret); code != http.StatusOK {
+		t.Fatalf("status = %d, want %d, failed claims must not use up the quota", code, http.StatusOK)
+	}
+	if base != "500000000000000000" {
+		t.Errorf("base payout = %s, want 0.5 ether", base)
+	}
+	if code := claim("https://app.example.com", secret); code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", code, http.StatusTooManyRequests)
+	}
+	if list := f.List(); len(list) != 1 || list[0].ClaimsToday != 1 || list[0].ClaimsTotal != 1 {
+		t.Errorf("list = %+v, want one claim counted", list)
+	}
+
+	// Claims that only carry the origin are not the frontend's
+	if code := claim("https://app.example.com", ""); code != http.StatusOK || base != "" {
+		t.Errorf("claim without the api key = %d with base %q, want %d without one", code, base, http.StatusOK)
+	}
+	other, _ := keys.Issue("other", 100)
+	if code := claim("https://app.example.com", other); code != http.StatusOK || base != "" {
+		t.Errorf("claim with another api key = %d with base %q, want %d without one", code, base, http.StatusOK)
+	}
+	if code := claim("https://other.example.com", secret); code != http.StatusOK {
+		t.Errorf("status of unregistered origin = %d, want %d", code, http.StatusOK)
+	}
+}
+
+func TestFrontendsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "frontends.json")
+	if err := os.WriteFile(path, []byte(`[{"origin":"https://App.Example.com/","api_key":"app","quota":5}]`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	key := make([]byte, 32)
+	f, err := LoadFrontends(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frontend, ok := f.Lookup("https://app.example.com"); !ok || frontend.Origin != "https://app.example.com" {
+		t.Fatalf("Lookup() = %+v, %v, want the origin of the file lowercased", frontend, ok)
+	}
+
+	if err := f.Register("https://shop.example.com", "shop", 10, "2"); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := LoadFrontends(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list := reloaded.List(); len(list) != 2 || list[1].APIKey != "shop" || list[1].Amount != "2" {
+		t.Errorf("reloaded frontends = %+v, want both frontends", list)
+	}
+	if _, err := LoadFrontends(path, nil); err == nil {
+		t.Error("encrypted frontends loaded without the state key")
+	}
+}
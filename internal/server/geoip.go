@@ -0,0 +1,240 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+	log "github.com/sirupsen/logrus"
+)
+
+type geoPolicy int
+
+const (
+	geoAllow geoPolicy = iota
+	geoBlock
+	geoCaptcha
+	geoReduce
+	geoStrict
+)
+
+type countryKey struct{}
+type cooldownKey struct{}
+type strictCaptchaKey struct{}
+type asnKey struct{}
+
+func withCountry(r *http.Request, country string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), countryKey{}, country))
+}
+
+// requestCountry returns the ISO code of the country the request came from, if known
+func requestCountry(ctx context.Context) string {
+	country, _ := ctx.Value(countryKey{}).(string)
+	return country
+}
+
+// requestASN returns the autonomous system the request came from, if known
+func requestASN(ctx context.Context) (asnRecord, bool) {
+	asn, ok := ctx.Value(asnKey{}).(asnRecord)
+	return asn, ok
+}
+
+// withStrictCaptcha makes the request solve hCaptcha even if it offers a proof of work
+func withStrictCaptcha(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), strictCaptchaKey{}, true))
+}
+
+func strictCaptcha(ctx context.Context) bool {
+	strict, _ := ctx.Value(strictCaptchaKey{}).(bool)
+	return strict
+}
+
+// withCooldown raises the cooldown the limiter applies to the request to at least ttl
+func withCooldown(r *http.Request, ttl time.Duration) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), cooldownKey{}, ttl))
+}
+
+func requestCooldown(ctx context.Context) time.Duration {
+	ttl, _ := ctx.Value(cooldownKey{}).(time.Duration)
+	return ttl
+}
+
+type asnRecord struct {
+	Number       uint   `maxminddb:"autonomous_system_number"`
+	Organization string `maxminddb:"autonomous_system_organization"`
+}
+
+// GeoIP looks up the country and the autonomous system of the client IP in
+// MaxMind databases and applies the policy configured for them. Countries can
+// be blocked, required to solve hCaptcha or paid reducedPayout; hosting and VPN
+// networks can be blocked or given the longer strictTTL cooldown
+type GeoIP struct {
+	proxies       *Proxies
+	lookup        func(ip net.IP) (string, error)
+	lookupASN     func(ip net.IP) (asnRecord, error)
+	closers       []func() error
+	policies      map[string]geoPolicy
+	asnPolicies   map[uint]geoPolicy
+	reducedPayout *big.Int
+	strictTTL     time.Duration
+}
+
+// OpenGeoIP opens the GeoIP2 or GeoLite2 country database at path and the ASN
+// database at asnPath, an empty path disables the respective lookups
+func OpenGeoIP(path, asnPath string, proxies *Proxies) (*GeoIP, error) {
+	g := &GeoIP{proxies: proxies, policies: make(map[string]geoPolicy), asnPolicies: make(map[uint]geoPolicy)}
+	if path != "" {
+		reader, err := maxminddb.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		g.closers = append(g.closers, reader.Close)
+		g.lookup = func(ip net.IP) (string, error) {
+			var record struct {
+				Country struct {
+					ISOCode string `maxminddb:"iso_code"`
+				} `maxminddb:"country"`
+			}
+			err := reader.Lookup(ip, &record)
+			return record.Country.ISOCode, err
+		}
+	}
+	if asnPath != "" {
+		reader, err := maxminddb.Open(asnPath)
+		if err != nil {
+			g.Close()
+			return nil, err
+		}
+		g.closers = append(g.closers, reader.Close)
+		g.lookupASN = func(ip net.IP) (asnRecord, error) {
+			var record asnRecord
+			err := reader.Lookup(ip, &record)
+			return record, err
+		}
+	}
+	return g, nil
+}
+
+// SetPolicies assigns a policy to each of the given country codes
+func (g *GeoIP) SetPolicies(block, captcha, reduce []string, reducedPayout *big.Int) {
+	for policy, countries := range map[geoPolicy][]string{geoBlock: block, geoCaptcha: captcha, geoReduce: reduce} {
+		for _, country := range countries {
+			g.policies[strings.ToUpper(country)] = policy
+		}
+	}
+	g.reducedPayout = reducedPayout
+}
+
+// SetASNPolicies blocks the given autonomous system numbers, e.g. "AS16509" or
+// "16509", and applies strictTTL as the cooldown of the strict ones
+func (g *GeoIP) SetASNPolicies(block, strict []string, strictTTL time.Duration) error {
+	for policy, asns := range map[geoPolicy][]string{geoBlock: block, geoStrict: strict} {
+		for _, asn := range asns {
+			number, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(asn), "AS"), 10, 32)
+			if err != nil {
+				return fmt.Errorf("invalid ASN %q", asn)
+			}
+			g.asnPolicies[uint(number)] = policy
+		}
+	}
+	g.strictTTL = strictTTL
+	return nil
+}
+
+func (g *GeoIP) Close() error {
+	var firstErr error
+	for _, closer := range g.closers {
+		if err := closer(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (g *GeoIP) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	if g.lookup == nil && g.lookupASN == nil {
+		next.ServeHTTP(w, r)
+		return
+	}
+	clientIP := g.proxies.ClientIP(r)
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	if g.lookup != nil {
+		var rejected bool
+		if r, rejected = g.applyCountry(w, r, ip); rejected {
+			return
+		}
+	}
+	if g.lookupASN != nil {
+		var rejected bool
+		if r, rejected = g.applyASN(w, r, ip); rejected {
+			return
+		}
+	}
+	next.ServeHTTP(w, r)
+}
+
+func (g *GeoIP) applyCountry(w http.ResponseWriter, r *http.Request, ip net.IP) (*http.Request, bool) {
+	country, err := g.lookup(ip)
+	if err != nil {
+		// A broken database should not take the faucet down
+		requestLog(r.Context()).WithError(err).WithField("clientIP", ip).Warn("Failed to look up country")
+		return r, false
+	}
+	if country == "" {
+		return r, false
+	}
+
+	r = withCountry(r, country)
+	switch g.policies[country] {
+	case geoBlock:
+		requestLog(r.Context()).WithFields(log.Fields{
+			"clientIP": ip,
+			"country":  country,
+		}).Info("Claim rejected by country policy")
+		flagClaim(r, "country_blocked")
+		renderLocalized(w, r, http.StatusForbidden, "country_blocked")
+		return r, true
+	case geoCaptcha:
+		r = withStrictCaptcha(r)
+	case geoReduce:
+		if g.reducedPayout != nil {
+			r = withPayoutLimit(r, g.reducedPayout)
+		}
+	}
+	return r, false
+}
+
+func (g *GeoIP) applyASN(w http.ResponseWriter, r *http.Request, ip net.IP) (*http.Request, bool) {
+	asn, err := g.lookupASN(ip)
+	if err != nil {
+		requestLog(r.Context()).WithError(err).WithField("clientIP", ip).Warn("Failed to look up ASN")
+		return r, false
+	}
+	r = r.WithContext(context.WithValue(r.Context(), asnKey{}, asn))
+
+	switch g.asnPolicies[asn.Number] {
+	case geoBlock:
+		requestLog(r.Context()).WithFields(log.Fields{
+			"clientIP":     ip,
+			"asn":          asn.Number,
+			"organization": asn.Organization,
+		}).Info("Claim rejected by network policy")
+		flagClaim(r, "network_blocked")
+		renderLocalized(w, r, http.StatusForbidden, "network_blocked")
+		return r, true
+	case geoStrict:
+		r = withCooldown(r, g.strictTTL)
+	}
+	return r, false
+}
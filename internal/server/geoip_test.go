@@ -0,0 +1,128 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/urfave/negroni"
+)
+
+func TestGeoIP(t *testing.T) {
+	countries := map[string]string{"1.1.1.1": "AU", "2.2.2.2": "FR", "3.3.3.3": "US", "4.4.4.4": "DE"}
+	geoip := &GeoIP{
+		lookup: func(ip net.IP) (string, error) {
+			return countries[ip.String()], nil
+		},
+		policies: make(map[string]geoPolicy),
+	}
+	geoip.SetPolicies([]string{"au"}, []string{"FR"}, []string{"US"}, big.NewInt(1))
+
+	var (
+		country string
+		strict  bool
+		limit   *big.Int
+	)
+	handler := negroni.New(geoip, negroni.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		country, strict, limit = requestCountry(r.Context()), strictCaptcha(r.Context()), payoutLimit(r.Context())
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	tests := []struct {
+		name       string
+		ip         string
+		wantStatus int
+		wantStrict bool
+		wantLimit  bool
+	}{
+		{name: "blocked", ip: "1.1.1.1", wantStatus: http.StatusForbidden},
+		{name: "captcha", ip: "2.2.2.2", wantStatus: http.StatusOK, wantStrict: true},
+		{name: "reduced", ip: "3.3.3.3", wantStatus: http.StatusOK, wantLimit: true},
+		{name: "allowed", ip: "4.4.4.4", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			country, strict, limit = "", false, nil
+			req := httptest.NewRequest("POST", "/api/claim", nil)
+			req.RemoteAddr = tt.ip + ":1234"
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if country != countries[tt.ip] {
+				t.Errorf("requestCountry() = %q, want %q", country, countries[tt.ip])
+			}
+			if strict != tt.wantStrict {
+				t.Errorf("strictCaptcha() = %v, want %v", strict, tt.wantStrict)
+			}
+			if (limit != nil) != tt.wantLimit {
+				t.Errorf("payoutLimit() = %v, want limit %v", limit, tt.wantLimit)
+			}
+		})
+	}
+}
+
+func TestGeoIPASN(t *testing.T) {
+	networks := map[string]asnRecord{
+		"1.1.1.1": {Number: 16509, Organization: "AMAZON-02"},
+		"2.2.2.2": {Number: 14061, Organization: "DIGITALOCEAN-ASN"},
+		"3.3.3.3": {Number: 3320, Organization: "Deutsche Telekom AG"},
+	}
+	geoip := &GeoIP{
+		lookupASN: func(ip net.IP) (asnRecord, error) {
+			return networks[ip.String()], nil
+		},
+		asnPolicies: make(map[uint]geoPolicy),
+	}
+	if err := geoip.SetASNPolicies([]string{"AS16509"}, []string{"14061"}, 24*time.Hour); err != nil {
+		t.Fatalf("SetASNPolicies() error = %v", err)
+	}
+	if err := geoip.SetASNPolicies([]string{"amazon"}, nil, 0); err == nil {
+		t.Errorf("SetASNPolicies() accepted an invalid ASN")
+	}
+
+	limiter := NewLimiter(nil, time.Hour, 0, 0, 0)
+	handler := negroni.New(geoip, limiter, negroni.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	tests := []struct {
+		name       string
+		ip         string
+		wantStatus int
+		wantTTL    time.Duration
+	}{
+		{name: "blocked", ip: "1.1.1.1", wantStatus: http.StatusForbidden},
+		{name: "strict", ip: "2.2.2.2", wantStatus: http.StatusOK, wantTTL: 24 * time.Hour},
+		{name: "residential", ip: "3.3.3.3", wantStatus: http.StatusOK, wantTTL: time.Hour},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			address := fmt.Sprintf("0x%040x", i+1)
+			body := bytes.NewBufferString(`{"address":"` + address + `"}`)
+			req := httptest.NewRequest("POST", "/api/claim", body)
+			req.RemoteAddr = tt.ip + ":1234"
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantTTL == 0 {
+				return
+			}
+			_, ttl, err := limiter.cache.GetWithTTL(tt.ip)
+			if err != nil || ttl <= tt.wantTTL-time.Minute || ttl > tt.wantTTL {
+				t.Errorf("cooldown = %s, %v, want %s", ttl, err, tt.wantTTL)
+			}
+		})
+	}
+}
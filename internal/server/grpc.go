@@ -0,0 +1,287 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/negroni"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/runtime/protoiface"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	faucetv1 "github.com/chainflag/eth-faucet/api/faucet/v1"
+)
+
+// errorDomain identifies the faucet in the ErrorInfo details of gRPC errors
+const errorDomain = "eth-faucet"
+
+type gatewayRequestKey struct{}
+
+// gatewayRequest returns the HTTP request a gRPC call was made through the gateway for, if any
+func gatewayRequest(ctx context.Context) (*http.Request, bool) {
+	r, ok := ctx.Value(gatewayRequestKey{}).(*http.Request)
+	return r, ok
+}
+
+// grpcService serves the gRPC API. Claims are made by running a request
+// through the claim pipeline of the HTTP server, so that they go through
+// exactly the same checks as POST /api/claim
+type grpcService struct {
+	faucetv1.UnimplementedFaucetServiceServer
+	server *Server
+	// claims serves calls from gRPC clients, which have not been logged and
+	// throttled by the HTTP server like the calls through the gateway
+	claims   http.Handler
+	pipeline http.Handler
+}
+
+func newGRPCService(s *Server) *grpcService {
+	pipeline := s.claimPipeline()
+	return &grpcService{
+		server:   s,
+		claims:   negroni.New(NewTracing(), NewRequestLogger(s.proxies), s.throttle, negroni.Wrap(pipeline)),
+		pipeline: pipeline,
+	}
+}
+
+// newGRPCServer returns a gRPC server of the API, which can be listed through server reflection
+func newGRPCServer(service *grpcService) *grpc.Server {
+	server := grpc.NewServer()
+	faucetv1.RegisterFaucetServiceServer(server, service)
+	reflection.Register(server)
+	return server
+}
+
+// newGateway returns the JSON routes of the API, which call it in process
+func newGateway(ctx context.Context, service *grpcService) (http.Handler, error) {
+	mux := runtime.NewServeMux()
+	if err := faucetv1.RegisterFaucetServiceHandlerServer(ctx, mux, service); err != nil {
+		return nil, err
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), gatewayRequestKey{}, r)))
+	}), nil
+}
+
+func (s *Server) serveGRPC() {
+	port := s.config().GRPCPort
+	listener, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Infof("Starting grpc server %d", port)
+	if err := s.grpcServer.Serve(listener); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// stopGRPC waits for ongoing calls to finish until ctx is done, then cancels them
+func (s *Server) stopGRPC(ctx context.Context) {
+	stopped := make(chan struct{})
+	go func() {
+		s.grpcServer.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		s.grpcServer.Stop()
+	}
+}
+
+func (g *grpcService) Claim(ctx context.Context, req *faucetv1.ClaimRequest) (*faucetv1.ClaimResponse, error) {
+	body, _ := json.Marshal(claimRequest{
+		Address:   req.Address,
+		Message:   req.Message,
+		Signature: req.Signature,
+		Email:     req.Email,
+		Amount:    req.Amount,
+		Chain:     req.Chain,
+		Token:     req.Token,
+		Purpose:   req.Purpose,
+	})
+	r, err := http.NewRequestWithContext(ctx, "POST", "/api/claim", bytes.NewReader(body))
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	handler := g.claims
+	if original, ok := gatewayRequest(ctx); ok {
+		handler = g.pipeline
+		r.Header = original.Header.Clone()
+		r.RemoteAddr = original.RemoteAddr
+	} else {
+		r.Header, r.RemoteAddr = grpcHeader(ctx)
+	}
+	r.Header.Set("Content-Type", "application/json")
+
+	w := newBufferedResponse()
+	handler.ServeHTTP(w, r)
+	var resp claimResponse
+	if err := json.Unmarshal(w.body.Bytes(), &resp); err != nil {
+		return nil, status.Error(codes.Internal, "malformed claim response")
+	}
+	if w.status != http.StatusOK {
+		return nil, grpcError(w.status, resp)
+	}
+
+	claim := &faucetv1.ClaimResponse{ClaimId: resp.ClaimID, Message: resp.Message}
+	if resp.Remaining != nil {
+		claim.Remaining = &faucetv1.Allowance{Amount: resp.Remaining.Amount}
+		if resp.Remaining.Claims != nil {
+			claims := int32(*resp.Remaining.Claims)
+			claim.Remaining.Claims = &claims
+		}
+	}
+	if resp.DryRun != nil {
+		claim.DryRun = &faucetv1.DryRun{Address: resp.DryRun.Address, Amount: resp.DryRun.Amount, Funder: resp.DryRun.Funder}
+	}
+	return claim, nil
+}
+
+func (g *grpcService) GetClaim(ctx context.Context, req *faucetv1.GetClaimRequest) (*faucetv1.ClaimStatus, error) {
+	claim, ok := g.server.queue.Get(req.ClaimId)
+	if !ok {
+		return nil, g.claimNotFound(ctx)
+	}
+	return newGRPCClaimStatus(claim, g.server.explorer), nil
+}
+
+func (g *grpcService) WatchClaim(req *faucetv1.GetClaimRequest, stream faucetv1.FaucetService_WatchClaimServer) error {
+	// Subscribe before reading the claim so no status change is missed in between
+	updates, unsubscribe := g.server.queue.Subscribe(req.ClaimId)
+	defer unsubscribe()
+	claim, ok := g.server.queue.Get(req.ClaimId)
+	if !ok {
+		return g.claimNotFound(stream.Context())
+	}
+
+	for {
+		if err := stream.Send(newGRPCClaimStatus(claim, g.server.explorer)); err != nil {
+			return err
+		}
+		if g.server.queue.Final(claim.Status) {
+			return nil
+		}
+
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case <-g.server.streams.Done():
+			return status.Error(codes.Unavailable, "server is shutting down")
+		case claim = <-updates:
+		}
+	}
+}
+
+func (g *grpcService) claimNotFound(ctx context.Context) error {
+	header, _ := grpcHeader(ctx)
+	if original, ok := gatewayRequest(ctx); ok {
+		header = original.Header
+	}
+	lang := requestLanguage(&http.Request{Header: header})
+	return grpcError(http.StatusNotFound, claimResponse{Message: localize(lang, "claim_not_found"), Code: "claim_not_found"})
+}
+
+func newGRPCClaimStatus(claim Claim, explorer *Explorer) *faucetv1.ClaimStatus {
+	resp := newClaimStatusResponse(claim, explorer)
+	return &faucetv1.ClaimStatus{
+		ClaimId:     resp.ClaimID,
+		Address:     resp.Address,
+		Status:      resp.Status,
+		TxHash:      resp.TxHash,
+		ExplorerUrl: resp.ExplorerURL,
+		Error:       resp.Error,
+	}
+}
+
+// grpcHeader turns the metadata of a gRPC call into the headers of an HTTP
+// request, and the peer of the call into its remote address
+func grpcHeader(ctx context.Context) (http.Header, string) {
+	header := make(http.Header)
+	md, _ := metadata.FromIncomingContext(ctx)
+	for key, values := range md {
+		if strings.HasPrefix(key, ":") || strings.HasPrefix(key, "grpc-") || key == "content-type" {
+			continue
+		}
+		for _, value := range values {
+			header.Add(key, value)
+		}
+	}
+	var remoteAddr string
+	if p, ok := peer.FromContext(ctx); ok {
+		remoteAddr = p.Addr.String()
+	}
+	return header, remoteAddr
+}
+
+// grpcError converts an error response of the claim pipeline to a gRPC
+// status, with the error code as the reason of its ErrorInfo details
+func grpcError(httpStatus int, resp claimResponse) error {
+	var code codes.Code
+	switch httpStatus {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge:
+		code = codes.InvalidArgument
+	case http.StatusUnauthorized:
+		code = codes.Unauthenticated
+	case http.StatusForbidden:
+		code = codes.PermissionDenied
+	case http.StatusNotFound:
+		code = codes.NotFound
+	case http.StatusTooManyRequests:
+		code = codes.ResourceExhausted
+	case http.StatusServiceUnavailable:
+		code = codes.Unavailable
+	default:
+		code = codes.Internal
+	}
+
+	st := status.New(code, resp.Message)
+	if resp.Code == "" {
+		return st.Err()
+	}
+	details := []protoiface.MessageV1{&errdetails.ErrorInfo{Reason: resp.Code, Domain: errorDomain}}
+	if resp.RetryAfter > 0 {
+		details = append(details, &errdetails.RetryInfo{RetryDelay: durationpb.New(time.Duration(resp.RetryAfter) * time.Second)})
+	}
+	if withDetails, err := st.WithDetails(details...); err == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
+
+// bufferedResponse keeps the response of the claim pipeline to a gRPC call
+type bufferedResponse struct {
+	header http.Header
+	body   bytes.Buffer
+	status int
+}
+
+func newBufferedResponse() *bufferedResponse {
+	return &bufferedResponse{header: make(http.Header), status: http.StatusOK}
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) Write(data []byte) (int, error) {
+	return b.body.Write(data)
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	b.status = status
+}
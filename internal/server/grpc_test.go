@@ -0,0 +1,119 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	faucetv1 "github.com/chainflag/eth-faucet/api/faucet/v1"
+)
+
+func TestGRPCService(t *testing.T) {
+	builder := &mockTxBuilder{}
+	var claims []*http.Request
+	var bodies []claimRequest
+	pipeline := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims = append(claims, r)
+		var req claimRequest
+		decodeJSONBody(r, &req)
+		bodies = append(bodies, req)
+		if req.Address == "0x0000000000000000000000000000000000000000" {
+			rateLimited(w, r, time.Minute, "address_cooldown")
+			return
+		}
+		renderJSON(w, claimResponse{Message: "queued", ClaimID: "abc"}, http.StatusOK)
+	})
+	service := &grpcService{
+		server:   &Server{TxBuilder: builder, queue: NewQueue(builder, 1, 1)},
+		claims:   pipeline,
+		pipeline: pipeline,
+	}
+
+	listener := bufconn.Listen(1 << 20)
+	server := newGRPCServer(service)
+	go server.Serve(listener)
+	defer server.Stop()
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := faucetv1.NewFaucetServiceClient(conn)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", "secret")
+	resp, err := client.Claim(ctx, &faucetv1.ClaimRequest{
+		Address: "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B",
+		Amount:  "0.5",
+		Chain:   "1337",
+		Token:   "ETH",
+		Purpose: "ci",
+	})
+	if err != nil {
+		t.Fatalf("Claim() error = %v", err)
+	}
+	if resp.ClaimId != "abc" {
+		t.Errorf("claim ID = %q, want abc", resp.ClaimId)
+	}
+	if r := claims[0]; r.Header.Get("X-API-Key") != "secret" || r.RemoteAddr == "" {
+		t.Errorf("claim request headers = %v from %q, want the call metadata and peer", r.Header, r.RemoteAddr)
+	}
+	if req := bodies[0]; req.Amount != "0.5" || req.Chain != "1337" || req.Token != "ETH" || req.Purpose != "ci" {
+		t.Errorf("claim request = %+v, want the amount, chain, token and purpose of the call", req)
+	}
+
+	_, err = client.Claim(context.Background(), &faucetv1.ClaimRequest{Address: "0x0000000000000000000000000000000000000000"})
+	st := status.Convert(err)
+	if st.Code() != codes.ResourceExhausted {
+		t.Fatalf("Claim() error = %v, want %v", err, codes.ResourceExhausted)
+	}
+	var reason string
+	var retryDelay time.Duration
+	for _, detail := range st.Details() {
+		switch d := detail.(type) {
+		case *errdetails.ErrorInfo:
+			reason = d.Reason
+		case *errdetails.RetryInfo:
+			retryDelay = d.RetryDelay.AsDuration()
+		}
+	}
+	if reason != "address_cooldown" || retryDelay != time.Minute {
+		t.Errorf("error details = %v, want the error code and retry delay", st.Details())
+	}
+
+	if _, err := client.GetClaim(context.Background(), &faucetv1.GetClaimRequest{ClaimId: "unknown"}); status.Code(err) != codes.NotFound {
+		t.Errorf("GetClaim() error = %v, want %v", err, codes.NotFound)
+	}
+
+	gateway, err := newGateway(context.Background(), service)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("POST", "/api/v1/claim", strings.NewReader(`{"address":"0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"}`))
+	r.Header.Set("h-captcha-response", "token")
+	rec := httptest.NewRecorder()
+	gateway.ServeHTTP(rec, r)
+	var body map[string]interface{}
+	json.NewDecoder(rec.Body).Decode(&body)
+	if rec.Code != http.StatusOK || body["claimId"] != "abc" {
+		t.Fatalf("gateway status = %d, body = %v", rec.Code, body)
+	}
+	if r := claims[len(claims)-1]; r.Header.Get("h-captcha-response") != "token" || r.RemoteAddr != "192.0.2.1:1234" {
+		t.Errorf("gateway claim headers = %v from %q, want those of the HTTP request", r.Header, r.RemoteAddr)
+	}
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// SecurityHeaders sets the response headers that keep browsers from sniffing
+// content types, framing the faucet on other sites and, once it is served
+// over HTTPS, from ever reaching it over plain HTTP again. An empty frame
+// option leaves framing allowed and a zero hsts max age sends no HSTS header.
+// The header only covers subdomains if subdomains is set, as it would lock
+// out any of them that is not served over HTTPS
+type SecurityHeaders struct {
+	frameOptions string
+	hsts         string
+}
+
+func NewSecurityHeaders(frameOptions string, hstsMaxAge time.Duration, subdomains bool) *SecurityHeaders {
+	h := &SecurityHeaders{frameOptions: frameOptions}
+	if hstsMaxAge > 0 {
+		h.hsts = "max-age=" + strconv.FormatInt(int64(hstsMaxAge/time.Second), 10)
+		if subdomains {
+			h.hsts += "; includeSubDomains"
+		}
+	}
+	return h
+}
+
+func (h *SecurityHeaders) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Referrer-Policy", "strict-origin-when-cross-origin")
+	if h.frameOptions != "" {
+		w.Header().Set("X-Frame-Options", h.frameOptions)
+	}
+	// Browsers ignore HSTS on plain HTTP responses, which may also come from
+	// behind a proxy that did not terminate TLS for this host
+	if h.hsts != "" && r.TLS != nil {
+		w.Header().Set("Strict-Transport-Security", h.hsts)
+	}
+	next.ServeHTTP(w, r)
+}
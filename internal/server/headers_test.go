@@ -0,0 +1,57 @@
+package server
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/urfave/negroni"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	handler := negroni.New(NewSecurityHeaders("DENY", 24*time.Hour, false), negroni.Wrap(http.NotFoundHandler()))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Header().Get("X-Content-Type-Options") != "nosniff" || rec.Header().Get("X-Frame-Options") != "DENY" {
+		t.Errorf("headers = %v, want nosniff and DENY", rec.Header())
+	}
+	if hsts := rec.Header().Get("Strict-Transport-Security"); hsts != "" {
+		t.Errorf("HSTS over plain HTTP = %q, want none", hsts)
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.TLS = &tls.ConnectionState{}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	if hsts := rec.Header().Get("Strict-Transport-Security"); hsts != "max-age=86400" {
+		t.Errorf("HSTS over HTTPS = %q, want max-age=86400", hsts)
+	}
+
+	handler = negroni.New(NewSecurityHeaders("", 24*time.Hour, true), negroni.Wrap(http.NotFoundHandler()))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	if hsts := rec.Header().Get("Strict-Transport-Security"); hsts != "max-age=86400; includeSubDomains" {
+		t.Errorf("HSTS covering subdomains = %q, want max-age=86400; includeSubDomains", hsts)
+	}
+}
+
+func TestTLSRedirect(t *testing.T) {
+	tests := []struct {
+		httpsPort int
+		want      string
+	}{
+		{httpsPort: 443, want: "https://faucet.fuse.io/api/info?lang=de"},
+		{httpsPort: 8443, want: "https://faucet.fuse.io:8443/api/info?lang=de"},
+	}
+	for _, tt := range tests {
+		srv := NewTLS("cert.pem", "key.pem", nil, "", "").redirectServer(80, tt.httpsPort)
+		rec := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(rec, httptest.NewRequest("GET", "http://faucet.fuse.io:80/api/info?lang=de", nil))
+		if rec.Code != http.StatusMovedPermanently || rec.Header().Get("Location") != tt.want {
+			t.Errorf("redirect = %d to %s, want %d to %s", rec.Code, rec.Header().Get("Location"), http.StatusMovedPermanently, tt.want)
+		}
+	}
+}
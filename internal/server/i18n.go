@@ -0,0 +1,360 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"golang.org/x/text/language"
+)
+
+// languages the catalog has messages in, the first one being the fallback
+var languages = []language.Tag{language.English, language.Spanish, language.French, language.German, language.Portuguese}
+
+var languageMatcher = language.NewMatcher(languages)
+
+// catalog holds the user-facing error messages by language and error code.
+// Every language must define the codes of English with the same format verbs
+var catalog = map[string]map[string]string{
+	"en": {
+		"invalid_address":          "Invalid address",
+		"invalid_email":            "Invalid email address",
+		"unreadable_body":          "Unable to read request body",
+		"malformed_json":           "Request body contains badly-formed JSON",
+		"invalid_field":            "Request body contains an invalid value for the %q field",
+		"unknown_field":            "Request body contains unknown field %s",
+		"empty_body":               "Request body must not be empty",
+		"body_too_large":           "Request body is too large",
+		"internal_error":           "Internal server error, please try again later",
+		"unauthorized":             "Unauthorized",
+		"claim_not_found":          "Claim not found",
+		"rate_limited":             "You have exceeded the rate limit. Please wait %s before you try again",
+		"quota_exceeded":           "API key quota of %d claims per day is used up. Please wait %s before you try again",
+		"frontend_quota_exceeded":  "The daily quota of %d claims of this site is used up, please try again tomorrow",
+		"throttled":                "Too many requests, please slow down",
+		"budget_exhausted":         "The faucet budget is exhausted, please try again later",
+		"claim_cap_reached":        "This address has reached its claim limit",
+		"queue_full":               "The faucet is busy, please try again later",
+		"queue_closed":             "The faucet is shutting down, please try again later",
+		"payout_unavailable":       "Unable to determine payout amount, please try again later",
+		"faucet_empty":             "The faucet is empty, please try again later",
+		"denied_address":           "This address or network is not permitted to use the faucet",
+		"denied_ip":                "This address or network is not permitted to use the faucet",
+		"not_allowlisted":          "This address or network is not permitted to use the faucet",
+		"country_blocked":          "The faucet is not available in your region",
+		"network_blocked":          "Claims from hosting providers and VPNs are not allowed",
+		"invalid_api_key":          "Invalid API key",
+		"name_not_found":           "%s does not resolve to an address",
+		"name_unavailable":         "Unable to resolve name, please try again later",
+		"eligibility_unavailable":  "Unable to verify eligibility, please try again later",
+		"contract_address":         "Payouts to contract addresses are not allowed",
+		"balance_too_high":         "Your balance already exceeds %s %s",
+		"score_too_low":            "Your reputation score %.2f is below the required %.2f",
+		"login_required":           "Please sign in with GitHub before requesting funds",
+		"invalid_oauth_state":      "Invalid OAuth state, please sign in again",
+		"github_login_failed":      "GitHub login failed, please try again",
+		"pow_failed":               "Proof of work verification failed, please request a new challenge",
+		"captcha_failed":           "Captcha verification failed, please try again",
+		"signature_required":       "Sign in with the recipient address to claim",
+		"token_required":           "Only holders of the required token can claim from this faucet",
+		"risk_too_high":            "This claim looks automated and was rejected",
+		"maintenance":              "The faucet is under maintenance until %s, please come back then",
+		"invalid_idempotency_key":  "Idempotency-Key must be at most 255 characters",
+		"idempotency_key_reused":   "This Idempotency-Key was already used for a different request",
+		"idempotency_in_progress":  "A request with this Idempotency-Key is still being processed, please retry shortly",
+		"captcha_unavailable":      "Captcha verification is unavailable, please try again later",
+		"api_key_required":         "An API key is required",
+		"cluster_cooldown":         "Too many addresses were claimed together with this one, please try again later",
+		"invalid_bypass_token":     "Invalid or expired bypass token",
+		"invalid_claim_token":      "Invalid or expired claim token",
+		"claim_token_used":         "This claim token has already been used",
+		"captcha_pow_fallback":     "Captcha verification is unavailable, please solve the proof of work challenge from /api/pow instead",
+		"invalid_amount":           "Amount must be one of %s",
+		"missing_field":            "Request body is missing the %q field",
+		"invalid_checksum":         "Invalid address checksum, please check the address for typos",
+		"unsupported_chain":        "This faucet does not pay out on chain %s",
+		"unsupported_token":        "This faucet does not pay out %s",
+		"network_unavailable":      "The network is unavailable, please try again later",
+		"unsupported_purpose":      "%s is not a purpose claims can be made for",
+		"purpose_budget_exhausted": "The budget for %s is exhausted, please try again later",
+	},
+	"es": {
+		"invalid_address":          "Dirección no válida",
+		"invalid_email":            "Dirección de correo electrónico no válida",
+		"unreadable_body":          "No se pudo leer el cuerpo de la solicitud",
+		"malformed_json":           "El cuerpo de la solicitud contiene JSON mal formado",
+		"invalid_field":            "El cuerpo de la solicitud contiene un valor no válido para el campo %q",
+		"unknown_field":            "El cuerpo de la solicitud contiene el campo desconocido %s",
+		"empty_body":               "El cuerpo de la solicitud no puede estar vacío",
+		"body_too_large":           "El cuerpo de la solicitud es demasiado grande",
+		"internal_error":           "Error interno del servidor, inténtalo de nuevo más tarde",
+		"unauthorized":             "No autorizado",
+		"claim_not_found":          "Solicitud no encontrada",
+		"rate_limited":             "Has superado el límite de solicitudes. Espera %s antes de volver a intentarlo",
+		"quota_exceeded":           "Se ha agotado la cuota de %d solicitudes diarias de la clave de API. Espera %s antes de volver a intentarlo",
+		"frontend_quota_exceeded":  "Se ha agotado la cuota diaria de %d solicitudes de este sitio, inténtalo de nuevo mañana",
+		"throttled":                "Demasiadas peticiones, ve más despacio",
+		"budget_exhausted":         "El presupuesto del faucet está agotado, inténtalo de nuevo más tarde",
+		"claim_cap_reached":        "Esta dirección ha alcanzado su límite de solicitudes",
+		"queue_full":               "El faucet está ocupado, inténtalo de nuevo más tarde",
+		"queue_closed":             "El faucet se está apagando, inténtalo de nuevo más tarde",
+		"payout_unavailable":       "No se pudo determinar el importe del pago, inténtalo de nuevo más tarde",
+		"faucet_empty":             "El faucet está vacío, inténtalo de nuevo más tarde",
+		"denied_address":           "Esta dirección o red no tiene permiso para usar el faucet",
+		"denied_ip":                "Esta dirección o red no tiene permiso para usar el faucet",
+		"not_allowlisted":          "Esta dirección o red no tiene permiso para usar el faucet",
+		"country_blocked":          "El faucet no está disponible en tu región",
+		"network_blocked":          "No se permiten solicitudes desde proveedores de alojamiento ni VPN",
+		"invalid_api_key":          "Clave de API no válida",
+		"name_not_found":           "%s no se resuelve a ninguna dirección",
+		"name_unavailable":         "No se pudo resolver el nombre, inténtalo de nuevo más tarde",
+		"eligibility_unavailable":  "No se pudo verificar la elegibilidad, inténtalo de nuevo más tarde",
+		"contract_address":         "No se permiten pagos a direcciones de contratos",
+		"balance_too_high":         "Tu saldo ya supera %s %s",
+		"score_too_low":            "Tu puntuación de reputación %.2f es inferior a la requerida de %.2f",
+		"login_required":           "Inicia sesión con GitHub antes de solicitar fondos",
+		"invalid_oauth_state":      "Estado de OAuth no válido, vuelve a iniciar sesión",
+		"github_login_failed":      "Falló el inicio de sesión con GitHub, inténtalo de nuevo",
+		"pow_failed":               "Falló la verificación de la prueba de trabajo, solicita un nuevo desafío",
+		"captcha_failed":           "Falló la verificación del captcha, inténtalo de nuevo",
+		"signature_required":       "Inicia sesión con la dirección de destino para solicitar fondos",
+		"token_required":           "Solo los poseedores del token requerido pueden usar este faucet",
+		"risk_too_high":            "Esta solicitud parece automatizada y fue rechazada",
+		"maintenance":              "El faucet está en mantenimiento hasta %s, vuelve entonces",
+		"invalid_idempotency_key":  "Idempotency-Key debe tener como máximo 255 caracteres",
+		"idempotency_key_reused":   "Esta Idempotency-Key ya se usó para una solicitud diferente",
+		"idempotency_in_progress":  "Una solicitud con esta Idempotency-Key aún se está procesando, vuelve a intentarlo en breve",
+		"captcha_unavailable":      "La verificación del captcha no está disponible, inténtalo de nuevo más tarde",
+		"api_key_required":         "Se requiere una clave de API",
+		"cluster_cooldown":         "Se solicitaron demasiadas direcciones junto con esta, inténtalo de nuevo más tarde",
+		"invalid_bypass_token":     "Token de exención no válido o caducado",
+		"invalid_claim_token":      "Token de reclamo no válido o caducado",
+		"claim_token_used":         "Este token de reclamo ya se ha utilizado",
+		"captcha_pow_fallback":     "La verificación del captcha no está disponible, resuelve en su lugar el desafío de prueba de trabajo de /api/pow",
+		"invalid_amount":           "La cantidad debe ser una de %s",
+		"missing_field":            "Falta el campo %q en el cuerpo de la solicitud",
+		"invalid_checksum":         "Suma de verificación de la dirección no válida, compruebe que no haya errores en la dirección",
+		"unsupported_chain":        "Este faucet no paga en la cadena %s",
+		"unsupported_token":        "Este faucet no paga en %s",
+		"network_unavailable":      "La red no está disponible, inténtalo de nuevo más tarde",
+		"unsupported_purpose":      "%s no es un propósito para el que se pueda reclamar",
+		"purpose_budget_exhausted": "El presupuesto para %s está agotado, inténtalo de nuevo más tarde",
+	},
+	"fr": {
+		"invalid_address":          "Adresse invalide",
+		"invalid_email":            "Adresse e-mail invalide",
+		"unreadable_body":          "Impossible de lire le corps de la requête",
+		"malformed_json":           "Le corps de la requête contient du JSON mal formé",
+		"invalid_field":            "Le corps de la requête contient une valeur invalide pour le champ %q",
+		"unknown_field":            "Le corps de la requête contient le champ inconnu %s",
+		"empty_body":               "Le corps de la requête ne doit pas être vide",
+		"body_too_large":           "Le corps de la requête est trop volumineux",
+		"internal_error":           "Erreur interne du serveur, veuillez réessayer plus tard",
+		"unauthorized":             "Non autorisé",
+		"claim_not_found":          "Demande introuvable",
+		"rate_limited":             "Vous avez dépassé la limite de demandes. Veuillez patienter %s avant de réessayer",
+		"quota_exceeded":           "Le quota de %d demandes par jour de la clé d'API est épuisé. Veuillez patienter %s avant de réessayer",
+		"frontend_quota_exceeded":  "Le quota quotidien de %d demandes de ce site est épuisé, veuillez réessayer demain",
+		"throttled":                "Trop de requêtes, veuillez ralentir",
+		"budget_exhausted":         "Le budget du faucet est épuisé, veuillez réessayer plus tard",
+		"claim_cap_reached":        "Cette adresse a atteint sa limite de demandes",
+		"queue_full":               "Le faucet est occupé, veuillez réessayer plus tard",
+		"queue_closed":             "Le faucet est en cours d'arrêt, veuillez réessayer plus tard",
+		"payout_unavailable":       "Impossible de déterminer le montant du versement, veuillez réessayer plus tard",
+		"faucet_empty":             "Le faucet est vide, veuillez réessayer plus tard",
+		"denied_address":           "Cette adresse ou ce réseau n'est pas autorisé à utiliser le faucet",
+		"denied_ip":                "Cette adresse ou ce réseau n'est pas autorisé à utiliser le faucet",
+		"not_allowlisted":          "Cette adresse ou ce réseau n'est pas autorisé à utiliser le faucet",
+		"country_blocked":          "Le faucet n'est pas disponible dans votre région",
+		"network_blocked":          "Les demandes provenant d'hébergeurs et de VPN ne sont pas autorisées",
+		"invalid_api_key":          "Clé d'API invalide",
+		"name_not_found":           "%s ne correspond à aucune adresse",
+		"name_unavailable":         "Impossible de résoudre le nom, veuillez réessayer plus tard",
+		"eligibility_unavailable":  "Impossible de vérifier l'éligibilité, veuillez réessayer plus tard",
+		"contract_address":         "Les versements vers des adresses de contrats ne sont pas autorisés",
+		"balance_too_high":         "Votre solde dépasse déjà %s %s",
+		"score_too_low":            "Votre score de réputation %.2f est inférieur au minimum requis de %.2f",
+		"login_required":           "Veuillez vous connecter avec GitHub avant de demander des fonds",
+		"invalid_oauth_state":      "État OAuth invalide, veuillez vous reconnecter",
+		"github_login_failed":      "La connexion avec GitHub a échoué, veuillez réessayer",
+		"pow_failed":               "La vérification de la preuve de travail a échoué, veuillez demander un nouveau défi",
+		"captcha_failed":           "La vérification du captcha a échoué, veuillez réessayer",
+		"signature_required":       "Connectez-vous avec l'adresse de destination pour faire une demande",
+		"token_required":           "Seuls les détenteurs du jeton requis peuvent utiliser ce faucet",
+		"risk_too_high":            "Cette demande semble automatisée et a été rejetée",
+		"maintenance":              "Le faucet est en maintenance jusqu'à %s, revenez à ce moment-là",
+		"invalid_idempotency_key":  "Idempotency-Key doit comporter au plus 255 caractères",
+		"idempotency_key_reused":   "Cette Idempotency-Key a déjà été utilisée pour une autre requête",
+		"idempotency_in_progress":  "Une requête avec cette Idempotency-Key est encore en cours de traitement, veuillez réessayer sous peu",
+		"captcha_unavailable":      "La vérification du captcha est indisponible, veuillez réessayer plus tard",
+		"api_key_required":         "Une clé d'API est requise",
+		"cluster_cooldown":         "Trop d'adresses ont été utilisées avec celle-ci, veuillez réessayer plus tard",
+		"invalid_bypass_token":     "Jeton de dérogation invalide ou expiré",
+		"invalid_claim_token":      "Jeton de réclamation invalide ou expiré",
+		"claim_token_used":         "Ce jeton de réclamation a déjà été utilisé",
+		"captcha_pow_fallback":     "La vérification du captcha est indisponible, veuillez plutôt résoudre le défi de preuve de travail de /api/pow",
+		"invalid_amount":           "Le montant doit être l'un de %s",
+		"missing_field":            "Le champ %q est absent du corps de la requête",
+		"invalid_checksum":         "Somme de contrôle de l'adresse invalide, vérifiez que l'adresse ne contient pas de faute de frappe",
+		"unsupported_chain":        "Ce faucet ne paie pas sur la chaîne %s",
+		"unsupported_token":        "Ce faucet ne paie pas en %s",
+		"network_unavailable":      "Le réseau est indisponible, veuillez réessayer plus tard",
+		"unsupported_purpose":      "%s n'est pas un objectif pour lequel réclamer",
+		"purpose_budget_exhausted": "Le budget pour %s est épuisé, veuillez réessayer plus tard",
+	},
+	"de": {
+		"invalid_address":          "Ungültige Adresse",
+		"invalid_email":            "Ungültige E-Mail-Adresse",
+		"unreadable_body":          "Der Anfragetext konnte nicht gelesen werden",
+		"malformed_json":           "Der Anfragetext enthält fehlerhaftes JSON",
+		"invalid_field":            "Der Anfragetext enthält einen ungültigen Wert für das Feld %q",
+		"unknown_field":            "Der Anfragetext enthält das unbekannte Feld %s",
+		"empty_body":               "Der Anfragetext darf nicht leer sein",
+		"body_too_large":           "Der Anfragetext ist zu groß",
+		"internal_error":           "Interner Serverfehler, bitte versuche es später erneut",
+		"unauthorized":             "Nicht autorisiert",
+		"claim_not_found":          "Anfrage nicht gefunden",
+		"rate_limited":             "Du hast das Anfragelimit überschritten. Bitte warte %s, bevor du es erneut versuchst",
+		"quota_exceeded":           "Das Tageskontingent von %d Anfragen des API-Schlüssels ist aufgebraucht. Bitte warte %s, bevor du es erneut versuchst",
+		"frontend_quota_exceeded":  "Das Tageskontingent von %d Anfragen dieser Seite ist aufgebraucht, bitte versuche es morgen erneut",
+		"throttled":                "Zu viele Anfragen, bitte etwas langsamer",
+		"budget_exhausted":         "Das Budget des Faucets ist aufgebraucht, bitte versuche es später erneut",
+		"claim_cap_reached":        "Diese Adresse hat ihr Anfragelimit erreicht",
+		"queue_full":               "Der Faucet ist ausgelastet, bitte versuche es später erneut",
+		"queue_closed":             "Der Faucet wird heruntergefahren, bitte versuche es später erneut",
+		"payout_unavailable":       "Der Auszahlungsbetrag konnte nicht ermittelt werden, bitte versuche es später erneut",
+		"faucet_empty":             "Der Faucet ist leer, bitte versuche es später erneut",
+		"denied_address":           "Diese Adresse oder dieses Netzwerk darf den Faucet nicht nutzen",
+		"denied_ip":                "Diese Adresse oder dieses Netzwerk darf den Faucet nicht nutzen",
+		"not_allowlisted":          "Diese Adresse oder dieses Netzwerk darf den Faucet nicht nutzen",
+		"country_blocked":          "Der Faucet ist in deiner Region nicht verfügbar",
+		"network_blocked":          "Anfragen von Hosting-Anbietern und VPNs sind nicht erlaubt",
+		"invalid_api_key":          "Ungültiger API-Schlüssel",
+		"name_not_found":           "%s wird zu keiner Adresse aufgelöst",
+		"name_unavailable":         "Der Name konnte nicht aufgelöst werden, bitte versuche es später erneut",
+		"eligibility_unavailable":  "Die Berechtigung konnte nicht geprüft werden, bitte versuche es später erneut",
+		"contract_address":         "Auszahlungen an Vertragsadressen sind nicht erlaubt",
+		"balance_too_high":         "Dein Guthaben übersteigt bereits %s %s",
+		"score_too_low":            "Dein Reputationswert %.2f liegt unter dem erforderlichen Wert von %.2f",
+		"login_required":           "Bitte melde dich mit GitHub an, bevor du Guthaben anforderst",
+		"invalid_oauth_state":      "Ungültiger OAuth-Status, bitte melde dich erneut an",
+		"github_login_failed":      "Die Anmeldung mit GitHub ist fehlgeschlagen, bitte versuche es erneut",
+		"pow_failed":               "Die Proof-of-Work-Prüfung ist fehlgeschlagen, bitte fordere eine neue Aufgabe an",
+		"captcha_failed":           "Die Captcha-Prüfung ist fehlgeschlagen, bitte versuche es erneut",
+		"signature_required":       "Melde dich mit der Empfängeradresse an, um Guthaben anzufordern",
+		"token_required":           "Nur Inhaber des erforderlichen Tokens können diesen Faucet nutzen",
+		"risk_too_high":            "Diese Anfrage wirkt automatisiert und wurde abgelehnt",
+		"maintenance":              "Der Faucet wird bis %s gewartet, bitte komm danach wieder",
+		"invalid_idempotency_key":  "Idempotency-Key darf höchstens 255 Zeichen lang sein",
+		"idempotency_key_reused":   "Dieser Idempotency-Key wurde bereits für eine andere Anfrage verwendet",
+		"idempotency_in_progress":  "Eine Anfrage mit diesem Idempotency-Key wird noch verarbeitet, bitte versuche es gleich erneut",
+		"captcha_unavailable":      "Die Captcha-Prüfung ist nicht verfügbar, bitte versuche es später erneut",
+		"api_key_required":         "Ein API-Schlüssel ist erforderlich",
+		"cluster_cooldown":         "Zu viele Adressen wurden zusammen mit dieser beansprucht, bitte versuche es später erneut",
+		"invalid_bypass_token":     "Ungültiges oder abgelaufenes Ausnahme-Token",
+		"invalid_claim_token":      "Ungültiges oder abgelaufenes Anforderungs-Token",
+		"claim_token_used":         "Dieses Anforderungs-Token wurde bereits verwendet",
+		"captcha_pow_fallback":     "Die Captcha-Prüfung ist nicht verfügbar, bitte löse stattdessen die Proof-of-Work-Aufgabe von /api/pow",
+		"invalid_amount":           "Der Betrag muss einer von %s sein",
+		"missing_field":            "Im Anfragetext fehlt das Feld %q",
+		"invalid_checksum":         "Ungültige Prüfsumme der Adresse, bitte prüfen Sie die Adresse auf Tippfehler",
+		"unsupported_chain":        "Dieser Faucet zahlt nicht auf der Chain %s aus",
+		"unsupported_token":        "Dieser Faucet zahlt kein %s aus",
+		"network_unavailable":      "Das Netzwerk ist nicht erreichbar, bitte versuche es später erneut",
+		"unsupported_purpose":      "%s ist kein Zweck, für den beansprucht werden kann",
+		"purpose_budget_exhausted": "Das Budget für %s ist aufgebraucht, bitte versuche es später erneut",
+	},
+	"pt": {
+		"invalid_address":          "Endereço inválido",
+		"invalid_email":            "Endereço de e-mail inválido",
+		"unreadable_body":          "Não foi possível ler o corpo da requisição",
+		"malformed_json":           "O corpo da requisição contém JSON malformado",
+		"invalid_field":            "O corpo da requisição contém um valor inválido para o campo %q",
+		"unknown_field":            "O corpo da requisição contém o campo desconhecido %s",
+		"empty_body":               "O corpo da requisição não pode estar vazio",
+		"body_too_large":           "O corpo da requisição é grande demais",
+		"internal_error":           "Erro interno do servidor, tente novamente mais tarde",
+		"unauthorized":             "Não autorizado",
+		"claim_not_found":          "Solicitação não encontrada",
+		"rate_limited":             "Você excedeu o limite de solicitações. Aguarde %s antes de tentar novamente",
+		"quota_exceeded":           "A cota de %d solicitações por dia da chave de API foi esgotada. Aguarde %s antes de tentar novamente",
+		"frontend_quota_exceeded":  "A cota diária de %d solicitações deste site se esgotou, tente novamente amanhã",
+		"throttled":                "Requisições demais, vá mais devagar",
+		"budget_exhausted":         "O orçamento do faucet se esgotou, tente novamente mais tarde",
+		"claim_cap_reached":        "Este endereço atingiu seu limite de solicitações",
+		"queue_full":               "O faucet está ocupado, tente novamente mais tarde",
+		"queue_closed":             "O faucet está sendo desligado, tente novamente mais tarde",
+		"payout_unavailable":       "Não foi possível determinar o valor do pagamento, tente novamente mais tarde",
+		"faucet_empty":             "O faucet está vazio, tente novamente mais tarde",
+		"denied_address":           "Este endereço ou rede não tem permissão para usar o faucet",
+		"denied_ip":                "Este endereço ou rede não tem permissão para usar o faucet",
+		"not_allowlisted":          "Este endereço ou rede não tem permissão para usar o faucet",
+		"country_blocked":          "O faucet não está disponível na sua região",
+		"network_blocked":          "Solicitações de provedores de hospedagem e VPNs não são permitidas",
+		"invalid_api_key":          "Chave de API inválida",
+		"name_not_found":           "%s não corresponde a nenhum endereço",
+		"name_unavailable":         "Não foi possível resolver o nome, tente novamente mais tarde",
+		"eligibility_unavailable":  "Não foi possível verificar a elegibilidade, tente novamente mais tarde",
+		"contract_address":         "Pagamentos para endereços de contratos não são permitidos",
+		"balance_too_high":         "Seu saldo já excede %s %s",
+		"score_too_low":            "Sua pontuação de reputação %.2f está abaixo da exigida de %.2f",
+		"login_required":           "Entre com o GitHub antes de solicitar fundos",
+		"invalid_oauth_state":      "Estado OAuth inválido, entre novamente",
+		"github_login_failed":      "Falha ao entrar com o GitHub, tente novamente",
+		"pow_failed":               "Falha na verificação da prova de trabalho, solicite um novo desafio",
+		"captcha_failed":           "Falha na verificação do captcha, tente novamente",
+		"signature_required":       "Entre com o endereço de destino para solicitar fundos",
+		"token_required":           "Somente detentores do token exigido podem usar este faucet",
+		"risk_too_high":            "Esta solicitação parece automatizada e foi rejeitada",
+		"maintenance":              "O faucet está em manutenção até %s, volte depois disso",
+		"invalid_idempotency_key":  "Idempotency-Key deve ter no máximo 255 caracteres",
+		"idempotency_key_reused":   "Esta Idempotency-Key já foi usada em uma solicitação diferente",
+		"idempotency_in_progress":  "Uma solicitação com esta Idempotency-Key ainda está sendo processada, tente novamente em instantes",
+		"captcha_unavailable":      "A verificação do captcha está indisponível, tente novamente mais tarde",
+		"api_key_required":         "É necessária uma chave de API",
+		"cluster_cooldown":         "Muitos endereços foram solicitados junto com este, tente novamente mais tarde",
+		"invalid_bypass_token":     "Token de isenção inválido ou expirado",
+		"invalid_claim_token":      "Token de resgate inválido ou expirado",
+		"claim_token_used":         "Este token de resgate já foi utilizado",
+		"captcha_pow_fallback":     "A verificação do captcha está indisponível, resolva em vez disso o desafio de prova de trabalho de /api/pow",
+		"invalid_amount":           "O valor deve ser um de %s",
+		"missing_field":            "O corpo da solicitação não contém o campo %q",
+		"invalid_checksum":         "Soma de verificação do endereço inválida, verifique se o endereço contém erros de digitação",
+		"unsupported_chain":        "Este faucet não paga na rede %s",
+		"unsupported_token":        "Este faucet não paga em %s",
+		"network_unavailable":      "A rede está indisponível, tente novamente mais tarde",
+		"unsupported_purpose":      "%s não é um propósito para o qual se pode solicitar",
+		"purpose_budget_exhausted": "O orçamento para %s se esgotou, tente novamente mais tarde",
+	},
+}
+
+// requestLanguage negotiates the language of the messages from the Accept-Language header
+func requestLanguage(r *http.Request) string {
+	tags, _, _ := language.ParseAcceptLanguage(r.Header.Get("Accept-Language"))
+	_, index, _ := languageMatcher.Match(tags...)
+	base, _ := languages[index].Base()
+	return base.String()
+}
+
+// localize returns the message of code in lang, falling back to English
+func localize(lang, code string, args ...interface{}) string {
+	format, ok := catalog[lang][code]
+	if !ok {
+		format = catalog["en"][code]
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// localizedResponse builds the error response of code in the language the
+// client prefers. Frontends can localize by the code on their own instead
+func localizedResponse(w http.ResponseWriter, r *http.Request, code string, args ...interface{}) claimResponse {
+	lang := requestLanguage(r)
+	w.Header().Set("Content-Language", lang)
+	w.Header().Add("Vary", "Accept-Language")
+	recordRejection(r, code)
+	return claimResponse{Message: localize(lang, code, args...), Code: code}
+}
+
+// renderLocalized renders the error response of code with the status
+func renderLocalized(w http.ResponseWriter, r *http.Request, status int, code string, args ...interface{}) {
+	renderJSON(w, localizedResponse(w, r, code, args...), status)
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var formatVerb = regexp.MustCompile(`%[-+# 0-9.]*[a-zA-Z]`)
+
+func TestCatalogComplete(t *testing.T) {
+	for _, tag := range languages {
+		base, _ := tag.Base()
+		messages, ok := catalog[base.String()]
+		if !ok {
+			t.Fatalf("no messages in %s", base)
+		}
+		for code, english := range catalog["en"] {
+			message, ok := messages[code]
+			if !ok {
+				t.Errorf("%s: missing message for %s", base, code)
+				continue
+			}
+			want := strings.Join(formatVerb.FindAllString(english, -1), " ")
+			if got := strings.Join(formatVerb.FindAllString(message, -1), " "); got != want {
+				t.Errorf("%s: %s has verbs %q, want %q", base, code, got, want)
+			}
+		}
+		if len(messages) != len(catalog["en"]) {
+			t.Errorf("%s has %d messages, want %d", base, len(messages), len(catalog["en"]))
+		}
+	}
+}
+
+func TestLocalizedResponse(t *testing.T) {
+	tests := []struct {
+		acceptLanguage string
+		want           string
+		message        string
+	}{
+		{acceptLanguage: "", want: "en", message: "You have exceeded the rate limit. Please wait 1m30s before you try again"},
+		{acceptLanguage: "es-MX,es;q=0.9,en;q=0.8", want: "es", message: "Has superado el límite de solicitudes. Espera 1m30s antes de volver a intentarlo"},
+		{acceptLanguage: "ja,de;q=0.5", want: "de", message: "Du hast das Anfragelimit überschritten. Bitte warte 1m30s, bevor du es erneut versuchst"},
+		{acceptLanguage: "pt-BR", want: "pt", message: "Você excedeu o limite de solicitações. Aguarde 1m30s antes de tentar novamente"},
+		{acceptLanguage: "ja", want: "en", message: "You have exceeded the rate limit. Please wait 1m30s before you try again"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.acceptLanguage, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/api/claim", nil)
+			r.Header.Set("Accept-Language", tt.acceptLanguage)
+			rec := httptest.NewRecorder()
+			resp := localizedResponse(rec, r, "rate_limited", 90*time.Second)
+			if got := rec.Header().Get("Content-Language"); got != tt.want {
+				t.Errorf("Content-Language = %q, want %q", got, tt.want)
+			}
+			if resp.Code != "rate_limited" || resp.Message != tt.message {
+				t.Errorf("response = %+v, want %q", resp, tt.message)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jellydator/ttlcache/v2"
+	"github.com/urfave/negroni"
+)
+
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	maxIdempotencyKeyLen = 255
+)
+
+// idempotentResponse is the response to the first request with an
+// idempotency key, or nil while that request is still being served
+type idempotentResponse struct {
+	digest [sha256.Size]byte
+	status int
+	header http.Header
+	body   []byte
+}
+
+// Idempotency replays the response of a successful claim to retries with the
+// same Idempotency-Key header, so that a client that lost the response does
+// not trigger a second payout or run into its own cooldown. Failed claims are
+// not kept and may be retried with the same key. Keys are scoped to the API
+// key of the claim, or to its client IP, so that clients can not replay or
+// hold up the claims of others
+type Idempotency struct {
+	mutex   sync.Mutex
+	cache   *ttlcache.Cache
+	ttl     time.Duration
+	proxies *Proxies
+}
+
+func NewIdempotency(ttl time.Duration, proxies *Proxies) *Idempotency {
+	cache := ttlcache.NewCache()
+	cache.SkipTTLExtensionOnHit(true)
+	return &Idempotency{cache: cache, ttl: ttl, proxies: proxies}
+}
+
+func (i *Idempotency) Enabled() bool {
+	return i.ttl > 0
+}
+
+func (i *Idempotency) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	key := r.Header.Get(idempotencyKeyHeader)
+	if !i.Enabled() || key == "" {
+		next.ServeHTTP(w, r)
+		return
+	}
+	if len(key) > maxIdempotencyKeyLen {
+		renderLocalized(w, r, http.StatusBadRequest, "invalid_idempotency_key")
+		return
+	}
+
+	body, err := readBody(r)
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+	digest := sha256.Sum256(body)
+	key = i.scope(r) + " " + key
+
+	i.mutex.Lock()
+	if value, err := i.cache.Get(key); err == nil {
+		i.mutex.Unlock()
+		resp, _ := value.(*idempotentResponse)
+		switch {
+		case resp == nil:
+			w.Header().Set("Retry-After", "1")
+			renderLocalized(w, r, http.StatusConflict, "idempotency_in_progress")
+		case resp.digest != digest:
+			renderLocalized(w, r, http.StatusUnprocessableEntity, "idempotency_key_reused")
+		default:
+			for name, values := range resp.header {
+				if name != requestIDHeader {
+					w.Header()[name] = values
+				}
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(resp.status)
+			w.Write(resp.body)
+		}
+		return
+	}
+	// Hold the key while the claim is served, concurrent retries are asked to come back for its outcome
+	i.cache.SetWithTTL(key, (*idempotentResponse)(nil), i.ttl)
+	i.mutex.Unlock()
+
+	recorder := &responseRecorder{ResponseWriter: w.(negroni.ResponseWriter)}
+	next.ServeHTTP(recorder, r)
+	if recorder.Status() != http.StatusOK {
+		i.cache.Remove(key)
+		return
+	}
+	i.cache.SetWithTTL(key, &idempotentResponse{
+		digest: digest,
+		status: recorder.Status(),
+		header: w.Header().Clone(),
+		body:   recorder.body.Bytes(),
+	}, i.ttl)
+}
+
+// scope returns who the idempotency keys of the request belong to
+func (i *Idempotency) scope(r *http.Request) string {
+	if secret := r.Header.Get(apiKeyHeader); secret != "" {
+		return "key:" + hashAPIKey(secret)
+	}
+	return "ip:" + i.proxies.ClientIP(r)
+}
+
+// responseRecorder keeps a copy of the body written to the response
+type responseRecorder struct {
+	negroni.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/urfave/negroni"
+)
+
+func TestIdempotency(t *testing.T) {
+	var claims int
+	status := http.StatusTooManyRequests
+	entered, release := make(chan struct{}), make(chan struct{})
+	handler := negroni.New(NewIdempotency(time.Hour, nil), negroni.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Slow") != "" {
+			close(entered)
+			<-release
+		}
+		claims++
+		renderJSON(w, claimResponse{Message: "queued", ClaimID: "abc"}, status)
+	})))
+	claim := func(key, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/api/claim", strings.NewReader(body))
+		r.Header.Set(idempotencyKeyHeader, key)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec
+	}
+	body := `{"address":"0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"}`
+
+	if rec := claim("key", body); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	status = http.StatusOK
+	if rec := claim("key", body); rec.Code != http.StatusOK || claims != 2 {
+		t.Fatalf("status = %d after %d claims, failed claims must not be replayed", rec.Code, claims)
+	}
+	rec := claim("key", body)
+	if rec.Code != http.StatusOK || claims != 2 || rec.Header().Get("Idempotent-Replayed") != "true" || !strings.Contains(rec.Body.String(), `"claim_id":"abc"`) {
+		t.Fatalf("retry status = %d, headers = %v, body = %s after %d claims, want the replayed response", rec.Code, rec.Header(), rec.Body, claims)
+	}
+	if rec := claim("key", `{"address":"0x0000000000000000000000000000000000000001"}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("status of reused key = %d, want %d", rec.Code, http.StatusUnprocessableEntity)
+	}
+	if rec := claim(strings.Repeat("k", maxIdempotencyKeyLen+1), body); rec.Code != http.StatusBadRequest {
+		t.Errorf("status of long key = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if rec := claim("", body); rec.Code != http.StatusOK || claims != 3 {
+		t.Errorf("claims without key = %d, want every claim served", claims)
+	}
+	if rec := claim("large", `{"address":"`+strings.Repeat("a", maxBodySize)+`"}`); rec.Code != http.StatusRequestEntityTooLarge || claims != 3 {
+		t.Errorf("status of a large body = %d after %d claims, want %d", rec.Code, claims, http.StatusRequestEntityTooLarge)
+	}
+
+	// Keys are scoped to the client
+	other := httptest.NewRequest("POST", "/api/claim", strings.NewReader(body))
+	other.Header.Set(idempotencyKeyHeader, "key")
+	other.RemoteAddr = "10.0.0.2:1234"
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, other)
+	if rec.Header().Get("Idempotent-Replayed") != "" || claims != 4 {
+		t.Errorf("claim of another client was replayed the response of the key")
+	}
+	other = httptest.NewRequest("POST", "/api/claim", strings.NewReader(body))
+	other.Header.Set(idempotencyKeyHeader, "key")
+	other.Header.Set(apiKeyHeader, "fk_secret")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, other)
+	if rec.Header().Get("Idempotent-Replayed") != "" || claims != 5 {
+		t.Errorf("claim with an api key was replayed the response of the key without one")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		r := httptest.NewRequest("POST", "/api/claim", strings.NewReader(body))
+		r.Header.Set(idempotencyKeyHeader, "slow")
+		r.Header.Set("Slow", "true")
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+		close(done)
+	}()
+	<-entered
+	if rec := claim("slow", body); rec.Code != http.StatusConflict || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("status of claim in progress = %d, want %d", rec.Code, http.StatusConflict)
+	}
+	close(release)
+	<-done
+	if rec := claim("slow", body); rec.Header().Get("Idempotent-Replayed") != "true" || claims != 6 {
+		t.Errorf("claim finished in the meantime was not replayed")
+	}
+}
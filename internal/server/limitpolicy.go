@@ -0,0 +1,103 @@
+package server
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// LimitFixed allows a number of claims in a window starting at the first of them
+	LimitFixed = "fixed"
+	// LimitSliding allows a number of claims within any window
+	LimitSliding = "sliding"
+	// LimitBucket lets claims fill a bucket of the given size that drains at
+	// that many claims per window, spreading bursts out over the window
+	LimitBucket = "bucket"
+)
+
+// limitEntry is the usage of a limit key, Count under the fixed policy,
+// Claims under the sliding one and Level under the bucket one
+type limitEntry struct {
+	Count   int         `json:"count,omitempty"`
+	Claims  []time.Time `json:"claims,omitempty"`
+	Level   float64     `json:"level,omitempty"`
+	Updated time.Time   `json:"updated,omitempty"`
+}
+
+// reservation describes the limit a claim was let through or rejected by,
+// reset being the time until its quota is restored or, for a rejected claim,
+// until it may be retried
+type reservation struct {
+	at        time.Time
+	limit     int
+	remaining int
+	reset     time.Duration
+}
+
+// take counts a claim made at now against the entry of key k, which expires
+// in ttl. It returns the entry with the claim, to be kept until the reset of
+// the reservation
+func (l *Limiter) take(k limitKey, entry limitEntry, ttl time.Duration, now time.Time) (limitEntry, reservation, bool) {
+	res := reservation{at: now, limit: k.claims}
+	switch l.mode {
+	case LimitSliding:
+		var claims []time.Time
+		for _, at := range entry.Claims {
+			if now.Sub(at) < k.ttl {
+				claims = append(claims, at)
+			}
+		}
+		if len(claims) >= k.claims {
+			res.reset = claims[len(claims)-k.claims].Add(k.ttl).Sub(now)
+			return entry, res, false
+		}
+		entry = limitEntry{Claims: append(claims, now)}
+		res.remaining = k.claims - len(entry.Claims)
+		res.reset = k.ttl
+	case LimitBucket:
+		rate := float64(k.claims) / k.ttl.Seconds()
+		level := math.Max(0, entry.Level-now.Sub(entry.Updated).Seconds()*rate)
+		// Leave some room for rounding errors of the drained level
+		if level+1 > float64(k.claims)+1e-9 {
+			res.reset = time.Duration((level + 1 - float64(k.claims)) / rate * float64(time.Second))
+			return entry, res, false
+		}
+		entry = limitEntry{Level: level + 1, Updated: now}
+		res.remaining = int(float64(k.claims) - entry.Level)
+		res.reset = time.Duration(entry.Level / rate * float64(time.Second))
+	default:
+		if entry.Count >= k.claims {
+			res.reset = ttl
+			return entry, res, false
+		}
+		if entry.Count == 0 {
+			ttl = k.ttl
+		}
+		entry = limitEntry{Count: entry.Count + 1}
+		res.remaining = k.claims - entry.Count
+		res.reset = ttl
+	}
+	return entry, res, true
+}
+
+// untake removes the claim of res from the entry of key k. It returns false
+// once the entry holds no more claims
+func (l *Limiter) untake(k limitKey, entry limitEntry, res reservation) (limitEntry, bool) {
+	switch l.mode {
+	case LimitSliding:
+		var claims []time.Time
+		for _, at := range entry.Claims {
+			if !at.Equal(res.at) {
+				claims = append(claims, at)
+			}
+		}
+		entry.Claims = claims
+		return entry, len(claims) > 0
+	case LimitBucket:
+		entry.Level--
+		return entry, entry.Level > 0
+	default:
+		entry.Count--
+		return entry, entry.Count > 0
+	}
+}
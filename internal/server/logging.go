@@ -0,0 +1,86 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/negroni"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// requestIDPattern limits the request IDs accepted from upstream proxies to
+// ones that are safe to copy into logs and response headers
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+type requestIDKey struct{}
+
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestLog returns a log entry tagged with the ID and trace of the request ctx
+// belongs to, and with the canary policy it runs in log mode for if any
+func requestLog(ctx context.Context) *log.Entry {
+	entry := log.WithContext(ctx)
+	if id := requestID(ctx); id != "" {
+		entry = entry.WithField("requestID", id)
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		entry = entry.WithField("traceID", span.TraceID().String())
+	}
+	if policy, ok := requestCanary(ctx); ok {
+		entry = entry.WithField("canaryPolicy", policy)
+	}
+	return entry
+}
+
+// RequestLogger assigns every request an ID, reusing the X-Request-ID of a
+// trusted proxy if it sent one, returns it in the X-Request-ID header and logs
+// the request once it has been served
+type RequestLogger struct {
+	proxies *Proxies
+}
+
+func NewRequestLogger(proxies *Proxies) *RequestLogger {
+	return &RequestLogger{proxies: proxies}
+}
+
+func (l *RequestLogger) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	id := r.Header.Get(requestIDHeader)
+	if !l.proxies.Trusted(r) || !requestIDPattern.MatchString(id) {
+		var err error
+		if id, err = newRandomID(); err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+	}
+	w.Header().Set(requestIDHeader, id)
+	r = r.WithContext(withRequestID(r.Context(), id))
+
+	start := time.Now()
+	next.ServeHTTP(w, r)
+	res := w.(negroni.ResponseWriter)
+	status := res.Status()
+	// net/http replies 200 to handlers that do not write anything
+	if !res.Written() {
+		status = http.StatusOK
+	}
+	requestLog(r.Context()).WithFields(log.Fields{
+		"method":   r.Method,
+		"path":     r.URL.Path,
+		"status":   status,
+		"size":     res.Size(),
+		"duration": time.Since(start).String(),
+		"clientIP": l.proxies.ClientIP(r),
+	}).Info("Request served")
+}
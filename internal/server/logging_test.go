@@ -0,0 +1,66 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/urfave/negroni"
+)
+
+func TestRequestLogger(t *testing.T) {
+	tests := []struct {
+		name       string
+		proxyCount int
+		header     string
+		wantReused bool
+	}{
+		{name: "generated", proxyCount: 0},
+		{name: "client supplied without proxy", proxyCount: 0, header: "abc-123"},
+		{name: "proxy supplied", proxyCount: 1, header: "abc-123", wantReused: true},
+		{name: "proxy supplied invalid", proxyCount: 1, header: "abc 123\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook := test.NewGlobal()
+			defer hook.Reset()
+
+			var gotCtxID string
+			proxies, _ := NewProxies(tt.proxyCount, nil, "")
+			n := negroni.New(NewRequestLogger(proxies))
+			n.UseHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotCtxID = requestID(r.Context())
+				requestLog(r.Context()).Info("handled")
+			})
+
+			req := httptest.NewRequest("GET", "/api/info", nil)
+			if tt.header != "" {
+				req.Header.Set(requestIDHeader, tt.header)
+			}
+			rr := httptest.NewRecorder()
+			n.ServeHTTP(rr, req)
+
+			id := rr.Header().Get(requestIDHeader)
+			if id == "" || id != gotCtxID {
+				t.Fatalf("X-Request-ID = %q, request context ID = %q", id, gotCtxID)
+			}
+			if reused := id == tt.header; reused != tt.wantReused {
+				t.Errorf("X-Request-ID = %q, want reused %v", id, tt.wantReused)
+			}
+			entries := hook.AllEntries()
+			if len(entries) != 2 {
+				t.Fatalf("got %d log entries, want 2", len(entries))
+			}
+			for _, entry := range entries {
+				if entry.Data["requestID"] != id {
+					t.Errorf("log entry %q requestID = %v, want %s", entry.Message, entry.Data["requestID"], id)
+				}
+			}
+			if entries[1].Level != log.InfoLevel || entries[1].Data["status"] != http.StatusOK {
+				t.Errorf("access log = %v %v", entries[1].Level, entries[1].Data)
+			}
+		})
+	}
+}
@@ -0,0 +1,320 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maintenanceTimeLayout formats the time claims resume at in messages
+const maintenanceTimeLayout = "2006-01-02 15:04 MST"
+
+// cronFields bound the values of each field of a cron expression
+var cronFields = []struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// cronSchedule is a standard five field cron expression, evaluated in UTC.
+// Each field is a bit set of the values it matches
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// Like cron, a day matches either day field when neither of them is *
+	domStar, dowStar bool
+}
+
+func parseCron(expr string) (*cronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("invalid cron expression %q, want minute hour day-of-month month day-of-week", expr)
+	}
+	var sets [5]uint64
+	for i, field := range fields {
+		set, err := parseCronField(field, cronFields[i].min, cronFields[i].max)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s in cron expression %q: %w", cronFields[i].name, expr, err)
+		}
+		sets[i] = set
+	}
+	// Sunday may be written as 7 as well
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+	return &cronSchedule{
+		minute:  sets[0],
+		hour:    sets[1],
+		dom:     sets[2],
+		month:   sets[3],
+		dow:     sets[4],
+		domStar: fields[2] == "*",
+		dowStar: fields[4] == "*",
+	}, nil
+}
+
+// parseCronField parses a comma separated list of *, values and ranges, each
+// with an optional /step
+func parseCronField(field string, min, max int) (uint64, error) {
+	if field == "" {
+		return 0, errors.New("empty field")
+	}
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if parts := strings.SplitN(part, "/", 2); len(parts) == 2 {
+			var err error
+			if step, err = strconv.Atoi(parts[1]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q", parts[1])
+			}
+			part = parts[0]
+		}
+		lo, hi := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid value %q", bounds[0])
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("invalid value %q", bounds[1])
+				}
+			} else if step > 1 {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q is out of range %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+func (c *cronSchedule) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// next returns the first time after t the schedule matches, or the zero time
+// if it never does, e.g. on February 30
+func (c *cronSchedule) next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// maintenanceWindow is a period during which claims are refused
+type maintenanceWindow struct {
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Message string    `json:"message,omitempty"`
+}
+
+// text returns the message of the window, or the built-in one in lang
+func (w maintenanceWindow) text(lang string) string {
+	if w.Message != "" {
+		return w.Message
+	}
+	return localize(lang, "maintenance", w.End.UTC().Format(maintenanceTimeLayout))
+}
+
+// Maintenance pauses claims during recurring windows that start on a cron
+// schedule and last for a fixed duration, and during one-off windows
+// scheduled through the admin API. The process keeps running throughout, so
+// rate limits and queued payouts survive the maintenance
+type Maintenance struct {
+	mutex    sync.RWMutex
+	schedule *cronSchedule
+	duration time.Duration
+	message  string
+	windows  []maintenanceWindow
+}
+
+// NewMaintenance returns maintenance windows starting on the cron expression
+// and lasting for duration, or none if expr is empty. A non-empty message
+// replaces the built-in localized one
+func NewMaintenance(expr string, duration time.Duration, message string) (*Maintenance, error) {
+	m := &Maintenance{duration: duration, message: message}
+	if expr != "" {
+		schedule, err := parseCron(expr)
+		if err != nil {
+			return nil, err
+		}
+		if duration <= 0 {
+			return nil, errors.New("maintenance duration must be positive when a schedule is set")
+		}
+		m.schedule = schedule
+	}
+	return m, nil
+}
+
+// recurring returns the window of the schedule that is ongoing at now, or else the next one
+func (m *Maintenance) recurring(now time.Time) (maintenanceWindow, bool) {
+	if m.schedule == nil {
+		return maintenanceWindow{}, false
+	}
+	start := m.schedule.next(now.Add(-m.duration))
+	if start.IsZero() {
+		return maintenanceWindow{}, false
+	}
+	return maintenanceWindow{Start: start, End: start.Add(m.duration), Message: m.message}, true
+}
+
+// Windows returns the ongoing and upcoming windows sorted by start, the
+// recurring one being only the next of its schedule
+func (m *Maintenance) Windows(now time.Time) []maintenanceWindow {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	var windows []maintenanceWindow
+	for _, w := range m.windows {
+		if w.End.After(now) {
+			windows = append(windows, w)
+		}
+	}
+	if w, ok := m.recurring(now); ok {
+		windows = append(windows, w)
+	}
+	sort.Slice(windows, func(i, j int) bool {
+		return windows[i].Start.Before(windows[j].Start)
+	})
+	return windows
+}
+
+// Active returns the window claims are paused by at now. Overlapping or
+// adjacent windows are merged so that the end is when claims really resume
+func (m *Maintenance) Active(now time.Time) (maintenanceWindow, bool) {
+	var active maintenanceWindow
+	var ok bool
+	for _, w := range m.Windows(now) {
+		switch {
+		case !ok && !w.Start.After(now):
+			active, ok = w, true
+		case ok && !w.Start.After(active.End) && w.End.After(active.End):
+			active.End = w.End
+		}
+	}
+	return active, ok
+}
+
+// Schedule adds a one-off window
+func (m *Maintenance) Schedule(w maintenanceWindow) error {
+	if !w.End.After(w.Start) {
+		return errors.New("maintenance must end after it starts")
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	now := time.Now()
+	windows := m.windows[:0]
+	for _, existing := range m.windows {
+		if existing.End.After(now) {
+			windows = append(windows, existing)
+		}
+	}
+	m.windows = append(windows, w)
+	return nil
+}
+
+// Cancel removes the one-off window starting at start
+func (m *Maintenance) Cancel(start time.Time) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for i, w := range m.windows {
+		if w.Start.Equal(start) {
+			m.windows = append(m.windows[:i], m.windows[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("no maintenance scheduled at this time")
+}
+
+func (m *Maintenance) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	window, ok := m.Active(time.Now())
+	if !ok {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	seconds := ceilSeconds(time.Until(window.End))
+	w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+	resp := localizedResponse(w, r, "maintenance", window.End.UTC().Format(maintenanceTimeLayout))
+	if window.Message != "" {
+		resp.Message = window.Message
+	}
+	resp.RetryAfter = seconds
+	resp.ResumeAt = &window.End
+	renderJSON(w, resp, http.StatusServiceUnavailable)
+}
+
+type maintenanceRequest struct {
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Message string    `json:"message"`
+}
+
+// handleMaintenance lists, schedules and cancels maintenance windows. A window
+// scheduled without a start begins right away
+func handleMaintenance(m *Maintenance) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			renderJSON(w, m.Windows(time.Now()), http.StatusOK)
+			return
+		}
+
+		var req maintenanceRequest
+		if err := decodeJSONBody(r, &req); err != nil {
+			renderError(w, r, err)
+			return
+		}
+
+		var err error
+		switch r.Method {
+		case "POST":
+			if req.Start.IsZero() {
+				req.Start = time.Now().UTC().Truncate(time.Second)
+			}
+			err = m.Schedule(maintenanceWindow{Start: req.Start, End: req.End, Message: req.Message})
+		case "DELETE":
+			err = m.Cancel(req.Start)
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			renderJSON(w, claimResponse{Message: err.Error()}, http.StatusBadRequest)
+			return
+		}
+		renderJSON(w, m.Windows(time.Now()), http.StatusOK)
+	}
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/urfave/negroni"
+)
+
+func TestCronNext(t *testing.T) {
+	from := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC) // a Wednesday
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{expr: "0 3 * * 0", want: time.Date(2024, 5, 5, 3, 0, 0, 0, time.UTC)},
+		{expr: "0 3 * * 7", want: time.Date(2024, 5, 5, 3, 0, 0, 0, time.UTC)},
+		{expr: "*/15 * * * *", want: time.Date(2024, 5, 1, 10, 45, 0, 0, time.UTC)},
+		{expr: "30 9-11 * * 1-5", want: time.Date(2024, 5, 1, 11, 30, 0, 0, time.UTC)},
+		{expr: "0 0 1 1,7 *", want: time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 12 15 * 5", want: time.Date(2024, 5, 3, 12, 0, 0, 0, time.UTC)},
+		{expr: "0 0 30 2 *", want: time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			schedule, err := parseCron(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := schedule.next(from); !got.Equal(tt.want) {
+				t.Errorf("next = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	for _, expr := range []string{"", "0 3 * *", "60 * * * *", "0 3 * * 8", "*/0 * * * *", "5-1 * * * *"} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("parseCron(%q) succeeded, want error", expr)
+		}
+	}
+}
+
+func TestMaintenance(t *testing.T) {
+	now := time.Now().UTC()
+	m, err := NewMaintenance("* * * * *", 90*time.Second, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	window, ok := m.Active(now)
+	if !ok || window.Start.After(now) || !window.End.After(now) {
+		t.Fatalf("active = %v %v, want window around %v", window, ok, now)
+	}
+
+	m, _ = NewMaintenance("", 0, "")
+	if _, ok := m.Active(now); ok {
+		t.Fatal("maintenance active without windows")
+	}
+	first := maintenanceWindow{Start: now.Add(-time.Minute), End: now.Add(time.Hour)}
+	second := maintenanceWindow{Start: now.Add(time.Hour), End: now.Add(2 * time.Hour)}
+	if err := m.Schedule(maintenanceWindow{Start: now, End: now}); err == nil {
+		t.Error("empty window scheduled")
+	}
+	m.Schedule(second)
+	m.Schedule(first)
+	window, ok = m.Active(now)
+	if !ok || !window.End.Equal(second.End) {
+		t.Fatalf("active = %v %v, want merged window ending at %v", window, ok, second.End)
+	}
+
+	handler := negroni.New(m, negroni.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	r := httptest.NewRequest("POST", "/api/claim", nil)
+	r.Header.Set("Accept-Language", "fr")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	var resp claimResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if rec.Code != http.StatusServiceUnavailable || resp.Code != "maintenance" || resp.ResumeAt == nil || !resp.ResumeAt.Equal(second.End) {
+		t.Fatalf("status = %d, response = %+v", rec.Code, resp)
+	}
+	if rec.Header().Get("Retry-After") == "" || rec.Header().Get("Content-Language") != "fr" {
+		t.Errorf("headers = %v", rec.Header())
+	}
+
+	if err := m.Cancel(first.Start); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.Active(now); ok {
+		t.Error("maintenance active after cancelling the ongoing window")
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/api/claim", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("status after maintenance = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// counterVec counts events by the value of a label
+type counterVec struct {
+	mutex  sync.Mutex
+	counts map[string]uint64
+}
+
+func (v *counterVec) Inc(label string) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if v.counts == nil {
+		v.counts = make(map[string]uint64)
+	}
+	v.counts[label]++
+}
+
+// writeCounter writes the counts of v in the Prometheus text format, with the
+// label values sorted so that the output is stable
+func (v *counterVec) writeCounter(w io.Writer, name, help, label string) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	values := make([]string, 0, len(v.counts))
+	for value := range v.counts {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	for _, value := range values {
+		fmt.Fprintf(w, "%s{%s=%q} %d\n", name, label, value, v.counts[value])
+	}
+}
+
+func writeGauge(w io.Writer, name, help string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %g\n", name, help, name, name, value)
+}
+
+func boolGauge(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// metricsWriter is implemented by the components that expose metrics
+type metricsWriter interface {
+	writeMetrics(w io.Writer)
+}
+
+// handleMetrics serves the metrics of the components in the Prometheus text format
+func handleMetrics(components ...metricsWriter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		for _, component := range components {
+			component.writeMetrics(w)
+		}
+	}
+}
@@ -1,10 +1,18 @@
 package server
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"math"
 	"net"
 	"net/http"
+	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -13,119 +21,627 @@ import (
 	"github.com/kataras/hcaptcha"
 	log "github.com/sirupsen/logrus"
 	"github.com/urfave/negroni"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/chainflag/eth-faucet/internal/breaker"
 )
 
 type Limiter struct {
 	mutex      sync.Mutex
 	cache      *ttlcache.Cache
-	proxyCount int
+	quotas     *ttlcache.Cache
+	proxies    *Proxies
 	ttl        time.Duration
+	ipv4Prefix int
+	ipv6Prefix int
+	subnetTTL  time.Duration
+	mode       string
+	claims     int
 }
 
-func NewLimiter(proxyCount int, ttl time.Duration) *Limiter {
+// NewLimiter limits claims per address and IP for ttl, and per IPv4/IPv6 subnet
+// of the given prefix lengths for subnetTTL. A zero prefix disables that subnet limit
+func NewLimiter(proxies *Proxies, ttl time.Duration, ipv4Prefix, ipv6Prefix int, subnetTTL time.Duration) *Limiter {
 	cache := ttlcache.NewCache()
 	cache.SkipTTLExtensionOnHit(true)
+	quotas := ttlcache.NewCache()
+	quotas.SkipTTLExtensionOnHit(true)
 	return &Limiter{
 		cache:      cache,
-		proxyCount: proxyCount,
+		quotas:     quotas,
+		proxies:    proxies,
 		ttl:        ttl,
+		ipv4Prefix: ipv4Prefix,
+		ipv6Prefix: ipv6Prefix,
+		subnetTTL:  subnetTTL,
+		mode:       LimitFixed,
+		claims:     1,
+	}
+}
+
+// SetPolicy makes the limiter allow the given number of claims per address
+// and IP within their cooldown, counted in the given mode. Subnets stay
+// limited to one claim per subnet cooldown
+func (l *Limiter) SetPolicy(mode string, claims int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if mode == "" {
+		mode = LimitFixed
 	}
+	if claims < 1 {
+		claims = 1
+	}
+	l.mode = mode
+	l.claims = claims
+}
+
+type limitKey struct {
+	key    string
+	ttl    time.Duration
+	claims int
 }
 
 func (l *Limiter) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
 	address, err := readAddress(r)
 	if err != nil {
-		var mr *malformedRequest
-		if errors.As(err, &mr) {
-			renderJSON(w, claimResponse{Message: mr.message}, mr.status)
-		} else {
-			renderJSON(w, claimResponse{Message: http.StatusText(http.StatusInternalServerError)}, http.StatusInternalServerError)
-		}
+		renderError(w, r, err)
 		return
 	}
-
-	if l.ttl <= 0 {
+	if _, ok := requestExemption(r.Context()); ok {
 		next.ServeHTTP(w, r)
 		return
 	}
+	if key, ok := requestAPIKey(r.Context()); ok {
+		l.serveQuota(w, r, next, key)
+		return
+	}
 
-	clintIP := getClientIPFromRequest(l.proxyCount, r)
-	l.mutex.Lock()
-	if l.limitByKey(w, address) || l.limitByKey(w, clintIP) {
-		l.mutex.Unlock()
+	clintIP := l.proxies.ClientIP(r)
+	keys := l.keys(address, clintIP, requestCooldown(r.Context()))
+	if weight := requestCooldownWeight(r.Context()); weight > 1 {
+		for i := range keys {
+			keys[i].ttl = time.Duration(float64(keys[i].ttl) * weight)
+		}
+	}
+	if len(keys) == 0 {
+		next.ServeHTTP(w, r)
+		return
+	}
+	_, span := tracer.Start(r.Context(), "limiter.check", trace.WithAttributes(attribute.Int("limiter.keys", len(keys))))
+	res, ok := l.reserve(keys)
+	span.SetAttributes(attribute.Bool("limiter.allowed", ok))
+	span.End()
+	if !ok {
+		setRateLimit(w, res.limit, 0, res.reset)
+		rateLimited(w, r, res.reset, "rate_limited", res.reset.Round(time.Second))
 		return
 	}
-	l.cache.SetWithTTL(address, true, l.ttl)
-	l.cache.SetWithTTL(clintIP, true, l.ttl)
-	l.mutex.Unlock()
 
+	// The claim only counts if it goes through, which is known once the
+	// response status is written, and is given back if its payout fails later
+	ctx := withPayoutRollback(r.Context())
+	onPayoutFailure(ctx, func() {
+		l.release(keys, res)
+	})
+	r = r.WithContext(ctx)
+	w.(negroni.ResponseWriter).Before(func(rw negroni.ResponseWriter) {
+		if rw.Status() == http.StatusOK {
+			setRateLimit(rw, res.limit, res.remaining, res.reset)
+		} else if res.remaining+1 < res.limit {
+			setRateLimit(rw, res.limit, res.remaining+1, res.reset)
+		} else {
+			setRateLimit(rw, res.limit, res.limit, 0)
+		}
+	})
 	next.ServeHTTP(w, r)
 	if w.(negroni.ResponseWriter).Status() != http.StatusOK {
-		l.cache.Remove(address)
-		l.cache.Remove(clintIP)
+		l.release(keys, res)
 		return
 	}
-	log.WithFields(log.Fields{
+	if res.remaining > 0 {
+		return
+	}
+	requestLog(r.Context()).WithFields(log.Fields{
 		"address":  address,
 		"clientIP": clintIP,
 	}).Info("Maximum request limit has been reached")
 }
 
-func (l *Limiter) limitByKey(w http.ResponseWriter, key string) bool {
-	if _, ttl, err := l.cache.GetWithTTL(key); err == nil {
-		errMsg := fmt.Sprintf("You have exceeded the rate limit. Please wait %s before you try again", ttl.Round(time.Second))
-		renderJSON(w, claimResponse{Message: errMsg}, http.StatusTooManyRequests)
-		return true
+// keys returns the cooldowns a claim of address by the identity, an IP or an
+// account ID of another claim channel, is subject to. Top-ups have no
+// identity and only count against the address. minTTL raises the cooldown of
+// suspicious requests above the configured one
+func (l *Limiter) keys(address, identity string, minTTL time.Duration) []limitKey {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	var keys []limitKey
+	if ttl := l.ttl; ttl > 0 || minTTL > 0 {
+		if minTTL > ttl {
+			ttl = minTTL
+		}
+		keys = append(keys, limitKey{address, ttl, l.claims})
+		if identity != "" {
+			keys = append(keys, limitKey{identity, ttl, l.claims})
+		}
+	}
+	if subnet := l.subnetKey(identity); subnet != "" && l.subnetTTL > 0 {
+		keys = append(keys, limitKey{subnet, l.subnetTTL, 1})
+	}
+	return keys
+}
+
+// reserve counts a claim against every key, unless one of them has no claims
+// left in which case the reservation holds the time until it may be retried.
+// Otherwise it describes the key with the fewest claims left
+func (l *Limiter) reserve(keys []limitKey) (reservation, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := time.Now()
+	entries := make([]limitEntry, len(keys))
+	ttls := make([]time.Duration, len(keys))
+	var res reservation
+	blocked := false
+	for i, k := range keys {
+		var entry limitEntry
+		value, ttl, err := l.cache.GetWithTTL(k.key)
+		if err == nil {
+			entry, _ = value.(limitEntry)
+		}
+		next, taken, ok := l.take(k, entry, ttl, now)
+		switch {
+		case !ok && (!blocked || taken.reset > res.reset):
+			res, blocked = taken, true
+		case blocked:
+		case i == 0 || taken.remaining < res.remaining || taken.remaining == res.remaining && taken.reset > res.reset:
+			res = taken
+		}
+		entries[i], ttls[i] = next, taken.reset
+	}
+	if blocked {
+		return res, false
+	}
+	// The quota of a key is restored once its entry expires
+	for i, k := range keys {
+		l.cache.SetWithTTL(k.key, entries[i], ttls[i])
+	}
+	return res, true
+}
+
+// release takes back the claim of res from the keys it was not accepted under
+func (l *Limiter) release(keys []limitKey, res reservation) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for _, k := range keys {
+		value, ttl, err := l.cache.GetWithTTL(k.key)
+		if err != nil {
+			continue
+		}
+		entry, _ := value.(limitEntry)
+		if entry, ok := l.untake(k, entry, res); ok {
+			l.cache.SetWithTTL(k.key, entry, ttl)
+		} else {
+			l.cache.Remove(k.key)
+		}
+	}
+}
+
+// serveQuota counts claims made with an API key against its daily quota
+// instead of applying the address and IP cooldowns
+func (l *Limiter) serveQuota(w http.ResponseWriter, r *http.Request, next http.HandlerFunc, key APIKey) {
+	// Claims of larger payouts use up the quota in proportion
+	cost := int(math.Ceil(requestCooldownWeight(r.Context())))
+	count, ttl, ok := l.countQuota(key, cost)
+	if !ok {
+		setRateLimit(w, key.Quota, key.Quota-count, ttl)
+		rateLimited(w, r, ttl, "quota_exceeded", key.Quota, ttl.Round(time.Second))
+		return
 	}
-	return false
+
+	ctx := withPayoutRollback(r.Context())
+	onPayoutFailure(ctx, func() {
+		l.releaseQuota(key, cost)
+	})
+	r = r.WithContext(ctx)
+	w.(negroni.ResponseWriter).Before(func(rw negroni.ResponseWriter) {
+		used := count
+		if rw.Status() == http.StatusOK {
+			used += cost
+		}
+		setRateLimit(rw, key.Quota, key.Quota-used, ttl)
+	})
+	next.ServeHTTP(w, r)
+	if w.(negroni.ResponseWriter).Status() != http.StatusOK {
+		l.releaseQuota(key, cost)
+	}
+}
+
+// countQuota counts cost claims against the daily quota of key unless that
+// would exceed it. It returns the claims counted before and the time until
+// the quota resets
+func (l *Limiter) countQuota(key APIKey, cost int) (int, time.Duration, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	count, ttl := 0, apiKeyWindow
+	if value, remaining, err := l.quotas.GetWithTTL(key.Hash); err == nil && remaining > 0 {
+		count, ttl = value.(int), remaining
+	}
+	if count+cost > key.Quota {
+		return count, ttl, false
+	}
+	l.quotas.SetWithTTL(key.Hash, count+cost, ttl)
+	return count, ttl, true
+}
+
+// takeQuota counts cost claims against the daily quota of key, or returns the
+// time until it resets if it is used up
+func (l *Limiter) takeQuota(key APIKey, cost int) (time.Duration, bool) {
+	_, ttl, ok := l.countQuota(key, cost)
+	return ttl, ok
 }
 
-func getClientIPFromRequest(proxyCount int, r *http.Request) string {
-	if proxyCount > 0 {
-		xForwardedFor := r.Header.Get("X-Forwarded-For")
-		if xForwardedFor != "" {
-			xForwardedForParts := strings.Split(xForwardedFor, ",")
-			// Avoid reading the user's forged request header by configuring the count of reverse proxies
-			partIndex := len(xForwardedForParts) - proxyCount
-			if partIndex < 0 {
-				partIndex = 0
-			}
-			return strings.TrimSpace(xForwardedForParts[partIndex])
+// releaseQuota gives back cost claims counted against the quota of key
+func (l *Limiter) releaseQuota(key APIKey, cost int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if value, remaining, err := l.quotas.GetWithTTL(key.Hash); err == nil && remaining > 0 && value.(int) > 0 {
+		count := value.(int) - cost
+		if count < 0 {
+			count = 0
 		}
+		l.quotas.SetWithTTL(key.Hash, count, remaining)
 	}
+}
+
+// setRateLimit describes the limit a claim is subject to in the RateLimit
+// headers of the IETF draft, reset being the time until the window restarts
+func setRateLimit(w http.ResponseWriter, limit, remaining int, reset time.Duration) {
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(remaining))
+	w.Header().Set("RateLimit-Reset", strconv.FormatInt(ceilSeconds(reset), 10))
+}
 
-	remoteIP, _, err := net.SplitHostPort(r.RemoteAddr)
+// rateLimited rejects a claim that has to wait before it may be retried, with
+// the wait in a form clients can back off on without parsing the message
+func rateLimited(w http.ResponseWriter, r *http.Request, wait time.Duration, code string, args ...interface{}) {
+	seconds := ceilSeconds(wait)
+	w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+	resp := localizedResponse(w, r, code, args...)
+	resp.RetryAfter = seconds
+	renderJSON(w, resp, http.StatusTooManyRequests)
+}
+
+func ceilSeconds(d time.Duration) int64 {
+	return int64(math.Ceil(d.Seconds()))
+}
+
+// SetTTL changes the cooldowns applied to subsequent claims, active cooldowns keep their expiry
+func (l *Limiter) SetTTL(ttl, subnetTTL time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.ttl = ttl
+	l.subnetTTL = subnetTTL
+}
+
+// subnetKey returns the network of the client IP masked to the configured prefix
+func (l *Limiter) subnetKey(clientIP string) string {
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return ""
+	}
+
+	prefix, bits := l.ipv6Prefix, 128
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, prefix, bits = ip4, l.ipv4Prefix, 32
+	}
+	if prefix <= 0 || prefix > bits {
+		return ""
+	}
+	network := &net.IPNet{IP: ip.Mask(net.CIDRMask(prefix, bits)), Mask: net.CIDRMask(prefix, bits)}
+	return network.String()
+}
+
+// savedLimit is the usage of a limit key in the state file
+type savedLimit struct {
+	ExpiresAt time.Time `json:"expires_at"`
+	limitEntry
+}
+
+// SaveState writes the usage of every limit key to path so it survives a
+// restart, encrypted with key if it is not nil
+func (l *Limiter) SaveState(path string, key []byte) error {
+	state := make(map[string]savedLimit)
+	now := time.Now()
+	for _, key := range l.cache.GetKeys() {
+		if value, ttl, err := l.cache.GetWithTTL(key); err == nil && ttl > 0 {
+			entry, _ := value.(limitEntry)
+			state[key] = savedLimit{ExpiresAt: now.Add(ttl), limitEntry: entry}
+		}
+	}
+
+	data, err := json.Marshal(state)
 	if err != nil {
-		remoteIP = r.RemoteAddr
+		return err
 	}
-	return remoteIP
+	return writeState(path, key, data)
 }
 
+// LoadState restores the usage saved by SaveState that has not expired yet.
+// Files of earlier versions, which only held the expiry of each cooldown, are
+// restored as a single claim
+func (l *Limiter) LoadState(path string, key []byte) error {
+	data, err := readState(path, key)
+	if err != nil || data == nil {
+		return err
+	}
+
+	var state map[string]json.RawMessage
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for key, raw := range state {
+		var saved savedLimit
+		if err := json.Unmarshal(raw, &saved.ExpiresAt); err == nil {
+			saved.limitEntry = limitEntry{Count: 1, Claims: []time.Time{time.Now()}, Level: 1, Updated: time.Now()}
+		} else if err := json.Unmarshal(raw, &saved); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if ttl := time.Until(saved.ExpiresAt); ttl > 0 {
+			l.cache.SetWithTTL(key, saved.limitEntry, ttl)
+		}
+	}
+	return nil
+}
+
+const (
+	// CaptchaFailClosed rejects claims while hCaptcha cannot be reached
+	CaptchaFailClosed = "closed"
+	// CaptchaFailOpen lets claims through unverified while hCaptcha cannot be
+	// reached, each address and IP at most once per fail open cooldown
+	CaptchaFailOpen = "open"
+	// CaptchaFailPow accepts the proof of work challenge in place of hCaptcha
+	// while it cannot be reached
+	CaptchaFailPow = "pow"
+
+	captchaTimeout          = 5 * time.Second
+	captchaBreakerThreshold = 5
+	captchaBreakerCooldown  = 30 * time.Second
+)
+
+// hcaptchaErrorPattern matches the error codes of the siteverify API such as
+// invalid-input-response, any other error is a failure to reach it
+var hcaptchaErrorPattern = regexp.MustCompile(`^[a-z]+(-[a-z]+)+$`)
+
+var errCaptchaUnavailable = errors.New("hcaptcha is unavailable")
+
 type Captcha struct {
-	client *hcaptcha.Client
-	secret string
+	mutex     sync.RWMutex
+	client    *hcaptcha.Client
+	secret    string
+	pow       *ProofOfWork
+	proxies   *Proxies
+	transport http.RoundTripper
+	// verified holds the tokens recently accepted by hCaptcha, which it
+	// would reject as already seen if a claim is retried
+	verified *ttlcache.Cache
+	cacheTTL time.Duration
+	breaker  *breaker.Breaker
+	failMode string
+	// unverified holds the addresses and IPs let through while hCaptcha was
+	// down, which may not fail open again within failOpenTTL
+	unverified  *ttlcache.Cache
+	failOpenTTL time.Duration
+	lastFailure time.Time
+	// verifications counts the calls to hCaptcha by result, fallbacks the
+	// claims that could not be verified by how the fail mode handled them
+	verifications counterVec
+	fallbacks     counterVec
+}
+
+func NewCaptcha(hcaptchaSiteKey, hcaptchaSecret string, pow *ProofOfWork, proxies *Proxies, cacheTTL time.Duration, failMode string, failOpenTTL time.Duration) *Captcha {
+	verified := ttlcache.NewCache()
+	verified.SkipTTLExtensionOnHit(true)
+	unverified := ttlcache.NewCache()
+	unverified.SkipTTLExtensionOnHit(true)
+	if failMode == "" {
+		failMode = CaptchaFailClosed
+	}
+	c := &Captcha{
+		pow:         pow,
+		proxies:     proxies,
+		verified:    verified,
+		cacheTTL:    cacheTTL,
+		breaker:     breaker.New(captchaBreakerThreshold, captchaBreakerCooldown),
+		failMode:    failMode,
+		unverified:  unverified,
+		failOpenTTL: failOpenTTL,
+	}
+	c.SetKeys(hcaptchaSiteKey, hcaptchaSecret)
+	return c
 }
 
-func NewCaptcha(hcaptchaSiteKey, hcaptchaSecret string) *Captcha {
+// SetKeys replaces the hCaptcha credentials used to verify subsequent claims
+func (c *Captcha) SetKeys(hcaptchaSiteKey, hcaptchaSecret string) {
 	client := hcaptcha.New(hcaptchaSecret)
 	client.SiteKey = hcaptchaSiteKey
-	return &Captcha{
-		client: client,
-		secret: hcaptchaSecret,
-	}
+	client.HTTPClient = &http.Client{Timeout: captchaTimeout, Transport: c.transport}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.client = client
+	c.secret = hcaptchaSecret
+}
+
+// Degraded reports whether hCaptcha failed to answer within the breaker cooldown
+func (c *Captcha) Degraded() bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.breaker.Open() || time.Since(c.lastFailure) < captchaBreakerCooldown
+}
+
+// PowFallback reports whether claims are to solve the proof of work challenge
+// in place of hCaptcha at the moment
+func (c *Captcha) PowFallback() bool {
+	return c != nil && c.failMode == CaptchaFailPow && c.pow.Enabled() && c.Degraded()
 }
 
 func (c *Captcha) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
-	if c.secret == "" {
+	// Requests with an API key are made by scripts that cannot solve a captcha
+	if _, ok := requestAPIKey(r.Context()); ok {
 		next.ServeHTTP(w, r)
 		return
 	}
+	// Exempt claims and claims authorized by a partner service were vetted elsewhere
+	_, exempt := requestExemption(r.Context())
+	if _, ok := requestPartner(r.Context()); ok || exempt {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	c.mutex.RLock()
+	client, secret := c.client, c.secret
+	c.mutex.RUnlock()
 
-	response := c.client.VerifyToken(r.Header.Get("h-captcha-response"))
-	if !response.Success {
-		renderJSON(w, claimResponse{Message: "Captcha verification failed, please try again"}, http.StatusTooManyRequests)
+	// Scripted clients may solve a proof of work challenge in place of hCaptcha,
+	// unless their request is subject to a strict captcha policy. Where it is
+	// only the fallback of hCaptcha, it is accepted while hCaptcha is down
+	strict := strictCaptcha(r.Context()) && secret != ""
+	powAccepted := secret == "" || c.failMode != CaptchaFailPow || c.Degraded()
+	if c.pow.Enabled() && !strict && powAccepted && (r.Header.Get(powSeedHeader) != "" || secret == "") {
+		c.servePow(w, r, next)
 		return
 	}
 
+	if secret == "" {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	token := r.Header.Get("h-captcha-response")
+	address, _ := readAddress(r)
+	digest := sha256.Sum256([]byte(token + "\x00" + strings.ToLower(address)))
+	key := hex.EncodeToString(digest[:])
+	if _, err := c.verified.Get(key); err == nil {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	verified, err := c.verify(r.Context(), client, token)
+	if err != nil {
+		requestLog(r.Context()).WithError(err).Warn("Failed to verify captcha")
+		c.fail(w, r, next, address, strict)
+		return
+	}
+	if !verified {
+		renderLocalized(w, r, http.StatusTooManyRequests, "captcha_failed")
+		return
+	}
+	if c.cacheTTL > 0 {
+		c.verified.SetWithTTL(key, true, c.cacheTTL)
+	}
+
 	next.ServeHTTP(w, r)
 }
+
+func (c *Captcha) servePow(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	address, _ := readAddress(r)
+	_, span := tracer.Start(r.Context(), "pow.verify")
+	verified := c.pow.Verify(r.Header.Get(powSeedHeader), address, r.Header.Get(powNonceHeader))
+	span.SetAttributes(attribute.Bool("captcha.success", verified))
+	span.End()
+	if !verified {
+		renderLocalized(w, r, http.StatusTooManyRequests, "pow_failed")
+		return
+	}
+	next.ServeHTTP(w, r)
+}
+
+// fail handles a claim whose captcha could not be verified according to the
+// fail mode. Claims subject to a strict captcha policy are always rejected
+func (c *Captcha) fail(w http.ResponseWriter, r *http.Request, next http.HandlerFunc, address string, strict bool) {
+	switch {
+	case strict || c.failMode == CaptchaFailClosed:
+		c.fallbacks.Inc(CaptchaFailClosed)
+		renderLocalized(w, r, http.StatusServiceUnavailable, "captcha_unavailable")
+	case c.failMode == CaptchaFailPow:
+		c.fallbacks.Inc(CaptchaFailPow)
+		renderLocalized(w, r, http.StatusServiceUnavailable, "captcha_pow_fallback")
+	default:
+		c.failOpen(w, r, next, address)
+	}
+}
+
+// failOpen lets a claim through unverified, unless its address or IP was let
+// through unverified before within failOpenTTL
+func (c *Captcha) failOpen(w http.ResponseWriter, r *http.Request, next http.HandlerFunc, address string) {
+	keys := []string{strings.ToLower(address), c.proxies.ClientIP(r)}
+	c.mutex.Lock()
+	for _, key := range keys {
+		if _, ttl, err := c.unverified.GetWithTTL(key); err == nil && ttl > 0 {
+			c.mutex.Unlock()
+			c.fallbacks.Inc("open_limited")
+			rateLimited(w, r, ttl, "rate_limited", ttl.Round(time.Second))
+			return
+		}
+	}
+	if c.failOpenTTL > 0 {
+		for _, key := range keys {
+			c.unverified.SetWithTTL(key, true, c.failOpenTTL)
+		}
+	}
+	c.mutex.Unlock()
+
+	c.fallbacks.Inc(CaptchaFailOpen)
+	requestLog(r.Context()).WithField("address", address).Info("Claim let through without captcha while hCaptcha is down")
+	next.ServeHTTP(w, r)
+	if status := w.(negroni.ResponseWriter).Status(); status != http.StatusOK && status != 0 {
+		for _, key := range keys {
+			c.unverified.Remove(key)
+		}
+	}
+}
+
+func (c *Captcha) writeMetrics(w io.Writer) {
+	c.mutex.RLock()
+	configured := c.secret != ""
+	c.mutex.RUnlock()
+	if !configured {
+		return
+	}
+	writeGauge(w, "faucet_captcha_up", "Whether hCaptcha answered the recent verifications", boolGauge(!c.Degraded()))
+	writeGauge(w, "faucet_captcha_breaker_open", "Whether calls to hCaptcha are suspended after repeated failures", boolGauge(c.breaker.Open()))
+	c.verifications.writeCounter(w, "faucet_captcha_verifications_total", "Verifications of hCaptcha tokens by result", "result")
+	c.fallbacks.writeCounter(w, "faucet_captcha_fallbacks_total", "Claims handled by the fail mode while hCaptcha was down", "mode")
+}
+
+// verify asks hCaptcha whether the token was solved. It fails without
+// calling hCaptcha while the breaker is open after repeated failures to reach it
+func (c *Captcha) verify(ctx context.Context, client *hcaptcha.Client, token string) (bool, error) {
+	if token == "" {
+		return false, nil
+	}
+	if !c.breaker.Allow() {
+		c.verifications.Inc("skipped")
+		return false, errCaptchaUnavailable
+	}
+
+	_, span := tracer.Start(ctx, "captcha.verify", trace.WithSpanKind(trace.SpanKindClient))
+	response := client.VerifyToken(token)
+	span.SetAttributes(attribute.Bool("captcha.success", response.Success))
+	span.End()
+	if !response.Success && len(response.ErrorCodes) > 0 && !hcaptchaErrorPattern.MatchString(response.ErrorCodes[0]) {
+		c.breaker.Failure()
+		c.mutex.Lock()
+		c.lastFailure = time.Now()
+		c.mutex.Unlock()
+		c.verifications.Inc("error")
+		return false, fmt.Errorf("%w: %s", errCaptchaUnavailable, response.ErrorCodes[0])
+	}
+	c.breaker.Success()
+	if response.Success {
+		c.verifications.Inc("success")
+	} else {
+		c.verifications.Inc("failure")
+	}
+	return response.Success, nil
+}
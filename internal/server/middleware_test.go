@@ -0,0 +1,368 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jellydator/ttlcache/v2"
+	"github.com/urfave/negroni"
+
+	"github.com/chainflag/eth-faucet/internal/breaker"
+)
+
+func TestLimiterSubnetKey(t *testing.T) {
+	limiter := NewLimiter(nil, time.Hour, 24, 64, time.Hour)
+	tests := []struct {
+		name string
+		ip   string
+		want string
+	}{
+		{name: "ipv4", ip: "192.168.1.77", want: "192.168.1.0/24"},
+		{name: "ipv6", ip: "2001:db8:1:2:3:4:5:6", want: "2001:db8:1:2::/64"},
+		{name: "invalid", ip: "invalid", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := limiter.subnetKey(tt.ip); got != tt.want {
+				t.Errorf("subnetKey() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLimiterSubnet(t *testing.T) {
+	limiter := NewLimiter(nil, 0, 24, 64, time.Hour)
+	handler := negroni.New(limiter, negroni.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		want       int
+	}{
+		{name: "first claim", remoteAddr: "10.0.0.1:1234", want: http.StatusOK},
+		{name: "same subnet", remoteAddr: "10.0.0.2:1234", want: http.StatusTooManyRequests},
+		{name: "other subnet", remoteAddr: "10.0.1.1:1234", want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := bytes.NewBufferString(`{"address":"0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"}`)
+			req := httptest.NewRequest("POST", "/api/claim", body)
+			req.RemoteAddr = tt.remoteAddr
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestLimiterState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "limiter.json")
+	limiter := NewLimiter(nil, time.Hour, 0, 0, 0)
+	limiter.cache.SetWithTTL("10.0.0.1", limitEntry{Count: 1}, time.Hour)
+	if err := limiter.SaveState(path, nil); err != nil {
+		t.Fatalf("SaveState() error = %v", err)
+	}
+
+	restored := NewLimiter(nil, time.Hour, 0, 0, 0)
+	if err := restored.LoadState(path, nil); err != nil {
+		t.Fatalf("LoadState() error = %v", err)
+	}
+	if _, ttl, err := restored.cache.GetWithTTL("10.0.0.1"); err != nil || ttl < 59*time.Minute {
+		t.Errorf("restored cooldown ttl = %v, err = %v", ttl, err)
+	}
+	if err := NewLimiter(nil, time.Hour, 0, 0, 0).LoadState(filepath.Join(t.TempDir(), "missing.json"), nil); err != nil {
+		t.Errorf("LoadState() with missing file error = %v", err)
+	}
+
+	legacy := filepath.Join(t.TempDir(), "legacy.json")
+	os.WriteFile(legacy, []byte(`{"10.0.0.1":"`+time.Now().Add(time.Hour).Format(time.RFC3339)+`"}`), 0600)
+	restored = NewLimiter(nil, time.Hour, 0, 0, 0)
+	if err := restored.LoadState(legacy, nil); err != nil {
+		t.Fatalf("LoadState() of legacy file error = %v", err)
+	}
+	if _, ok := restored.reserve(restored.keys("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", "10.0.0.1", 0)); ok {
+		t.Errorf("legacy cooldown was not restored")
+	}
+}
+
+func TestLimiterPolicies(t *testing.T) {
+	// Claims of two per three hours made at these minutes
+	minutes := []int{0, 100, 170, 192, 197}
+	tests := []struct {
+		mode    string
+		allowed []bool
+	}{
+		{mode: LimitFixed, allowed: []bool{true, true, false, true, true}},
+		{mode: LimitSliding, allowed: []bool{true, true, false, true, false}},
+		{mode: LimitBucket, allowed: []bool{true, true, true, true, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			limiter := NewLimiter(nil, 3*time.Hour, 0, 0, 0)
+			limiter.SetPolicy(tt.mode, 2)
+			k := limitKey{"0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", 3 * time.Hour, 2}
+			var entry limitEntry
+			var expiresAt time.Time
+			start := time.Now()
+			for i, want := range tt.allowed {
+				now := start.Add(time.Duration(minutes[i]) * time.Minute)
+				if !now.Before(expiresAt) {
+					entry = limitEntry{}
+				}
+				next, res, ok := limiter.take(k, entry, expiresAt.Sub(now), now)
+				if ok != want {
+					t.Fatalf("claim %d allowed = %v, want %v", i, ok, want)
+				}
+				if ok {
+					entry, expiresAt = next, now.Add(res.reset)
+				} else if res.reset <= 0 || res.reset > 3*time.Hour {
+					t.Errorf("claim %d retry in %v", i, res.reset)
+				}
+			}
+		})
+	}
+}
+
+func TestLimiterRelease(t *testing.T) {
+	for _, mode := range []string{LimitFixed, LimitSliding, LimitBucket} {
+		limiter := NewLimiter(nil, time.Hour, 0, 0, 0)
+		limiter.SetPolicy(mode, 2)
+		keys := limiter.keys("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", "10.0.0.1", 0)
+		first, _ := limiter.reserve(keys)
+		res, ok := limiter.reserve(keys)
+		if !ok || res.remaining != 0 {
+			t.Fatalf("%s: second claim allowed = %v with %d left", mode, ok, res.remaining)
+		}
+		limiter.release(keys, res)
+		if res, ok = limiter.reserve(keys); !ok {
+			t.Errorf("%s: claim after release was rejected", mode)
+		}
+		limiter.release(keys, first)
+		limiter.release(keys, res)
+		if keys := limiter.cache.GetKeys(); len(keys) != 0 {
+			t.Errorf("%s: keys %v left after releasing every claim", mode, keys)
+		}
+	}
+}
+
+func TestLimiterFailedPayout(t *testing.T) {
+	q := NewQueue(&mockTxBuilder{err: errors.New("insufficient funds")}, 1, 1)
+	q.OnFinal(RollbackFailed)
+	q.Start()
+	var claimID string
+	limiter := NewLimiter(nil, time.Hour, 0, 0, 0)
+	handler := negroni.New(limiter, negroni.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claim, err := q.Enqueue(r.Context(), "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", big.NewInt(1))
+		if err != nil {
+			t.Fatalf("Enqueue() error = %v", err)
+		}
+		claimID = claim.ID
+		w.WriteHeader(http.StatusOK)
+	})))
+	claim := func() int {
+		body := bytes.NewBufferString(`{"address":"0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"}`)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("POST", "/api/claim", body))
+		return rec.Code
+	}
+
+	if code := claim(); code != http.StatusOK {
+		t.Fatalf("first claim = %d, want %d", code, http.StatusOK)
+	}
+	waitForStatus(t, q, claimID, ClaimFailed)
+	deadline := time.Now().Add(time.Second)
+	for len(limiter.cache.GetKeys()) > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if code := claim(); code != http.StatusOK {
+		t.Errorf("claim after a failed payout = %d, want %d", code, http.StatusOK)
+	}
+}
+
+func TestLimiterHeaders(t *testing.T) {
+	limiter := NewLimiter(nil, time.Hour, 0, 0, 0)
+	status := http.StatusOK
+	handler := negroni.New(limiter, negroni.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	})))
+	claim := func(address string) *httptest.ResponseRecorder {
+		body := bytes.NewBufferString(`{"address":"` + address + `"}`)
+		req := httptest.NewRequest("POST", "/api/claim", body)
+		req.RemoteAddr = "10.0.0.1:1234"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	status = http.StatusBadGateway
+	rec := claim("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
+	if got := rec.Header().Get("RateLimit-Remaining"); got != "1" {
+		t.Errorf("failed claim RateLimit-Remaining = %q, want 1", got)
+	}
+
+	status = http.StatusOK
+	rec = claim("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
+	if got := rec.Header().Get("RateLimit-Limit"); got != "1" {
+		t.Errorf("RateLimit-Limit = %q, want 1", got)
+	}
+	if got := rec.Header().Get("RateLimit-Remaining"); got != "0" {
+		t.Errorf("RateLimit-Remaining = %q, want 0", got)
+	}
+	if got := rec.Header().Get("RateLimit-Reset"); got != "3600" {
+		t.Errorf("RateLimit-Reset = %q, want 3600", got)
+	}
+
+	rec = claim("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	retryAfter, err := strconv.Atoi(rec.Header().Get("Retry-After"))
+	if err != nil || retryAfter < 3590 || retryAfter > 3600 {
+		t.Errorf("Retry-After = %q", rec.Header().Get("Retry-After"))
+	}
+	var resp claimResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.RetryAfter != int64(retryAfter) {
+		t.Errorf("retryAfterSeconds = %d, want %d", resp.RetryAfter, retryAfter)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestCaptchaVerification(t *testing.T) {
+	var calls int
+	var reply string
+	transport := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		calls++
+		if reply == "" {
+			return nil, errors.New("connection refused")
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(reply)), Header: make(http.Header)}, nil
+	})
+	newHandler := func(failMode string) http.Handler {
+		captcha := &Captcha{pow: NewProofOfWork(0), verified: ttlcache.NewCache(), cacheTTL: time.Minute, breaker: breaker.New(2, time.Hour), failMode: failMode, unverified: ttlcache.NewCache(), failOpenTTL: time.Hour}
+		captcha.transport = transport
+		captcha.SetKeys("sitekey", "secret")
+		return negroni.New(captcha, negroni.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	}
+	claim := func(handler http.Handler, token string) int {
+		r := httptest.NewRequest("POST", "/api/claim", strings.NewReader(`{"address":"0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"}`))
+		r.Header.Set("h-captcha-response", token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec.Code
+	}
+
+	handler := newHandler(CaptchaFailClosed)
+	reply = `{"success":false,"error-codes":["invalid-input-response"]}`
+	if code := claim(handler, "bad"); code != http.StatusTooManyRequests {
+		t.Errorf("status of unsolved captcha = %d, want %d", code, http.StatusTooManyRequests)
+	}
+	reply = `{"success":true}`
+	if code := claim(handler, "good"); code != http.StatusOK {
+		t.Errorf("status of solved captcha = %d, want %d", code, http.StatusOK)
+	}
+	reply = `{"success":false,"error-codes":["already-seen-response"]}`
+	if code := claim(handler, "good"); code != http.StatusOK || calls != 2 {
+		t.Errorf("status of retried claim = %d after %d calls, want the verified token to be cached", code, calls)
+	}
+
+	reply = ""
+	for i := 0; i < 2; i++ {
+		if code := claim(handler, "token"); code != http.StatusServiceUnavailable {
+			t.Errorf("status while hCaptcha is down = %d, want %d", code, http.StatusServiceUnavailable)
+		}
+	}
+	if code := claim(handler, "token"); code != http.StatusServiceUnavailable || calls != 4 {
+		t.Errorf("status = %d after %d calls, want the breaker to stop calling hCaptcha", code, calls)
+	}
+
+	if code := claim(newHandler(CaptchaFailOpen), "token"); code != http.StatusOK {
+		t.Errorf("status while hCaptcha is down = %d, want %d when failing open", code, http.StatusOK)
+	}
+}
+
+func TestCaptchaFailModes(t *testing.T) {
+	down := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		return nil, errors.New("connection refused")
+	})
+	newCaptcha := func(failMode string) *Captcha {
+		captcha := NewCaptcha("", "", NewProofOfWork(1), nil, time.Minute, failMode, time.Hour)
+		captcha.transport = down
+		captcha.SetKeys("sitekey", "secret")
+		return captcha
+	}
+	claim := func(captcha *Captcha, address string, pow bool) int {
+		handler := negroni.New(captcha, negroni.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+		r := httptest.NewRequest("POST", "/api/claim", strings.NewReader(`{"address":"`+address+`"}`))
+		r.RemoteAddr = "192.0.2.1:1234"
+		r.Header.Set("h-captcha-response", "token")
+		if pow {
+			challenge, _ := captcha.pow.NewChallenge()
+			r.Header.Set(powSeedHeader, challenge.Seed)
+			r.Header.Set(powNonceHeader, solve(challenge.Seed, address, 1))
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec.Code
+	}
+
+	// Failing open lets one claim per IP through within the cooldown
+	open := newCaptcha(CaptchaFailOpen)
+	if code := claim(open, "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", false); code != http.StatusOK {
+		t.Errorf("status of first unverified claim = %d, want %d", code, http.StatusOK)
+	}
+	if code := claim(open, "0x0000000000000000000000000000000000000001", false); code != http.StatusTooManyRequests {
+		t.Errorf("status of second unverified claim from the IP = %d, want %d", code, http.StatusTooManyRequests)
+	}
+
+	// Falling back to proof of work only accepts it once hCaptcha failed
+	pow := newCaptcha(CaptchaFailPow)
+	if pow.PowFallback() {
+		t.Error("PowFallback() before hCaptcha failed")
+	}
+	if code := claim(pow, "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", false); code != http.StatusServiceUnavailable {
+		t.Errorf("status of claim without proof of work = %d, want %d", code, http.StatusServiceUnavailable)
+	}
+	if !pow.PowFallback() {
+		t.Error("PowFallback() is false after hCaptcha failed")
+	}
+	if code := claim(pow, "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", true); code != http.StatusOK {
+		t.Errorf("status of claim with proof of work = %d, want %d", code, http.StatusOK)
+	}
+
+	rec := httptest.NewRecorder()
+	handleMetrics(open, pow).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	for _, want := range []string{
+		"faucet_captcha_up 0\n",
+		`faucet_captcha_verifications_total{result="error"} 2`,
+		`faucet_captcha_fallbacks_total{mode="open"} 1`,
+		`faucet_captcha_fallbacks_total{mode="open_limited"} 1`,
+		`faucet_captcha_fallbacks_total{mode="pow"} 1`,
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("metrics lack %q:\n%s", want, rec.Body.String())
+		}
+	}
+}
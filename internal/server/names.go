@@ -0,0 +1,155 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/jellydator/ttlcache/v2"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+type resolvedAddressKey struct{}
+
+func withResolvedAddress(r *http.Request, address string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), resolvedAddressKey{}, address))
+}
+
+func resolvedAddress(ctx context.Context) (string, bool) {
+	address, ok := ctx.Value(resolvedAddressKey{}).(string)
+	return address, ok
+}
+
+// NativeAddresses lets claims on chains whose addresses are not hex name the
+// recipient in the native format, e.g. bech32, and hands the rest of the claim
+// pipeline its hex form. Hex addresses are refused as they would pay out to an
+// account nobody holds the key of. A nil codec disables it
+type NativeAddresses struct {
+	codec chain.AddressCodec
+}
+
+func NewNativeAddresses(codec chain.AddressCodec) *NativeAddresses {
+	return &NativeAddresses{codec: codec}
+}
+
+func (n *NativeAddresses) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	var claimReq claimRequest
+	// Malformed requests are reported by the limiter
+	if n.codec == nil || decodeJSONBody(r, &claimReq) != nil {
+		next.ServeHTTP(w, r)
+		return
+	}
+	account, err := n.codec.ParseAddress(claimReq.Address)
+	if err != nil {
+		renderLocalized(w, r, http.StatusBadRequest, "invalid_address")
+		return
+	}
+	next.ServeHTTP(w, withResolvedAddress(r, account.Hex()))
+}
+
+type addressResolver interface {
+	Resolve(ctx context.Context, name string) (common.Address, error)
+}
+
+const (
+	// nameLookupRate and nameLookupBurst bound the names a client IP gets
+	// resolved through the node, as lookups run before the limiter and captcha
+	nameLookupRate  = 0.1
+	nameLookupBurst = 5
+	// nameNotFoundTTL is how long a name found to be unregistered is remembered
+	nameNotFoundTTL = time.Minute
+)
+
+// NameResolution lets users claim to an ENS style name in place of an address,
+// caching every resolution for ttl and every unknown name for a minute. A nil
+// resolver disables it
+type NameResolution struct {
+	resolver addressResolver
+	cache    *ttlcache.Cache
+	ttl      time.Duration
+	lookups  *Throttle
+}
+
+func NewNameResolution(resolver addressResolver, ttl time.Duration, proxies *Proxies) *NameResolution {
+	cache := ttlcache.NewCache()
+	cache.SkipTTLExtensionOnHit(true)
+	return &NameResolution{
+		resolver: resolver,
+		cache:    cache,
+		ttl:      ttl,
+		lookups:  NewThrottle(proxies, nameLookupRate, nameLookupBurst),
+	}
+}
+
+func (n *NameResolution) Enabled() bool {
+	return n.resolver != nil
+}
+
+// Resolve returns the checksummed address name points to
+func (n *NameResolution) Resolve(ctx context.Context, name string) (string, error) {
+	name = strings.ToLower(name)
+	if value, err := n.cache.Get(name); err == nil {
+		if value.(string) == "" {
+			return "", chain.ErrNameNotFound
+		}
+		return value.(string), nil
+	}
+	address, err := n.resolver.Resolve(ctx, name)
+	if errors.Is(err, chain.ErrNameNotFound) {
+		n.cache.SetWithTTL(name, "", nameNotFoundTTL)
+		return "", err
+	} else if err != nil {
+		return "", err
+	}
+	n.cache.SetWithTTL(name, address.Hex(), n.ttl)
+	return address.Hex(), nil
+}
+
+// cached reports whether name resolves without a call to the node
+func (n *NameResolution) cached(name string) bool {
+	_, err := n.cache.Get(strings.ToLower(name))
+	return err == nil
+}
+
+// Run prunes the lookup buckets of idle clients until ctx is done
+func (n *NameResolution) Run(ctx context.Context) {
+	n.lookups.Run(ctx)
+}
+
+func (n *NameResolution) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	var claimReq claimRequest
+	// Malformed requests are reported by the limiter
+	if !n.Enabled() || decodeJSONBody(r, &claimReq) != nil || !chain.IsName(claimReq.Address) {
+		next.ServeHTTP(w, r)
+		return
+	}
+	if !n.cached(claimReq.Address) {
+		if ok, wait := n.lookups.allow(n.lookups.proxies.ClientIP(r), time.Now()); !ok {
+			rateLimited(w, r, wait, "throttled")
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	address, err := n.Resolve(ctx, claimReq.Address)
+	if errors.Is(err, chain.ErrNameNotFound) {
+		renderLocalized(w, r, http.StatusBadRequest, "name_not_found", claimReq.Address)
+		return
+	} else if err != nil {
+		requestLog(r.Context()).WithError(err).WithField("name", claimReq.Address).Error("Failed to resolve name")
+		renderLocalized(w, r, http.StatusServiceUnavailable, "name_unavailable")
+		return
+	}
+
+	requestLog(r.Context()).WithFields(log.Fields{
+		"name":    claimReq.Address,
+		"address": address,
+	}).Info("Resolved claim recipient")
+	next.ServeHTTP(w, withResolvedAddress(r, address))
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/urfave/negroni"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+type mockResolver struct {
+	names map[string]common.Address
+	calls int
+}
+
+func (m *mockResolver) Resolve(_ context.Context, name string) (common.Address, error) {
+	m.calls++
+	address, ok := m.names[name]
+	if !ok {
+		return common.Address{}, chain.ErrNameNotFound
+	}
+	return address, nil
+}
+
+func TestNameResolution(t *testing.T) {
+	resolver := &mockResolver{names: map[string]common.Address{
+		"alice.fuse": common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"),
+	}}
+	proxies, _ := NewProxies(0, nil, "")
+	var got string
+	handler := negroni.New(NewNameResolution(resolver, time.Minute, proxies), negroni.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = readAddress(r)
+	})))
+
+	tests := []struct {
+		name    string
+		body    string
+		want    string
+		wantErr int
+	}{
+		{name: "address", body: `{"address":"0x829BD824B016326A401d083B33D092293333A830"}`, want: "0x829BD824B016326A401d083B33D092293333A830"},
+		{name: "name", body: `{"address":"alice.fuse"}`, want: "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"},
+		{name: "cached name", body: `{"address":"Alice.fuse"}`, want: "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"},
+		{name: "unknown name", body: `{"address":"bob.fuse"}`, wantErr: http.StatusBadRequest},
+		{name: "cached unknown name", body: `{"address":"bob.fuse"}`, wantErr: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = ""
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest("POST", "/api/claim", bytes.NewBufferString(tt.body)))
+			if tt.wantErr != 0 {
+				if rec.Code != tt.wantErr {
+					t.Errorf("status = %d, want %d", rec.Code, tt.wantErr)
+				}
+				return
+			}
+			if got != tt.want {
+				t.Errorf("readAddress() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+	if resolver.calls != 2 {
+		t.Errorf("resolver calls = %d, want 2", resolver.calls)
+	}
+}
+
+func TestNameResolutionThrottle(t *testing.T) {
+	resolver := &mockResolver{}
+	proxies, _ := NewProxies(0, nil, "")
+	handler := negroni.New(NewNameResolution(resolver, time.Minute, proxies), negroni.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	claim := func(name, remoteAddr string) int {
+		req := httptest.NewRequest("POST", "/api/claim", bytes.NewBufferString(`{"address":"`+name+`"}`))
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	for i := 0; i < nameLookupBurst; i++ {
+		if code := claim(fmt.Sprintf("bot%d.fuse", i), "10.0.0.1:1234"); code != http.StatusBadRequest {
+			t.Fatalf("lookup %d status = %d, want %d", i, code, http.StatusBadRequest)
+		}
+	}
+	if code := claim("another.fuse", "10.0.0.1:1234"); code != http.StatusTooManyRequests {
+		t.Errorf("lookup over the burst status = %d, want %d", code, http.StatusTooManyRequests)
+	}
+	if code := claim("bot0.fuse", "10.0.0.1:1234"); code != http.StatusBadRequest {
+		t.Errorf("cached lookup status = %d, want %d", code, http.StatusBadRequest)
+	}
+	if code := claim("another.fuse", "10.0.0.2:1234"); code != http.StatusBadRequest {
+		t.Errorf("lookup from another client status = %d, want %d", code, http.StatusBadRequest)
+	}
+	if resolver.calls != nameLookupBurst+1 {
+		t.Errorf("resolver calls = %d, want %d", resolver.calls, nameLookupBurst+1)
+	}
+}
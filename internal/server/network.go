@@ -0,0 +1,46 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+// NetworkCheck turns claims away right away while the circuit breakers of the
+// RPC endpoints are open, rather than queueing payouts that could only time
+// out. Clients that do not track their endpoints let every claim through
+type NetworkCheck struct {
+	status   chain.NetworkStatus
+	rejected uint64
+}
+
+func NewNetworkCheck(client interface{}) *NetworkCheck {
+	status, _ := client.(chain.NetworkStatus)
+	return &NetworkCheck{status: status}
+}
+
+// Available reports whether the node can currently be reached
+func (n *NetworkCheck) Available() bool {
+	return n == nil || n.status == nil || n.status.NetworkAvailable()
+}
+
+func (n *NetworkCheck) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	if n.Available() {
+		next.ServeHTTP(w, r)
+		return
+	}
+	atomic.AddUint64(&n.rejected, 1)
+	renderLocalized(w, r, http.StatusServiceUnavailable, "network_unavailable")
+}
+
+func (n *NetworkCheck) writeMetrics(w io.Writer) {
+	if n.status == nil {
+		return
+	}
+	writeGauge(w, "faucet_rpc_up", "Whether the circuit breakers of the RPC endpoints let calls through", boolGauge(n.Available()))
+	fmt.Fprintf(w, "# HELP %[1]s Claims turned away while the RPC endpoints were unavailable\n# TYPE %[1]s counter\n%[1]s %[2]d\n",
+		"faucet_rpc_rejected_claims_total", atomic.LoadUint64(&n.rejected))
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type fakeNetwork struct {
+	available bool
+}
+
+func (n *fakeNetwork) NetworkAvailable() bool {
+	return n.available
+}
+
+func TestNetworkCheck(t *testing.T) {
+	network := &fakeNetwork{available: true}
+	check := NewNetworkCheck(network)
+	claim := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		check.ServeHTTP(rec, httptest.NewRequest("POST", "/api/claim", nil), func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})
+		return rec
+	}
+
+	if rec := claim(); rec.Code != http.StatusOK {
+		t.Errorf("status while the network is available = %d, want %d", rec.Code, http.StatusOK)
+	}
+	network.available = false
+	rec := claim()
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "network_unavailable") {
+		t.Errorf("claim while the network is unavailable = %d %s, want %d network_unavailable", rec.Code, rec.Body, http.StatusServiceUnavailable)
+	}
+
+	var metrics bytes.Buffer
+	check.writeMetrics(&metrics)
+	if !strings.Contains(metrics.String(), "faucet_rpc_up 0") || !strings.Contains(metrics.String(), "faucet_rpc_rejected_claims_total 1") {
+		t.Errorf("metrics = %s, want the RPC down with 1 rejected claim", metrics.String())
+	}
+
+	if !NewNetworkCheck(nil).Available() {
+		t.Error("network unavailable without a client tracking it")
+	}
+}
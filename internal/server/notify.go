@@ -0,0 +1,141 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+// payoutAlertInterval spaces out alerts about refused payouts, which come in bursts
+const payoutAlertInterval = 10 * time.Minute
+
+type Notifier interface {
+	Notify(ctx context.Context, message string) error
+}
+
+// NewNotifier returns a Notifier fanning out to every configured channel. The
+// webhook receives {"text": message}, which Slack incoming webhooks accept as is
+func NewNotifier(webhookURL, telegramToken, telegramChatID string) Notifier {
+	var notifiers multiNotifier
+	if webhookURL != "" {
+		notifiers = append(notifiers, &webhookNotifier{url: webhookURL})
+	}
+	if telegramToken != "" && telegramChatID != "" {
+		notifiers = append(notifiers, &telegramNotifier{token: telegramToken, chatID: telegramChatID})
+	}
+	return notifiers
+}
+
+var notifyClient = &http.Client{Timeout: 10 * time.Second}
+
+type multiNotifier []Notifier
+
+func (m multiNotifier) Notify(ctx context.Context, message string) error {
+	var firstErr error
+	for _, n := range m {
+		if err := n.Notify(ctx, message); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+type webhookNotifier struct {
+	url string
+}
+
+func (n *webhookNotifier) Notify(ctx context.Context, message string) error {
+	body, err := json.Marshal(map[string]string{"text": message})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return doNotify(req)
+}
+
+type telegramNotifier struct {
+	token  string
+	chatID string
+}
+
+func (n *telegramNotifier) Notify(ctx context.Context, message string) error {
+	endpoint := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", n.token)
+	form := url.Values{"chat_id": {n.chatID}, "text": {message}}
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBufferString(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return doNotify(req)
+}
+
+func doNotify(req *http.Request) error {
+	resp, err := notifyClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("notification to %s failed with status %d", req.URL.Host, resp.StatusCode)
+	}
+	return nil
+}
+
+// PayoutAlerts alerts the operators when payouts are refused because the
+// network fee is above the cap or the funder cannot afford them, which takes
+// a config change or a refill to fix
+type PayoutAlerts struct {
+	mutex    sync.Mutex
+	notifier Notifier
+	network  string
+	lastSent map[error]time.Time
+}
+
+func NewPayoutAlerts(notifier Notifier, network string) *PayoutAlerts {
+	return &PayoutAlerts{notifier: notifier, network: network, lastSent: make(map[error]time.Time)}
+}
+
+// ClaimFinished alerts about a claim whose payout was refused, at most once per interval and reason
+func (a *PayoutAlerts) ClaimFinished(claim Claim) {
+	var reason error
+	switch {
+	case errors.Is(claim.err, chain.ErrInsufficientFunds):
+		reason = chain.ErrInsufficientFunds
+	case errors.Is(claim.err, chain.ErrFeeCapExceeded):
+		reason = chain.ErrFeeCapExceeded
+	default:
+		return
+	}
+
+	a.mutex.Lock()
+	if time.Since(a.lastSent[reason]) < payoutAlertInterval {
+		a.mutex.Unlock()
+		return
+	}
+	a.lastSent[reason] = time.Now()
+	a.mutex.Unlock()
+
+	message := fmt.Sprintf("Faucet %s refused a payout: %s", a.network, claim.Error)
+	log.WithField("claimID", claim.ID).Error(message)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := a.notifier.Notify(ctx, message); err != nil {
+			log.WithError(err).Error("Failed to send payout alert")
+		}
+	}()
+}
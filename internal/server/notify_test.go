@@ -0,0 +1,51 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+type chanNotifier chan string
+
+func (n chanNotifier) Notify(_ context.Context, message string) error {
+	n <- message
+	return nil
+}
+
+func TestPayoutAlerts(t *testing.T) {
+	notifier := make(chanNotifier, 10)
+	alerts := NewPayoutAlerts(notifier, "fuse")
+	failed := func(err error) Claim {
+		return Claim{ID: "1", Status: ClaimFailed, Error: err.Error(), err: err}
+	}
+
+	alerts.ClaimFinished(failed(errors.New("nonce too low")))
+	alerts.ClaimFinished(failed(fmt.Errorf("%w: 1 wei needed, 0 wei held", chain.ErrInsufficientFunds)))
+	alerts.ClaimFinished(failed(fmt.Errorf("%w: 1 wei needed, 0 wei held", chain.ErrInsufficientFunds)))
+	alerts.ClaimFinished(failed(fmt.Errorf("%w: 2 wei per gas asked, 1 allowed", chain.ErrFeeCapExceeded)))
+
+	var messages []string
+	for len(messages) < 2 {
+		select {
+		case message := <-notifier:
+			messages = append(messages, message)
+		case <-time.After(time.Second):
+			t.Fatalf("alerts = %q, want 2", messages)
+		}
+	}
+	select {
+	case message := <-notifier:
+		t.Errorf("unexpected alert %q, repeated alerts must be spaced out", message)
+	case <-time.After(50 * time.Millisecond):
+	}
+	got := strings.Join(messages, "\n")
+	if !strings.Contains(got, "does not cover") || !strings.Contains(got, "fee cap") {
+		t.Errorf("alerts = %q, want one per reason", messages)
+	}
+}
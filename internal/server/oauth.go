@@ -0,0 +1,215 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jellydator/ttlcache/v2"
+	"github.com/urfave/negroni"
+)
+
+const (
+	sessionCookie = "faucet_session"
+	sessionTTL    = 24 * time.Hour
+	oauthStateTTL = 10 * time.Minute
+
+	githubAuthorizeURL = "https://github.com/login/oauth/authorize"
+	githubTokenURL     = "https://github.com/login/oauth/access_token"
+	githubUserURL      = "https://api.github.com/user"
+)
+
+var apiClient = &http.Client{Timeout: 10 * time.Second}
+
+// GithubAuth ties claims to a GitHub account and enforces a cooldown per account
+type GithubAuth struct {
+	mutex        sync.Mutex
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	states       *ttlcache.Cache
+	sessions     *ttlcache.Cache
+	cooldowns    *ttlcache.Cache
+	ttl          time.Duration
+}
+
+func NewGithubAuth(clientID, clientSecret, redirectURL string, ttl time.Duration) *GithubAuth {
+	newCache := func() *ttlcache.Cache {
+		cache := ttlcache.NewCache()
+		cache.SkipTTLExtensionOnHit(true)
+		return cache
+	}
+	return &GithubAuth{
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		redirectURL:  redirectURL,
+		states:       newCache(),
+		sessions:     newCache(),
+		cooldowns:    newCache(),
+		ttl:          ttl,
+	}
+}
+
+func (g *GithubAuth) Enabled() bool {
+	return g.clientID != "" && g.clientSecret != ""
+}
+
+// Account returns the account bound to the session cookie of the request
+func (g *GithubAuth) Account(r *http.Request) (string, bool) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return "", false
+	}
+	account, err := g.sessions.Get(cookie.Value)
+	if err != nil {
+		return "", false
+	}
+	return account.(string), true
+}
+
+func (g *GithubAuth) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	if _, ok := requestAPIKey(r.Context()); !g.Enabled() || ok {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	account, ok := g.Account(r)
+	if !ok {
+		renderLocalized(w, r, http.StatusUnauthorized, "login_required")
+		return
+	}
+	g.mutex.Lock()
+	if g.ttl <= 0 {
+		g.mutex.Unlock()
+		next.ServeHTTP(w, r)
+		return
+	}
+	if _, ttl, err := g.cooldowns.GetWithTTL(account); err == nil {
+		g.mutex.Unlock()
+		rateLimited(w, r, ttl, "rate_limited", ttl.Round(time.Second))
+		return
+	}
+	g.cooldowns.SetWithTTL(account, true, g.ttl)
+	g.mutex.Unlock()
+
+	next.ServeHTTP(w, r)
+	if w.(negroni.ResponseWriter).Status() != http.StatusOK {
+		g.cooldowns.Remove(account)
+	}
+}
+
+// SetCooldown changes the time an account has to wait between claims
+func (g *GithubAuth) SetCooldown(ttl time.Duration) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.ttl = ttl
+}
+
+func (g *GithubAuth) handleLogin() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		state, err := newRandomID()
+		if err != nil {
+			renderLocalized(w, r, http.StatusInternalServerError, "internal_error")
+			return
+		}
+		g.states.SetWithTTL(state, true, oauthStateTTL)
+
+		query := url.Values{
+			"client_id":    {g.clientID},
+			"redirect_uri": {g.redirectURL},
+			"state":        {state},
+		}
+		http.Redirect(w, r, githubAuthorizeURL+"?"+query.Encode(), http.StatusFound)
+	}
+}
+
+func (g *GithubAuth) handleCallback() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := g.states.Remove(r.URL.Query().Get("state")); err != nil {
+			renderLocalized(w, r, http.StatusBadRequest, "invalid_oauth_state")
+			return
+		}
+
+		account, err := g.fetchAccount(r.Context(), r.URL.Query().Get("code"))
+		if err != nil {
+			requestLog(r.Context()).WithError(err).Error("Failed to complete GitHub login")
+			renderLocalized(w, r, http.StatusBadGateway, "github_login_failed")
+			return
+		}
+		session, err := newRandomID()
+		if err != nil {
+			renderLocalized(w, r, http.StatusInternalServerError, "internal_error")
+			return
+		}
+		g.sessions.SetWithTTL(session, account, sessionTTL)
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     sessionCookie,
+			Value:    session,
+			Path:     "/",
+			MaxAge:   int(sessionTTL.Seconds()),
+			HttpOnly: true,
+			Secure:   strings.HasPrefix(g.redirectURL, "https://"),
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, "/", http.StatusFound)
+	}
+}
+
+func (g *GithubAuth) fetchAccount(ctx context.Context, code string) (string, error) {
+	form := url.Values{
+		"client_id":     {g.clientID},
+		"client_secret": {g.clientSecret},
+		"code":          {code},
+		"redirect_uri":  {g.redirectURL},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", githubTokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var token struct {
+		AccessToken string `json:"access_token"`
+		Error       string `json:"error_description"`
+	}
+	if err := doJSON(req, &token); err != nil {
+		return "", err
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("no access token: %s", token.Error)
+	}
+
+	req, err = http.NewRequestWithContext(ctx, "GET", githubUserURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	var user struct {
+		ID int64 `json:"id"`
+	}
+	if err := doJSON(req, &user); err != nil {
+		return "", err
+	}
+	if user.ID == 0 {
+		return "", fmt.Errorf("github user not found")
+	}
+	return fmt.Sprintf("github:%d", user.ID), nil
+}
+
+func doJSON(req *http.Request, v interface{}) error {
+	req.Header.Set("Accept", "application/json")
+	resp, err := apiClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status %d", req.URL.Host, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
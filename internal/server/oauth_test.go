@@ -0,0 +1,42 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/urfave/negroni"
+)
+
+func TestGithubAuthCooldown(t *testing.T) {
+	auth := NewGithubAuth("id", "secret", "http://localhost/auth/github/callback", time.Hour)
+	auth.sessions.SetWithTTL("session", "github:1", sessionTTL)
+	handler := negroni.New(auth, negroni.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	tests := []struct {
+		name    string
+		session string
+		want    int
+	}{
+		{name: "anonymous", want: http.StatusUnauthorized},
+		{name: "unknown session", session: "forged", want: http.StatusUnauthorized},
+		{name: "first claim", session: "session", want: http.StatusOK},
+		{name: "cooldown", session: "session", want: http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/claim", nil)
+			if tt.session != "" {
+				req.AddCookie(&http.Cookie{Name: sessionCookie, Value: tt.session})
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+type payoutLimitKey struct{}
+
+// withPayoutLimit lets a middleware cap the amount paid out for the request
+func withPayoutLimit(r *http.Request, limit *big.Int) *http.Request {
+	if current := payoutLimit(r.Context()); current != nil && current.Cmp(limit) <= 0 {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), payoutLimitKey{}, limit))
+}
+
+func payoutLimit(ctx context.Context) *big.Int {
+	limit, _ := ctx.Value(payoutLimitKey{}).(*big.Int)
+	return limit
+}
+
+type payoutBaseKey struct{}
+
+// withPayoutBase makes the payout policy pay the claim as if amount were the
+// base payout, scaling the tiers and the fiat payout in proportion
+func withPayoutBase(ctx context.Context, amount *big.Int) context.Context {
+	return context.WithValue(ctx, payoutBaseKey{}, amount)
+}
+
+func payoutBase(ctx context.Context) *big.Int {
+	amount, _ := ctx.Value(payoutBaseKey{}).(*big.Int)
+	return amount
+}
+
+// PayoutTier grants Amount to addresses that satisfy every configured condition
+type PayoutTier struct {
+	Name         string `json:"name"`
+	Amount       string `json:"amount"`
+	MinNonce     uint64 `json:"min_nonce"`
+	MinAgeBlocks uint64 `json:"min_age_blocks"`
+	MaxBalance   string `json:"max_balance"`
+
+	amount     *big.Int
+	maxBalance *big.Int
+}
+
+type PayoutPolicy struct {
+	client chain.Client
+	base   *big.Int
+	fiat   *FiatPayout
+	tiers  []PayoutTier
+}
+
+func LoadPayoutPolicy(client chain.Client, base *big.Int, path string) (*PayoutPolicy, error) {
+	policy := &PayoutPolicy{client: client, base: base}
+	if path == "" {
+		return policy, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &policy.tiers); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for i := range policy.tiers {
+		tier := &policy.tiers[i]
+		if tier.amount, err = chain.ParseEther(tier.Amount); err != nil {
+			return nil, fmt.Errorf("tier %q: %w", tier.Name, err)
+		}
+		if tier.MaxBalance != "" {
+			if tier.maxBalance, err = chain.ParseEther(tier.MaxBalance); err != nil {
+				return nil, fmt.Errorf("tier %q: %w", tier.Name, err)
+			}
+		}
+	}
+	return policy, nil
+}
+
+// Amount returns the largest payout among the tiers the address qualifies for,
+// falling back to the base amount when none match, scaled to the base payout
+// of the claim if it has one of its own
+func (p *PayoutPolicy) Amount(ctx context.Context, address string) (*big.Int, error) {
+	amount, err := p.amount(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	return p.scale(ctx, amount), nil
+}
+
+// BaseAmount returns the payout of addresses that qualify for no tier
+func (p *PayoutPolicy) BaseAmount(ctx context.Context) (*big.Int, error) {
+	amount, err := p.baseAmount()
+	if err != nil {
+		return nil, err
+	}
+	return p.scale(ctx, amount), nil
+}
+
+// scale converts amount to the base payout of the claim, if it has one of its own
+func (p *PayoutPolicy) scale(ctx context.Context, amount *big.Int) *big.Int {
+	base := payoutBase(ctx)
+	if base == nil || p.base.Sign() <= 0 {
+		return amount
+	}
+	return new(big.Int).Div(new(big.Int).Mul(amount, base), p.base)
+}
+
+func (p *PayoutPolicy) amount(ctx context.Context, address string) (*big.Int, error) {
+	if len(p.tiers) == 0 {
+		return p.baseAmount()
+	}
+
+	account := common.HexToAddress(address)
+	nonce, err := p.client.NonceAt(ctx, account, nil)
+	if err != nil {
+		return nil, err
+	}
+	balance, err := p.client.BalanceAt(ctx, account, nil)
+	if err != nil {
+		return nil, err
+	}
+	head, err := p.client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var amount *big.Int
+	for _, tier := range p.tiers {
+		if nonce < tier.MinNonce {
+			continue
+		}
+		if tier.maxBalance != nil && balance.Cmp(tier.maxBalance) > 0 {
+			continue
+		}
+		if tier.MinAgeBlocks > 0 && !p.activeSince(ctx, account, head.Number, tier.MinAgeBlocks) {
+			continue
+		}
+		if amount == nil || tier.amount.Cmp(amount) > 0 {
+			amount = tier.amount
+		}
+	}
+	if amount == nil {
+		return p.baseAmount()
+	}
+	return amount, nil
+}
+
+// baseAmount is the payout of addresses that qualify for no tier, which is
+// worth a fixed fiat amount if payouts are denominated in fiat
+func (p *PayoutPolicy) baseAmount() (*big.Int, error) {
+	if p.fiat.Enabled() {
+		return p.fiat.Amount()
+	}
+	return p.base, nil
+}
+
+// activeSince reports whether the account had sent a transaction ageBlocks ago,
+// which requires the provider to serve historical state
+func (p *PayoutPolicy) activeSince(ctx context.Context, account common.Address, head *big.Int, ageBlocks uint64) bool {
+	block := new(big.Int).Sub(head, new(big.Int).SetUint64(ageBlocks))
+	if block.Sign() < 0 {
+		return false
+	}
+	nonce, err := p.client.NonceAt(ctx, account, block)
+	return err == nil && nonce > 0
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+func TestPayoutPolicyAmount(t *testing.T) {
+	richAddress := common.HexToAddress("0x0000000000000000000000000000000000000001")
+	simClient := backends.NewSimulatedBackend(
+		core.GenesisAlloc{
+			richAddress: {Balance: chain.EtherToWei(100)},
+		}, 10000000,
+	)
+	defer simClient.Close()
+
+	path := filepath.Join(t.TempDir(), "tiers.json")
+	tiers := `[
+		{"name": "new", "amount": "0.1"},
+		{"name": "poor", "amount": "0.5", "max_balance": "10"},
+		{"name": "active", "amount": "2", "min_nonce": 1}
+	]`
+	if err := os.WriteFile(path, []byte(tiers), 0644); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := LoadPayoutPolicy(simClient, chain.EtherToWei(1), path)
+	if err != nil {
+		t.Fatalf("LoadPayoutPolicy() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		address common.Address
+		want    *big.Int
+	}{
+		{name: "empty account", address: common.HexToAddress("0x0000000000000000000000000000000000000002"), want: big.NewInt(500000000000000000)},
+		{name: "rich account", address: richAddress, want: big.NewInt(100000000000000000)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := policy.Amount(context.Background(), tt.address.Hex())
+			if err != nil {
+				t.Fatalf("Amount() error = %v", err)
+			}
+			if got.Cmp(tt.want) != 0 {
+				t.Errorf("Amount() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPayoutPolicyBase(t *testing.T) {
+	simClient := backends.NewSimulatedBackend(core.GenesisAlloc{}, 10000000)
+	defer simClient.Close()
+
+	path := filepath.Join(t.TempDir(), "tiers.json")
+	if err := os.WriteFile(path, []byte(`[{"name": "poor", "amount": "0.5", "max_balance": "10"}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := LoadPayoutPolicy(simClient, chain.EtherToWei(1), path)
+	if err != nil {
+		t.Fatalf("LoadPayoutPolicy() error = %v", err)
+	}
+
+	// A base payout of 2 doubles whatever the policy pays
+	ctx := withPayoutBase(context.Background(), chain.EtherToWei(2))
+	if got, err := policy.Amount(ctx, "0x0000000000000000000000000000000000000002"); err != nil || got.Cmp(chain.EtherToWei(1)) != 0 {
+		t.Errorf("Amount() = %v, %v, want the tier amount doubled", got, err)
+	}
+	if got, err := policy.BaseAmount(ctx); err != nil || got.Cmp(chain.EtherToWei(2)) != 0 {
+		t.Errorf("BaseAmount() = %v, %v, want the base payout of the claim", got, err)
+	}
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/jellydator/ttlcache/v2"
+
+	"github.com/chainflag/eth-faucet/pkg/client"
+)
+
+const (
+	powSeedHeader   = "pow-seed"
+	powNonceHeader  = "pow-nonce"
+	powChallengeTTL = 5 * time.Minute
+)
+
+// ProofOfWork issues single-use seeds and accepts a claim once
+// sha256(seed || address || nonce) has at least difficulty leading zero bits
+type ProofOfWork struct {
+	difficulty int
+	seeds      *ttlcache.Cache
+}
+
+func NewProofOfWork(difficulty int) *ProofOfWork {
+	seeds := ttlcache.NewCache()
+	seeds.SkipTTLExtensionOnHit(true)
+	return &ProofOfWork{
+		difficulty: difficulty,
+		seeds:      seeds,
+	}
+}
+
+func (p *ProofOfWork) Enabled() bool {
+	return p.difficulty > 0
+}
+
+func (p *ProofOfWork) NewChallenge() (*powChallenge, error) {
+	seed, err := newRandomID()
+	if err != nil {
+		return nil, err
+	}
+	p.seeds.SetWithTTL(seed, true, powChallengeTTL)
+
+	return &powChallenge{
+		Seed:       seed,
+		Difficulty: p.difficulty,
+		ExpiresAt:  time.Now().Add(powChallengeTTL).Unix(),
+	}, nil
+}
+
+// Verify checks the solution and consumes the seed so it can not be replayed
+func (p *ProofOfWork) Verify(seed, address, nonce string) bool {
+	if seed == "" || nonce == "" {
+		return false
+	}
+	if err := p.seeds.Remove(seed); err != nil {
+		return false
+	}
+
+	return client.VerifyProofOfWork(seed, address, nonce, p.difficulty)
+}
+
+func (p *ProofOfWork) handleChallenge() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" || !p.Enabled() {
+			http.NotFound(w, r)
+			return
+		}
+
+		challenge, err := p.NewChallenge()
+		if err != nil {
+			renderLocalized(w, r, http.StatusInternalServerError, "internal_error")
+			return
+		}
+		renderJSON(w, challenge, http.StatusOK)
+	}
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/chainflag/eth-faucet/pkg/client"
+)
+
+func solve(seed, address string, difficulty int) string {
+	challenge := client.Challenge{Seed: seed, Difficulty: difficulty}
+	nonce, _ := challenge.Solve(context.Background(), address)
+	return nonce
+}
+
+func TestProofOfWork(t *testing.T) {
+	address := "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"
+	pow := NewProofOfWork(8)
+	challenge, err := pow.NewChallenge()
+	if err != nil {
+		t.Fatalf("NewChallenge() error = %v", err)
+	}
+
+	nonce := solve(challenge.Seed, address, challenge.Difficulty)
+	if pow.Verify(challenge.Seed, "0x0000000000000000000000000000000000000000", nonce) {
+		t.Errorf("Verify() accepted a solution for another address")
+	}
+
+	challenge, _ = pow.NewChallenge()
+	nonce = solve(challenge.Seed, address, challenge.Difficulty)
+	if !pow.Verify(challenge.Seed, address, nonce) {
+		t.Errorf("Verify() rejected a valid solution")
+	}
+	if pow.Verify(challenge.Seed, address, nonce) {
+		t.Errorf("Verify() accepted a replayed seed")
+	}
+	if pow.Verify("unknown", address, nonce) {
+		t.Errorf("Verify() accepted an unknown seed")
+	}
+}
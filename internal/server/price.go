@@ -0,0 +1,190 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+const (
+	coingeckoPriceURL = "https://api.coingecko.com/api/v3/simple/price"
+	// maxPriceAge is how old a price may get before payouts in fiat stop, which
+	// covers the 24 hour heartbeat of the slowest Chainlink feeds
+	maxPriceAge = 25 * time.Hour
+	// maxQuoteAge is how old a CoinGecko price may get, which is updated
+	// every few minutes
+	maxQuoteAge = 30 * time.Minute
+)
+
+var errPriceUnavailable = errors.New("no recent price of the payout token")
+
+// payoutTooLarge is returned instead of a fiat payout above the configured maximum
+type payoutTooLarge struct {
+	amount, max *big.Int
+}
+
+func (e *payoutTooLarge) Error() string {
+	return fmt.Sprintf("payout of %s Ethers exceeds the maximum of %s, the token price may be wrong", chain.FormatEther(e.amount), chain.FormatEther(e.max))
+}
+
+// PriceSource reports the price of the payout token in a fiat currency and
+// when that price was determined
+type PriceSource interface {
+	Price(ctx context.Context) (*big.Rat, time.Time, error)
+}
+
+// NewPriceSource returns a source reading the Chainlink feed if its address is
+// given, otherwise one querying CoinGecko for the coin, or nil if neither is configured
+func NewPriceSource(client bind.ContractCaller, feed, coin, currency string) PriceSource {
+	switch {
+	case feed != "":
+		return &chainlinkPrice{client: client, feed: common.HexToAddress(feed)}
+	case coin != "":
+		return &coingeckoPrice{url: coingeckoPriceURL, coin: coin, currency: strings.ToLower(currency)}
+	default:
+		return nil
+	}
+}
+
+type chainlinkPrice struct {
+	client bind.ContractCaller
+	feed   common.Address
+}
+
+func (c *chainlinkPrice) Price(ctx context.Context) (*big.Rat, time.Time, error) {
+	return chain.LatestPrice(ctx, c.client, c.feed)
+}
+
+type coingeckoPrice struct {
+	url      string
+	coin     string
+	currency string
+}
+
+func (c *coingeckoPrice) Price(ctx context.Context) (*big.Rat, time.Time, error) {
+	query := url.Values{"ids": {c.coin}, "vs_currencies": {c.currency}, "include_last_updated_at": {"true"}}
+	req, err := http.NewRequestWithContext(ctx, "GET", c.url+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	var resp map[string]map[string]float64
+	if err := doJSON(req, &resp); err != nil {
+		return nil, time.Time{}, err
+	}
+	prices, ok := resp[c.coin]
+	if !ok || prices[c.currency] <= 0 {
+		return nil, time.Time{}, fmt.Errorf("no %s price of %s", c.currency, c.coin)
+	}
+	updatedAt := time.Now()
+	if at := prices["last_updated_at"]; at > 0 {
+		updatedAt = time.Unix(int64(at), 0)
+	}
+	return new(big.Rat).SetFloat64(prices[c.currency]), updatedAt, nil
+}
+
+// FiatPayout keeps the base payout worth a fixed amount of a fiat currency,
+// such as $0.05 worth of FUSE, by refreshing the price of the payout token
+// every interval. Payouts stop when the price gets older than the max age of
+// its source, and are refused when they come to more than max Wei
+type FiatPayout struct {
+	source   PriceSource
+	amount   *big.Rat
+	max      *big.Int
+	currency string
+	interval time.Duration
+	maxAge   time.Duration
+	mutex    sync.RWMutex
+	price    *big.Rat
+	pricedAt time.Time
+}
+
+func NewFiatPayout(source PriceSource, amount *big.Rat, max *big.Int, currency string, interval time.Duration) *FiatPayout {
+	maxAge := maxPriceAge
+	if _, ok := source.(*coingeckoPrice); ok {
+		maxAge = maxQuoteAge
+	}
+	return &FiatPayout{
+		source:   source,
+		amount:   amount,
+		max:      max,
+		currency: strings.ToUpper(currency),
+		interval: interval,
+		maxAge:   maxAge,
+	}
+}
+
+func (f *FiatPayout) Enabled() bool {
+	return f != nil && f.source != nil && f.amount != nil
+}
+
+func (f *FiatPayout) Run(ctx context.Context) {
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+	for {
+		if err := f.refresh(ctx); err != nil {
+			log.WithError(err).Warn("Failed to fetch the price of the payout token")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (f *FiatPayout) refresh(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	price, pricedAt, err := f.source.Price(ctx)
+	if err != nil {
+		return err
+	}
+	if time.Since(pricedAt) > f.maxAge {
+		return fmt.Errorf("price was last updated at %s", pricedAt.UTC().Format(time.RFC3339))
+	}
+
+	f.mutex.Lock()
+	f.price, f.pricedAt = price, pricedAt
+	f.mutex.Unlock()
+	log.WithFields(log.Fields{
+		"price":    price.FloatString(6),
+		"currency": f.currency,
+		"pricedAt": pricedAt,
+	}).Debug("Updated the price of the payout token")
+	return nil
+}
+
+// Amount returns the payout in wei that is worth the fiat amount at the last
+// price, or a *payoutTooLarge error if that exceeds the maximum
+func (f *FiatPayout) Amount() (*big.Int, error) {
+	f.mutex.RLock()
+	price, pricedAt := f.price, f.pricedAt
+	f.mutex.RUnlock()
+	if price == nil || time.Since(pricedAt) > f.maxAge {
+		return nil, errPriceUnavailable
+	}
+	wei := new(big.Rat).Mul(f.amount, new(big.Rat).SetInt(chain.EtherToWei(1)))
+	wei.Quo(wei, price)
+	amount := new(big.Int).Quo(wei.Num(), wei.Denom())
+	if f.max != nil && amount.Cmp(f.max) > 0 {
+		return nil, &payoutTooLarge{amount: amount, max: f.max}
+	}
+	return amount, nil
+}
+
+// String returns the fiat amount with its currency, e.g. 0.05 USD
+func (f *FiatPayout) String() string {
+	return fmt.Sprintf("%s %s", strings.TrimSuffix(strings.TrimRight(f.amount.FloatString(6), "0"), "."), f.currency)
+}
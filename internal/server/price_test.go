@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+type fixedPrice struct {
+	price    string
+	pricedAt time.Time
+}
+
+func (p *fixedPrice) Price(context.Context) (*big.Rat, time.Time, error) {
+	price, _ := new(big.Rat).SetString(p.price)
+	return price, p.pricedAt, nil
+}
+
+func TestCoingeckoPrice(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("ids") != "fuse-network-token" || r.URL.Query().Get("vs_currencies") != "eur" {
+			w.Write([]byte(`{}`))
+			return
+		}
+		w.Write([]byte(`{"fuse-network-token":{"eur":0.0425,"last_updated_at":1700000000}}`))
+	}))
+	defer server.Close()
+
+	source := &coingeckoPrice{url: server.URL, coin: "fuse-network-token", currency: "eur"}
+	price, pricedAt, err := source.Price(context.Background())
+	if err != nil {
+		t.Fatalf("Price() error = %v", err)
+	}
+	if price.FloatString(4) != "0.0425" || pricedAt.Unix() != 1700000000 {
+		t.Errorf("Price() = %s at %d, want 0.0425 at 1700000000", price.FloatString(4), pricedAt.Unix())
+	}
+	source.coin = "unknown"
+	if _, _, err := source.Price(context.Background()); err == nil {
+		t.Error("Price() of an unknown coin succeeded")
+	}
+}
+
+func TestFiatPayoutMaxAge(t *testing.T) {
+	amount, _ := new(big.Rat).SetString("0.05")
+	quote := NewFiatPayout(&coingeckoPrice{}, amount, nil, "usd", time.Minute)
+	feed := NewFiatPayout(&chainlinkPrice{}, amount, nil, "usd", time.Minute)
+	if quote.maxAge != maxQuoteAge || feed.maxAge != maxPriceAge {
+		t.Errorf("max price age = %s for CoinGecko and %s for a feed, want %s and %s", quote.maxAge, feed.maxAge, maxQuoteAge, maxPriceAge)
+	}
+}
+
+func TestFiatPayout(t *testing.T) {
+	source := &fixedPrice{price: "0.025", pricedAt: time.Now()}
+	amount, _ := new(big.Rat).SetString("0.05")
+	fiat := NewFiatPayout(source, amount, chain.EtherToWei(10), "usd", time.Minute)
+	if _, err := fiat.Amount(); !errors.Is(err, errPriceUnavailable) {
+		t.Errorf("Amount() before any price error = %v, want %v", err, errPriceUnavailable)
+	}
+	if err := fiat.refresh(context.Background()); err != nil {
+		t.Fatalf("refresh() error = %v", err)
+	}
+	if wei, err := fiat.Amount(); err != nil || wei.Cmp(chain.EtherToWei(2)) != 0 {
+		t.Errorf("Amount() = %v, %v, want 2 ether", wei, err)
+	}
+	if got := fiat.String(); got != "0.05 USD" {
+		t.Errorf("String() = %q, want 0.05 USD", got)
+	}
+
+	// A price that doubles halves the payout, and a stale one is not used
+	source.price = "0.05"
+	fiat.refresh(context.Background())
+	policy := &PayoutPolicy{base: chain.EtherToWei(1), fiat: fiat}
+	if wei, err := policy.Amount(context.Background(), "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"); err != nil || wei.Cmp(chain.EtherToWei(1)) != 0 {
+		t.Errorf("PayoutPolicy.Amount() = %v, %v, want 1 ether", wei, err)
+	}
+	// A price that crashed would pay out more than the maximum
+	source.price = "0.001"
+	fiat.refresh(context.Background())
+	var tooLarge *payoutTooLarge
+	if _, err := fiat.Amount(); !errors.As(err, &tooLarge) || tooLarge.amount.Cmp(chain.EtherToWei(50)) != 0 {
+		t.Errorf("Amount() at a crashed price error = %v, want the 50 ether payout refused", err)
+	}
+	if _, err := policy.Amount(context.Background(), "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"); err == nil {
+		t.Error("PayoutPolicy.Amount() at a crashed price succeeded")
+	}
+
+	source.price, source.pricedAt = "1", time.Now().Add(-maxPriceAge-time.Minute)
+	if err := fiat.refresh(context.Background()); err == nil {
+		t.Error("refresh() accepted a stale price")
+	}
+	fiat.pricedAt = source.pricedAt
+	if _, err := fiat.Amount(); !errors.Is(err, errPriceUnavailable) {
+		t.Errorf("Amount() with a stale price error = %v, want %v", err, errPriceUnavailable)
+	}
+}
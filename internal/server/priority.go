@@ -0,0 +1,222 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ClaimPriority is the class a claim is paid out in when the queue backs up
+type ClaimPriority int
+
+const (
+	// PriorityAPIKey is the class of claims made with an API key
+	PriorityAPIKey ClaimPriority = iota
+	// PriorityAllowlist is the class of claims by allowlisted addresses and IPs
+	PriorityAllowlist
+	// PriorityWeb is the class of every other claim
+	PriorityWeb
+
+	priorityClasses = 3
+)
+
+var priorityNames = [priorityClasses]string{"apikey", "allowlist", "web"}
+
+func (p ClaimPriority) String() string {
+	return priorityNames[p]
+}
+
+// DefaultPriorityWeights pays out four API key claims and two allowlisted
+// claims for every web claim while all of them are waiting
+var DefaultPriorityWeights = [priorityClasses]int{4, 2, 1}
+
+// ParsePriorityWeights reads weights like "apikey=8,web=1", classes that are
+// not mentioned keep their default weight
+func ParsePriorityWeights(entries []string) ([priorityClasses]int, error) {
+	weights := DefaultPriorityWeights
+	for _, entry := range entries {
+		i := strings.Index(entry, "=")
+		if i < 0 {
+			return weights, fmt.Errorf("invalid priority weight %q", entry)
+		}
+		class, value := strings.TrimSpace(entry[:i]), strings.TrimSpace(entry[i+1:])
+		weight, err := strconv.Atoi(value)
+		if err != nil || weight <= 0 {
+			return weights, fmt.Errorf("invalid priority weight %q", entry)
+		}
+		found := false
+		for p, name := range priorityNames {
+			if name == class {
+				weights[p], found = weight, true
+			}
+		}
+		if !found {
+			return weights, fmt.Errorf("unknown priority class %q", class)
+		}
+	}
+	return weights, nil
+}
+
+type allowlistedKey struct{}
+
+// withAllowlisted marks a claim as made by an allowlisted address or IP
+func withAllowlisted(ctx context.Context) context.Context {
+	return context.WithValue(ctx, allowlistedKey{}, true)
+}
+
+// claimPriority returns the class of the claim made with ctx
+func claimPriority(ctx context.Context) ClaimPriority {
+	if _, ok := requestAPIKey(ctx); ok {
+		return PriorityAPIKey
+	}
+	if allowlisted, _ := ctx.Value(allowlistedKey{}).(bool); allowlisted {
+		return PriorityAllowlist
+	}
+	return PriorityWeb
+}
+
+// claimScheduler holds the claims waiting for a worker, one FIFO per priority
+// class. Classes are served by smooth weighted round robin, except that a
+// claim waiting longer than maxWait goes first so that no class starves
+type claimScheduler struct {
+	mutex   sync.Mutex
+	ready   *sync.Cond
+	classes [priorityClasses][]*Claim
+	weights [priorityClasses]int
+	credits [priorityClasses]int
+	maxWait time.Duration
+	size    int
+	waiting int
+	closed  bool
+}
+
+func newClaimScheduler(size int) *claimScheduler {
+	s := &claimScheduler{weights: DefaultPriorityWeights, size: size}
+	s.ready = sync.NewCond(&s.mutex)
+	return s
+}
+
+// Push adds a claim to its class, reporting false if the scheduler is full
+func (s *claimScheduler) Push(claim *Claim) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.waiting >= s.size {
+		return false
+	}
+	claim.queuedAt = time.Now()
+	s.classes[claim.priority] = append(s.classes[claim.priority], claim)
+	s.waiting++
+	s.ready.Signal()
+	return true
+}
+
+// Pop waits for the next claim to pay out. It returns false once the
+// scheduler is closed and every claim has been taken
+func (s *claimScheduler) Pop() (*Claim, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for s.waiting == 0 {
+		if s.closed {
+			return nil, false
+		}
+		s.ready.Wait()
+	}
+
+	next := s.next()
+	claim := s.classes[next][0]
+	s.classes[next][0] = nil
+	s.classes[next] = s.classes[next][1:]
+	if len(s.classes[next]) == 0 {
+		s.credits[next] = 0
+	}
+	s.waiting--
+	return claim, true
+}
+
+func (s *claimScheduler) next() ClaimPriority {
+	var heads [priorityClasses]int
+	return s.pick(&heads, &s.credits, time.Now())
+}
+
+// pick returns the class the next claim is taken from, given the index of the
+// first claim of every class that has not been taken yet and their credits
+func (s *claimScheduler) pick(heads *[priorityClasses]int, credits *[priorityClasses]int, now time.Time) ClaimPriority {
+	starved, total := -1, 0
+	for p, claims := range s.classes {
+		if len(claims) == heads[p] {
+			continue
+		}
+		total += s.weights[p]
+		head := claims[heads[p]]
+		if s.maxWait > 0 && now.Sub(head.queuedAt) > s.maxWait &&
+			(starved < 0 || head.queuedAt.Before(s.classes[starved][heads[starved]].queuedAt)) {
+			starved = p
+		}
+	}
+	if starved >= 0 {
+		return ClaimPriority(starved)
+	}
+
+	best := -1
+	for p, claims := range s.classes {
+		if len(claims) == heads[p] {
+			continue
+		}
+		credits[p] += s.weights[p]
+		if best < 0 || credits[p] > credits[best] {
+			best = p
+		}
+	}
+	credits[best] -= total
+	return ClaimPriority(best)
+}
+
+// Position returns the place of the claim with id in the order the waiting
+// claims will be paid out in if no other claim arrives, 1 being the next one,
+// or 0 if it is not waiting
+func (s *claimScheduler) Position(id string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	class, index := -1, 0
+	for p, claims := range s.classes {
+		for i, claim := range claims {
+			if claim.ID == id {
+				class, index = p, i
+			}
+		}
+	}
+	if class < 0 {
+		return 0
+	}
+
+	var heads [priorityClasses]int
+	credits := s.credits
+	now := time.Now()
+	for position := 1; ; position++ {
+		next := s.pick(&heads, &credits, now)
+		if int(next) == class && heads[next] == index {
+			return position
+		}
+		if heads[next]++; heads[next] == len(s.classes[next]) {
+			credits[next] = 0
+		}
+	}
+}
+
+// Len returns the number of claims waiting
+func (s *claimScheduler) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.waiting
+}
+
+// Close lets Pop return once the claims left have been taken
+func (s *claimScheduler) Close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.closed = true
+	s.ready.Broadcast()
+}
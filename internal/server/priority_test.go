@@ -0,0 +1,67 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestClaimScheduler(t *testing.T) {
+	s := newClaimScheduler(16)
+	s.weights = [priorityClasses]int{2, 1, 1}
+	push := func(id string, priority ClaimPriority) {
+		if !s.Push(&Claim{ID: id, priority: priority}) {
+			t.Fatalf("Push(%s) reported a full scheduler", id)
+		}
+	}
+	for _, id := range []string{"w1", "w2", "w3"} {
+		push(id, PriorityWeb)
+	}
+	for _, id := range []string{"k1", "k2", "k3", "k4"} {
+		push(id, PriorityAPIKey)
+	}
+	push("a1", PriorityAllowlist)
+
+	var order []string
+	for i := 0; i < 8; i++ {
+		claim, _ := s.Pop()
+		order = append(order, claim.ID)
+	}
+	want := []string{"k1", "a1", "w1", "k2", "k3", "w2", "k4", "w3"}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("payout order = %v, want %v", order, want)
+		}
+	}
+
+	s.maxWait = time.Minute
+	push("w4", PriorityWeb)
+	s.classes[PriorityWeb][0].queuedAt = time.Now().Add(-2 * time.Minute)
+	push("k5", PriorityAPIKey)
+	if claim, _ := s.Pop(); claim.ID != "w4" {
+		t.Errorf("claim paid out first = %s, want the starving w4", claim.ID)
+	}
+
+	s.Close()
+	if claim, ok := s.Pop(); !ok || claim.ID != "k5" {
+		t.Errorf("claims left after Close() were not handed out")
+	}
+	if _, ok := s.Pop(); ok {
+		t.Errorf("Pop() on an empty closed scheduler returned a claim")
+	}
+}
+
+func TestParsePriorityWeights(t *testing.T) {
+	weights, err := ParsePriorityWeights([]string{"apikey=10", "web=2"})
+	if err != nil || weights != [priorityClasses]int{10, 2, 2} {
+		t.Errorf("ParsePriorityWeights() = %v, %v", weights, err)
+	}
+	for _, entries := range [][]string{{"apikey"}, {"apikey=0"}, {"vip=3"}} {
+		if _, err := ParsePriorityWeights(entries); err == nil {
+			t.Errorf("ParsePriorityWeights(%v) accepted invalid weights", entries)
+		}
+	}
+	if got := claimPriority(withAllowlisted(context.Background())); got != PriorityAllowlist {
+		t.Errorf("priority of allowlisted claim = %s", got)
+	}
+}
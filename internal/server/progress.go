@@ -0,0 +1,107 @@
+package server
+
+import (
+	"time"
+)
+
+const (
+	// latencySamples is the number of recent payouts estimates are averaged over
+	latencySamples = 20
+	// progressInterval is how often claim status streams check for progress
+	progressInterval = 2 * time.Second
+)
+
+// latencyWindow keeps the latencies of the most recent payouts
+type latencyWindow struct {
+	samples []time.Duration
+	next    int
+}
+
+func (w *latencyWindow) add(d time.Duration) {
+	if len(w.samples) < latencySamples {
+		w.samples = append(w.samples, d)
+		return
+	}
+	w.samples[w.next] = d
+	w.next = (w.next + 1) % latencySamples
+}
+
+// mean returns the average latency, or false if there is no sample yet
+func (w *latencyWindow) mean() (time.Duration, bool) {
+	if len(w.samples) == 0 {
+		return 0, false
+	}
+	var sum time.Duration
+	for _, d := range w.samples {
+		sum += d
+	}
+	return sum / time.Duration(len(w.samples)), true
+}
+
+// ClaimProgress tells where a claim that is not final stands
+type ClaimProgress struct {
+	// Position is the place of the claim among the waiting ones, 1 being the
+	// next to be paid out, or 0 once a worker has taken it
+	Position int
+	// Queued is the number of claims waiting for a worker
+	Queued int
+	// Pending is the number of payouts being sent or waiting for confirmations
+	Pending int
+	// ETA is how long until the payout is expected to be final, 0 if the
+	// faucet has not made enough payouts to tell
+	ETA time.Duration
+}
+
+// Progress returns the progress of the claim with id, or false if it is unknown or final
+func (q *Queue) Progress(id string) (ClaimProgress, bool) {
+	value, err := q.claims.Get(id)
+	if err != nil {
+		return ClaimProgress{}, false
+	}
+
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+	claim := value.(*Claim)
+	if q.Final(claim.Status) {
+		return ClaimProgress{}, false
+	}
+	progress := ClaimProgress{Queued: q.pending.Len(), Pending: q.inflight}
+	send, sendKnown := q.sendLatency.mean()
+	confirm, confirmKnown := q.confirmLatency.mean()
+	if q.tracker == nil || q.dryRun {
+		confirm, confirmKnown = 0, true
+	}
+	now := time.Now()
+	switch claim.Status {
+	case ClaimQueued:
+		progress.Position = q.pending.Position(claim.ID)
+		if !sendKnown || !confirmKnown {
+			break
+		}
+		if progress.Position == 0 {
+			progress.ETA = remaining(send, now.Sub(claim.takenAt)) + confirm
+			break
+		}
+		// Claims are sent in rounds of as many as the queue sends at once
+		parallel := q.workers
+		if q.batcher != nil {
+			parallel = q.batchSize
+		}
+		rounds := (progress.Position + parallel - 1) / parallel
+		progress.ETA = time.Duration(rounds)*send + confirm
+	default:
+		if confirmKnown {
+			progress.ETA = remaining(confirm, now.Sub(claim.sentAt))
+		}
+	}
+	return progress, true
+}
+
+// remaining returns what is left of expected after elapsed, at least a
+// second as a payout running late is still expected any moment
+func remaining(expected, elapsed time.Duration) time.Duration {
+	if left := expected - elapsed; left > time.Second {
+		return left
+	}
+	return time.Second
+}
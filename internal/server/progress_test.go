@@ -0,0 +1,90 @@
+package server
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+func TestClaimSchedulerPosition(t *testing.T) {
+	s := newClaimScheduler(16)
+	s.weights = [priorityClasses]int{2, 1, 1}
+	for _, claim := range []*Claim{
+		{ID: "w1", priority: PriorityWeb}, {ID: "w2", priority: PriorityWeb}, {ID: "k1", priority: PriorityAPIKey},
+		{ID: "k2", priority: PriorityAPIKey}, {ID: "k3", priority: PriorityAPIKey}, {ID: "a1", priority: PriorityAllowlist},
+	} {
+		s.Push(claim)
+	}
+	// Taking one claim first leaves the scheduler with credits to account for
+	s.Pop()
+
+	positions := make(map[string]int)
+	for _, id := range []string{"w1", "w2", "k2", "k3", "a1"} {
+		positions[id] = s.Position(id)
+	}
+	for want := 1; s.Len() > 0; want++ {
+		claim, _ := s.Pop()
+		if positions[claim.ID] != want {
+			t.Errorf("Position(%s) = %d, but it was paid out as number %d", claim.ID, positions[claim.ID], want)
+		}
+	}
+	if got := s.Position("k1"); got != 0 {
+		t.Errorf("Position() of a claim that was taken = %d, want 0", got)
+	}
+}
+
+func TestQueueProgress(t *testing.T) {
+	q := NewQueue(&mockTxBuilder{}, 2, 8)
+	q.EnableTracking(&mockConfirmer{states: make(map[common.Hash]chain.TxState)}, 1, time.Hour)
+	var ids []string
+	for i := 0; i < 3; i++ {
+		claim, _ := q.Enqueue(context.Background(), "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", big.NewInt(1))
+		ids = append(ids, claim.ID)
+	}
+
+	progress, ok := q.Progress(ids[2])
+	if !ok || progress.Position != 3 || progress.Queued != 3 || progress.Pending != 0 {
+		t.Fatalf("Progress() = %+v, %v, want third of 3 queued claims", progress, ok)
+	}
+	if progress.ETA != 0 {
+		t.Errorf("Progress().ETA = %v before any payout, want unknown", progress.ETA)
+	}
+
+	q.sendLatency.add(8 * time.Second)
+	q.sendLatency.add(12 * time.Second)
+	q.confirmLatency.add(30 * time.Second)
+	// Two workers send the first two claims in a round, then the third
+	if progress, _ := q.Progress(ids[2]); progress.ETA != 50*time.Second {
+		t.Errorf("Progress().ETA = %v, want 50s", progress.ETA)
+	}
+	if progress, _ := q.Progress(ids[0]); progress.ETA != 40*time.Second {
+		t.Errorf("Progress().ETA of the next claim = %v, want 40s", progress.ETA)
+	}
+	if _, ok := q.Progress("unknown"); ok {
+		t.Error("Progress() of an unknown claim reported ok")
+	}
+
+	q.Start()
+	defer q.Close(context.Background())
+	waitForStatus(t, q, ids[0], ClaimBroadcast)
+	progress, ok = q.Progress(ids[0])
+	if !ok || progress.Position != 0 || progress.ETA <= 0 || progress.ETA > 30*time.Second {
+		t.Errorf("Progress() of a broadcast claim = %+v, %v, want the confirmation time left", progress, ok)
+	}
+}
+
+func TestQueueProgressFinal(t *testing.T) {
+	q := NewQueue(&mockTxBuilder{}, 1, 1)
+	q.Start()
+	defer q.Close(context.Background())
+	claim, _ := q.Enqueue(context.Background(), "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", big.NewInt(1))
+	waitForStatus(t, q, claim.ID, ClaimBroadcast)
+	if progress, ok := q.Progress(claim.ID); ok {
+		t.Errorf("Progress() of a final claim = %+v, want none", progress)
+	}
+}
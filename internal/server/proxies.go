@@ -0,0 +1,165 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Headers reverse proxies pass the client IP in
+const (
+	ProxyHeaderXFF       = "x-forwarded-for"
+	ProxyHeaderForwarded = "forwarded"
+	ProxyHeaderRealIP    = "x-real-ip"
+)
+
+// Proxies tells the IP of clients from that of the reverse proxies in front
+// of the server. The addresses a proxy adds to its header are only believed
+// when the request came from a trusted proxy, either the last count hops or
+// any address in the trusted ranges. A nil Proxies trusts no header
+type Proxies struct {
+	count   int
+	trusted []*net.IPNet
+	header  string
+}
+
+// NewProxies trusts the given number of proxies in front of the server, or
+// those in the trusted CIDR ranges if there are any, to pass on the client IP
+// in header
+func NewProxies(count int, trusted []string, header string) (*Proxies, error) {
+	p := &Proxies{count: count, header: strings.ToLower(header)}
+	if p.header == "" {
+		p.header = ProxyHeaderXFF
+	}
+	if p.header != ProxyHeaderXFF && p.header != ProxyHeaderForwarded && p.header != ProxyHeaderRealIP {
+		return nil, fmt.Errorf("unknown proxy header %q", header)
+	}
+	for _, cidr := range trusted {
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", cidr)
+		}
+		p.trusted = append(p.trusted, network)
+	}
+	return p, nil
+}
+
+// Enabled reports whether any proxy is trusted
+func (p *Proxies) Enabled() bool {
+	return p != nil && (p.count > 0 || len(p.trusted) > 0)
+}
+
+// Trusted reports whether the request came straight from a trusted proxy
+func (p *Proxies) Trusted(r *http.Request) bool {
+	if !p.Enabled() {
+		return false
+	}
+	if len(p.trusted) == 0 {
+		return true
+	}
+	return p.trusts(normalizeIP(r.RemoteAddr))
+}
+
+func (p *Proxies) trusts(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range p.trusted {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the IP the request was made from in canonical form, so
+// that every spelling of an IPv6 address ends up under the same limiter key
+func (p *Proxies) ClientIP(r *http.Request) string {
+	remoteIP := normalizeIP(r.RemoteAddr)
+	if !p.Trusted(r) {
+		return remoteIP
+	}
+	hops := p.hops(r)
+	if len(hops) == 0 {
+		return remoteIP
+	}
+
+	var clientIP string
+	if len(p.trusted) > 0 {
+		// The client is the last hop not added by a trusted proxy
+		clientIP = hops[0]
+		for i := len(hops) - 1; i >= 0; i-- {
+			if !p.trusts(normalizeIP(hops[i])) {
+				clientIP = hops[i]
+				break
+			}
+		}
+	} else {
+		// Avoid reading the user's forged request header by configuring the count of reverse proxies
+		index := len(hops) - p.count
+		if index < 0 {
+			index = 0
+		}
+		clientIP = hops[index]
+	}
+	if ip := normalizeIP(clientIP); net.ParseIP(ip) != nil {
+		return ip
+	}
+	return remoteIP
+}
+
+// hops returns the addresses in the proxy header, the client first
+func (p *Proxies) hops(r *http.Request) []string {
+	var hops []string
+	switch p.header {
+	case ProxyHeaderForwarded:
+		for _, value := range r.Header.Values("Forwarded") {
+			for _, element := range strings.Split(value, ",") {
+				for _, pair := range strings.Split(element, ";") {
+					if i := strings.Index(pair, "="); i >= 0 && strings.EqualFold(strings.TrimSpace(pair[:i]), "for") {
+						hops = append(hops, strings.Trim(strings.TrimSpace(pair[i+1:]), `"`))
+					}
+				}
+			}
+		}
+	case ProxyHeaderRealIP:
+		if value := strings.TrimSpace(r.Header.Get("X-Real-IP")); value != "" {
+			hops = append(hops, value)
+		}
+	default:
+		for _, value := range r.Header.Values("X-Forwarded-For") {
+			for _, hop := range strings.Split(value, ",") {
+				hops = append(hops, strings.TrimSpace(hop))
+			}
+		}
+	}
+	return hops
+}
+
+// normalizeIP strips the port, brackets and zone of an address and returns
+// its IP in canonical form, IPv4-mapped IPv6 addresses as IPv4. Addresses
+// that are not an IP are returned without port
+func normalizeIP(addr string) string {
+	host := addr
+	if h, _, err := net.SplitHostPort(addr); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if i := strings.IndexByte(host, '%'); i >= 0 {
+		host = host[:i]
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return host
+	}
+	return ip.String()
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProxiesClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		count      int
+		trusted    []string
+		header     string
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{name: "no proxy", remoteAddr: "10.0.0.1:1234", headers: map[string]string{"X-Forwarded-For": "1.2.3.4"}, want: "10.0.0.1"},
+		{name: "proxy count", count: 1, remoteAddr: "10.0.0.1:1234", headers: map[string]string{"X-Forwarded-For": "6.6.6.6, 1.2.3.4"}, want: "1.2.3.4"},
+		{name: "proxy count exceeds hops", count: 3, remoteAddr: "10.0.0.1:1234", headers: map[string]string{"X-Forwarded-For": "1.2.3.4"}, want: "1.2.3.4"},
+		{name: "trusted proxies", trusted: []string{"10.0.0.0/8"}, remoteAddr: "10.0.0.1:1234", headers: map[string]string{"X-Forwarded-For": "6.6.6.6, 1.2.3.4, 10.0.0.2"}, want: "1.2.3.4"},
+		{name: "untrusted peer", trusted: []string{"10.0.0.0/8"}, remoteAddr: "192.0.2.1:1234", headers: map[string]string{"X-Forwarded-For": "1.2.3.4"}, want: "192.0.2.1"},
+		{name: "trusted single address", trusted: []string{"10.0.0.1"}, remoteAddr: "10.0.0.1:1234", headers: map[string]string{"X-Forwarded-For": "1.2.3.4"}, want: "1.2.3.4"},
+		{name: "forwarded", count: 1, header: ProxyHeaderForwarded, remoteAddr: "10.0.0.1:1234", headers: map[string]string{"Forwarded": `for=6.6.6.6, for="[2001:DB8:0:0::1]:4711";proto=https`}, want: "2001:db8::1"},
+		{name: "forwarded obfuscated", count: 1, header: ProxyHeaderForwarded, remoteAddr: "10.0.0.1:1234", headers: map[string]string{"Forwarded": "for=_hidden"}, want: "10.0.0.1"},
+		{name: "x-real-ip", count: 1, header: ProxyHeaderRealIP, remoteAddr: "10.0.0.1:1234", headers: map[string]string{"X-Real-IP": "1.2.3.4", "X-Forwarded-For": "6.6.6.6"}, want: "1.2.3.4"},
+		{name: "ipv6 zone", remoteAddr: "[fe80::1%eth0]:1234", want: "fe80::1"},
+		{name: "ipv4 mapped", count: 1, remoteAddr: "10.0.0.1:1234", headers: map[string]string{"X-Forwarded-For": "::ffff:1.2.3.4"}, want: "1.2.3.4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxies, err := NewProxies(tt.count, tt.trusted, tt.header)
+			if err != nil {
+				t.Fatalf("NewProxies() error = %v", err)
+			}
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			if got := proxies.ClientIP(r); got != tt.want {
+				t.Errorf("ClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := NewProxies(0, []string{"10.0.0.0/33"}, ""); err == nil {
+		t.Error("NewProxies() accepted an invalid range")
+	}
+	if _, err := NewProxies(0, nil, "x-client-ip"); err == nil {
+		t.Error("NewProxies() accepted an unknown header")
+	}
+}
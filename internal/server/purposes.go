@@ -0,0 +1,119 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+// purposePattern is what the name of a purpose may look like, e.g. ci or tutorial-x
+var purposePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+type purposeKey struct{}
+
+// withPurpose tags the claim made with ctx with the program it is for
+func withPurpose(ctx context.Context, purpose string) context.Context {
+	return context.WithValue(ctx, purposeKey{}, purpose)
+}
+
+// requestPurpose returns the purpose the claim made with ctx is tagged with, if any
+func requestPurpose(ctx context.Context) string {
+	purpose, _ := ctx.Value(purposeKey{}).(string)
+	return purpose
+}
+
+// Purposes is the set of programs, such as a hackathon, CI pipelines or a
+// tutorial, that claims may name as their purpose so that the stats show
+// which of them consume the faucet funds. A purpose may have a budget per UTC
+// day of its own on top of the global budget. Without purposes claims may
+// not name one
+type Purposes struct {
+	names   []string
+	budgets map[string]*Budget
+}
+
+// ParsePurposes reads purposes given as name, or as name=Ethers for a daily budget
+func ParsePurposes(entries []string) (*Purposes, error) {
+	p := &Purposes{budgets: make(map[string]*Budget)}
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		name, budget := entry, ""
+		if i := strings.Index(entry, "="); i >= 0 {
+			name, budget = entry[:i], entry[i+1:]
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !purposePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid purpose %q, it must be lowercase letters, digits, - or _", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate purpose %q", name)
+		}
+		seen[name] = true
+		p.names = append(p.names, name)
+		if budget == "" {
+			continue
+		}
+		amount, err := chain.ParseEther(strings.TrimSpace(budget))
+		if err != nil || amount.Sign() <= 0 {
+			return nil, errors.New("purpose budgets must be given as name=Ethers per day")
+		}
+		p.budgets[name] = NewBudget(0, nil, 0, amount)
+	}
+	sort.Strings(p.names)
+	return p, nil
+}
+
+func (p *Purposes) Enabled() bool {
+	return p != nil && len(p.names) > 0
+}
+
+// Names returns the purposes claims may name, sorted
+func (p *Purposes) Names() []string {
+	if p == nil {
+		return nil
+	}
+	return p.names
+}
+
+// Valid reports whether purpose is one of the configured purposes
+func (p *Purposes) Valid(purpose string) bool {
+	i := sort.SearchStrings(p.Names(), purpose)
+	return i < len(p.Names()) && p.names[i] == purpose
+}
+
+// Reserve counts a payout of amount against the budget of purpose, if it has
+// one, returning a *budgetExhausted naming the purpose if it has no room left
+func (p *Purposes) Reserve(purpose string, amount *big.Int) (time.Time, error) {
+	budget, ok := p.budget(purpose)
+	if !ok {
+		return time.Now(), nil
+	}
+	reservedAt, err := budget.Reserve(amount)
+	var exhausted *budgetExhausted
+	if errors.As(err, &exhausted) {
+		exhausted.purpose = purpose
+	}
+	return reservedAt, err
+}
+
+// Release undoes a reservation whose claim could not be queued or whose payout failed
+func (p *Purposes) Release(purpose string, amount *big.Int, reservedAt time.Time) {
+	if budget, ok := p.budget(purpose); ok {
+		budget.Release(amount, reservedAt)
+	}
+}
+
+func (p *Purposes) budget(purpose string) (*Budget, bool) {
+	if p == nil || purpose == "" {
+		return nil, false
+	}
+	budget, ok := p.budgets[purpose]
+	return budget, ok
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+func TestParsePurposes(t *testing.T) {
+	purposes, err := ParsePurposes([]string{"tutorial-x", "Hackathon=2", "ci"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := purposes.Names(); len(names) != 3 || names[0] != "ci" || names[1] != "hackathon" || names[2] != "tutorial-x" {
+		t.Errorf("Names() = %v, want [ci hackathon tutorial-x]", names)
+	}
+	if !purposes.Valid("hackathon") || purposes.Valid("airdrop") || purposes.Valid("") {
+		t.Error("Valid() does not match the configured purposes")
+	}
+
+	for _, entries := range [][]string{{"ci", "CI"}, {"not a name"}, {"ci=abc"}, {"ci=0"}} {
+		if _, err := ParsePurposes(entries); err == nil {
+			t.Errorf("ParsePurposes(%q) succeeded", entries)
+		}
+	}
+	var none *Purposes
+	if none.Enabled() || none.Valid("ci") {
+		t.Error("nil purposes enabled")
+	}
+}
+
+func TestPurposeBudgets(t *testing.T) {
+	purposes, _ := ParsePurposes([]string{"hackathon=2", "ci"})
+	amount := chain.EtherToWei(1)
+
+	for i := 0; i < 5; i++ {
+		if _, err := purposes.Reserve("ci", amount); err != nil {
+			t.Fatalf("Reserve(ci) error = %v, want no budget", err)
+		}
+	}
+	if _, err := purposes.Reserve("hackathon", amount); err != nil {
+		t.Fatalf("Reserve(hackathon) error = %v", err)
+	}
+	reservedAt, err := purposes.Reserve("hackathon", amount)
+	if err != nil {
+		t.Fatalf("Reserve(hackathon) error = %v", err)
+	}
+	_, err = purposes.Reserve("hackathon", amount)
+	var exhausted *budgetExhausted
+	if !errors.As(err, &exhausted) || exhausted.purpose != "hackathon" {
+		t.Fatalf("Reserve(hackathon) over budget error = %v, want its budget exhausted", err)
+	}
+
+	purposes.Release("hackathon", amount, reservedAt)
+	if _, err := purposes.Reserve("hackathon", amount); err != nil {
+		t.Errorf("Reserve(hackathon) after a release error = %v", err)
+	}
+}
@@ -0,0 +1,525 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/jellydator/ttlcache/v2"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+const (
+	claimRetention  = 24 * time.Hour
+	transferTimeout = 5 * time.Second
+)
+
+var (
+	errQueueFull   = errors.New("faucet is busy, please try again later")
+	errQueueClosed = errors.New("faucet is shutting down, please try again later")
+	// errPayoutUnavailable is returned when the payout policy cannot reach the RPC node
+	errPayoutUnavailable = errors.New("Unable to determine payout amount, please try again later")
+)
+
+type ClaimStatus string
+
+const (
+	ClaimQueued    ClaimStatus = "queued"
+	ClaimBroadcast ClaimStatus = "broadcast"
+	ClaimMined     ClaimStatus = "mined"
+	ClaimConfirmed ClaimStatus = "confirmed"
+	ClaimFailed    ClaimStatus = "failed"
+	// ClaimSimulated is the final status of claims in dry run mode, whose tx was built but not broadcast
+	ClaimSimulated ClaimStatus = "simulated"
+)
+
+type Claim struct {
+	ID        string
+	Address   string
+	Amount    *big.Int
+	Status    ClaimStatus
+	TxHash    common.Hash
+	Error     string
+	Retries   int
+	CreatedAt time.Time
+	// RequestID is the ID of the request that queued the claim, for correlating logs
+	RequestID string
+	// span links the payout to the trace of the request that queued the claim
+	span trace.SpanContext
+	// email is where the receipt of the payout is sent, if the claimant asked for one
+	email string
+	// priority is the class the claim waits for a worker in, since queuedAt
+	priority ClaimPriority
+	queuedAt time.Time
+	// takenAt is when a worker took the claim and sentAt when its tx was broadcast
+	takenAt time.Time
+	sentAt  time.Time
+	// err is why the payout failed
+	err error
+	// rollback gives back what was counted against the claimant if the payout fails
+	rollback *payoutRollback
+}
+
+type rollbackKey struct{}
+
+// payoutRollback collects what the handlers of a claim counted against its
+// claimant, such as limiter keys, to be given back if the payout fails after
+// the claim was accepted
+type payoutRollback struct {
+	mutex sync.Mutex
+	fns   []func()
+}
+
+// withPayoutRollback returns ctx carrying a rollback of the claim made with it
+func withPayoutRollback(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(rollbackKey{}).(*payoutRollback); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, rollbackKey{}, &payoutRollback{})
+}
+
+// onPayoutFailure registers fn to be called if the payout of the claim made with ctx fails
+func onPayoutFailure(ctx context.Context, fn func()) {
+	if rollback, ok := ctx.Value(rollbackKey{}).(*payoutRollback); ok {
+		rollback.mutex.Lock()
+		rollback.fns = append(rollback.fns, fn)
+		rollback.mutex.Unlock()
+	}
+}
+
+func (r *payoutRollback) run() {
+	r.mutex.Lock()
+	fns := r.fns
+	r.fns = nil
+	r.mutex.Unlock()
+	for _, fn := range fns {
+		fn()
+	}
+}
+
+// RollbackFailed gives back what was counted against the claimant of a claim
+// whose payout failed. It is meant to be registered with OnFinal
+func RollbackFailed(claim Claim) {
+	if claim.Status == ClaimFailed && claim.rollback != nil {
+		// Final hooks run with the queue locked, and the rollbacks take locks of their own
+		go claim.rollback.run()
+	}
+}
+
+type Queue struct {
+	mutex       sync.RWMutex
+	builder     chain.TxBuilder
+	claims      *ttlcache.Cache
+	pending     *claimScheduler
+	jobs        chan *Claim
+	workers     int
+	batcher     chain.BatchTxBuilder
+	batchSize   int
+	batchWindow time.Duration
+	tracker     *confirmationTracker
+	dryRun      bool
+	onFinal     []func(Claim)
+	subscribers map[string][]chan Claim
+	closed      bool
+	// inflight is the number of claims taken from the queue that are not final
+	inflight       int
+	sendLatency    latencyWindow
+	confirmLatency latencyWindow
+	wg             sync.WaitGroup
+}
+
+func NewQueue(builder chain.TxBuilder, workers, size int) *Queue {
+	if workers < 1 {
+		workers = 1
+	}
+	claims := ttlcache.NewCache()
+	claims.SkipTTLExtensionOnHit(true)
+	return &Queue{
+		builder:     builder,
+		claims:      claims,
+		pending:     newClaimScheduler(size),
+		jobs:        make(chan *Claim),
+		workers:     workers,
+		subscribers: make(map[string][]chan Claim),
+	}
+}
+
+// SetPriorities sets the share of payouts each priority class gets while
+// claims of several classes are waiting, and how long a claim may wait before
+// it goes ahead of every class. It must be called before Start
+func (q *Queue) SetPriorities(weights [priorityClasses]int, maxWait time.Duration) {
+	q.pending.weights = weights
+	q.pending.maxWait = maxWait
+}
+
+// EnableBatching makes the queue collect claims for up to window or until size
+// claims are waiting, and pay them out in one multisend transaction. It must be
+// called before Start
+func (q *Queue) EnableBatching(batcher chain.BatchTxBuilder, size int, window time.Duration) {
+	q.batcher = batcher
+	q.batchSize = size
+	q.batchWindow = window
+}
+
+// EnableTracking makes the queue follow broadcast claims until their tx has the
+// given number of confirmations, resending or requeueing dropped payouts. It
+// must be called before Start
+func (q *Queue) EnableTracking(confirmer chain.Confirmer, confirmations uint64, interval time.Duration) {
+	q.tracker = newConfirmationTracker(q, confirmer, confirmations, interval)
+}
+
+// EnableDryRun marks claims as simulated once the tx builder has run them
+// without broadcasting. It must be called before Start
+func (q *Queue) EnableDryRun() {
+	q.dryRun = true
+}
+
+// OnFinal registers fn to be called with every claim reaching a final status.
+// fn runs with the queue locked and must not block. It must be called before Start
+func (q *Queue) OnFinal(fn func(Claim)) {
+	q.onFinal = append(q.onFinal, fn)
+}
+
+// Final reports whether no further status changes will follow a claim in the given status
+func (q *Queue) Final(status ClaimStatus) bool {
+	switch status {
+	case ClaimConfirmed, ClaimFailed, ClaimSimulated:
+		return true
+	case ClaimBroadcast:
+		return q.tracker == nil
+	default:
+		return false
+	}
+}
+
+func (q *Queue) Start() {
+	if q.tracker != nil {
+		go q.tracker.run()
+	}
+	go q.dispatch()
+	if q.batcher != nil {
+		q.wg.Add(1)
+		go q.batch()
+		return
+	}
+	q.wg.Add(q.workers)
+	for i := 0; i < q.workers; i++ {
+		go q.work()
+	}
+}
+
+// Closed reports whether the queue has stopped accepting claims
+func (q *Queue) Closed() bool {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+	return q.closed
+}
+
+// Close stops accepting claims and waits until the queued ones have been sent
+func (q *Queue) Close(ctx context.Context) error {
+	q.mutex.Lock()
+	if !q.closed {
+		q.closed = true
+		q.pending.Close()
+	}
+	q.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+	if q.tracker != nil {
+		defer q.tracker.stop()
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%d claims left in queue: %w", q.pending.Len(), ctx.Err())
+	}
+}
+
+func (q *Queue) Enqueue(ctx context.Context, address string, amount *big.Int) (*Claim, error) {
+	id, err := newRandomID()
+	if err != nil {
+		return nil, err
+	}
+	claim := &Claim{
+		ID:        id,
+		Address:   address,
+		Amount:    amount,
+		Status:    ClaimQueued,
+		CreatedAt: time.Now(),
+		RequestID: requestID(ctx),
+		span:      trace.SpanContextFromContext(ctx),
+		email:     receiptEmail(ctx),
+		priority:  claimPriority(ctx),
+	}
+	claim.rollback, _ = ctx.Value(rollbackKey{}).(*payoutRollback)
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.closed {
+		return nil, errQueueClosed
+	}
+	if !q.pending.Push(claim) {
+		return nil, errQueueFull
+	}
+	q.claims.SetWithTTL(id, claim, claimRetention)
+
+	return claim, nil
+}
+
+func (q *Queue) Get(id string) (Claim, bool) {
+	value, err := q.claims.Get(id)
+	if err != nil {
+		return Claim{}, false
+	}
+
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+	return *value.(*Claim), true
+}
+
+// Subscribe returns a channel receiving a snapshot of the claim on every status change
+func (q *Queue) Subscribe(id string) (<-chan Claim, func()) {
+	ch := make(chan Claim, 4)
+	q.mutex.Lock()
+	q.subscribers[id] = append(q.subscribers[id], ch)
+	q.mutex.Unlock()
+
+	return ch, func() {
+		q.mutex.Lock()
+		defer q.mutex.Unlock()
+		subs := q.subscribers[id]
+		for i, sub := range subs {
+			if sub == ch {
+				q.subscribers[id] = append(subs[:i], subs[i+1:]...)
+				break
+			}
+		}
+		if len(q.subscribers[id]) == 0 {
+			delete(q.subscribers, id)
+		}
+	}
+}
+
+// update applies fn to the claim and notifies subscribers
+func (q *Queue) update(claim *Claim, fn func(*Claim)) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	fn(claim)
+	q.notify(claim)
+}
+
+// requeue puts a claim whose payout was dropped back into the queue, or fails it
+// if it ran out of retries or the queue cannot take it
+func (q *Queue) requeue(claim *Claim) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if !q.closed && claim.Retries < maxClaimRetries && q.pending.Push(claim) {
+		q.inflight--
+		claim.Status = ClaimQueued
+		claim.TxHash = common.Hash{}
+		claim.Retries++
+	} else {
+		claim.Status = ClaimFailed
+		claim.Error = errTxDropped.Error()
+	}
+	q.notify(claim)
+}
+
+func (q *Queue) notify(claim *Claim) {
+	if q.Final(claim.Status) {
+		q.inflight--
+		if claim.Status == ClaimConfirmed {
+			q.confirmLatency.add(time.Since(claim.sentAt))
+		}
+		for _, fn := range q.onFinal {
+			fn(*claim)
+		}
+	}
+	q.publish(claim)
+}
+
+// publish sends a snapshot of the claim to its subscribers
+func (q *Queue) publish(claim *Claim) {
+	for _, ch := range q.subscribers[claim.ID] {
+		select {
+		case ch <- *claim:
+		default:
+		}
+	}
+}
+
+// Replaced points the claims paid out by a stalled tx to the tx that replaced
+// it, which is the one that will be mined
+func (q *Queue) Replaced(replaced, replacement common.Hash) {
+	for _, value := range q.claims.GetItems() {
+		claim := value.(*Claim)
+		q.mutex.Lock()
+		if claim.TxHash == replaced {
+			claim.TxHash = replacement
+			q.publish(claim)
+		}
+		q.mutex.Unlock()
+	}
+}
+
+// dispatch hands the claims to the workers in the order of the scheduler
+func (q *Queue) dispatch() {
+	for {
+		claim, ok := q.pending.Pop()
+		if !ok {
+			close(q.jobs)
+			return
+		}
+		q.mutex.Lock()
+		claim.takenAt = time.Now()
+		q.inflight++
+		q.mutex.Unlock()
+		q.jobs <- claim
+	}
+}
+
+func (q *Queue) work() {
+	defer q.wg.Done()
+	for claim := range q.jobs {
+		ctx := trace.ContextWithRemoteSpanContext(context.Background(), claim.span)
+		ctx, span := tracer.Start(ctx, "queue.payout", trace.WithAttributes(claimAttributes(claim)...))
+		ctx, cancel := context.WithTimeout(ctx, transferTimeout)
+		txHash, err := q.builder.Transfer(ctx, claim.Address, claim.Amount)
+		cancel()
+		endSpan(span, err)
+		q.finish(claim, txHash, err)
+	}
+}
+
+// batch collects claims until the batch is full or its window has passed
+func (q *Queue) batch() {
+	defer q.wg.Done()
+	var (
+		pending []*Claim
+		flush   <-chan time.Time
+	)
+	for {
+		select {
+		case claim, ok := <-q.jobs:
+			if !ok {
+				q.sendBatch(pending)
+				return
+			}
+			pending = append(pending, claim)
+			if len(pending) == 1 {
+				flush = time.After(q.batchWindow)
+			}
+			if len(pending) < q.batchSize {
+				continue
+			}
+		case <-flush:
+		}
+		q.sendBatch(pending)
+		pending, flush = nil, nil
+	}
+}
+
+func (q *Queue) sendBatch(claims []*Claim) {
+	if len(claims) == 0 {
+		return
+	}
+
+	// A batch pays out claims of several requests, so it links to their traces
+	// instead of continuing one of them
+	links := make([]trace.Link, len(claims))
+	for i, claim := range claims {
+		links[i] = trace.Link{SpanContext: claim.span, Attributes: claimAttributes(claim)}
+	}
+	ctx, span := tracer.Start(context.Background(), "queue.batch", trace.WithLinks(links...),
+		trace.WithAttributes(attribute.Int("batch.size", len(claims))))
+	ctx, cancel := context.WithTimeout(ctx, transferTimeout)
+	defer cancel()
+	// A single claim is cheaper as a plain transfer than through the contract
+	if len(claims) == 1 {
+		txHash, err := q.builder.Transfer(ctx, claims[0].Address, claims[0].Amount)
+		endSpan(span, err)
+		q.finish(claims[0], txHash, err)
+		return
+	}
+
+	to := make([]string, len(claims))
+	values := make([]*big.Int, len(claims))
+	for i, claim := range claims {
+		to[i] = claim.Address
+		values[i] = claim.Amount
+	}
+	txHash, err := q.batcher.BatchTransfer(ctx, to, values)
+	endSpan(span, err)
+	for _, claim := range claims {
+		q.finish(claim, txHash, err)
+	}
+}
+
+func (q *Queue) finish(claim *Claim, txHash common.Hash, err error) {
+	q.update(claim, func(c *Claim) {
+		if err == nil {
+			c.sentAt = time.Now()
+			q.sendLatency.add(c.sentAt.Sub(c.takenAt))
+		}
+		switch {
+		case err != nil:
+			c.Status = ClaimFailed
+			c.Error = err.Error()
+			c.err = err
+		case q.dryRun:
+			c.Status = ClaimSimulated
+			c.TxHash = txHash
+		default:
+			c.Status = ClaimBroadcast
+			c.TxHash = txHash
+		}
+	})
+
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"claimID":   claim.ID,
+			"requestID": claim.RequestID,
+		}).Error("Failed to send transaction")
+		return
+	}
+	log.WithFields(log.Fields{
+		"claimID":   claim.ID,
+		"requestID": claim.RequestID,
+		"txHash":    txHash,
+		"address":   claim.Address,
+	}).Info("Transaction sent successfully")
+	if q.tracker != nil && !q.dryRun {
+		q.tracker.watch(claim, txHash)
+	}
+}
+
+func claimAttributes(claim *Claim) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("claim.id", claim.ID),
+		attribute.String("claim.address", claim.Address),
+		attribute.String("claim.amount", claim.Amount.String()),
+	}
+}
+
+func newRandomID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
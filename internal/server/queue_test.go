@@ -0,0 +1,279 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+type mockTxBuilder struct {
+	err error
+}
+
+func (m *mockTxBuilder) Sender() common.Address {
+	return common.Address{}
+}
+
+func (m *mockTxBuilder) Transfer(_ context.Context, _ string, _ *big.Int) (common.Hash, error) {
+	if m.err != nil {
+		return common.Hash{}, m.err
+	}
+	return common.HexToHash("0x01"), nil
+}
+
+func waitForStatus(t *testing.T, q *Queue, id string, want ClaimStatus) Claim {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		claim, ok := q.Get(id)
+		if !ok {
+			t.Fatalf("claim %s not found", id)
+		}
+		if claim.Status == want {
+			return claim
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("claim %s did not reach status %s", id, want)
+	return Claim{}
+}
+
+func TestQueue(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		want    ClaimStatus
+		wantErr string
+	}{
+		{name: "broadcast", want: ClaimBroadcast},
+		{name: "failed", err: errors.New("insufficient funds"), want: ClaimFailed, wantErr: "insufficient funds"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := NewQueue(&mockTxBuilder{err: tt.err}, 1, 1)
+			q.Start()
+			claim, err := q.Enqueue(context.Background(), "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", big.NewInt(1))
+			if err != nil {
+				t.Fatalf("Enqueue() error = %v", err)
+			}
+			got := waitForStatus(t, q, claim.ID, tt.want)
+			if got.Error != tt.wantErr {
+				t.Errorf("Claim.Error = %q, want %q", got.Error, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestQueueFull(t *testing.T) {
+	q := NewQueue(&mockTxBuilder{}, 1, 1)
+	if _, err := q.Enqueue(context.Background(), "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", big.NewInt(1)); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	if _, err := q.Enqueue(context.Background(), "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", big.NewInt(1)); !errors.Is(err, errQueueFull) {
+		t.Errorf("Enqueue() error = %v, want %v", err, errQueueFull)
+	}
+}
+
+func TestQueueSubscribe(t *testing.T) {
+	q := NewQueue(&mockTxBuilder{}, 1, 1)
+	claim, err := q.Enqueue(context.Background(), "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", big.NewInt(1))
+	if err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	updates, unsubscribe := q.Subscribe(claim.ID)
+	defer unsubscribe()
+	q.Start()
+
+	select {
+	case got := <-updates:
+		if got.Status != ClaimBroadcast {
+			t.Errorf("update status = %s, want %s", got.Status, ClaimBroadcast)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no status update received")
+	}
+}
+
+func TestQueueReplaced(t *testing.T) {
+	q := NewQueue(&mockTxBuilder{}, 1, 1)
+	finals := 0
+	q.OnFinal(func(Claim) { finals++ })
+	q.Start()
+	claim, err := q.Enqueue(context.Background(), "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", big.NewInt(1))
+	if err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	sent := waitForStatus(t, q, claim.ID, ClaimBroadcast)
+
+	q.Replaced(sent.TxHash, common.HexToHash("0x02"))
+	if got, _ := q.Get(claim.ID); got.TxHash != common.HexToHash("0x02") || got.Status != ClaimBroadcast {
+		t.Errorf("claim after replacement = %s %s, want %s with the replacement tx", got.Status, got.TxHash, ClaimBroadcast)
+	}
+	if finals != 1 {
+		t.Errorf("claim finished %d times, want once", finals)
+	}
+}
+
+func TestQueueClose(t *testing.T) {
+	q := NewQueue(&mockTxBuilder{}, 1, 2)
+	claim, err := q.Enqueue(context.Background(), "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", big.NewInt(1))
+	if err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	q.Start()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := q.Close(ctx); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if got, _ := q.Get(claim.ID); got.Status != ClaimBroadcast {
+		t.Errorf("claim status after Close() = %s, want %s", got.Status, ClaimBroadcast)
+	}
+	if _, err := q.Enqueue(context.Background(), "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", big.NewInt(1)); !errors.Is(err, errQueueClosed) {
+		t.Errorf("Enqueue() after Close() error = %v, want %v", err, errQueueClosed)
+	}
+}
+
+func TestQueueDryRun(t *testing.T) {
+	q := NewQueue(&mockTxBuilder{}, 1, 1)
+	q.EnableDryRun()
+	q.Start()
+	defer q.Close(context.Background())
+
+	claim, err := q.Enqueue(context.Background(), "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", big.NewInt(1))
+	if err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	got := waitForStatus(t, q, claim.ID, ClaimSimulated)
+	if got.TxHash != common.HexToHash("0x01") {
+		t.Errorf("TxHash = %v, want the simulated tx", got.TxHash)
+	}
+	if !q.Final(ClaimSimulated) {
+		t.Error("Final(ClaimSimulated) = false, want true")
+	}
+}
+
+type mockBatchTxBuilder struct {
+	mockTxBuilder
+	batches chan []string
+}
+
+func (m *mockBatchTxBuilder) BatchTransfer(_ context.Context, to []string, _ []*big.Int) (common.Hash, error) {
+	m.batches <- to
+	return common.HexToHash("0x02"), nil
+}
+
+func TestQueueBatch(t *testing.T) {
+	builder := &mockBatchTxBuilder{batches: make(chan []string, 1)}
+	q := NewQueue(builder, 1, 4)
+	q.EnableBatching(builder, 2, time.Minute)
+	q.Start()
+
+	var ids []string
+	for i := 0; i < 2; i++ {
+		claim, err := q.Enqueue(context.Background(), "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", big.NewInt(1))
+		if err != nil {
+			t.Fatalf("Enqueue() error = %v", err)
+		}
+		ids = append(ids, claim.ID)
+	}
+	select {
+	case to := <-builder.batches:
+		if len(to) != 2 {
+			t.Errorf("batch size = %d, want 2", len(to))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("full batch was not sent")
+	}
+	for _, id := range ids {
+		if got := waitForStatus(t, q, id, ClaimBroadcast); got.TxHash != common.HexToHash("0x02") {
+			t.Errorf("claim %s tx hash = %v, want batch tx", id, got.TxHash)
+		}
+	}
+
+	// A claim left over at shutdown is sent on its own
+	claim, err := q.Enqueue(context.Background(), "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", big.NewInt(1))
+	if err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	if err := q.Close(context.Background()); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if got, _ := q.Get(claim.ID); got.TxHash != common.HexToHash("0x01") {
+		t.Errorf("leftover claim tx hash = %v, want single transfer", got.TxHash)
+	}
+}
+
+type mockConfirmer struct {
+	mutex     sync.Mutex
+	states    map[common.Hash]chain.TxState
+	resendErr error
+}
+
+func (m *mockConfirmer) set(hash common.Hash, state chain.TxState) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.states[hash] = state
+}
+
+func (m *mockConfirmer) Confirm(_ context.Context, hash common.Hash, _ uint64) (chain.TxState, common.Hash, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if state, ok := m.states[hash]; ok {
+		return state, hash, nil
+	}
+	return chain.TxPending, hash, nil
+}
+
+func (m *mockConfirmer) Resend(_ context.Context, _ common.Hash) (common.Hash, error) {
+	return common.Hash{}, m.resendErr
+}
+
+func TestQueueTracking(t *testing.T) {
+	confirmer := &mockConfirmer{states: make(map[common.Hash]chain.TxState)}
+	q := NewQueue(&mockTxBuilder{}, 1, 1)
+	q.EnableTracking(confirmer, 1, 5*time.Millisecond)
+	q.Start()
+	defer q.Close(context.Background())
+
+	claim, err := q.Enqueue(context.Background(), "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", big.NewInt(1))
+	if err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	waitForStatus(t, q, claim.ID, ClaimBroadcast)
+	if q.Final(ClaimBroadcast) {
+		t.Errorf("broadcast is final while tracking confirmations")
+	}
+	confirmer.set(common.HexToHash("0x01"), chain.TxMined)
+	waitForStatus(t, q, claim.ID, ClaimMined)
+	confirmer.set(common.HexToHash("0x01"), chain.TxConfirmed)
+	waitForStatus(t, q, claim.ID, ClaimConfirmed)
+}
+
+func TestQueueTrackingDropped(t *testing.T) {
+	confirmer := &mockConfirmer{
+		states:    map[common.Hash]chain.TxState{common.HexToHash("0x01"): chain.TxDropped},
+		resendErr: chain.ErrNonceUsed,
+	}
+	q := NewQueue(&mockTxBuilder{}, 1, 1)
+	q.EnableTracking(confirmer, 1, 5*time.Millisecond)
+	q.Start()
+	defer q.Close(context.Background())
+
+	claim, err := q.Enqueue(context.Background(), "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", big.NewInt(1))
+	if err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	// Every retry is dropped again until the claim runs out of retries
+	got := waitForStatus(t, q, claim.ID, ClaimFailed)
+	if got.Retries != maxClaimRetries || got.Error != errTxDropped.Error() {
+		t.Errorf("claim retries = %d, error = %q", got.Retries, got.Error)
+	}
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestReceipts(t *testing.T) {
+	var sent map[string]interface{}
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&sent)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer api.Close()
+
+	mailer := &sendgridMailer{key: "key", from: "faucet@example.com", endpoint: api.URL}
+	explorer := &Explorer{template: "https://explorer.example/tx/{tx}"}
+	receipts, err := NewReceipts(mailer, "", explorer, "fuse", "FUSE")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claim := Claim{
+		ID:      "1",
+		Address: "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B",
+		Amount:  big.NewInt(1e18),
+		Status:  ClaimConfirmed,
+		TxHash:  common.HexToHash("0x01"),
+		email:   "user@example.com",
+	}
+	if err := receipts.send(context.Background(), claim); err != nil {
+		t.Fatalf("send() error = %v", err)
+	}
+	personalizations, _ := json.Marshal(sent["personalizations"])
+	if !strings.Contains(string(personalizations), "user@example.com") {
+		t.Errorf("receipt sent to %s, want user@example.com", personalizations)
+	}
+	content, _ := json.Marshal(sent["content"])
+	if !strings.Contains(string(content), "https://explorer.example/tx/"+claim.TxHash.Hex()) {
+		t.Errorf("receipt %s does not link the payout tx", content)
+	}
+
+	receipts.ClaimFinished(Claim{ID: "2", Status: ClaimConfirmed})
+	receipts.ClaimFinished(Claim{ID: "3", Status: ClaimFailed, email: "user@example.com"})
+	receipts.ClaimFinished(claim)
+	if len(receipts.claims) != 1 {
+		t.Errorf("%d receipts queued, want 1 for the paid claim with an email", len(receipts.claims))
+	}
+}
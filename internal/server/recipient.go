@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+type recipientReader interface {
+	bind.ContractCaller
+	BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error)
+}
+
+// rejectedRecipient explains why an address may not receive a payout
+type rejectedRecipient struct {
+	code string
+	args []interface{}
+}
+
+func (e *rejectedRecipient) Error() string {
+	return localize("en", e.code, e.args...)
+}
+
+// RecipientCheck refuses payouts to contracts, such as exchange deposit
+// addresses, and to accounts holding more than maxBalance. A nil maxBalance
+// disables the balance check
+type RecipientCheck struct {
+	client          recipientReader
+	rejectContracts bool
+	maxBalance      *big.Int
+	symbol          string
+}
+
+func NewRecipientCheck(client recipientReader, rejectContracts bool, maxBalance *big.Int, symbol string) *RecipientCheck {
+	return &RecipientCheck{client: client, rejectContracts: rejectContracts, maxBalance: maxBalance, symbol: symbol}
+}
+
+func (c *RecipientCheck) Enabled() bool {
+	return c.rejectContracts || c.maxBalance != nil
+}
+
+// Check returns a *rejectedRecipient if address may not be funded
+func (c *RecipientCheck) Check(ctx context.Context, address string) error {
+	if !c.Enabled() {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	account := common.HexToAddress(address)
+	if c.rejectContracts {
+		code, err := c.client.CodeAt(ctx, account, nil)
+		if err != nil {
+			return err
+		}
+		if len(code) > 0 {
+			return &rejectedRecipient{code: "contract_address"}
+		}
+	}
+	if c.maxBalance != nil {
+		balance, err := c.client.BalanceAt(ctx, account, nil)
+		if err != nil {
+			return err
+		}
+		if balance.Cmp(c.maxBalance) > 0 {
+			return &rejectedRecipient{code: "balance_too_high", args: []interface{}{chain.FormatEther(c.maxBalance), c.symbol}}
+		}
+	}
+	return nil
+}
+
+func (c *RecipientCheck) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	address, _ := readAddress(r)
+	if err := c.Check(r.Context(), address); err != nil {
+		var rejected *rejectedRecipient
+		if errors.As(err, &rejected) {
+			requestLog(r.Context()).WithFields(log.Fields{
+				"address": address,
+				"reason":  rejected.code,
+			}).Info("Claim rejected by recipient check")
+			flagClaim(r, rejected.code)
+			renderLocalized(w, r, http.StatusForbidden, rejected.code, rejected.args...)
+			return
+		}
+		requestLog(r.Context()).WithError(err).WithField("address", address).Error("Failed to check recipient")
+		renderLocalized(w, r, http.StatusServiceUnavailable, "eligibility_unavailable")
+		return
+	}
+	next.ServeHTTP(w, r)
+}
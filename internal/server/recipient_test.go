@@ -0,0 +1,66 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/urfave/negroni"
+)
+
+type mockRecipientReader struct {
+	code    map[common.Address][]byte
+	balance map[common.Address]*big.Int
+}
+
+func (m *mockRecipientReader) CodeAt(_ context.Context, account common.Address, _ *big.Int) ([]byte, error) {
+	return m.code[account], nil
+}
+
+func (m *mockRecipientReader) CallContract(_ context.Context, _ ethereum.CallMsg, _ *big.Int) ([]byte, error) {
+	return nil, nil
+}
+
+func (m *mockRecipientReader) BalanceAt(_ context.Context, account common.Address, _ *big.Int) (*big.Int, error) {
+	if balance, ok := m.balance[account]; ok {
+		return balance, nil
+	}
+	return new(big.Int), nil
+}
+
+func TestRecipientCheck(t *testing.T) {
+	contract := "0x829BD824B016326A401d083B33D092293333A830"
+	rich := "0x4976fb03C32e5B8cfe2b6cCB31c09Ba78EBaBa41"
+	reader := &mockRecipientReader{
+		code:    map[common.Address][]byte{common.HexToAddress(contract): {0x60, 0x80}},
+		balance: map[common.Address]*big.Int{common.HexToAddress(rich): big.NewInt(101)},
+	}
+	handler := negroni.New(NewRecipientCheck(reader, true, big.NewInt(100), "ETH"), negroni.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	tests := []struct {
+		name    string
+		address string
+		want    int
+	}{
+		{name: "eoa", address: "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", want: http.StatusOK},
+		{name: "contract", address: contract, want: http.StatusForbidden},
+		{name: "rich account", address: rich, want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := bytes.NewBufferString(`{"address":"` + tt.address + `"}`)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest("POST", "/api/claim", body))
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package server
+
+import (
+	"context"
+	"math/big"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/jellydator/ttlcache/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// riskIPMemory is how long an IP counts as known after its last claim
+	riskIPMemory = 24 * time.Hour
+	// riskBurstWindow and riskBurstClaims define rapid sequential claims from a subnet
+	riskBurstWindow = 10 * time.Minute
+	riskBurstClaims = 3
+)
+
+// Weights of the risk signals, which add up to a score between 0 and 100
+const (
+	riskNewIP        = 10
+	riskDatacenter   = 30
+	riskFreshAddress = 20
+	riskSubnetBurst  = 25
+	riskUserAgent    = 15
+)
+
+// datacenterKeywords identify hosting providers and VPNs in ASN organization names
+var datacenterKeywords = []string{
+	"amazon", "google", "microsoft", "digitalocean", "ovh", "hetzner", "linode", "akamai", "vultr",
+	"alibaba", "tencent", "oracle", "contabo", "scaleway", "leaseweb", "choopa", "m247", "datacamp",
+	"hosting", "cloud", "server", "vpn", "datacenter", "data center",
+}
+
+// automationAgents identify HTTP libraries and headless browsers in User-Agent headers
+var automationAgents = []string{
+	"curl", "wget", "python", "go-http-client", "okhttp", "java/", "node-fetch", "axios", "libwww",
+	"httpclient", "headless", "phantomjs", "selenium", "puppeteer", "playwright",
+}
+
+type riskKey struct{}
+
+// requestRisk returns the risk score of the claim, if it was scored
+func requestRisk(ctx context.Context) (int, bool) {
+	score, ok := ctx.Value(riskKey{}).(int)
+	return score, ok
+}
+
+type riskReader interface {
+	NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error)
+	BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error)
+}
+
+// RiskEngine scores claims by combining signals of abuse: an IP that has not
+// claimed before, a datacenter network, a fresh recipient address, rapid claims
+// from the same subnet and an automated User-Agent. Claims scoring captchaScore
+// or more must solve hCaptcha, those scoring denyScore or more are rejected.
+// A zero threshold disables that action. Claims tripping the tarpit, if one is
+// enabled, are held in it rather than rejected
+type RiskEngine struct {
+	client       riskReader
+	proxies      *Proxies
+	captchaScore int
+	denyScore    int
+	tarpit       *Tarpit
+	knownIPs     *ttlcache.Cache
+	mutex        sync.Mutex
+	subnets      *ttlcache.Cache
+}
+
+func NewRiskEngine(client riskReader, proxies *Proxies, captchaScore, denyScore int) *RiskEngine {
+	knownIPs := ttlcache.NewCache()
+	knownIPs.SkipTTLExtensionOnHit(true)
+	subnets := ttlcache.NewCache()
+	subnets.SkipTTLExtensionOnHit(true)
+	return &RiskEngine{
+		client:       client,
+		proxies:      proxies,
+		captchaScore: captchaScore,
+		denyScore:    denyScore,
+		knownIPs:     knownIPs,
+		subnets:      subnets,
+	}
+}
+
+// EnableTarpit holds claims tripping t in it
+func (e *RiskEngine) EnableTarpit(t *Tarpit) {
+	e.tarpit = t
+}
+
+func (e *RiskEngine) Enabled() bool {
+	return e.captchaScore > 0 || e.denyScore > 0 || e.tarpit.Enabled()
+}
+
+func (e *RiskEngine) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	// Requests with an API key come from trusted scripts, and exempt ones from trusted people
+	_, exempt := requestExemption(r.Context())
+	if _, ok := requestAPIKey(r.Context()); !e.Enabled() || ok || exempt {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	address, _ := readAddress(r)
+	clientIP := e.proxies.ClientIP(r)
+	score, signals := e.score(r, address, clientIP)
+	r = r.WithContext(context.WithValue(r.Context(), riskKey{}, score))
+	fields := log.Fields{
+		"address":   address,
+		"clientIP":  clientIP,
+		"riskScore": score,
+		"signals":   strings.Join(signals, ","),
+	}
+
+	if e.tarpit.Trips(score) {
+		requestLog(r.Context()).WithFields(fields).Warn("Claim tarpitted by risk score")
+		flagClaim(r, "tarpitted")
+		e.tarpit.serve(w, r, address)
+		return
+	}
+	if e.denyScore > 0 && score >= e.denyScore {
+		requestLog(r.Context()).WithFields(fields).Warn("Claim rejected by risk score")
+		flagClaim(r, "risk_too_high")
+		renderLocalized(w, r, http.StatusForbidden, "risk_too_high")
+		return
+	}
+	if e.captchaScore > 0 && score >= e.captchaScore {
+		requestLog(r.Context()).WithFields(fields).Info("Claim requires a captcha by risk score")
+		r = withStrictCaptcha(r)
+	} else {
+		requestLog(r.Context()).WithFields(fields).Debug("Claim risk scored")
+	}
+	next.ServeHTTP(w, r)
+}
+
+// score returns the sum of the weights of the signals the claim raises, and their names
+func (e *RiskEngine) score(r *http.Request, address, clientIP string) (int, []string) {
+	var score int
+	var signals []string
+	raise := func(signal string, weight int) {
+		score += weight
+		signals = append(signals, signal)
+	}
+
+	if _, err := e.knownIPs.Get(clientIP); err != nil {
+		raise("new_ip", riskNewIP)
+	}
+	e.knownIPs.SetWithTTL(clientIP, true, riskIPMemory)
+	if asn, ok := requestASN(r.Context()); ok && isDatacenter(asn.Organization) {
+		raise("datacenter", riskDatacenter)
+	}
+	if e.freshAddress(r.Context(), address) {
+		raise("fresh_address", riskFreshAddress)
+	}
+	if e.recordSubnetClaim(clientIP) >= riskBurstClaims {
+		raise("subnet_burst", riskSubnetBurst)
+	}
+	if isAutomatedAgent(r.UserAgent()) {
+		raise("user_agent", riskUserAgent)
+	}
+	if score > 100 {
+		score = 100
+	}
+	return score, signals
+}
+
+// freshAddress reports whether address has never sent a tx nor holds any funds
+func (e *RiskEngine) freshAddress(ctx context.Context, address string) bool {
+	if e.client == nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	account := common.HexToAddress(address)
+	nonce, err := e.client.NonceAt(ctx, account, nil)
+	if err != nil {
+		requestLog(ctx).WithError(err).WithField("address", address).Warn("Failed to fetch nonce for risk scoring")
+		return false
+	}
+	if nonce > 0 {
+		return false
+	}
+	balance, err := e.client.BalanceAt(ctx, account, nil)
+	if err != nil {
+		requestLog(ctx).WithError(err).WithField("address", address).Warn("Failed to fetch balance for risk scoring")
+		return false
+	}
+	return balance.Sign() == 0
+}
+
+// recordSubnetClaim counts the claim against the /24 or /48 subnet of the
+// client IP and returns the number of claims from it within the burst window
+func (e *RiskEngine) recordSubnetClaim(clientIP string) int {
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return 0
+	}
+	mask := net.CIDRMask(48, 128)
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, mask = ip4, net.CIDRMask(24, 32)
+	}
+	subnet := ip.Mask(mask).String()
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	now := time.Now()
+	var recent []time.Time
+	if cached, err := e.subnets.Get(subnet); err == nil {
+		for _, at := range cached.([]time.Time) {
+			if now.Sub(at) < riskBurstWindow {
+				recent = append(recent, at)
+			}
+		}
+	}
+	recent = append(recent, now)
+	e.subnets.SetWithTTL(subnet, recent, riskBurstWindow)
+	return len(recent)
+}
+
+func isDatacenter(organization string) bool {
+	organization = strings.ToLower(organization)
+	for _, keyword := range datacenterKeywords {
+		if strings.Contains(organization, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+func isAutomatedAgent(userAgent string) bool {
+	if userAgent == "" {
+		return true
+	}
+	userAgent = strings.ToLower(userAgent)
+	for _, agent := range automationAgents {
+		if strings.Contains(userAgent, agent) {
+			return true
+		}
+	}
+	return false
+}
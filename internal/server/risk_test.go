@@ -0,0 +1,104 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/urfave/negroni"
+)
+
+// accountReader reports the nonce and balance of every account as nonce and balance
+type accountReader struct {
+	nonce   uint64
+	balance int64
+}
+
+func (a accountReader) NonceAt(_ context.Context, _ common.Address, _ *big.Int) (uint64, error) {
+	return a.nonce, nil
+}
+
+func (a accountReader) BalanceAt(_ context.Context, _ common.Address, _ *big.Int) (*big.Int, error) {
+	return big.NewInt(a.balance), nil
+}
+
+func TestRiskEngine(t *testing.T) {
+	tests := []struct {
+		name      string
+		reader    accountReader
+		userAgent string
+		asn       string
+		want      int
+		signals   int
+	}{
+		{name: "browser", reader: accountReader{nonce: 4}, userAgent: "Mozilla/5.0", want: riskNewIP, signals: 1},
+		{name: "fresh address", userAgent: "Mozilla/5.0", want: riskNewIP + riskFreshAddress, signals: 2},
+		{name: "script", reader: accountReader{balance: 1}, userAgent: "python-requests/2.31", want: riskNewIP + riskUserAgent, signals: 2},
+		{name: "datacenter", reader: accountReader{nonce: 1}, asn: "DIGITALOCEAN-ASN", want: riskNewIP + riskDatacenter + riskUserAgent, signals: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := NewRiskEngine(tt.reader, nil, 50, 80)
+			r := httptest.NewRequest("POST", "/api/claim", bytes.NewBufferString(`{"address":"0x0000000000000000000000000000000000000001"}`))
+			r.Header.Set("User-Agent", tt.userAgent)
+			if tt.asn != "" {
+				r = r.WithContext(context.WithValue(r.Context(), asnKey{}, asnRecord{Organization: tt.asn}))
+			}
+			score, signals := engine.score(r, "0x0000000000000000000000000000000000000001", "192.0.2.1")
+			if score != tt.want || len(signals) != tt.signals {
+				t.Errorf("score = %d %v, want %d with %d signals", score, signals, tt.want, tt.signals)
+			}
+		})
+	}
+}
+
+func TestRiskEngineThresholds(t *testing.T) {
+	engine := NewRiskEngine(accountReader{}, nil, riskFreshAddress+riskSubnetBurst, riskFreshAddress+riskSubnetBurst+riskUserAgent)
+	var scores []int
+	var strict []bool
+	handler := negroni.New(engine, negroni.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		score, _ := requestRisk(r.Context())
+		scores = append(scores, score)
+		strict = append(strict, strictCaptcha(r.Context()))
+	})))
+	claim := func(ip, userAgent string) int {
+		r := httptest.NewRequest("POST", "/api/claim", bytes.NewBufferString(`{"address":"0x0000000000000000000000000000000000000001"}`))
+		r.RemoteAddr = ip + ":1234"
+		r.Header.Set("User-Agent", userAgent)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec.Code
+	}
+
+	// The first two claims from the subnet are new IPs with a fresh address
+	for _, ip := range []string{"198.51.100.1", "198.51.100.2"} {
+		if code := claim(ip, "Mozilla/5.0"); code != http.StatusOK {
+			t.Fatalf("claim from %s: status = %d, want %d", ip, code, http.StatusOK)
+		}
+	}
+	// The third is a subnet burst and must solve a captcha
+	if code := claim("198.51.100.1", "Mozilla/5.0"); code != http.StatusOK {
+		t.Fatalf("burst claim: status = %d, want %d", code, http.StatusOK)
+	}
+	// A scripted burst claim is rejected
+	if code := claim("198.51.100.1", "curl/8.0"); code != http.StatusForbidden {
+		t.Fatalf("scripted claim: status = %d, want %d", code, http.StatusForbidden)
+	}
+
+	want := []int{riskNewIP + riskFreshAddress, riskNewIP + riskFreshAddress, riskFreshAddress + riskSubnetBurst}
+	if len(scores) != len(want) {
+		t.Fatalf("scores = %v, want %v", scores, want)
+	}
+	for i := range want {
+		if scores[i] != want[i] {
+			t.Errorf("scores = %v, want %v", scores, want)
+		}
+		if strict[i] != (i == 2) {
+			t.Errorf("claim %d strict captcha = %v", i, strict[i])
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jellydator/ttlcache/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+const passportSubmitURL = "https://api.scorer.gitcoin.co/registry/submit-passport"
+
+type Scorer interface {
+	Score(ctx context.Context, address string) (float64, error)
+}
+
+// NewScorer returns the Gitcoin Passport scorer if an API key is given,
+// otherwise a scorer posting to webhookURL, or nil if neither is configured
+func NewScorer(passportAPIKey, passportScorerID, webhookURL string) Scorer {
+	switch {
+	case passportAPIKey != "":
+		return &passportScorer{apiKey: passportAPIKey, scorerID: passportScorerID}
+	case webhookURL != "":
+		return &webhookScorer{url: webhookURL}
+	default:
+		return nil
+	}
+}
+
+type passportScorer struct {
+	apiKey   string
+	scorerID string
+}
+
+func (p *passportScorer) Score(ctx context.Context, address string) (float64, error) {
+	body, _ := json.Marshal(map[string]string{"address": address, "scorer_id": p.scorerID})
+	req, err := http.NewRequestWithContext(ctx, "POST", passportSubmitURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-KEY", p.apiKey)
+
+	var resp struct {
+		Score  string `json:"score"`
+		Status string `json:"status"`
+	}
+	if err := doJSON(req, &resp); err != nil {
+		return 0, err
+	}
+	if resp.Status != "DONE" {
+		return 0, fmt.Errorf("passport score is %s", resp.Status)
+	}
+	return strconv.ParseFloat(resp.Score, 64)
+}
+
+// webhookScorer posts {"address": ...} and expects {"score": <number>} in return
+type webhookScorer struct {
+	url string
+}
+
+func (s *webhookScorer) Score(ctx context.Context, address string) (float64, error) {
+	body, _ := json.Marshal(map[string]string{"address": address})
+	req, err := http.NewRequestWithContext(ctx, "POST", s.url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var resp struct {
+		Score float64 `json:"score"`
+	}
+	if err := doJSON(req, &resp); err != nil {
+		return 0, err
+	}
+	return resp.Score, nil
+}
+
+// Eligibility rejects claims whose address scores below minScore, or caps their
+// payout at reducedPayout when one is configured
+type Eligibility struct {
+	scorer        Scorer
+	minScore      float64
+	reducedPayout *big.Int
+	cache         *ttlcache.Cache
+	cacheTTL      time.Duration
+}
+
+func NewEligibility(scorer Scorer, minScore float64, reducedPayout *big.Int, cacheTTL time.Duration) *Eligibility {
+	cache := ttlcache.NewCache()
+	cache.SkipTTLExtensionOnHit(true)
+	return &Eligibility{
+		scorer:        scorer,
+		minScore:      minScore,
+		reducedPayout: reducedPayout,
+		cache:         cache,
+		cacheTTL:      cacheTTL,
+	}
+}
+
+func (e *Eligibility) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	if e.scorer == nil {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	address, _ := readAddress(r)
+	score, err := e.score(r.Context(), address)
+	if err != nil {
+		requestLog(r.Context()).WithError(err).WithField("address", address).Error("Failed to score address")
+		renderLocalized(w, r, http.StatusServiceUnavailable, "eligibility_unavailable")
+		return
+	}
+	if score >= e.minScore {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	requestLog(r.Context()).WithFields(log.Fields{
+		"address": address,
+		"score":   score,
+	}).Info("Address scored below the eligibility threshold")
+	if e.reducedPayout != nil {
+		next.ServeHTTP(w, withPayoutLimit(r, e.reducedPayout))
+		return
+	}
+	flagClaim(r, "score_too_low")
+	renderLocalized(w, r, http.StatusForbidden, "score_too_low", score, e.minScore)
+}
+
+func (e *Eligibility) score(ctx context.Context, address string) (float64, error) {
+	if cached, err := e.cache.Get(address); err == nil {
+		return cached.(float64), nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	score, err := e.scorer.Score(ctx, address)
+	if err != nil {
+		return 0, err
+	}
+	e.cache.SetWithTTL(address, score, e.cacheTTL)
+	return score, nil
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"bytes"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/urfave/negroni"
+)
+
+func TestEligibility(t *testing.T) {
+	calls := 0
+	scoreServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(`{"score": 5}`))
+	}))
+	defer scoreServer.Close()
+
+	tests := []struct {
+		name       string
+		minScore   float64
+		reduced    *big.Int
+		wantStatus int
+		wantLimit  *big.Int
+	}{
+		{name: "eligible", minScore: 5, wantStatus: http.StatusOK},
+		{name: "rejected", minScore: 10, wantStatus: http.StatusForbidden},
+		{name: "reduced", minScore: 10, reduced: big.NewInt(1), wantStatus: http.StatusOK, wantLimit: big.NewInt(1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotLimit *big.Int
+			eligibility := NewEligibility(NewScorer("", "", scoreServer.URL), tt.minScore, tt.reduced, time.Minute)
+			handler := negroni.New(eligibility, negroni.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotLimit = payoutLimit(r.Context())
+			})))
+
+			for i := 0; i < 2; i++ {
+				body := bytes.NewBufferString(`{"address":"0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"}`)
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, httptest.NewRequest("POST", "/api/claim", body))
+				if rec.Code != tt.wantStatus {
+					t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+				}
+				if (gotLimit == nil) != (tt.wantLimit == nil) || (gotLimit != nil && gotLimit.Cmp(tt.wantLimit) != 0) {
+					t.Errorf("payout limit = %v, want %v", gotLimit, tt.wantLimit)
+				}
+			}
+		})
+	}
+	if calls != len(tests) {
+		t.Errorf("scorer called %d times, want %d with caching", calls, len(tests))
+	}
+}
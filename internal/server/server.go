@@ -2,46 +2,682 @@ package server
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math/big"
 	"net/http"
+	"net/mail"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
 	log "github.com/sirupsen/logrus"
 	"github.com/urfave/negroni"
+	"google.golang.org/grpc"
 
 	"github.com/chainflag/eth-faucet/internal/chain"
-	"github.com/chainflag/eth-faucet/web"
 )
 
 type Server struct {
 	chain.TxBuilder
-	cfg *Config
+	mutex      sync.RWMutex
+	cfg        *Config
+	proxies    *Proxies
+	client     chain.Client
+	httpServer *http.Server
+	redirect   *http.Server
+	tls        *TLS
+	grpcServer *grpc.Server
+	gateway    http.Handler
+	ctx        context.Context
+	cancel     context.CancelFunc
+	// streams is done once claim status streams must end for a shutdown
+	streams    context.Context
+	endStreams context.CancelFunc
+	queue      *Queue
+	limiter    *Limiter
+	captcha    *Captcha
+	pow        *ProofOfWork
+	policy     *PayoutPolicy
+	balance    *BalanceMonitor
+	github     *GithubAuth
+	scoring    *Eligibility
+	denylist   *AccessList
+	allowlist  *AccessList
+	apiKeys    *APIKeys
+	claimCap   *ClaimCap
+	claims     *ClaimStore
+	telegram   *TelegramBot
+	names      *NameResolution
+	native     *NativeAddresses
+	screening  *RecipientCheck
+	geoip      *GeoIP
+	webhooks   *Webhooks
+	budget     *Budget
+	tokenGate  *TokenGate
+	signIn     *SignIn
+	throttle   *Throttle
+	explorer   *Explorer
+	receipts   *Receipts
+	risk       *RiskEngine
+	tarpit     *Tarpit
+	downtime   *Maintenance
+	network    *NetworkCheck
+	canaries   *CanaryPolicies
+	frontends  *Frontends
+	validation *ClaimValidation
+	choices    *PayoutChoices
+	purposes   *Purposes
+	idempotent *Idempotency
+	subs       *Subscriptions
+	topUps     *TopUps
+	clusters   *Clustering
+	exempt     *Exemptions
+	snapshots  *Snapshots
+	partners   *ClaimTokens
+	reports    *AbuseReports
+	fiat       *FiatPayout
+	stats      *Stats
 }
 
-func NewServer(builder chain.TxBuilder, cfg *Config) *Server {
-	return &Server{
-		TxBuilder: builder,
-		cfg:       cfg,
+func NewServer(builder chain.TxBuilder, client chain.Client, cfg *Config) (*Server, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
 	}
+	// Chains paid out through an adapter have no JSON-RPC client to look into accounts with
+	if client == nil && (cfg.PayoutTiersPath != "" || cfg.RejectContracts || cfg.MaxClaimerBalance != "" ||
+		(cfg.GateToken != "" && cfg.GateProvider == "") || cfg.TopUpInterval > 0) {
+		return nil, errors.New("payout tiers, recipient checks, token gating on the same chain and top-ups require an EVM chain")
+	}
+	var balances balanceReader = client
+	if reader, ok := builder.(balanceReader); ok && client == nil {
+		balances = reader
+	}
+	codec, _ := builder.(chain.AddressCodec)
+	policy, err := LoadPayoutPolicy(client, chain.EtherToWei(int64(cfg.Payout)), cfg.PayoutTiersPath)
+	if err != nil {
+		return nil, err
+	}
+	var fiat *FiatPayout
+	if cfg.PayoutFiat != "" {
+		amount, ok := new(big.Rat).SetString(cfg.PayoutFiat)
+		if !ok || amount.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid fiat payout %q", cfg.PayoutFiat)
+		}
+		maxPayout, err := chain.ParseEther(cfg.PayoutFiatMax)
+		if err != nil || maxPayout.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid maximum fiat payout %q", cfg.PayoutFiatMax)
+		}
+		var priceClient bind.ContractCaller = client
+		if cfg.PriceProvider != "" {
+			if priceClient, err = chain.Dial(cfg.PriceProvider); err != nil {
+				return nil, fmt.Errorf("cannot connect to price feed provider: %w", err)
+			}
+		}
+		if cfg.PriceFeed != "" && priceClient == nil {
+			return nil, errors.New("a price feed requires an EVM chain or a price feed provider")
+		}
+		fiat = NewFiatPayout(NewPriceSource(priceClient, cfg.PriceFeed, cfg.PriceCoin, cfg.PriceCurrency), amount, maxPayout, cfg.PriceCurrency, cfg.PriceInterval)
+		policy.fiat = fiat
+	}
+	denylist, err := LoadAccessList(cfg.DenylistPath)
+	if err != nil {
+		return nil, err
+	}
+	var allowlist *AccessList
+	if cfg.AllowlistPath != "" {
+		if allowlist, err = LoadAccessList(cfg.AllowlistPath); err != nil {
+			return nil, err
+		}
+	}
+	var exemptList *AccessList
+	if cfg.ExemptListPath != "" {
+		if exemptList, err = LoadAccessList(cfg.ExemptListPath); err != nil {
+			return nil, err
+		}
+	}
+	partnerSecrets, err := ParsePartnerSecrets(cfg.PartnerSecrets)
+	if err != nil {
+		return nil, err
+	}
+	apiKeys, err := LoadAPIKeys(cfg.APIKeysPath)
+	if err != nil {
+		return nil, err
+	}
+	choices, err := ParsePayoutChoices(cfg.PayoutChoices)
+	if err != nil {
+		return nil, err
+	}
+	purposes, err := ParsePurposes(cfg.Purposes)
+	if err != nil {
+		return nil, err
+	}
+	proxies, err := NewProxies(cfg.ProxyCount, cfg.TrustedProxies, cfg.ProxyHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	minBalance, err := chain.ParseEther(cfg.MinBalance)
+	if err != nil {
+		return nil, err
+	}
+	var limits []*big.Int
+	for _, alert := range cfg.BalanceAlerts {
+		limit, err := chain.ParseEther(alert)
+		if err != nil {
+			return nil, err
+		}
+		limits = append(limits, limit)
+	}
+	var capAmount *big.Int
+	if cfg.CapAmount != "" {
+		if capAmount, err = chain.ParseEther(cfg.CapAmount); err != nil {
+			return nil, err
+		}
+	}
+	stateKey, err := ParseStateKey(cfg.StateKey)
+	if err != nil {
+		return nil, err
+	}
+	frontends, err := LoadFrontends(cfg.FrontendsPath, stateKey)
+	if err != nil {
+		return nil, err
+	}
+	subs, err := LoadSubscriptions(cfg.SubscriptionsPath, stateKey)
+	if err != nil {
+		return nil, err
+	}
+	subs.SetMaxThreshold(chain.EtherToWei(int64(cfg.Payout)))
+	claimStore, err := LoadClaimStore(cfg.ClaimStorePath, stateKey, cfg.CapPeriod)
+	if err != nil {
+		return nil, err
+	}
+	var maxClaimerBalance *big.Int
+	if cfg.MaxClaimerBalance != "" {
+		if maxClaimerBalance, err = chain.ParseEther(cfg.MaxClaimerBalance); err != nil {
+			return nil, err
+		}
+	}
+	var hourlyBudget, dailyBudget *big.Int
+	if cfg.HourlyBudget != "" {
+		if hourlyBudget, err = chain.ParseEther(cfg.HourlyBudget); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.DailyBudget != "" {
+		if dailyBudget, err = chain.ParseEther(cfg.DailyBudget); err != nil {
+			return nil, err
+		}
+	}
+	var geoReducedPayout *big.Int
+	if cfg.GeoReducedPayout != "" {
+		if geoReducedPayout, err = chain.ParseEther(cfg.GeoReducedPayout); err != nil {
+			return nil, err
+		}
+	}
+	geoip, err := OpenGeoIP(cfg.GeoIPPath, cfg.ASNPath, proxies)
+	if err != nil {
+		return nil, err
+	}
+	geoip.SetPolicies(cfg.GeoBlock, cfg.GeoCaptcha, cfg.GeoReduce, geoReducedPayout)
+	if err := geoip.SetASNPolicies(cfg.ASNBlock, cfg.ASNStrict, time.Duration(cfg.ASNStrictInterval)*time.Minute); err != nil {
+		geoip.Close()
+		return nil, err
+	}
+	var resolver addressResolver
+	if cfg.ENSProvider != "" {
+		ensClient, err := chain.Dial(cfg.ENSProvider)
+		if err != nil {
+			return nil, fmt.Errorf("cannot connect to name resolver provider: %w", err)
+		}
+		resolver = chain.NewNameResolver(ensClient, common.HexToAddress(cfg.ENSRegistry))
+	}
+	var gateClient bind.ContractCaller
+	var gateMinBalance *big.Int
+	if cfg.GateToken != "" {
+		if gateMinBalance, err = chain.ParseUnits(cfg.GateMinBalance, cfg.GateDecimals); err != nil {
+			return nil, err
+		}
+		gateClient = client
+		if cfg.GateProvider != "" {
+			if gateClient, err = chain.Dial(cfg.GateProvider); err != nil {
+				return nil, fmt.Errorf("cannot connect to gating token provider: %w", err)
+			}
+		}
+	}
+	var reducedPayout *big.Int
+	if cfg.ReducedPayout != "" {
+		if reducedPayout, err = chain.ParseEther(cfg.ReducedPayout); err != nil {
+			return nil, err
+		}
+	}
+	scorer := NewScorer(cfg.PassportAPIKey, cfg.PassportScorerID, cfg.ScoreWebhook)
+	notifier := NewNotifier(cfg.AlertWebhook, cfg.TelegramToken, cfg.TelegramChatID)
+	limiter := NewLimiter(proxies, time.Duration(cfg.Interval)*time.Minute,
+		cfg.IPv4Prefix, cfg.IPv6Prefix, time.Duration(cfg.SubnetInterval)*time.Minute)
+	limiter.SetPolicy(cfg.LimitMode, cfg.LimitClaims)
+	snapshots := NewSnapshots(limiter, cfg.LimiterStatePath, stateKey, cfg.LimiterSnapshot)
+	if err := snapshots.Restore(); err != nil {
+		return nil, err
+	}
+	canaries, err := LoadCanaryPolicies(cfg.CanaryPoliciesPath, func(spec PolicySpec) (negroni.Handler, error) {
+		switch spec.Kind {
+		case PolicyLimiter:
+			l := NewLimiter(proxies, time.Duration(spec.Minutes)*time.Minute,
+				cfg.IPv4Prefix, cfg.IPv6Prefix, time.Duration(spec.SubnetMinutes)*time.Minute)
+			l.SetPolicy(spec.LimitMode, spec.Claims)
+			return l, nil
+		case PolicyRisk:
+			return NewRiskEngine(client, proxies, spec.CaptchaScore, spec.DenyScore), nil
+		default:
+			if scorer == nil {
+				return nil, errors.New("eligibility policies need a reputation scorer")
+			}
+			return NewEligibility(scorer, spec.MinScore, nil, cfg.ScoreCacheTTL), nil
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	queue := NewQueue(builder, cfg.QueueWorkers, cfg.QueueSize)
+	weights, err := ParsePriorityWeights(cfg.QueueWeights)
+	if err != nil {
+		return nil, err
+	}
+	queue.SetPriorities(weights, cfg.QueueMaxWait)
+	if cfg.BatchSize > 1 {
+		batcher, ok := builder.(chain.BatchTxBuilder)
+		if !ok {
+			return nil, errors.New("tx builder does not support batched payouts")
+		}
+		queue.EnableBatching(batcher, cfg.BatchSize, cfg.BatchWindow)
+	}
+	if cfg.DryRun {
+		queue.EnableDryRun()
+	}
+	// Simulated payouts never get a receipt to track
+	if cfg.Confirmations > 0 && !cfg.DryRun {
+		confirmer, ok := builder.(chain.Confirmer)
+		if !ok {
+			return nil, errors.New("tx builder does not support confirmation tracking")
+		}
+		queue.EnableTracking(confirmer, cfg.Confirmations, cfg.ConfirmInterval)
+	}
+	if replacer, ok := builder.(chain.Replacer); ok {
+		replacer.OnReplace(queue.Replaced)
+	}
+	queue.OnFinal(NewPayoutAlerts(notifier, cfg.Network).ClaimFinished)
+	queue.OnFinal(RollbackFailed)
+	if claimStore.Persistent() {
+		queue.OnFinal(claimStore.ClaimFinished)
+	}
+	webhooks := NewWebhooks(cfg.WebhookURLs, cfg.WebhookSecret, proxies)
+	if webhooks.Enabled() {
+		queue.OnFinal(webhooks.ClaimFinished)
+	}
+	pow := NewProofOfWork(cfg.PowDifficulty)
+	var chainID *big.Int
+	if identifier, ok := builder.(chain.ChainIdentifier); ok {
+		chainID = identifier.ChainID()
+	}
+
+	explorer, err := NewExplorer(chainID, cfg.ExplorerTemplates, cfg.ExplorerURL)
+	if err != nil {
+		return nil, err
+	}
+	mailer, err := NewMailer(cfg.EmailSMTP, cfg.EmailSendgridKey, cfg.EmailFrom)
+	if err != nil {
+		return nil, err
+	}
+	receipts, err := NewReceipts(mailer, cfg.EmailTemplate, explorer, cfg.Network, cfg.Symbol)
+	if err != nil {
+		return nil, err
+	}
+	if receipts.Enabled() {
+		queue.OnFinal(receipts.ClaimFinished)
+	}
+
+	downtime, err := NewMaintenance(cfg.MaintenanceCron, cfg.MaintenanceLength, cfg.MaintenanceMessage)
+	if err != nil {
+		return nil, err
+	}
+
+	// Funds sent back to the faucet are no sweep
+	clusters := NewClustering(claimStore, client, proxies, denylist, append(holders(builder), senders(builder)...),
+		cfg.ClusterInterval, cfg.ClusterWindow, cfg.ClusterSize, cfg.ClusterAction, cfg.ClusterCooldown)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	streams, endStreams := context.WithCancel(ctx)
+	s := &Server{
+		TxBuilder:  builder,
+		cfg:        cfg,
+		proxies:    proxies,
+		client:     client,
+		ctx:        ctx,
+		cancel:     cancel,
+		streams:    streams,
+		endStreams: endStreams,
+		queue:      queue,
+		limiter:    limiter,
+		captcha:    NewCaptcha(cfg.HcaptchaSiteKey, cfg.HcaptchaSecret, pow, proxies, cfg.CaptchaCacheTTL, cfg.CaptchaFailMode, cfg.CaptchaFailOpenTTL),
+		pow:        pow,
+		policy:     policy,
+		github:     NewGithubAuth(cfg.GithubClientID, cfg.GithubClientSecret, cfg.OAuthRedirectURL, time.Duration(cfg.Interval)*time.Minute),
+		scoring:    NewEligibility(scorer, cfg.MinScore, reducedPayout, cfg.ScoreCacheTTL),
+		balance:    NewBalanceMonitor(balances, holders(builder), cfg.Symbol, cfg.BalanceInterval, minBalance, limits, notifier),
+		denylist:   denylist,
+		allowlist:  allowlist,
+		apiKeys:    apiKeys,
+		claimCap:   NewClaimCap(claimStore, cfg.CapClaims, capAmount, cfg.CapPeriod),
+		claims:     claimStore,
+		names:      NewNameResolution(resolver, cfg.ENSCacheTTL, proxies),
+		native:     NewNativeAddresses(codec),
+		screening:  NewRecipientCheck(client, cfg.RejectContracts, maxClaimerBalance, cfg.Symbol),
+		geoip:      geoip,
+		webhooks:   webhooks,
+		explorer:   explorer,
+		receipts:   receipts,
+		throttle:   NewThrottle(proxies, cfg.ThrottleRate, cfg.ThrottleBurst),
+		signIn:     NewSignIn(cfg.SIWEDomain, chainID),
+		validation: NewClaimValidation(chainID, cfg.Symbol, purposes),
+		tokenGate:  NewTokenGate(gateClient, common.HexToAddress(cfg.GateToken), gateMinBalance, cfg.GateCacheTTL),
+		downtime:   downtime,
+		network:    NewNetworkCheck(client),
+		frontends:  frontends,
+		choices:    choices,
+		purposes:   purposes,
+		idempotent: NewIdempotency(cfg.IdempotencyTTL, proxies),
+		subs:       subs,
+		clusters:   clusters,
+		exempt:     NewExemptions(proxies, exemptList),
+		snapshots:  snapshots,
+		partners:   NewClaimTokens(partnerSecrets),
+		risk:       NewRiskEngine(client, proxies, cfg.RiskCaptchaScore, cfg.RiskDenyScore),
+		canaries:   canaries,
+		fiat:       fiat,
+		stats:      NewStats(claimStore, webhooks),
+		tarpit:     NewTarpit(cfg.TarpitScore, cfg.TarpitDelay, cfg.TarpitJitter, cfg.TarpitMode),
+		budget:     NewBudget(cfg.HourlyBudgetClaims, hourlyBudget, cfg.DailyBudgetClaims, dailyBudget),
+	}
+	s.risk.EnableTarpit(s.tarpit)
+	fraud := NewWebhooks(cfg.AbuseWebhooks, cfg.WebhookSecret, proxies)
+	s.reports = NewAbuseReports(s.partners, denylist, claimStore, webhooks, fraud, cfg.AbuseWindow)
+
+	if cfg.TelegramBotToken != "" {
+		s.telegram = NewTelegramBot(s, cfg.TelegramBotToken)
+	}
+	s.topUps = NewTopUps(s, client, subs, cfg.TopUpInterval, cfg.TopUpCooldown)
+
+	service := newGRPCService(s)
+	if s.gateway, err = newGateway(s.ctx, service); err != nil {
+		return nil, err
+	}
+	if cfg.GRPCPort != 0 {
+		s.grpcServer = newGRPCServer(service)
+	}
+
+	cors := NewCors(cfg.CorsOrigins, cfg.CorsMethods, cfg.CorsHeaders, cfg.CorsCredentials)
+	headers := NewSecurityHeaders(cfg.FrameOptions, cfg.HSTSMaxAge, cfg.HSTSSubdomains)
+	n := negroni.New(negroni.NewRecovery(), headers, NewTracing(), NewRequestLogger(proxies), cors, s.throttle)
+	n.UseHandler(s.setupRouter())
+	s.httpServer = &http.Server{
+		Addr:    ":" + strconv.Itoa(cfg.HTTPPort),
+		Handler: n,
+	}
+	s.tls = NewTLS(cfg.TLSCert, cfg.TLSKey, cfg.TLSDomains, cfg.TLSCacheDir, cfg.TLSEmail)
+	if s.tls.Enabled() {
+		s.tls.apply(s.httpServer)
+		if cfg.TLSRedirectPort > 0 {
+			s.redirect = s.tls.redirectServer(cfg.TLSRedirectPort, cfg.HTTPPort)
+		}
+	}
+	return s, nil
+}
+
+// holders returns the accounts holding the funds paid out, which is the
+// faucet contract if the tx builder pays out through one
+func holders(builder chain.TxBuilder) []common.Address {
+	if faucet, ok := builder.(chain.FaucetContract); ok {
+		if contract, ok := faucet.Faucet(); ok {
+			return []common.Address{contract}
+		}
+	}
+	return senders(builder)
+}
+
+// formatAddress returns account in the address format of the chain
+func (s *Server) formatAddress(account common.Address) string {
+	if codec, ok := s.TxBuilder.(chain.AddressCodec); ok {
+		return codec.FormatAddress(account)
+	}
+	return account.Hex()
+}
+
+// senders returns every funder account of the tx builder
+func senders(builder chain.TxBuilder) []common.Address {
+	if multi, ok := builder.(chain.MultiSender); ok {
+		return multi.Senders()
+	}
+	return []common.Address{builder.Sender()}
 }
 
 func (s *Server) setupRouter() *http.ServeMux {
 	router := http.NewServeMux()
-	router.Handle("/", http.FileServer(web.Dist()))
-	limiter := NewLimiter(s.cfg.proxyCount, time.Duration(s.cfg.interval)*time.Minute)
-	hcaptcha := NewCaptcha(s.cfg.hcaptchaSiteKey, s.cfg.hcaptchaSecret)
-	router.Handle("/api/claim", negroni.New(limiter, hcaptcha, negroni.Wrap(s.handleClaim())))
-	router.Handle("/api/info", s.handleInfo())
+	router.Handle("/", s.handleWeb())
+	router.Handle("/api/claim", s.claimPipeline())
+	router.Handle("/api/claim/", s.handleClaimStatus())
+	router.Handle("/api/v1/", s.gateway)
+	router.Handle("/api/pow", s.pow.handleChallenge())
+	router.Handle("/api/siwe/nonce", s.signIn.handleNonce())
+	if s.partners.Enabled() {
+		router.Handle("/api/partner/tokens", s.partners.handleMint())
+		router.Handle("/api/partner/reports", s.reports.handleReport())
+	}
+	if s.topUps.Enabled() {
+		router.Handle("/api/subscriptions", negroni.New(s.apiKeys, negroni.Wrap(handleSubscriptions(s.subs, s.denylist))))
+	}
+
+	if s.github.Enabled() {
+		router.Handle("/auth/github/login", s.github.handleLogin())
+		router.Handle("/auth/github/callback", s.github.handleCallback())
+	}
+	if s.cfg.AdminToken != "" {
+		router.Handle("/admin/denylist", adminAuth(s.cfg.AdminToken, handleAccessList(s.denylist)))
+		if s.allowlist != nil {
+			router.Handle("/admin/allowlist", adminAuth(s.cfg.AdminToken, handleAccessList(s.allowlist)))
+		}
+		if s.exempt.list != nil {
+			router.Handle("/admin/exempt", adminAuth(s.cfg.AdminToken, handleAccessList(s.exempt.list)))
+		}
+		router.Handle("/admin/bypass", adminAuth(s.cfg.AdminToken, handleBypassTokens(s.exempt)))
+		router.Handle("/admin/apikeys", adminAuth(s.cfg.AdminToken, handleAPIKeys(s.apiKeys)))
+		router.Handle("/admin/frontends", adminAuth(s.cfg.AdminToken, handleFrontends(s.frontends, s.apiKeys)))
+		router.Handle("/admin/maintenance", adminAuth(s.cfg.AdminToken, handleMaintenance(s.downtime)))
+		router.Handle("/admin/stats", adminAuth(s.cfg.AdminToken, s.stats.handleStats(true)))
+		if s.claims.Persistent() {
+			router.Handle("/admin/claims/export", adminAuth(s.cfg.AdminToken, handleClaimsExport(s.claims)))
+		}
+		if s.clusters.Enabled() {
+			router.Handle("/admin/clusters", adminAuth(s.cfg.AdminToken, handleClusters(s.clusters)))
+		}
+		if s.canaries.Enabled() {
+			router.Handle("/admin/policies", adminAuth(s.cfg.AdminToken, s.canaries.handlePolicies()))
+		}
+	}
+	router.Handle("/api/info", negroni.New(s.apiKeys, negroni.Wrap(s.handleInfo())))
+	router.Handle("/api/stats", s.stats.handleStats(false))
+	router.Handle("/healthz", s.handleHealth())
+	router.Handle("/metrics", handleMetrics(s.captcha, s.network, s.canaries))
+	router.Handle("/readyz", s.handleReady())
 
 	return router
 }
 
+// claimPipeline returns the checks claims go through before they are queued
+func (s *Server) claimPipeline() http.Handler {
+	acl := NewAccessControl(s.proxies, s.denylist, s.allowlist)
+	return negroni.New(s.idempotent, s.stats, s.validation, s.downtime, s.network, s.webhooks, s.balance, s.native, s.names, acl, s.geoip, s.apiKeys, s.exempt, s.partners, s.frontends, s.github, s.clusters, s.choices, s.limiter, s.risk, s.canaries, s.captcha, s.signIn, s.screening, s.tokenGate, s.scoring, negroni.Wrap(s.handleClaim()))
+}
+
 func (s *Server) Run() {
-	n := negroni.New(negroni.NewRecovery(), negroni.NewLogger())
-	n.UseHandler(s.setupRouter())
-	log.Infof("Starting http server %d", s.cfg.httpPort)
-	log.Fatal(http.ListenAndServe(":"+strconv.Itoa(s.cfg.httpPort), n))
+	s.queue.Start()
+	go s.balance.Run(s.ctx)
+	go s.stats.Run(s.ctx)
+	if s.telegram != nil {
+		go s.telegram.Run(s.ctx)
+	}
+	if s.webhooks.Enabled() {
+		go s.webhooks.Run(s.ctx)
+	}
+	if s.throttle.Enabled() {
+		go s.throttle.Run(s.ctx)
+	}
+	if s.names.Enabled() {
+		go s.names.Run(s.ctx)
+	}
+	if s.receipts.Enabled() {
+		go s.receipts.Run(s.ctx)
+	}
+	if s.topUps.Enabled() {
+		go s.topUps.Run(s.ctx)
+	}
+	if s.clusters.Enabled() {
+		go s.clusters.Run(s.ctx)
+	}
+	if s.snapshots.Enabled() {
+		go s.snapshots.Run(s.ctx)
+	}
+	if s.fiat.Enabled() {
+		go s.fiat.Run(s.ctx)
+	}
+	if s.reports.Enabled() {
+		go s.reports.Run(s.ctx)
+	}
+	if s.grpcServer != nil {
+		go s.serveGRPC()
+	}
+	if s.redirect != nil {
+		go s.serveRedirect()
+	}
+	var err error
+	if s.tls.Enabled() {
+		log.Infof("Starting https server %d", s.config().HTTPPort)
+		err = s.tls.listenAndServe(s.httpServer)
+	} else {
+		log.Infof("Starting http server %d", s.config().HTTPPort)
+		err = s.httpServer.ListenAndServe()
+	}
+	if err != nil && err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
+
+// serveRedirect redirects plain HTTP requests to the HTTPS server
+func (s *Server) serveRedirect() {
+	log.Infof("Starting http redirect server %d", s.config().TLSRedirectPort)
+	if err := s.redirect.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
+
+// Shutdown stops accepting requests, waits for queued payouts to be sent and
+// persists the limiter state, giving up on whatever is left once ctx is done
+func (s *Server) Shutdown(ctx context.Context) error {
+	// Open claim status streams would hold up the http shutdown until the
+	// deadline, so they end first, and the queue is drained meanwhile so that
+	// in-flight payouts get the whole shutdown timeout
+	s.endStreams()
+	drained := make(chan error, 1)
+	go func() {
+		drained <- s.queue.Close(ctx)
+	}()
+
+	log.Info("Shutting down http server")
+	err := s.httpServer.Shutdown(ctx)
+	if s.redirect != nil {
+		s.redirect.Shutdown(ctx)
+	}
+	if s.grpcServer != nil {
+		s.stopGRPC(ctx)
+	}
+	if drainErr := <-drained; drainErr != nil {
+		log.WithError(drainErr).Error("Payout queue was not drained before shutdown")
+		err = drainErr
+	}
+	s.cancel()
+	s.geoip.Close()
+
+	if saveErr := s.snapshots.Save(); saveErr != nil {
+		log.WithError(saveErr).Error("Failed to save limiter state")
+		err = saveErr
+	}
+	return err
+}
+
+// Reload applies the payout amount and tiers, rate limit intervals, hCaptcha keys
+// and access lists of cfg, every other setting keeps its value until a restart
+func (s *Server) Reload(cfg *Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	policy, err := LoadPayoutPolicy(s.client, chain.EtherToWei(int64(cfg.Payout)), cfg.PayoutTiersPath)
+	if err != nil {
+		return err
+	}
+	policy.fiat = s.fiat
+	if err := s.denylist.Reload(); err != nil {
+		return err
+	}
+	if s.allowlist != nil {
+		if err := s.allowlist.Reload(); err != nil {
+			return err
+		}
+	}
+	if s.exempt.list != nil {
+		if err := s.exempt.list.Reload(); err != nil {
+			return err
+		}
+	}
+	if err := s.canaries.Reload(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	next := *s.cfg
+	next.Payout = cfg.Payout
+	next.PayoutTiersPath = cfg.PayoutTiersPath
+	next.Interval = cfg.Interval
+	next.SubnetInterval = cfg.SubnetInterval
+	next.HcaptchaSiteKey = cfg.HcaptchaSiteKey
+	next.HcaptchaSecret = cfg.HcaptchaSecret
+	s.cfg = &next
+	s.policy = policy
+	s.mutex.Unlock()
+
+	ttl := time.Duration(cfg.Interval) * time.Minute
+	s.limiter.SetTTL(ttl, time.Duration(cfg.SubnetInterval)*time.Minute)
+	s.github.SetCooldown(ttl)
+	s.captcha.SetKeys(cfg.HcaptchaSiteKey, cfg.HcaptchaSecret)
+	s.subs.SetMaxThreshold(chain.EtherToWei(int64(cfg.Payout)))
+	log.Info("Reloaded configuration")
+	return nil
+}
+
+func (s *Server) config() *Config {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.cfg
+}
+
+func (s *Server) payoutPolicy() *PayoutPolicy {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.policy
 }
 
 func (s *Server) handleClaim() http.HandlerFunc {
@@ -53,36 +689,353 @@ func (s *Server) handleClaim() http.HandlerFunc {
 
 		// The error always be nil since it has already been handled in limiter
 		address, _ := readAddress(r)
-		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
-		defer cancel()
-		txHash, err := s.Transfer(ctx, address, chain.EtherToWei(int64(s.cfg.payout)))
-		if err != nil {
-			log.WithError(err).Error("Failed to send transaction")
-			renderJSON(w, claimResponse{Message: err.Error()}, http.StatusInternalServerError)
+		ctx := withClientIP(r.Context(), s.proxies.ClientIP(r))
+		if s.receipts.Enabled() || s.purposes.Enabled() {
+			var claimReq claimRequest
+			decodeJSONBody(r, &claimReq)
+			if claimReq.Email != "" && s.receipts.Enabled() {
+				email, err := mail.ParseAddress(claimReq.Email)
+				if err != nil {
+					renderLocalized(w, r, http.StatusBadRequest, "invalid_email")
+					return
+				}
+				ctx = withReceiptEmail(ctx, email.Address)
+			}
+			// The purpose has already been validated
+			if claimReq.Purpose != "" {
+				ctx = withPurpose(ctx, strings.ToLower(claimReq.Purpose))
+			}
+		}
+		claim, allowance, err := s.submitClaim(ctx, address, payoutLimit(r.Context()))
+		var exhausted *budgetExhausted
+		switch {
+		case errors.As(err, &exhausted) && exhausted.purpose != "":
+			rateLimited(w, r, time.Until(exhausted.resetAt), "purpose_budget_exhausted", exhausted.purpose)
+			return
+		case errors.As(err, &exhausted):
+			rateLimited(w, r, time.Until(exhausted.resetAt), "budget_exhausted")
+			return
+		case errors.Is(err, errClaimCapReached):
+			renderLocalized(w, r, http.StatusTooManyRequests, "claim_cap_reached")
+			return
+		case errors.Is(err, errPayoutUnavailable):
+			renderLocalized(w, r, http.StatusServiceUnavailable, "payout_unavailable")
+			return
+		case errors.Is(err, errQueueFull):
+			renderLocalized(w, r, http.StatusServiceUnavailable, "queue_full")
+			return
+		case errors.Is(err, errQueueClosed):
+			renderLocalized(w, r, http.StatusServiceUnavailable, "queue_closed")
+			return
+		case err != nil:
+			renderLocalized(w, r, http.StatusInternalServerError, "internal_error")
+			return
+		}
+
+		resp := claimResponse{
+			Message:   fmt.Sprintf("Claim queued: %s", claim.ID),
+			ClaimID:   claim.ID,
+			Remaining: newAllowanceResponse(allowance),
+		}
+		resp.Progress = newProgressResponse(s.queue.Progress(claim.ID))
+		if s.config().DryRun {
+			resp.Message = fmt.Sprintf("Dry run, claim queued but its payout will not be broadcast: %s", claim.ID)
+			resp.DryRun = &dryRunResponse{Address: claim.Address, Amount: chain.FormatEther(claim.Amount), Funder: s.formatAddress(s.Sender())}
+		}
+		renderJSON(w, resp, http.StatusOK)
+	}
+}
+
+// submitClaim queues a payout to address, capped at limit if not nil, after
+// applying the payout policy and the claim cap. Every claim channel goes through it
+func (s *Server) submitClaim(ctx context.Context, address string, limit *big.Int) (*Claim, *Allowance, error) {
+	policyCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	amount, err := s.payoutPolicy().Amount(policyCtx, address)
+	if err != nil {
+		requestLog(ctx).WithError(err).Error("Failed to determine payout amount")
+		return nil, nil, errPayoutUnavailable
+	}
+	if limit != nil && limit.Cmp(amount) < 0 {
+		amount = limit
+	}
+
+	record, allowance, err := s.claimCap.Reserve(address, amount)
+	if err != nil {
+		if !errors.Is(err, errClaimCapReached) {
+			requestLog(ctx).WithError(err).Error("Failed to record claim")
+		}
+		return nil, nil, err
+	}
+
+	release := func() {
+		if releaseErr := s.claimCap.Release(address, record); releaseErr != nil {
+			requestLog(ctx).WithError(releaseErr).Error("Failed to release claim")
+		}
+	}
+	reservedAt, err := s.budget.Reserve(record.Amount)
+	if err != nil {
+		release()
+		requestLog(ctx).WithError(err).Warn("Claim rejected by payout budget")
+		return nil, nil, err
+	}
+	purpose := requestPurpose(ctx)
+	purposeAt, err := s.purposes.Reserve(purpose, record.Amount)
+	if err != nil {
+		release()
+		s.budget.Release(record.Amount, reservedAt)
+		requestLog(ctx).WithError(err).Warn("Claim rejected by purpose budget")
+		return nil, nil, err
+	}
+
+	// The reservations are given back if the payout fails, and the claim
+	// stays in the history of the address without counting against its cap
+	ctx = withPayoutRollback(ctx)
+	onPayoutFailure(ctx, func() {
+		s.budget.Release(record.Amount, reservedAt)
+		s.purposes.Release(purpose, record.Amount, purposeAt)
+		if err := s.claims.Update(address, record.ClaimedAt, func(r *claimRecord) {
+			r.Status = ClaimFailed
+		}); err != nil {
+			log.WithError(err).WithField("address", address).Error("Failed to record failed claim")
+		}
+	})
+	claim, err := s.queue.Enqueue(ctx, address, record.Amount)
+	if err != nil {
+		release()
+		s.budget.Release(record.Amount, reservedAt)
+		s.purposes.Release(purpose, record.Amount, purposeAt)
+		requestLog(ctx).WithError(err).Error("Failed to queue claim")
+		return nil, nil, err
+	}
+	var chainID string
+	if identifier, ok := s.TxBuilder.(chain.ChainIdentifier); ok {
+		chainID = identifier.ChainID().String()
+	}
+	err = s.claims.Update(address, record.ClaimedAt, func(r *claimRecord) {
+		r.ClaimID = claim.ID
+		r.IP = requestClientIP(ctx)
+		r.ChainID = chainID
+		r.Purpose = purpose
+		// The payout may have failed already
+		if r.Status == "" {
+			r.Status = ClaimQueued
+		}
+	})
+	if err != nil {
+		requestLog(ctx).WithError(err).Error("Failed to record claim")
+	}
+
+	fields := log.Fields{
+		"claimID": claim.ID,
+		"address": address,
+		"amount":  claim.Amount,
+	}
+	if country := requestCountry(ctx); country != "" {
+		fields["country"] = country
+	}
+	if score, ok := requestRisk(ctx); ok {
+		fields["riskScore"] = score
+	}
+	exemptionFields(ctx, fields)
+	if partner, ok := requestPartner(ctx); ok {
+		fields["partner"] = partner
+	}
+	if purpose != "" {
+		fields["purpose"] = purpose
+	}
+	requestLog(ctx).WithFields(fields).Info("Claim queued")
+	return claim, allowance, nil
+}
+
+func (s *Server) handleClaimStatus() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.NotFound(w, r)
 			return
 		}
 
-		log.WithFields(log.Fields{
-			"txHash":  txHash,
-			"address": address,
-		}).Info("Transaction sent successfully")
-		resp := claimResponse{Message: fmt.Sprintf("Txhash: %s", txHash)}
+		id := strings.TrimPrefix(r.URL.Path, "/api/claim/")
+		if strings.HasSuffix(id, "/events") {
+			s.streamClaimStatus(w, r, strings.TrimSuffix(id, "/events"))
+			return
+		}
+
+		claim, ok := s.queue.Get(id)
+		if !ok {
+			if resp, ok := s.tarpit.FakeClaim(id); ok {
+				renderJSON(w, resp, http.StatusOK)
+				return
+			}
+			renderLocalized(w, r, http.StatusNotFound, "claim_not_found")
+			return
+		}
+		resp := newClaimStatusResponse(claim, s.explorer)
+		resp.Progress = newProgressResponse(s.queue.Progress(id))
 		renderJSON(w, resp, http.StatusOK)
 	}
 }
 
+// streamClaimStatus sends the claim status as server-sent events until it is final
+func (s *Server) streamClaimStatus(w http.ResponseWriter, r *http.Request, id string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	// Subscribe before reading the claim so no status change is missed in between
+	updates, unsubscribe := s.queue.Subscribe(id)
+	defer unsubscribe()
+	claim, ok := s.queue.Get(id)
+	if !ok {
+		renderLocalized(w, r, http.StatusNotFound, "claim_not_found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	// The queue position and ETA change without a status change, so they are
+	// sent again whenever they moved since the last event
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	var sent claimStatusResponse
+	for {
+		resp := newClaimStatusResponse(claim, s.explorer)
+		resp.Progress = newProgressResponse(s.queue.Progress(id))
+		if !sameStatus(resp, sent) {
+			data, _ := json.Marshal(resp)
+			fmt.Fprintf(w, "event: status\ndata: %s\n\n", data)
+			flusher.Flush()
+			sent = resp
+		}
+		if s.queue.Final(claim.Status) {
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.streams.Done():
+			return
+		case claim = <-updates:
+		case <-ticker.C:
+		}
+	}
+}
+
 func (s *Server) handleInfo() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != "GET" {
 			http.NotFound(w, r)
 			return
 		}
-		renderJSON(w, infoResponse{
-			Account:         s.Sender().String(),
-			Network:         s.cfg.network,
-			Symbol:          s.cfg.symbol,
-			Payout:          strconv.Itoa(s.cfg.payout),
-			HcaptchaSiteKey: s.cfg.hcaptchaSiteKey,
-		}, http.StatusOK)
+		renderJSON(w, s.info(r), http.StatusOK)
+	}
+}
+
+// info describes the faucet to the frontend making the request
+func (s *Server) info(r *http.Request) infoResponse {
+	var oauthLogin string
+	if s.github.Enabled() {
+		oauthLogin = "/auth/github/login"
+	}
+	cfg := s.config()
+	var balance string
+	if wei := s.balance.Balance(); wei != nil {
+		balance = chain.FormatEther(wei)
+	}
+	var chainID *big.Int
+	if identifier, ok := s.TxBuilder.(chain.ChainIdentifier); ok {
+		chainID = identifier.ChainID()
+	}
+	payout := strconv.Itoa(cfg.Payout)
+	ctx := r.Context()
+	if frontend, ok := s.frontends.Authenticate(r); ok && frontend.Amount != "" {
+		amount, _ := chain.ParseEther(frontend.Amount)
+		ctx = withPayoutBase(ctx, amount)
+	}
+	var payoutFiat string
+	if s.fiat.Enabled() {
+		payoutFiat = s.fiat.String()
+	}
+	if s.fiat.Enabled() || payoutBase(ctx) != nil {
+		if amount, err := s.payoutPolicy().BaseAmount(ctx); err == nil {
+			payout = chain.FormatEther(amount)
+		}
+	}
+	now := time.Now()
+	_, maintenance := s.downtime.Active(now)
+	var nextMaintenance *maintenanceResponse
+	if windows := s.downtime.Windows(now); len(windows) > 0 {
+		next := maintenanceResponse(windows[0])
+		nextMaintenance = &next
+	}
+	return infoResponse{
+		Account:         s.formatAddress(holders(s.TxBuilder)[0]),
+		Balance:         balance,
+		Network:         cfg.Network,
+		ChainID:         chainID,
+		Symbol:          cfg.Symbol,
+		Payout:          payout,
+		PayoutFiat:      payoutFiat,
+		PayoutChoices:   s.choices.Amounts(),
+		Purposes:        s.purposes.Names(),
+		CooldownSeconds: int64(cfg.Interval) * 60,
+		CaptchaProvider: captchaProvider(cfg, s.captcha),
+		HcaptchaSiteKey: cfg.HcaptchaSiteKey,
+		PowDifficulty:   cfg.PowDifficulty,
+		OAuthLogin:      oauthLogin,
+		NameResolution:  s.names.Enabled(),
+		Paused:          s.queue.Closed() || s.balance.Empty() || maintenance || !s.network.Available(),
+		Maintenance:     nextMaintenance,
+		DryRun:          cfg.DryRun,
+		SignIn:          cfg.SIWEDomain != "",
+		EmailReceipts:   cfg.EmailSMTP != "" || cfg.EmailSendgridKey != "",
+	}
+}
+
+// captchaProvider names the challenge claims from the web have to solve, which
+// is proof of work while it stands in for an unavailable hCaptcha
+func captchaProvider(cfg *Config, captcha *Captcha) string {
+	switch {
+	case captcha.PowFallback():
+		return "pow"
+	case cfg.HcaptchaSecret != "":
+		return "hcaptcha"
+	case cfg.PowDifficulty > 0:
+		return "pow"
+	default:
+		return ""
+	}
+}
+
+// handleHealth reports that the process is up, regardless of its dependencies
+func (s *Server) handleHealth() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		renderJSON(w, healthResponse{Status: "ok"}, http.StatusOK)
+	}
+}
+
+// handleReady reports whether claims can be paid out, that is the server is not
+// shutting down and the tx builder passes its RPC, chain ID and signing checks
+func (s *Server) handleReady() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.queue.Closed() {
+			renderJSON(w, healthResponse{Status: "unavailable", Error: errQueueClosed.Error()}, http.StatusServiceUnavailable)
+			return
+		}
+		if checker, ok := s.TxBuilder.(chain.HealthChecker); ok {
+			ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+			defer cancel()
+			if err := checker.Check(ctx); err != nil {
+				log.WithError(err).Warn("Readiness check failed")
+				renderJSON(w, healthResponse{Status: "unavailable", Error: err.Error()}, http.StatusServiceUnavailable)
+				return
+			}
+		}
+		renderJSON(w, healthResponse{Status: "ok"}, http.StatusOK)
 	}
 }
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type checkingTxBuilder struct {
+	mockTxBuilder
+	checkErr error
+}
+
+func (c *checkingTxBuilder) Check(_ context.Context) error {
+	return c.checkErr
+}
+
+func TestHandleReady(t *testing.T) {
+	tests := []struct {
+		name     string
+		checkErr error
+		closed   bool
+		want     int
+	}{
+		{name: "ready", want: http.StatusOK},
+		{name: "rpc down", checkErr: errors.New("rpc node unreachable"), want: http.StatusServiceUnavailable},
+		{name: "shutting down", closed: true, want: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := &checkingTxBuilder{checkErr: tt.checkErr}
+			s := &Server{TxBuilder: builder, queue: NewQueue(builder, 1, 1)}
+			if tt.closed {
+				s.queue.Close(context.Background())
+			}
+
+			rec := httptest.NewRecorder()
+			s.handleReady().ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+type chainTxBuilder struct {
+	mockTxBuilder
+}
+
+func (c *chainTxBuilder) ChainID() *big.Int {
+	return big.NewInt(122)
+}
+
+func TestHandleInfo(t *testing.T) {
+	builder := &chainTxBuilder{}
+	s := &Server{
+		TxBuilder: builder,
+		cfg:       &Config{Network: "fuse", Symbol: "FUSE", Payout: 1, Interval: 1440, PowDifficulty: 16},
+		queue:     NewQueue(builder, 1, 1),
+		github:    NewGithubAuth("", "", "", 0),
+		balance:   NewBalanceMonitor(nil, nil, "FUSE", time.Minute, big.NewInt(0), nil, nil),
+		names:     NewNameResolution(nil, 0, nil),
+		downtime:  &Maintenance{},
+	}
+
+	rec := httptest.NewRecorder()
+	s.handleInfo().ServeHTTP(rec, httptest.NewRequest("GET", "/api/info", nil))
+	var info map[string]interface{}
+	if err := json.NewDecoder(rec.Body).Decode(&info); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	want := map[string]interface{}{
+		"chain_id":         float64(122),
+		"cooldown_seconds": float64(86400),
+		"captcha_provider": "pow",
+		"paused":           false,
+	}
+	for key, value := range want {
+		if info[key] != value {
+			t.Errorf("%s = %v, want %v", key, info[key], value)
+		}
+	}
+
+	s.queue.Close(context.Background())
+	rec = httptest.NewRecorder()
+	s.handleInfo().ServeHTTP(rec, httptest.NewRequest("GET", "/api/info", nil))
+	if err := json.NewDecoder(rec.Body).Decode(&info); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if info["paused"] != true {
+		t.Errorf("paused = %v after shutdown, want true", info["paused"])
+	}
+}
+
+func TestShutdownEndsStreams(t *testing.T) {
+	builder := &mockTxBuilder{}
+	queue := NewQueue(builder, 1, 1)
+	claim, err := queue.Enqueue(context.Background(), "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", big.NewInt(1))
+	if err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	streams, endStreams := context.WithCancel(context.Background())
+	s := &Server{
+		TxBuilder:  builder,
+		queue:      queue,
+		cancel:     func() {},
+		streams:    streams,
+		endStreams: endStreams,
+		geoip:      &GeoIP{},
+		snapshots:  &Snapshots{},
+	}
+	faucet := httptest.NewServer(s.handleClaimStatus())
+	defer faucet.Close()
+	s.httpServer = faucet.Config
+
+	resp, err := http.Get(faucet.URL + "/api/claim/" + claim.ID + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	// The claim is never paid out, so the stream only ends with the shutdown
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("shutdown took %s with a claim status stream open, want the stream ended right away", elapsed)
+	}
+}
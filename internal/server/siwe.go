@@ -0,0 +1,183 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/jellydator/ttlcache/v2"
+)
+
+const (
+	siweNonceTTL = 5 * time.Minute
+	siweHeader   = " wants you to sign in with your Ethereum account:"
+)
+
+type siweNonce struct {
+	Nonce     string `json:"nonce"`
+	Domain    string `json:"domain"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// siweMessage holds the fields of an EIP-4361 message the faucet checks
+type siweMessage struct {
+	domain         string
+	address        string
+	chainID        string
+	nonce          string
+	expirationTime string
+}
+
+// parseSIWEMessage extracts the domain, address and the fields following the
+// statement from an EIP-4361 message
+func parseSIWEMessage(message string) (*siweMessage, error) {
+	lines := strings.Split(strings.ReplaceAll(message, "\r\n", "\n"), "\n")
+	if len(lines) < 2 || !strings.HasSuffix(lines[0], siweHeader) {
+		return nil, errors.New("not a Sign-In with Ethereum message")
+	}
+	msg := &siweMessage{
+		domain:  strings.TrimSuffix(lines[0], siweHeader),
+		address: strings.TrimSpace(lines[1]),
+	}
+	for _, line := range lines[2:] {
+		field := strings.SplitN(line, ": ", 2)
+		if len(field) != 2 {
+			continue
+		}
+		switch field[0] {
+		case "Chain ID":
+			msg.chainID = field[1]
+		case "Nonce":
+			msg.nonce = field[1]
+		case "Expiration Time":
+			msg.expirationTime = field[1]
+		}
+	}
+	if msg.nonce == "" {
+		return nil, errors.New("message has no nonce")
+	}
+	return msg, nil
+}
+
+// recoverSigner returns the address that signed message with personal_sign (EIP-191)
+func recoverSigner(message, signature string) (common.Address, error) {
+	sig, err := hexutil.Decode(signature)
+	if err != nil || len(sig) != crypto.SignatureLength {
+		return common.Address{}, errors.New("invalid signature")
+	}
+	if sig[crypto.RecoveryIDOffset] >= 27 {
+		sig[crypto.RecoveryIDOffset] -= 27
+	}
+	pub, err := crypto.SigToPub(accounts.TextHash([]byte(message)), sig)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(*pub), nil
+}
+
+// SignIn requires claimants to prove they control the recipient address by
+// signing a Sign-In with Ethereum (EIP-4361) message for domain, carrying a
+// single-use nonce issued by the faucet
+type SignIn struct {
+	domain  string
+	chainID *big.Int
+	nonces  *ttlcache.Cache
+}
+
+func NewSignIn(domain string, chainID *big.Int) *SignIn {
+	nonces := ttlcache.NewCache()
+	nonces.SkipTTLExtensionOnHit(true)
+	return &SignIn{domain: domain, chainID: chainID, nonces: nonces}
+}
+
+func (s *SignIn) Enabled() bool {
+	return s.domain != ""
+}
+
+func (s *SignIn) NewNonce() (*siweNonce, error) {
+	nonce, err := newRandomID()
+	if err != nil {
+		return nil, err
+	}
+	s.nonces.SetWithTTL(nonce, true, siweNonceTTL)
+	return &siweNonce{
+		Nonce:     nonce,
+		Domain:    s.domain,
+		ExpiresAt: time.Now().Add(siweNonceTTL).Unix(),
+	}, nil
+}
+
+// Verify checks that message was signed by address for this faucet and
+// consumes its nonce so it can not be replayed
+func (s *SignIn) Verify(message, signature, address string) error {
+	msg, err := parseSIWEMessage(message)
+	if err != nil {
+		return err
+	}
+	if err := s.nonces.Remove(msg.nonce); err != nil {
+		return errors.New("unknown or expired nonce")
+	}
+	if msg.domain != s.domain {
+		return fmt.Errorf("message is for domain %q", msg.domain)
+	}
+	if !strings.EqualFold(msg.address, address) {
+		return errors.New("message is not for the recipient address")
+	}
+	if s.chainID != nil && msg.chainID != s.chainID.String() {
+		return fmt.Errorf("message is for chain ID %q", msg.chainID)
+	}
+	if msg.expirationTime != "" {
+		expiresAt, err := time.Parse(time.RFC3339, msg.expirationTime)
+		if err != nil || time.Now().After(expiresAt) {
+			return errors.New("message has expired")
+		}
+	}
+	signer, err := recoverSigner(message, signature)
+	if err != nil {
+		return err
+	}
+	if signer != common.HexToAddress(address) {
+		return errors.New("message is not signed by the recipient address")
+	}
+	return nil
+}
+
+func (s *SignIn) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	if !s.Enabled() {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	address, _ := readAddress(r)
+	var claimReq claimRequest
+	decodeJSONBody(r, &claimReq)
+	if err := s.Verify(claimReq.Message, claimReq.Signature, address); err != nil {
+		requestLog(r.Context()).WithError(err).WithField("address", address).Info("Claim rejected by ownership proof")
+		renderLocalized(w, r, http.StatusForbidden, "signature_required")
+		return
+	}
+	next.ServeHTTP(w, r)
+}
+
+func (s *SignIn) handleNonce() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" || !s.Enabled() {
+			http.NotFound(w, r)
+			return
+		}
+
+		nonce, err := s.NewNonce()
+		if err != nil {
+			renderLocalized(w, r, http.StatusInternalServerError, "internal_error")
+			return
+		}
+		renderJSON(w, nonce, http.StatusOK)
+	}
+}
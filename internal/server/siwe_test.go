@@ -0,0 +1,74 @@
+package server
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/urfave/negroni"
+)
+
+func siweMessageFor(domain, address, nonce string) string {
+	return fmt.Sprintf(`%s wants you to sign in with your Ethereum account:
+%s
+
+Claim testnet funds
+
+URI: https://%s
+Version: 1
+Chain ID: 122
+Nonce: %s
+Issued At: 2022-12-01T00:00:00Z`, domain, address, domain, nonce)
+}
+
+func TestSignIn(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	address := crypto.PubkeyToAddress(key.PublicKey).Hex()
+	other, _ := crypto.GenerateKey()
+	sign := func(key *ecdsa.PrivateKey, message string) string {
+		sig, _ := crypto.Sign(accounts.TextHash([]byte(message)), key)
+		sig[crypto.RecoveryIDOffset] += 27
+		return hexutil.Encode(sig)
+	}
+
+	signIn := NewSignIn("faucet.example", big.NewInt(122))
+	handler := negroni.New(signIn, negroni.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	tests := []struct {
+		name   string
+		domain string
+		signer *ecdsa.PrivateKey
+		replay bool
+		want   int
+	}{
+		{name: "signed", domain: "faucet.example", signer: key, want: http.StatusOK},
+		{name: "other signer", domain: "faucet.example", signer: other, want: http.StatusForbidden},
+		{name: "other domain", domain: "evil.example", signer: key, want: http.StatusForbidden},
+		{name: "replayed nonce", domain: "faucet.example", signer: key, replay: true, want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nonce, err := signIn.NewNonce()
+			if err != nil {
+				t.Fatal(err)
+			}
+			message := siweMessageFor(tt.domain, address, nonce.Nonce)
+			if tt.replay {
+				signIn.Verify(message, sign(tt.signer, message), address)
+			}
+			body, _ := json.Marshal(claimRequest{Address: address, Message: message, Signature: sign(tt.signer, message)})
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest("POST", "/api/claim", bytes.NewReader(body)))
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
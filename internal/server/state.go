@@ -0,0 +1,158 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// stateMagic starts the state files encrypted with a state key, which are
+// followed by the nonce and the AES-256-GCM sealed content
+var stateMagic = []byte("FFSTATE1")
+
+// ParseStateKey reads a 32 byte state key given in hex or base64
+func ParseStateKey(s string) ([]byte, error) {
+	if s == "" {
+		return nil, nil
+	}
+	key, err := hex.DecodeString(s)
+	if err != nil {
+		key, err = base64.StdEncoding.DecodeString(s)
+	}
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("state key must be 32 bytes in hex or base64")
+	}
+	return key, nil
+}
+
+// readState returns the content of the state file at path, decrypted with
+// key, or nil if there is none. Files written without a key are read as they
+// are, so that a key can be added to an existing deployment
+func readState(path string, key []byte) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, stateMagic) {
+		return data, nil
+	}
+	if key == nil {
+		return nil, fmt.Errorf("%s is encrypted and no state key is set", path)
+	}
+	aead, err := stateCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	data = data[len(stateMagic):]
+	if len(data) < aead.NonceSize() {
+		return nil, fmt.Errorf("%s: truncated state file", path)
+	}
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], stateMagic)
+	if err != nil {
+		return nil, fmt.Errorf("%s: wrong state key or corrupted file", path)
+	}
+	return plaintext, nil
+}
+
+// writeState replaces the state file at path with data, encrypted with key if
+// it is not nil. The file is written aside and renamed, so that a crash in
+// between leaves the previous state
+func writeState(path string, key, data []byte) error {
+	if key != nil {
+		aead, err := stateCipher(key)
+		if err != nil {
+			return err
+		}
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return err
+		}
+		data = aead.Seal(append(append([]byte(nil), stateMagic...), nonce...), nonce, data, stateMagic)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func stateCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Snapshots saves the rate limiter state to a file every interval and on
+// shutdown, so that neither a restart nor a crash resets the cooldowns
+type Snapshots struct {
+	limiter  *Limiter
+	path     string
+	key      []byte
+	interval time.Duration
+}
+
+// NewSnapshots saves the state of limiter to path, encrypted with key if it is
+// not nil, every interval or only on shutdown if interval is zero
+func NewSnapshots(limiter *Limiter, path string, key []byte, interval time.Duration) *Snapshots {
+	return &Snapshots{limiter: limiter, path: path, key: key, interval: interval}
+}
+
+// Enabled reports whether snapshots are saved periodically
+func (s *Snapshots) Enabled() bool {
+	return s.path != "" && s.interval > 0
+}
+
+// Restore loads the last snapshot into the limiter
+func (s *Snapshots) Restore() error {
+	if s.path == "" {
+		return nil
+	}
+	return s.limiter.LoadState(s.path, s.key)
+}
+
+// Save writes a snapshot of the limiter state
+func (s *Snapshots) Save() error {
+	if s.path == "" {
+		return nil
+	}
+	return s.limiter.SaveState(s.path, s.key)
+}
+
+func (s *Snapshots) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Save(); err != nil {
+				log.WithError(err).Error("Failed to save limiter snapshot")
+			}
+		}
+	}
+}
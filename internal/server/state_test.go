@@ -0,0 +1,94 @@
+package server
+
+import (
+	"bytes"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseStateKey(t *testing.T) {
+	hexKey := strings.Repeat("ab", 32)
+	if key, err := ParseStateKey(hexKey); err != nil || len(key) != 32 {
+		t.Errorf("ParseStateKey(hex) = %x, %v", key, err)
+	}
+	if key, err := ParseStateKey("q83vEjRWeJCrze8SNFZ4kKvN7xI0VniQq83vEjRWeJA="); err != nil || len(key) != 32 {
+		t.Errorf("ParseStateKey(base64) = %x, %v", key, err)
+	}
+	if key, err := ParseStateKey(""); err != nil || key != nil {
+		t.Errorf("ParseStateKey(\"\") = %x, %v, want no key", key, err)
+	}
+	for _, invalid := range []string{"abcd", "not a key"} {
+		if _, err := ParseStateKey(invalid); err == nil {
+			t.Errorf("ParseStateKey(%q) accepted an invalid key", invalid)
+		}
+	}
+}
+
+func TestEncryptedLimiterState(t *testing.T) {
+	key, _ := ParseStateKey(strings.Repeat("ab", 32))
+	path := filepath.Join(t.TempDir(), "limiter.state")
+	limiter := NewLimiter(nil, time.Hour, 0, 0, 0)
+	limiter.cache.SetWithTTL("10.0.0.1", limitEntry{Count: 1}, time.Hour)
+	snapshots := NewSnapshots(limiter, path, key, time.Minute)
+	if err := snapshots.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if bytes.Contains(data, []byte("10.0.0.1")) {
+		t.Error("state file holds the limit keys in plain text")
+	}
+
+	restored := NewLimiter(nil, time.Hour, 0, 0, 0)
+	if err := NewSnapshots(restored, path, key, 0).Restore(); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if _, ttl, err := restored.cache.GetWithTTL("10.0.0.1"); err != nil || ttl < 59*time.Minute {
+		t.Errorf("restored cooldown ttl = %v, err = %v", ttl, err)
+	}
+
+	otherKey, _ := ParseStateKey(strings.Repeat("cd", 32))
+	for name, key := range map[string][]byte{"no key": nil, "wrong key": otherKey} {
+		if err := NewLimiter(nil, time.Hour, 0, 0, 0).LoadState(path, key); err == nil {
+			t.Errorf("LoadState() with %s read the encrypted state", name)
+		}
+	}
+
+	// A state file saved before a key was set is still restored
+	plain := filepath.Join(t.TempDir(), "plain.state")
+	limiter.SaveState(plain, nil)
+	restored = NewLimiter(nil, time.Hour, 0, 0, 0)
+	if err := restored.LoadState(plain, key); err != nil {
+		t.Fatalf("LoadState() of unencrypted state error = %v", err)
+	}
+	if _, err := restored.cache.Get("10.0.0.1"); err != nil {
+		t.Error("unencrypted cooldown was not restored")
+	}
+}
+
+func TestEncryptedClaimStore(t *testing.T) {
+	key, _ := ParseStateKey(strings.Repeat("ab", 32))
+	path := filepath.Join(t.TempDir(), "claims.json")
+	store, _ := LoadClaimStore(path, key, 0)
+	if err := store.Add("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", claimRecord{Amount: big.NewInt(1), ClaimedAt: time.Now(), IP: "203.0.113.7"}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if bytes.Contains(data, []byte("203.0.113.7")) {
+		t.Error("claim store holds the claims in plain text")
+	}
+
+	reloaded, err := LoadClaimStore(path, key, 0)
+	if err != nil {
+		t.Fatalf("LoadClaimStore() error = %v", err)
+	}
+	if history := reloaded.History("0xab5801a7d398351b8be11c439e05c5b3259aec9b"); len(history) != 1 || history[0].IP != "203.0.113.7" {
+		t.Errorf("History() = %+v, want the stored claim", history)
+	}
+	if _, err := LoadClaimStore(path, nil, 0); err == nil {
+		t.Error("LoadClaimStore() without the key read the encrypted claims")
+	}
+}
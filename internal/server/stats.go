@@ -0,0 +1,290 @@
+package server
+
+import (
+	"context"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/negroni"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+const (
+	// statsHours and statsDays are the hourly and daily buckets reported
+	statsHours = 24
+	statsDays  = 30
+	// statsCacheTTL is how long a computed response is served before the claims are aggregated again
+	statsCacheTTL = time.Minute
+
+	eventDailySummary = "stats.daily"
+)
+
+type rejectionKey struct{}
+
+// rejection holds the error code a claim was rejected with
+type rejection struct {
+	code string
+}
+
+// recordRejection notes the code of the error response of a claim for the stats
+func recordRejection(r *http.Request, code string) {
+	if rejection, ok := r.Context().Value(rejectionKey{}).(*rejection); ok {
+		rejection.code = code
+	}
+}
+
+// statsBucket aggregates the claims made within a period starting at Start
+type statsBucket struct {
+	Start      time.Time      `json:"start"`
+	Claims     int            `json:"claims"`
+	Failed     int            `json:"failed"`
+	Addresses  int            `json:"unique_addresses"`
+	Dispensed  string         `json:"dispensed"`
+	Rejections map[string]int `json:"rejections,omitempty"`
+	// Purposes breaks the claims tagged with a purpose out by purpose
+	Purposes map[string]*purposeStats `json:"purposes,omitempty"`
+
+	addresses map[string]bool
+	dispensed *big.Int
+}
+
+// purposeStats aggregates the claims tagged with one purpose
+type purposeStats struct {
+	Claims    int    `json:"claims"`
+	Dispensed string `json:"dispensed"`
+
+	dispensed *big.Int
+}
+
+func newStatsBucket(start time.Time) *statsBucket {
+	return &statsBucket{
+		Start:      start,
+		Rejections: make(map[string]int),
+		Purposes:   make(map[string]*purposeStats),
+		addresses:  make(map[string]bool),
+		dispensed:  new(big.Int),
+	}
+}
+
+func (b *statsBucket) add(address string, record claimRecord) {
+	b.Claims++
+	b.addresses[address] = true
+	purpose := b.Purposes[record.Purpose]
+	if record.Purpose != "" && purpose == nil {
+		purpose = &purposeStats{dispensed: new(big.Int)}
+		b.Purposes[record.Purpose] = purpose
+	}
+	if purpose != nil {
+		purpose.Claims++
+	}
+	switch record.Status {
+	case ClaimFailed:
+		b.Failed++
+	case ClaimSimulated:
+	default:
+		if record.Amount != nil {
+			b.dispensed.Add(b.dispensed, record.Amount)
+			if purpose != nil {
+				purpose.dispensed.Add(purpose.dispensed, record.Amount)
+			}
+		}
+	}
+}
+
+func (b *statsBucket) finish() {
+	b.Addresses = len(b.addresses)
+	b.Dispensed = chain.FormatEther(b.dispensed)
+	for _, purpose := range b.Purposes {
+		purpose.Dispensed = chain.FormatEther(purpose.dispensed)
+	}
+}
+
+type statsResponse struct {
+	GeneratedAt time.Time      `json:"generated_at"`
+	Total       *statsBucket   `json:"total"`
+	Hourly      []*statsBucket `json:"hourly"`
+	Daily       []*statsBucket `json:"daily"`
+}
+
+// withoutRejections returns a copy of the response leaving out the rejection
+// codes, which would tell bots which limits they hit
+func (r *statsResponse) withoutRejections() *statsResponse {
+	strip := func(b *statsBucket) *statsBucket {
+		stripped := *b
+		stripped.Rejections = nil
+		return &stripped
+	}
+	public := &statsResponse{GeneratedAt: r.GeneratedAt, Total: strip(r.Total)}
+	for _, b := range r.Hourly {
+		public.Hourly = append(public.Hourly, strip(b))
+	}
+	for _, b := range r.Daily {
+		public.Daily = append(public.Daily, strip(b))
+	}
+	return public
+}
+
+// Stats aggregates the claim store into claims, unique addresses and amounts
+// dispensed per hour and per day for dashboards, along with the codes claims
+// were rejected with, which are only counted in memory for the last statsDays.
+// A summary of every day is logged and emitted as a webhook after midnight UTC
+type Stats struct {
+	claims     *ClaimStore
+	webhooks   *Webhooks
+	mutex      sync.Mutex
+	rejections map[time.Time]map[string]int
+	cached     *statsResponse
+}
+
+func NewStats(claims *ClaimStore, webhooks *Webhooks) *Stats {
+	return &Stats{
+		claims:     claims,
+		webhooks:   webhooks,
+		rejections: make(map[time.Time]map[string]int),
+	}
+}
+
+// ServeHTTP counts the claims rejected further down the chain by their error code
+func (s *Stats) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	rejected := &rejection{}
+	next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), rejectionKey{}, rejected)))
+	if status := w.(negroni.ResponseWriter).Status(); status == http.StatusOK || status == 0 {
+		return
+	}
+	code := rejected.code
+	if code == "" {
+		code = "unknown"
+	}
+
+	hour := time.Now().Truncate(time.Hour)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.rejections[hour] == nil {
+		s.rejections[hour] = make(map[string]int)
+		cutoff := hour.Add(-statsDays * 24 * time.Hour)
+		for start := range s.rejections {
+			if start.Before(cutoff) {
+				delete(s.rejections, start)
+			}
+		}
+	}
+	s.rejections[hour][code]++
+}
+
+// Compute aggregates the claims of the last statsHours and statsDays and all retained ones
+func (s *Stats) Compute(now time.Time) *statsResponse {
+	hour := now.Truncate(time.Hour)
+	day := now.Truncate(24 * time.Hour)
+	resp := &statsResponse{GeneratedAt: now.UTC(), Total: newStatsBucket(time.Time{})}
+	for i := statsHours - 1; i >= 0; i-- {
+		resp.Hourly = append(resp.Hourly, newStatsBucket(hour.Add(-time.Duration(i)*time.Hour).UTC()))
+	}
+	for i := statsDays - 1; i >= 0; i-- {
+		resp.Daily = append(resp.Daily, newStatsBucket(day.Add(-time.Duration(i)*24*time.Hour).UTC()))
+	}
+	bucket := func(buckets []*statsBucket, period time.Duration, at time.Time) *statsBucket {
+		i := len(buckets) - 1 - int(buckets[len(buckets)-1].Start.Sub(at.Truncate(period))/period)
+		if i < 0 || i >= len(buckets) {
+			return nil
+		}
+		return buckets[i]
+	}
+
+	for _, claim := range s.claims.Export(claimFilter{}) {
+		if resp.Total.Claims == 0 {
+			resp.Total.Start = claim.ClaimedAt.UTC()
+		}
+		resp.Total.add(claim.Address, claim.claimRecord)
+		if b := bucket(resp.Hourly, time.Hour, claim.ClaimedAt); b != nil {
+			b.add(claim.Address, claim.claimRecord)
+		}
+		if b := bucket(resp.Daily, 24*time.Hour, claim.ClaimedAt); b != nil {
+			b.add(claim.Address, claim.claimRecord)
+		}
+	}
+
+	s.mutex.Lock()
+	for start, codes := range s.rejections {
+		for code, count := range codes {
+			resp.Total.Rejections[code] += count
+			if b := bucket(resp.Hourly, time.Hour, start); b != nil {
+				b.Rejections[code] += count
+			}
+			if b := bucket(resp.Daily, 24*time.Hour, start); b != nil {
+				b.Rejections[code] += count
+			}
+		}
+	}
+	s.mutex.Unlock()
+
+	resp.Total.finish()
+	for _, b := range append(resp.Hourly, resp.Daily...) {
+		b.finish()
+	}
+	return resp
+}
+
+// Run logs and emits the summary of the previous day after every midnight UTC until ctx is done
+func (s *Stats) Run(ctx context.Context) {
+	for {
+		now := time.Now()
+		timer := time.NewTimer(now.Truncate(24 * time.Hour).Add(24 * time.Hour).Sub(now))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		s.summarize(time.Now())
+	}
+}
+
+// summarize logs and emits the stats of the day before now
+func (s *Stats) summarize(now time.Time) {
+	daily := s.Compute(now).Daily
+	if len(daily) < 2 {
+		return
+	}
+	summary := daily[len(daily)-2]
+	log.WithFields(log.Fields{
+		"date":       summary.Start.Format("2006-01-02"),
+		"claims":     summary.Claims,
+		"failed":     summary.Failed,
+		"addresses":  summary.Addresses,
+		"dispensed":  summary.Dispensed,
+		"rejections": summary.Rejections,
+	}).Info("Daily claim summary")
+	s.webhooks.emit(eventDailySummary, summary)
+}
+
+// handleStats serves the stats, with the rejections of claims only if
+// rejections is set as on the admin endpoint
+func (s *Stats) handleStats(rejections bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.NotFound(w, r)
+			return
+		}
+		now := time.Now()
+		s.mutex.Lock()
+		cached := s.cached
+		s.mutex.Unlock()
+		if cached == nil || now.Sub(cached.GeneratedAt) >= statsCacheTTL {
+			cached = s.Compute(now)
+			s.mutex.Lock()
+			s.cached = cached
+			s.mutex.Unlock()
+		}
+		if rejections {
+			w.Header().Set("Cache-Control", "no-store")
+			renderJSON(w, cached, http.StatusOK)
+			return
+		}
+		w.Header().Set("Cache-Control", "public, max-age=60")
+		renderJSON(w, cached.withoutRejections(), http.StatusOK)
+	}
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/urfave/negroni"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+func TestStats(t *testing.T) {
+	now := time.Date(2024, 5, 10, 14, 30, 0, 0, time.UTC)
+	store, _ := LoadClaimStore("", nil, 0)
+	for _, claim := range []struct {
+		address string
+		at      time.Time
+		status  ClaimStatus
+		purpose string
+	}{
+		{"0x0000000000000000000000000000000000000001", now.Add(-10 * time.Minute), ClaimConfirmed, "ci"},
+		{"0x0000000000000000000000000000000000000001", now.Add(-50 * time.Minute), ClaimConfirmed, "ci"},
+		{"0x0000000000000000000000000000000000000002", now.Add(-3 * time.Hour), ClaimFailed, "hackathon"},
+		{"0x0000000000000000000000000000000000000003", now.Add(-30 * time.Hour), ClaimConfirmed, ""},
+		{"0x0000000000000000000000000000000000000004", now.Add(-90 * 24 * time.Hour), ClaimConfirmed, ""},
+	} {
+		store.Add(claim.address, claimRecord{Amount: chain.EtherToWei(1), ClaimedAt: claim.at, Status: claim.status, Purpose: claim.purpose})
+	}
+
+	hooks := NewWebhooks([]string{"http://127.0.0.1:1"}, "", nil)
+	stats := NewStats(store, hooks)
+	handler := negroni.New(stats, negroni.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("reject") != "" {
+			renderLocalized(w, r, http.StatusTooManyRequests, r.URL.Query().Get("reject"))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})))
+	for _, target := range []string{"/api/claim?reject=claim_cap_reached", "/api/claim?reject=claim_cap_reached", "/api/claim"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", target, nil))
+	}
+
+	resp := stats.Compute(now)
+	if resp.Total.Claims != 5 || resp.Total.Addresses != 4 || resp.Total.Failed != 1 || resp.Total.Dispensed != "4" {
+		t.Errorf("total = %+v, want 5 claims to 4 addresses, 1 failed and 4 dispensed", resp.Total)
+	}
+	if resp.Total.Rejections["claim_cap_reached"] != 2 || len(resp.Total.Rejections) != 1 {
+		t.Errorf("total rejections = %v, want 2 claim_cap_reached", resp.Total.Rejections)
+	}
+	if ci, hackathon := resp.Total.Purposes["ci"], resp.Total.Purposes["hackathon"]; len(resp.Total.Purposes) != 2 ||
+		ci.Claims != 2 || ci.Dispensed != "2" || hackathon.Claims != 1 || hackathon.Dispensed != "0" {
+		t.Errorf("total purposes = %v, want 2 ci claims dispensing 2 and 1 failed hackathon claim", resp.Total.Purposes)
+	}
+	if len(resp.Hourly) != statsHours || len(resp.Daily) != statsDays {
+		t.Fatalf("got %d hourly and %d daily buckets", len(resp.Hourly), len(resp.Daily))
+	}
+	current := resp.Hourly[statsHours-1]
+	if !current.Start.Equal(now.Truncate(time.Hour)) || current.Claims != 1 {
+		t.Errorf("current hour = %+v, want 1 claim since 14:00", current)
+	}
+	if previous := resp.Hourly[statsHours-2]; previous.Claims != 1 || previous.Addresses != 1 {
+		t.Errorf("previous hour = %+v, want 1 claim", previous)
+	}
+	today, yesterday := resp.Daily[statsDays-1], resp.Daily[statsDays-2]
+	if today.Claims != 3 || today.Addresses != 2 || today.Dispensed != "2" || today.Failed != 1 {
+		t.Errorf("today = %+v, want 3 claims to 2 addresses with 2 dispensed", today)
+	}
+	if yesterday.Claims != 1 || !yesterday.Start.Equal(time.Date(2024, 5, 9, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("yesterday = %+v, want 1 claim on May 9", yesterday)
+	}
+
+	// Only the admin endpoint tells which limits claims were rejected by
+	for _, tt := range []struct {
+		rejections bool
+		want       int
+	}{{false, 0}, {true, 2}} {
+		rec := httptest.NewRecorder()
+		stats.handleStats(tt.rejections).ServeHTTP(rec, httptest.NewRequest("GET", "/api/stats", nil))
+		var served statsResponse
+		json.NewDecoder(rec.Body).Decode(&served)
+		if got := served.Total.Rejections["claim_cap_reached"]; got != tt.want || served.Total.Claims != 5 {
+			t.Errorf("handleStats(%v) served %d rejections in %+v, want %d", tt.rejections, got, served.Total, tt.want)
+		}
+	}
+
+	// The summary after midnight covers the day before
+	stats.summarize(time.Date(2024, 5, 11, 0, 0, 1, 0, time.UTC))
+	select {
+	case event := <-hooks.endpoints[0].events:
+		data, _ := json.Marshal(event.Data)
+		var summary statsBucket
+		json.Unmarshal(data, &summary)
+		if event.Type != eventDailySummary || summary.Claims != 3 || !summary.Start.Equal(now.Truncate(24*time.Hour)) {
+			t.Errorf("summary event = %s %+v, want 3 claims on May 10", event.Type, summary)
+		}
+	default:
+		t.Error("no daily summary was emitted")
+	}
+}
@@ -0,0 +1,327 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+// maxSubscriptionsPerKey caps the addresses topped up for a single API key
+const maxSubscriptionsPerKey = 10
+
+// Subscription tops up Address whenever its balance falls below Threshold
+// Ethers. Owner is the name of the API key that registered it
+type Subscription struct {
+	Address   string    `json:"address"`
+	Threshold string    `json:"threshold"`
+	Owner     string    `json:"owner"`
+	CreatedAt time.Time `json:"created_at"`
+	LastTopUp time.Time `json:"last_top_up,omitempty"`
+}
+
+type subscriptionRequest struct {
+	Address   string `json:"address"`
+	Threshold string `json:"threshold"`
+}
+
+// Subscriptions holds the addresses registered for automatic top-ups by
+// address, optionally backed by a JSON file encrypted with key if set.
+// Thresholds may not exceed maxThreshold, which is the base payout
+type Subscriptions struct {
+	mutex        sync.Mutex
+	path         string
+	key          []byte
+	subs         map[string]Subscription
+	maxThreshold *big.Int
+}
+
+func LoadSubscriptions(path string, key []byte) (*Subscriptions, error) {
+	s := &Subscriptions{path: path, key: key, subs: make(map[string]Subscription)}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := readState(path, key)
+	if err != nil || data == nil {
+		return s, err
+	}
+	var subs []Subscription
+	if err := json.Unmarshal(data, &subs); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, sub := range subs {
+		s.subs[sub.Address] = sub
+	}
+	return s, nil
+}
+
+// SetMaxThreshold caps the thresholds of subscriptions, nil meaning no cap
+func (s *Subscriptions) SetMaxThreshold(max *big.Int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.maxThreshold = max
+}
+
+// threshold returns the threshold of sub in Wei, lowered to the cap if it was
+// registered before the cap was lowered
+func (s *Subscriptions) threshold(sub Subscription) (*big.Int, error) {
+	amount, err := chain.ParseEther(sub.Threshold)
+	if err != nil {
+		return nil, err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.maxThreshold != nil && amount.Cmp(s.maxThreshold) > 0 {
+		return new(big.Int).Set(s.maxThreshold), nil
+	}
+	return amount, nil
+}
+
+// Register subscribes address for the API key owner, or changes the threshold
+// of its subscription
+func (s *Subscriptions) Register(owner, address, threshold string) error {
+	if !chain.IsValidAddress(address, false) {
+		return fmt.Errorf("invalid address %q", address)
+	}
+	amount, err := chain.ParseEther(threshold)
+	if err != nil || amount.Sign() <= 0 {
+		return errors.New("threshold must be a positive amount of Ethers")
+	}
+	address = common.HexToAddress(address).Hex()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	sub, ok := s.subs[address]
+	switch {
+	case s.maxThreshold != nil && amount.Cmp(s.maxThreshold) > 0:
+		return fmt.Errorf("threshold must not exceed the payout of %s Ethers", chain.FormatEther(s.maxThreshold))
+	case ok && sub.Owner != owner:
+		return fmt.Errorf("%s is already subscribed by another API key", address)
+	case !ok && len(s.list(owner)) >= maxSubscriptionsPerKey:
+		return fmt.Errorf("an API key can subscribe at most %d addresses", maxSubscriptionsPerKey)
+	case !ok:
+		sub = Subscription{Address: address, Owner: owner, CreatedAt: time.Now()}
+	}
+	sub.Threshold = threshold
+	s.subs[address] = sub
+	return s.save()
+}
+
+// Remove cancels the subscription of address made by the API key owner
+func (s *Subscriptions) Remove(owner, address string) error {
+	address = common.HexToAddress(address).Hex()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if sub, ok := s.subs[address]; !ok || sub.Owner != owner {
+		return fmt.Errorf("subscription of %s not found", address)
+	}
+	delete(s.subs, address)
+	return s.save()
+}
+
+// List returns the subscriptions of the API key owner, or every subscription
+// if owner is empty
+func (s *Subscriptions) List(owner string) []Subscription {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.list(owner)
+}
+
+func (s *Subscriptions) list(owner string) []Subscription {
+	subs := make([]Subscription, 0, len(s.subs))
+	for _, sub := range s.subs {
+		if owner == "" || sub.Owner == owner {
+			subs = append(subs, sub)
+		}
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].CreatedAt.Before(subs[j].CreatedAt) })
+	return subs
+}
+
+func (s *Subscriptions) toppedUp(address string, at time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	sub, ok := s.subs[address]
+	if !ok {
+		return nil
+	}
+	sub.LastTopUp = at
+	s.subs[address] = sub
+	return s.save()
+}
+
+func (s *Subscriptions) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(s.list(""), "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeState(s.path, s.key, data)
+}
+
+// handleSubscriptions lets holders of an API key manage the addresses they
+// want topped up
+func handleSubscriptions(subs *Subscriptions, denylist *AccessList) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key, ok := requestAPIKey(r.Context())
+		if !ok {
+			renderLocalized(w, r, http.StatusUnauthorized, "api_key_required")
+			return
+		}
+		if r.Method == "GET" {
+			renderJSON(w, subs.List(key.Name), http.StatusOK)
+			return
+		}
+
+		var req subscriptionRequest
+		if err := decodeJSONBody(r, &req); err != nil {
+			renderError(w, r, err)
+			return
+		}
+
+		switch r.Method {
+		case "POST":
+			if denylist.ContainsAddress(req.Address) {
+				renderLocalized(w, r, http.StatusForbidden, reasonDeniedAddress)
+				return
+			}
+			if err := subs.Register(key.Name, req.Address, req.Threshold); err != nil {
+				renderJSON(w, claimResponse{Message: err.Error()}, http.StatusBadRequest)
+				return
+			}
+		case "DELETE":
+			if err := subs.Remove(key.Name, req.Address); err != nil {
+				renderJSON(w, claimResponse{Message: err.Error()}, http.StatusNotFound)
+				return
+			}
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		renderJSON(w, subs.List(key.Name), http.StatusOK)
+	}
+}
+
+// TopUps pays out to subscribed addresses whose balance fell below their
+// threshold, at most once per cooldown, on behalf of the API key that
+// subscribed them. Each top-up goes through the access lists, recipient
+// screening, address cooldown and API key quota a claim would
+type TopUps struct {
+	server   *Server
+	client   balanceReader
+	subs     *Subscriptions
+	interval time.Duration
+	cooldown time.Duration
+}
+
+func NewTopUps(s *Server, client balanceReader, subs *Subscriptions, interval, cooldown time.Duration) *TopUps {
+	return &TopUps{server: s, client: client, subs: subs, interval: interval, cooldown: cooldown}
+}
+
+func (t *TopUps) Enabled() bool {
+	return t.interval > 0
+}
+
+func (t *TopUps) Run(ctx context.Context) {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.check(ctx)
+		}
+	}
+}
+
+func (t *TopUps) check(ctx context.Context) {
+	for _, sub := range t.subs.List("") {
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(sub.LastTopUp) < t.cooldown {
+			continue
+		}
+		if err := t.topUp(ctx, sub); err != nil {
+			log.WithError(err).WithField("address", sub.Address).Warn("Failed to top up subscribed address")
+		}
+	}
+}
+
+func (t *TopUps) topUp(ctx context.Context, sub Subscription) error {
+	key, ok := t.server.apiKeys.ByName(sub.Owner)
+	if !ok {
+		// The API key was revoked, its subscriptions go with it
+		return t.subs.Remove(sub.Owner, sub.Address)
+	}
+	s := t.server
+	if s.denylist.ContainsAddress(sub.Address) || (s.allowlist != nil && !s.allowlist.ContainsAddress(sub.Address)) {
+		// The address was denylisted since it subscribed, its subscription goes with it
+		log.WithFields(log.Fields{
+			"address": sub.Address,
+			"owner":   sub.Owner,
+		}).Info("Dropped subscription of address no longer permitted to use the faucet")
+		return t.subs.Remove(sub.Owner, sub.Address)
+	}
+	threshold, err := t.subs.threshold(sub)
+	if err != nil {
+		return err
+	}
+
+	balanceCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	balance, err := t.client.BalanceAt(balanceCtx, common.HexToAddress(sub.Address), nil)
+	cancel()
+	if err != nil {
+		return err
+	}
+	if balance.Cmp(threshold) >= 0 {
+		return nil
+	}
+
+	if err := s.screening.Check(ctx, sub.Address); err != nil {
+		return err
+	}
+	if wait, ok := s.limiter.takeQuota(key, 1); !ok {
+		return fmt.Errorf("quota of API key %s exceeded for %s", key.Name, wait.Round(time.Second))
+	}
+	keys := s.limiter.keys(sub.Address, "", 0)
+	res, ok := s.limiter.reserve(keys)
+	if !ok {
+		s.limiter.releaseQuota(key, 1)
+		return fmt.Errorf("address rate limited for %s", res.reset.Round(time.Second))
+	}
+	release := func() {
+		s.limiter.release(keys, res)
+		s.limiter.releaseQuota(key, 1)
+	}
+
+	// Top-ups are paid out in the priority class of the API key
+	ctx = withPayoutRollback(context.WithValue(ctx, apiKeyCtxKey{}, key))
+	onPayoutFailure(ctx, release)
+	claim, _, err := s.submitClaim(ctx, sub.Address, nil)
+	if err != nil {
+		release()
+		return err
+	}
+	log.WithFields(log.Fields{
+		"address": sub.Address,
+		"owner":   sub.Owner,
+		"claimID": claim.ID,
+	}).Info("Topped up subscribed address")
+	return t.subs.toppedUp(sub.Address, time.Now())
+}
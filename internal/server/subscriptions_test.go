@@ -0,0 +1,142 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+type balanceMap map[common.Address]*big.Int
+
+func (b balanceMap) BalanceAt(_ context.Context, account common.Address, _ *big.Int) (*big.Int, error) {
+	if balance, ok := b[account]; ok {
+		return balance, nil
+	}
+	return new(big.Int), nil
+}
+
+func TestSubscriptions(t *testing.T) {
+	key := make([]byte, 32)
+	subs, err := LoadSubscriptions(filepath.Join(t.TempDir(), "subscriptions.json"), key)
+	if err != nil {
+		t.Fatalf("LoadSubscriptions() error = %v", err)
+	}
+	subs.SetMaxThreshold(big.NewInt(1e18))
+	denylist, _ := LoadAccessList("")
+	denylist.Add("0x0000000000000000000000000000000000000bad")
+	handler := handleSubscriptions(subs, denylist)
+	call := func(method, owner, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/api/subscriptions", strings.NewReader(body))
+		if owner != "" {
+			r = withAPIKey(r, APIKey{Name: owner})
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec
+	}
+
+	if rec := call("GET", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("status without API key = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	rec := call("POST", "ci", `{"address":"0xab5801a7d398351b8be11c439e05c5b3259aec9b","threshold":"0.5"}`)
+	var list []Subscription
+	json.NewDecoder(rec.Body).Decode(&list)
+	if rec.Code != http.StatusOK || len(list) != 1 || list[0].Address != "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B" {
+		t.Fatalf("register status = %d, subscriptions = %v", rec.Code, list)
+	}
+	if rec := call("POST", "other", `{"address":"0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B","threshold":"1"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("status of address subscribed by another key = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if rec := call("POST", "ci", `{"address":"0x0000000000000000000000000000000000000bad","threshold":"1"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("status of denylisted address = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	if rec := call("POST", "ci", `{"address":"0x0000000000000000000000000000000000000001","threshold":"0"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("status of zero threshold = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if rec := call("POST", "ci", `{"address":"0x0000000000000000000000000000000000000001","threshold":"2"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("status of threshold above the payout = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if rec := call("DELETE", "other", `{"address":"0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("status of removing another key's subscription = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	if data, _ := os.ReadFile(subs.path); bytes.Contains(data, []byte("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")) {
+		t.Error("subscriptions stored in the clear")
+	}
+	reloaded, _ := LoadSubscriptions(subs.path, key)
+	if got := reloaded.List("ci"); len(got) != 1 || got[0].Threshold != "0.5" {
+		t.Errorf("reloaded subscriptions = %v", got)
+	}
+}
+
+func TestTopUps(t *testing.T) {
+	builder := &mockTxBuilder{}
+	claimStore, _ := LoadClaimStore("", nil, 0)
+	policy, _ := LoadPayoutPolicy(nil, big.NewInt(1), "")
+	keys, _ := LoadAPIKeys("")
+	keys.Issue("ci", 2)
+	denylist, _ := LoadAccessList("")
+	s := &Server{
+		TxBuilder: builder,
+		cfg:       &Config{},
+		queue:     NewQueue(builder, 1, 4),
+		policy:    policy,
+		apiKeys:   keys,
+		claimCap:  NewClaimCap(claimStore, 0, nil, 0),
+		claims:    claimStore,
+		budget:    NewBudget(0, nil, 0, nil),
+		denylist:  denylist,
+		limiter:   NewLimiter(nil, time.Hour, 0, 0, 0),
+		screening: NewRecipientCheck(nil, false, nil, "ETH"),
+	}
+	subs, _ := LoadSubscriptions("", nil)
+	low, funded := "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", "0x0000000000000000000000000000000000000001"
+	denied, claimed := "0x0000000000000000000000000000000000000003", "0x0000000000000000000000000000000000000004"
+	subs.Register("ci", low, "1")
+	subs.Register("ci", funded, "1")
+	subs.Register("ci", denied, "1")
+	subs.Register("ci", claimed, "1")
+	subs.Register("revoked", "0x0000000000000000000000000000000000000002", "1")
+	denylist.Add(denied)
+	// An address that claimed from the web is in its cooldown
+	s.limiter.reserve(s.limiter.keys(claimed, "192.0.2.1", 0))
+	balances := balanceMap{common.HexToAddress(low): big.NewInt(1), common.HexToAddress(funded): big.NewInt(2e18)}
+	topUps := NewTopUps(s, balances, subs, time.Minute, time.Hour)
+
+	topUps.check(context.Background())
+	topUps.check(context.Background())
+	if n := s.queue.pending.Len(); n != 1 {
+		t.Errorf("%d top-ups queued, want one for the address below its threshold", n)
+	}
+	if claim, _ := s.queue.pending.Pop(); claim.Address != low || claim.priority != PriorityAPIKey {
+		t.Errorf("top-up of %s in class %s, want %s in the apikey class", claim.Address, claim.priority, low)
+	}
+	if got := subs.List(""); len(got) != 3 {
+		t.Errorf("subscriptions = %v, want the ones of the revoked key and the denylisted address dropped", got)
+	}
+
+	// The top-up counted against the quota of the key, the one refused by
+	// the address cooldown did not
+	key, _ := keys.ByName("ci")
+	if _, ok := s.limiter.takeQuota(key, 1); !ok {
+		t.Error("quota used up by the top-up refused by the address cooldown")
+	}
+	if _, ok := s.limiter.takeQuota(key, 1); ok {
+		t.Error("top-up not counted against the quota of the API key")
+	}
+	s.limiter.cache.Remove(claimed)
+	topUps.check(context.Background())
+	if n := s.queue.pending.Len(); n != 0 {
+		t.Errorf("%d top-ups queued with the quota of the API key used up, want 0", n)
+	}
+}
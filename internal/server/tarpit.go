@@ -0,0 +1,151 @@
+package server
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jellydator/ttlcache/v2"
+)
+
+const (
+	// TarpitFake answers tarpitted claims with a made up success
+	TarpitFake = "fake"
+	// TarpitError answers tarpitted claims with an explicit rejection
+	TarpitError = "error"
+)
+
+const (
+	// maxTarpitted caps the requests held in the tarpit at once, beyond which they are answered right away
+	maxTarpitted = 512
+	// fakeClaimMemory is how long the status of a fake claim can be looked up
+	fakeClaimMemory = 24 * time.Hour
+)
+
+// Tarpit slows down claims whose risk score reaches a threshold instead of
+// rejecting them right away, so that bots learn neither the limits nor which
+// of their claims tripped them. Tarpitted claims are held for a jittered delay
+// and then answered with a fake success, the same for every retry to an
+// address, or with an explicit error
+type Tarpit struct {
+	score  int
+	delay  time.Duration
+	jitter time.Duration
+	mode   string
+	mutex  sync.Mutex
+	ids    *ttlcache.Cache
+	fakes  *ttlcache.Cache
+	slots  chan struct{}
+}
+
+func NewTarpit(score int, delay, jitter time.Duration, mode string) *Tarpit {
+	if mode == "" {
+		mode = TarpitFake
+	}
+	ids := ttlcache.NewCache()
+	ids.SkipTTLExtensionOnHit(true)
+	fakes := ttlcache.NewCache()
+	fakes.SkipTTLExtensionOnHit(true)
+	return &Tarpit{
+		score:  score,
+		delay:  delay,
+		jitter: jitter,
+		mode:   mode,
+		ids:    ids,
+		fakes:  fakes,
+		slots:  make(chan struct{}, maxTarpitted),
+	}
+}
+
+func (t *Tarpit) Enabled() bool {
+	return t != nil && t.score > 0
+}
+
+// Trips reports whether a claim with the risk score belongs in the tarpit
+func (t *Tarpit) Trips(score int) bool {
+	return t.Enabled() && score >= t.score
+}
+
+// fakeClaim returns the ID of the fake claim to address, the same one for
+// every retry while it is remembered
+func (t *Tarpit) fakeClaim(address string) (string, error) {
+	address = strings.ToLower(address)
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if id, err := t.ids.Get(address); err == nil {
+		return id.(string), nil
+	}
+	id, err := newRandomID()
+	if err != nil {
+		return "", err
+	}
+	t.ids.SetWithTTL(address, id, fakeClaimMemory)
+	t.fakes.SetWithTTL(id, address, fakeClaimMemory)
+	return id, nil
+}
+
+// wait holds the request for the jittered delay, and reports false if it was
+// given up on before
+func (t *Tarpit) wait(r *http.Request) bool {
+	delay := t.delay
+	if t.jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(t.jitter)))
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+// serve answers a tarpitted claim to address after the delay
+func (t *Tarpit) serve(w http.ResponseWriter, r *http.Request, address string) {
+	select {
+	case t.slots <- struct{}{}:
+		defer func() { <-t.slots }()
+		if !t.wait(r) {
+			return
+		}
+	default:
+		// The tarpit is full, holding on to more requests would only tie up the faucet
+		requestLog(r.Context()).Debug("Tarpit full, claim answered right away")
+	}
+
+	if t.mode == TarpitError || address == "" {
+		renderLocalized(w, r, http.StatusForbidden, "risk_too_high")
+		return
+	}
+	id, err := t.fakeClaim(address)
+	if err != nil {
+		renderLocalized(w, r, http.StatusInternalServerError, "internal_error")
+		return
+	}
+	renderJSON(w, claimResponse{
+		Message:  fmt.Sprintf("Claim queued: %s", id),
+		ClaimID:  id,
+		Progress: &progressResponse{QueuePosition: 1, QueueLength: 1},
+	}, http.StatusOK)
+}
+
+// FakeClaim returns the status of a fake claim handed out by the tarpit, if id is one
+func (t *Tarpit) FakeClaim(id string) (claimStatusResponse, bool) {
+	if !t.Enabled() {
+		return claimStatusResponse{}, false
+	}
+	address, err := t.fakes.Get(id)
+	if err != nil {
+		return claimStatusResponse{}, false
+	}
+	return claimStatusResponse{
+		ClaimID:  id,
+		Address:  address.(string),
+		Status:   string(ClaimQueued),
+		Progress: &progressResponse{QueuePosition: 1, QueueLength: 1},
+	}, true
+}
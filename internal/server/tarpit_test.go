@@ -0,0 +1,81 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/urfave/negroni"
+)
+
+func TestTarpit(t *testing.T) {
+	tests := []struct {
+		name   string
+		mode   string
+		agent  string
+		status int
+		fake   bool
+	}{
+		{name: "low risk", mode: TarpitFake, agent: "Mozilla/5.0", status: http.StatusAccepted},
+		{name: "fake success", mode: TarpitFake, agent: "curl/8.0", status: http.StatusOK, fake: true},
+		{name: "slow error", mode: TarpitError, agent: "curl/8.0", status: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A scripted claim scores 25 from a new IP and 15 on retries, while a browser scores 10
+			engine := NewRiskEngine(nil, nil, 0, 15)
+			tarpit := NewTarpit(15, 50*time.Millisecond, 10*time.Millisecond, tt.mode)
+			engine.EnableTarpit(tarpit)
+			handler := negroni.New(engine, negroni.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusAccepted)
+			})))
+			claim := func() (*httptest.ResponseRecorder, time.Duration) {
+				r := httptest.NewRequest("POST", "/api/claim", bytes.NewBufferString(`{"address":"0x0000000000000000000000000000000000000001"}`))
+				r.Header.Set("User-Agent", tt.agent)
+				rec := httptest.NewRecorder()
+				start := time.Now()
+				handler.ServeHTTP(rec, r)
+				return rec, time.Since(start)
+			}
+
+			rec, took := claim()
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if tarpitted := tt.status != http.StatusAccepted; tarpitted && took < 50*time.Millisecond {
+				t.Errorf("tarpitted claim answered after %v", took)
+			}
+			if !tt.fake {
+				return
+			}
+			var resp claimResponse
+			json.NewDecoder(rec.Body).Decode(&resp)
+			status, ok := tarpit.FakeClaim(resp.ClaimID)
+			if !ok || status.Status != string(ClaimQueued) {
+				t.Errorf("FakeClaim(%q) = %+v, %v, want a queued claim", resp.ClaimID, status, ok)
+			}
+			rec, _ = claim()
+			var retry claimResponse
+			json.NewDecoder(rec.Body).Decode(&retry)
+			if retry.ClaimID != resp.ClaimID {
+				t.Errorf("retried fake claim ID = %q, want %q", retry.ClaimID, resp.ClaimID)
+			}
+		})
+	}
+}
+
+func TestTarpitGivenUp(t *testing.T) {
+	tarpit := NewTarpit(1, time.Hour, 0, TarpitFake)
+	ctx, cancel := context.WithCancel(context.Background())
+	r := httptest.NewRequest("POST", "/api/claim", nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	cancel()
+	tarpit.serve(rec, r, "0x0000000000000000000000000000000000000001")
+	if rec.Body.Len() != 0 {
+		t.Errorf("claim given up on was answered with %q", rec.Body.String())
+	}
+}
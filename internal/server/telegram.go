@@ -0,0 +1,282 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+const (
+	telegramPollTimeout = 30 * time.Second
+	// botReplyTimeout is how long the bot waits for a claim to be broadcast before giving up on the tx link
+	botReplyTimeout = 2 * time.Minute
+)
+
+var telegramClient = &http.Client{Timeout: telegramPollTimeout + 10*time.Second}
+
+type telegramUpdate struct {
+	UpdateID int64            `json:"update_id"`
+	Message  *telegramMessage `json:"message"`
+}
+
+type telegramMessage struct {
+	MessageID int64 `json:"message_id"`
+	From      struct {
+		ID int64 `json:"id"`
+	} `json:"from"`
+	Chat struct {
+		ID int64 `json:"id"`
+	} `json:"chat"`
+	Text string `json:"text"`
+}
+
+// TelegramBot lets users claim by sending "/claim <address>" to a Telegram bot.
+// Claims go through the same payout pipeline as the web, with the cooldown
+// applied to the Telegram account in place of the client IP
+type TelegramBot struct {
+	server   *Server
+	endpoint string
+	offset   int64
+}
+
+func NewTelegramBot(s *Server, token string) *TelegramBot {
+	return &TelegramBot{
+		server:   s,
+		endpoint: fmt.Sprintf("https://api.telegram.org/bot%s/", token),
+	}
+}
+
+// Run long polls Telegram for messages until ctx is done
+func (b *TelegramBot) Run(ctx context.Context) {
+	for {
+		updates, err := b.getUpdates(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.WithError(err).Error("Failed to fetch Telegram updates")
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(5 * time.Second):
+			}
+			continue
+		}
+		for _, update := range updates {
+			b.offset = update.UpdateID + 1
+			if update.Message != nil {
+				b.handleMessage(ctx, update.Message)
+			}
+		}
+	}
+}
+
+func (b *TelegramBot) handleMessage(ctx context.Context, msg *telegramMessage) {
+	fields := strings.Fields(msg.Text)
+	if len(fields) == 0 {
+		return
+	}
+	// Commands sent in groups carry the bot name, e.g. /claim@faucet_bot
+	command := strings.SplitN(fields[0], "@", 2)[0]
+	switch {
+	case command == "/claim" && len(fields) == 2:
+		b.claim(ctx, msg, fields[1])
+	case command == "/claim":
+		b.reply(ctx, msg, "Usage: /claim <address>")
+	case command == "/start" || command == "/help":
+		cfg := b.server.config()
+		b.reply(ctx, msg, fmt.Sprintf("Send /claim <address> to receive %d %s on %s", cfg.Payout, cfg.Symbol, cfg.Network))
+	}
+}
+
+func (b *TelegramBot) claim(ctx context.Context, msg *telegramMessage, address string) {
+	s := b.server
+	if id, err := newRandomID(); err == nil {
+		ctx = withRequestID(ctx, id)
+	}
+	if chain.IsName(address) && s.names.Enabled() {
+		resolved, err := s.names.Resolve(ctx, address)
+		if err != nil {
+			b.reply(ctx, msg, fmt.Sprintf("Unable to resolve %s", address))
+			return
+		}
+		address = resolved
+	}
+	if codec, ok := s.TxBuilder.(chain.AddressCodec); ok {
+		account, err := codec.ParseAddress(address)
+		if err != nil {
+			b.reply(ctx, msg, "Invalid address")
+			return
+		}
+		address = account.Hex()
+	} else if !chain.IsValidAddress(address, true) {
+		b.reply(ctx, msg, "Invalid address")
+		return
+	}
+	if s.balance.Empty() {
+		b.reply(ctx, msg, "The faucet is empty, please try again later")
+		return
+	}
+	if window, ok := s.downtime.Active(time.Now()); ok {
+		b.reply(ctx, msg, window.text("en"))
+		return
+	}
+	if !s.network.Available() {
+		b.reply(ctx, msg, "The network is unavailable, please try again later")
+		return
+	}
+	if s.denylist.ContainsAddress(address) || (s.allowlist != nil && !s.allowlist.ContainsAddress(address)) {
+		b.reply(ctx, msg, "This address is not permitted to use the faucet")
+		return
+	}
+
+	if err := s.screening.Check(ctx, address); err != nil {
+		var rejected *rejectedRecipient
+		if errors.As(err, &rejected) {
+			b.reply(ctx, msg, rejected.Error())
+		} else {
+			b.reply(ctx, msg, "Unable to verify eligibility, please try again later")
+		}
+		return
+	}
+
+	keys := s.limiter.keys(address, "telegram:"+strconv.FormatInt(msg.From.ID, 10), 0)
+	res, ok := s.limiter.reserve(keys)
+	if !ok {
+		b.reply(ctx, msg, fmt.Sprintf("You have exceeded the rate limit. Please wait %s before you try again", res.reset.Round(time.Second)))
+		return
+	}
+	// As for web claims, the cooldown is given back if the payout fails later
+	ctx = withPayoutRollback(ctx)
+	onPayoutFailure(ctx, func() {
+		s.limiter.release(keys, res)
+	})
+	claim, _, err := s.submitClaim(ctx, address, nil)
+	if err != nil {
+		s.limiter.release(keys, res)
+		switch {
+		case errors.Is(err, errClaimCapReached):
+			b.reply(ctx, msg, "This address has reached its claim limit")
+		case errors.As(err, new(*budgetExhausted)):
+			b.reply(ctx, msg, "The faucet budget is exhausted, please try again later")
+		case errors.Is(err, errPayoutUnavailable), errors.Is(err, errQueueFull), errors.Is(err, errQueueClosed):
+			b.reply(ctx, msg, err.Error())
+		default:
+			b.reply(ctx, msg, "Failed to queue claim, please try again later")
+		}
+		return
+	}
+
+	requestLog(ctx).WithFields(log.Fields{
+		"address":    address,
+		"telegramID": msg.From.ID,
+	}).Info("Claim received through Telegram")
+	b.reply(ctx, msg, fmt.Sprintf("Claim queued: %s", claim.ID))
+	go b.replyWithTx(ctx, msg, claim.ID)
+}
+
+// replyWithTx waits until the claim is broadcast and replies with its tx
+func (b *TelegramBot) replyWithTx(ctx context.Context, msg *telegramMessage, id string) {
+	updates, unsubscribe := b.server.queue.Subscribe(id)
+	defer unsubscribe()
+	if claim, ok := b.server.queue.Get(id); ok && claim.Status != ClaimQueued {
+		b.replyStatus(ctx, msg, claim)
+		return
+	}
+
+	timeout := time.NewTimer(botReplyTimeout)
+	defer timeout.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timeout.C:
+			return
+		case claim := <-updates:
+			if claim.Status != ClaimQueued {
+				b.replyStatus(ctx, msg, claim)
+				return
+			}
+		}
+	}
+}
+
+func (b *TelegramBot) replyStatus(ctx context.Context, msg *telegramMessage, claim Claim) {
+	if claim.Status == ClaimFailed {
+		b.reply(ctx, msg, fmt.Sprintf("Payout failed: %s", claim.Error))
+		return
+	}
+	if claim.Status == ClaimSimulated {
+		b.reply(ctx, msg, fmt.Sprintf("Dry run, payout not broadcast: %s", claim.TxHash.Hex()))
+		return
+	}
+	tx := claim.TxHash.Hex()
+	if link := b.server.explorer.TxURL(claim.TxHash); link != "" {
+		tx = link
+	}
+	b.reply(ctx, msg, fmt.Sprintf("Payout sent: %s", tx))
+}
+
+func (b *TelegramBot) getUpdates(ctx context.Context) ([]telegramUpdate, error) {
+	var updates []telegramUpdate
+	err := b.call(ctx, "getUpdates", map[string]interface{}{
+		"offset":          b.offset,
+		"timeout":         int(telegramPollTimeout.Seconds()),
+		"allowed_updates": []string{"message"},
+	}, &updates)
+	return updates, err
+}
+
+func (b *TelegramBot) reply(ctx context.Context, msg *telegramMessage, text string) {
+	err := b.call(ctx, "sendMessage", map[string]interface{}{
+		"chat_id":             msg.Chat.ID,
+		"text":                text,
+		"reply_to_message_id": msg.MessageID,
+	}, nil)
+	if err != nil {
+		log.WithError(err).Error("Failed to reply on Telegram")
+	}
+}
+
+func (b *TelegramBot) call(ctx context.Context, method string, params, result interface{}) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", b.endpoint+method, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := telegramClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var apiResp struct {
+		OK          bool            `json:"ok"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
+		return err
+	}
+	if !apiResp.OK {
+		return fmt.Errorf("telegram %s failed: %s", method, apiResp.Description)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(apiResp.Result, result)
+}
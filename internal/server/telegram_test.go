@@ -0,0 +1,141 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTelegramBotClaim(t *testing.T) {
+	var (
+		mutex   sync.Mutex
+		replies []string
+	)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var params struct {
+			Text string `json:"text"`
+		}
+		json.NewDecoder(r.Body).Decode(&params)
+		mutex.Lock()
+		replies = append(replies, params.Text)
+		mutex.Unlock()
+		w.Write([]byte(`{"ok":true,"result":{}}`))
+	}))
+	defer api.Close()
+
+	builder := &mockTxBuilder{}
+	denylist, _ := LoadAccessList("")
+	claimStore, _ := LoadClaimStore("", nil, 0)
+	policy, _ := LoadPayoutPolicy(nil, big.NewInt(1), "")
+	s := &Server{
+		TxBuilder: builder,
+		cfg:       &Config{Payout: 1, Symbol: "ETH", Network: "testnet"},
+		queue:     NewQueue(builder, 1, 1),
+		limiter:   NewLimiter(nil, time.Hour, 0, 0, 0),
+		policy:    policy,
+		balance:   NewBalanceMonitor(nil, nil, "ETH", time.Minute, big.NewInt(0), nil, nil),
+		denylist:  denylist,
+		claimCap:  NewClaimCap(claimStore, 0, nil, 0),
+		claims:    claimStore,
+		budget:    NewBudget(0, nil, 0, nil),
+		downtime:  &Maintenance{},
+		screening: NewRecipientCheck(nil, false, nil, "ETH"),
+		names:     NewNameResolution(nil, 0, nil),
+		explorer:  &Explorer{template: "https://explorer.example/tx/{tx}"},
+	}
+	s.queue.Start()
+	bot := NewTelegramBot(s, "token")
+	bot.endpoint = api.URL + "/"
+
+	send := func(from int64, text string) {
+		msg := &telegramMessage{Text: text}
+		msg.From.ID = from
+		bot.handleMessage(context.Background(), msg)
+	}
+	send(1, "/claim 0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
+	send(1, "/claim 0x829BD824B016326A401d083B33D092293333A830")
+	send(2, "/claim@faucet_bot 0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
+	send(3, "/claim nope")
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		mutex.Lock()
+		got := strings.Join(replies, "\n")
+		mutex.Unlock()
+		if strings.Contains(got, "Payout sent") || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(replies) != 5 {
+		t.Fatalf("replies = %q, want 5", replies)
+	}
+	got := strings.Join(replies, "\n")
+	if !strings.HasPrefix(replies[0], "Claim queued") {
+		t.Errorf("first claim reply = %q", replies[0])
+	}
+	// The second account ID and the second address both hit a cooldown
+	if n := strings.Count(got, "rate limit"); n != 2 {
+		t.Errorf("rate limited replies = %d, want 2: %q", n, replies)
+	}
+	if !strings.Contains(got, "Invalid address") {
+		t.Errorf("invalid address accepted: %q", replies)
+	}
+	if !strings.Contains(got, "Payout sent: https://explorer.example/tx/0x") {
+		t.Errorf("no tx link in replies: %q", replies)
+	}
+}
+
+func TestTelegramBotFailedPayout(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":true,"result":{}}`))
+	}))
+	defer api.Close()
+
+	builder := &mockTxBuilder{err: errors.New("insufficient funds")}
+	denylist, _ := LoadAccessList("")
+	claimStore, _ := LoadClaimStore("", nil, 0)
+	policy, _ := LoadPayoutPolicy(nil, big.NewInt(1), "")
+	s := &Server{
+		TxBuilder: builder,
+		cfg:       &Config{Payout: 1, Symbol: "ETH", Network: "testnet"},
+		queue:     NewQueue(builder, 1, 1),
+		limiter:   NewLimiter(nil, time.Hour, 0, 0, 0),
+		policy:    policy,
+		balance:   NewBalanceMonitor(nil, nil, "ETH", time.Minute, big.NewInt(0), nil, nil),
+		denylist:  denylist,
+		claimCap:  NewClaimCap(claimStore, 0, nil, 0),
+		claims:    claimStore,
+		budget:    NewBudget(0, nil, 0, nil),
+		downtime:  &Maintenance{},
+		screening: NewRecipientCheck(nil, false, nil, "ETH"),
+		names:     NewNameResolution(nil, 0, nil),
+	}
+	s.queue.OnFinal(RollbackFailed)
+	s.queue.Start()
+	bot := NewTelegramBot(s, "token")
+	bot.endpoint = api.URL + "/"
+
+	msg := &telegramMessage{Text: "/claim 0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"}
+	msg.From.ID = 1
+	bot.handleMessage(context.Background(), msg)
+
+	// The cooldowns of the account and address go once the payout failed
+	deadline := time.Now().Add(time.Second)
+	for len(s.limiter.cache.GetKeys()) > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if keys := s.limiter.cache.GetKeys(); len(keys) != 0 {
+		t.Errorf("cooldowns %v kept after the payout of a Telegram claim failed", keys)
+	}
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const throttlePruneInterval = time.Minute
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// Throttle limits every client IP to rate requests per second on all
+// endpoints, with bursts of up to burst requests. It guards against request
+// floods independently of the claim cooldown enforced by the Limiter
+type Throttle struct {
+	mutex   sync.Mutex
+	proxies *Proxies
+	rate    float64
+	burst   float64
+	buckets map[string]*tokenBucket
+}
+
+func NewThrottle(proxies *Proxies, rate float64, burst int) *Throttle {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Throttle{
+		proxies: proxies,
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+func (t *Throttle) Enabled() bool {
+	return t.rate > 0
+}
+
+// allow takes a token from the bucket of key, or returns how long until one is available
+func (t *Throttle) allow(key string, now time.Time) (bool, time.Duration) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	b, ok := t.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: t.burst, updated: now}
+		t.buckets[key] = b
+	}
+	b.tokens += now.Sub(b.updated).Seconds() * t.rate
+	if b.tokens > t.burst {
+		b.tokens = t.burst
+	}
+	b.updated = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / t.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// prune drops the buckets that have refilled, as they behave like new ones
+func (t *Throttle) prune(now time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for key, b := range t.buckets {
+		if b.tokens+now.Sub(b.updated).Seconds()*t.rate >= t.burst {
+			delete(t.buckets, key)
+		}
+	}
+}
+
+// Run prunes idle buckets until ctx is done
+func (t *Throttle) Run(ctx context.Context) {
+	ticker := time.NewTicker(throttlePruneInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			t.prune(now)
+		}
+	}
+}
+
+func (t *Throttle) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	// Probes must keep working however busy the faucet gets
+	if !t.Enabled() || r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	clientIP := t.proxies.ClientIP(r)
+	if ok, wait := t.allow(clientIP, time.Now()); !ok {
+		requestLog(r.Context()).WithField("clientIP", clientIP).Debug("Request throttled")
+		rateLimited(w, r, wait, "throttled")
+		return
+	}
+	next.ServeHTTP(w, r)
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/urfave/negroni"
+)
+
+func TestThrottle(t *testing.T) {
+	throttle := NewThrottle(nil, 1, 2)
+	now := time.Now()
+	for i, want := range []bool{true, true, false} {
+		if ok, _ := throttle.allow("10.0.0.1", now); ok != want {
+			t.Errorf("request %d allowed = %v, want %v", i, ok, want)
+		}
+	}
+	if ok, _ := throttle.allow("10.0.0.2", now); !ok {
+		t.Error("request from another IP throttled")
+	}
+	if ok, _ := throttle.allow("10.0.0.1", now.Add(time.Second)); !ok {
+		t.Error("request throttled after the bucket refilled")
+	}
+
+	throttle.prune(now.Add(time.Minute))
+	if len(throttle.buckets) != 0 {
+		t.Errorf("%d buckets left after pruning, want 0", len(throttle.buckets))
+	}
+}
+
+func TestThrottleHandler(t *testing.T) {
+	handler := negroni.New(NewThrottle(nil, 0.001, 1), negroni.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	tests := []struct {
+		path string
+		want int
+	}{
+		{path: "/api/info", want: http.StatusOK},
+		{path: "/api/info", want: http.StatusTooManyRequests},
+		{path: "/healthz", want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", tt.path, nil))
+		if rec.Code != tt.want {
+			t.Errorf("GET %s status = %d, want %d", tt.path, rec.Code, tt.want)
+		}
+		if rec.Code == http.StatusTooManyRequests && rec.Header().Get("Retry-After") == "" {
+			t.Error("throttled response has no Retry-After header")
+		}
+	}
+}
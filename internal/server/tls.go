@@ -0,0 +1,72 @@
+package server
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strconv"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// TLS terminates HTTPS in the faucet itself, with a certificate read from
+// files or obtained and renewed from Let's Encrypt for the given domains,
+// which are then cached in cacheDir. Neither files nor domains disable it
+type TLS struct {
+	certFile string
+	keyFile  string
+	manager  *autocert.Manager
+}
+
+func NewTLS(certFile, keyFile string, domains []string, cacheDir, email string) *TLS {
+	t := &TLS{certFile: certFile, keyFile: keyFile}
+	if len(domains) > 0 {
+		t.manager = &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(domains...),
+			Cache:      autocert.DirCache(cacheDir),
+			Email:      email,
+		}
+	}
+	return t
+}
+
+func (t *TLS) Enabled() bool {
+	return t.certFile != "" || t.manager != nil
+}
+
+// apply makes srv serve HTTPS, answering the TLS-ALPN challenges of Let's
+// Encrypt if the certificate is obtained from it
+func (t *TLS) apply(srv *http.Server) {
+	if t.manager != nil {
+		srv.TLSConfig = t.manager.TLSConfig()
+	} else {
+		srv.TLSConfig = &tls.Config{}
+	}
+	srv.TLSConfig.MinVersion = tls.VersionTLS12
+}
+
+// listenAndServe serves srv over HTTPS until it is shut down
+func (t *TLS) listenAndServe(srv *http.Server) error {
+	return srv.ListenAndServeTLS(t.certFile, t.keyFile)
+}
+
+// redirectServer returns a plain HTTP server on port that redirects to HTTPS
+// on httpsPort and answers the HTTP challenges of Let's Encrypt
+func (t *TLS) redirectServer(port, httpsPort int) *http.Server {
+	redirect := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if httpsPort != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(httpsPort))
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+	var handler http.Handler = redirect
+	if t.manager != nil {
+		handler = t.manager.HTTPHandler(redirect)
+	}
+	return &http.Server{Addr: ":" + strconv.Itoa(port), Handler: handler}
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/jellydator/ttlcache/v2"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+// TokenGate only lets through claims to addresses holding at least minBalance
+// of an ERC-20 token or ERC-721 NFT, which may live on another chain than the
+// faucet. Balances are cached for cacheTTL
+type TokenGate struct {
+	client     bind.ContractCaller
+	token      common.Address
+	minBalance *big.Int
+	cache      *ttlcache.Cache
+	cacheTTL   time.Duration
+}
+
+func NewTokenGate(client bind.ContractCaller, token common.Address, minBalance *big.Int, cacheTTL time.Duration) *TokenGate {
+	cache := ttlcache.NewCache()
+	cache.SkipTTLExtensionOnHit(true)
+	return &TokenGate{
+		client:     client,
+		token:      token,
+		minBalance: minBalance,
+		cache:      cache,
+		cacheTTL:   cacheTTL,
+	}
+}
+
+func (g *TokenGate) Enabled() bool {
+	return g.client != nil
+}
+
+func (g *TokenGate) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	if !g.Enabled() {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	address, _ := readAddress(r)
+	holder, err := g.holds(r.Context(), address)
+	if err != nil {
+		requestLog(r.Context()).WithError(err).WithField("address", address).Error("Failed to check token balance")
+		renderLocalized(w, r, http.StatusServiceUnavailable, "eligibility_unavailable")
+		return
+	}
+	if !holder {
+		requestLog(r.Context()).WithFields(log.Fields{
+			"address": address,
+			"token":   g.token.Hex(),
+		}).Info("Claim rejected by token gate")
+		renderLocalized(w, r, http.StatusForbidden, "token_required")
+		return
+	}
+	next.ServeHTTP(w, r)
+}
+
+func (g *TokenGate) holds(ctx context.Context, address string) (bool, error) {
+	if cached, err := g.cache.Get(address); err == nil {
+		return cached.(bool), nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	balance, err := chain.TokenBalance(ctx, g.client, g.token, common.HexToAddress(address))
+	if err != nil {
+		return false, err
+	}
+	holder := balance.Cmp(g.minBalance) >= 0
+	g.cache.SetWithTTL(address, holder, g.cacheTTL)
+	return holder, nil
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/urfave/negroni"
+)
+
+// balanceCaller answers balanceOf calls with the balance of the address
+type balanceCaller struct {
+	balances map[common.Address]int64
+	calls    int
+}
+
+func (c *balanceCaller) CodeAt(_ context.Context, _ common.Address, _ *big.Int) ([]byte, error) {
+	return nil, nil
+}
+
+func (c *balanceCaller) CallContract(_ context.Context, call ethereum.CallMsg, _ *big.Int) ([]byte, error) {
+	c.calls++
+	balance := big.NewInt(c.balances[common.BytesToAddress(call.Data[4:])])
+	return common.LeftPadBytes(balance.Bytes(), 32), nil
+}
+
+func TestTokenGate(t *testing.T) {
+	holder := "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"
+	caller := &balanceCaller{balances: map[common.Address]int64{common.HexToAddress(holder): 2}}
+	tests := []struct {
+		name       string
+		address    string
+		minBalance int64
+		want       int
+	}{
+		{name: "holder", address: holder, minBalance: 1, want: http.StatusOK},
+		{name: "not enough", address: holder, minBalance: 3, want: http.StatusForbidden},
+		{name: "no tokens", address: "0x0000000000000000000000000000000000000001", minBalance: 1, want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			caller.calls = 0
+			gate := NewTokenGate(caller, common.HexToAddress("0x2"), big.NewInt(tt.minBalance), time.Minute)
+			handler := negroni.New(gate, negroni.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+			for i := 0; i < 2; i++ {
+				body := bytes.NewBufferString(`{"address":"` + tt.address + `"}`)
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, httptest.NewRequest("POST", "/api/claim", body))
+				if rec.Code != tt.want {
+					t.Errorf("status = %d, want %d", rec.Code, tt.want)
+				}
+			}
+			if caller.calls != 1 {
+				t.Errorf("balance checked %d times, want 1 with caching", caller.calls)
+			}
+		})
+	}
+}
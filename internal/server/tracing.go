@@ -0,0 +1,49 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/urfave/negroni"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/chainflag/eth-faucet/internal/server")
+
+// Tracing starts a server span for every request, continuing the trace of the
+// caller when the request carries a W3C traceparent header
+type Tracing struct {
+	propagator propagation.TextMapPropagator
+}
+
+func NewTracing() *Tracing {
+	return &Tracing{propagator: propagation.TraceContext{}}
+}
+
+func (t *Tracing) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	ctx := t.propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := tracer.Start(ctx, r.Method+" "+r.URL.Path, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+		attribute.String("http.method", r.Method),
+		attribute.String("http.target", r.URL.Path),
+	))
+	defer span.End()
+
+	next.ServeHTTP(w, r.WithContext(ctx))
+	status := w.(negroni.ResponseWriter).Status()
+	span.SetAttributes(attribute.Int("http.status_code", status))
+	if status >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+}
+
+// endSpan records err on the span before ending it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/urfave/negroni"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var (
+	recordSpans  sync.Once
+	spanExporter *tracetest.InMemoryExporter
+)
+
+// recordedSpans returns the spans ended since the previous call. The tracer of
+// the package binds to the first global provider, so it is only set once
+func recordedSpans() map[string]tracetest.SpanStub {
+	recordSpans.Do(func() {
+		spanExporter = tracetest.NewInMemoryExporter()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(spanExporter)))
+	})
+	spans := make(map[string]tracetest.SpanStub)
+	for _, span := range spanExporter.GetSpans() {
+		spans[span.Name] = span
+	}
+	spanExporter.Reset()
+	return spans
+}
+
+func TestTracing(t *testing.T) {
+	recordedSpans()
+
+	q := NewQueue(&mockTxBuilder{}, 1, 1)
+	q.Start()
+	defer q.Close(context.Background())
+
+	var claimID string
+	n := negroni.New(NewTracing())
+	n.UseHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claim, err := q.Enqueue(r.Context(), "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", big.NewInt(1))
+		if err != nil {
+			t.Fatalf("Enqueue() error = %v", err)
+		}
+		claimID = claim.ID
+	})
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest("POST", "/api/claim", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	n.ServeHTTP(httptest.NewRecorder(), req)
+	waitForStatus(t, q, claimID, ClaimBroadcast)
+
+	spans := recordedSpans()
+	request, ok := spans["POST /api/claim"]
+	if !ok {
+		t.Fatal("request span not recorded")
+	}
+	if got := request.SpanContext.TraceID().String(); got != traceID {
+		t.Errorf("request span trace ID = %s, want %s", got, traceID)
+	}
+	payout, ok := spans["queue.payout"]
+	if !ok {
+		t.Fatal("payout span not recorded")
+	}
+	if payout.Parent.SpanID() != request.SpanContext.SpanID() {
+		t.Errorf("payout span parent = %s, want request span %s", payout.Parent.SpanID(), request.SpanContext.SpanID())
+	}
+}
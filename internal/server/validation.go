@@ -0,0 +1,65 @@
+package server
+
+import (
+	"math/big"
+	"net/http"
+	"strings"
+)
+
+// maxBodySize is the largest request body accepted, in bytes
+const maxBodySize = 4096
+
+// ClaimValidation rejects claims whose body does not follow the claim schema
+// before any other check counts them. The address is required, and the chain
+// and token a client names, if any, must be the ones the faucet pays out in.
+// The address itself is checked once names and native addresses are resolved
+type ClaimValidation struct {
+	chainID  *big.Int
+	symbol   string
+	purposes *Purposes
+}
+
+// NewClaimValidation accepts claims for chainID, which is nil on chains
+// without a numeric ID, and the token symbol, tagged with one of purposes if any
+func NewClaimValidation(chainID *big.Int, symbol string, purposes *Purposes) *ClaimValidation {
+	return &ClaimValidation{chainID: chainID, symbol: symbol, purposes: purposes}
+}
+
+func (v *ClaimValidation) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	if r.Method != "POST" {
+		next.ServeHTTP(w, r)
+		return
+	}
+	var claimReq claimRequest
+	if err := decodeJSONBody(r, &claimReq); err != nil {
+		renderError(w, r, err)
+		return
+	}
+	if err := v.validate(claimReq); err != nil {
+		renderError(w, r, err)
+		return
+	}
+	next.ServeHTTP(w, r)
+}
+
+func (v *ClaimValidation) validate(req claimRequest) error {
+	if req.Address == "" {
+		return &malformedRequest{status: http.StatusBadRequest, code: "missing_field", field: "address", args: []interface{}{"address"}}
+	}
+	if req.Chain != "" {
+		chainID, ok := new(big.Int).SetString(req.Chain, 10)
+		if !ok || chainID.Sign() <= 0 {
+			return &malformedRequest{status: http.StatusBadRequest, code: "invalid_field", field: "chain", args: []interface{}{"chain"}}
+		}
+		if v.chainID == nil || chainID.Cmp(v.chainID) != 0 {
+			return &malformedRequest{status: http.StatusBadRequest, code: "unsupported_chain", field: "chain", args: []interface{}{req.Chain}}
+		}
+	}
+	if req.Token != "" && !strings.EqualFold(req.Token, v.symbol) {
+		return &malformedRequest{status: http.StatusBadRequest, code: "unsupported_token", field: "token", args: []interface{}{req.Token}}
+	}
+	if req.Purpose != "" && !v.purposes.Valid(strings.ToLower(req.Purpose)) {
+		return &malformedRequest{status: http.StatusBadRequest, code: "unsupported_purpose", field: "purpose", args: []interface{}{req.Purpose}}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/urfave/negroni"
+)
+
+func TestClaimValidation(t *testing.T) {
+	purposes, _ := ParsePurposes([]string{"hackathon", "ci"})
+	validation := NewClaimValidation(big.NewInt(122), "FUSE", purposes)
+	handler := negroni.New(validation, negroni.HandlerFunc(func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		if _, err := readAddress(r); err != nil {
+			renderError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		code   string
+		field  string
+	}{
+		{name: "valid", body: `{"address":"0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B","chain":"122","token":"fuse"}`, status: http.StatusOK},
+		{name: "missing address", body: `{"chain":"122"}`, status: http.StatusBadRequest, code: "missing_field", field: "address"},
+		{name: "bad checksum", body: `{"address":"0xab5801a7d398351b8be11c439e05c5b3259aec9b"}`, status: http.StatusBadRequest, code: "invalid_checksum", field: "address"},
+		{name: "not an address", body: `{"address":"0x1234"}`, status: http.StatusBadRequest, code: "invalid_address", field: "address"},
+		{name: "unknown field", body: `{"address":"0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B","foo":1}`, status: http.StatusBadRequest, code: "unknown_field", field: "foo"},
+		{name: "wrong type", body: `{"address":1}`, status: http.StatusBadRequest, code: "invalid_field", field: "address"},
+		{name: "trailing data", body: `{"address":"0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"}{}`, status: http.StatusBadRequest, code: "malformed_json"},
+		{name: "other chain", body: `{"address":"0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B","chain":"1"}`, status: http.StatusBadRequest, code: "unsupported_chain", field: "chain"},
+		{name: "invalid chain", body: `{"address":"0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B","chain":"fuse"}`, status: http.StatusBadRequest, code: "invalid_field", field: "chain"},
+		{name: "other token", body: `{"address":"0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B","token":"ETH"}`, status: http.StatusBadRequest, code: "unsupported_token", field: "token"},
+		{name: "purpose", body: `{"address":"0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B","purpose":"CI"}`, status: http.StatusOK},
+		{name: "unknown purpose", body: `{"address":"0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B","purpose":"airdrop"}`, status: http.StatusBadRequest, code: "unsupported_purpose", field: "purpose"},
+		{name: "too large", body: `{"address":"` + strings.Repeat("a", maxBodySize) + `"}`, status: http.StatusRequestEntityTooLarge, code: "body_too_large"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest("POST", "/api/claim", strings.NewReader(tt.body)))
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if tt.code == "" {
+				return
+			}
+			var resp claimResponse
+			json.NewDecoder(rec.Body).Decode(&resp)
+			if resp.Code != tt.code || resp.Field != tt.field {
+				t.Errorf("error = %s in %q, want %s in %q", resp.Code, resp.Field, tt.code, tt.field)
+			}
+		})
+	}
+}
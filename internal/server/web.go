@@ -0,0 +1,64 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/chainflag/eth-faucet/web"
+)
+
+var titlePattern = regexp.MustCompile(`<title>[^<]*</title>`)
+
+// handleWeb serves the bundled frontend. Its page comes with the faucet info
+// the frontend would otherwise fetch from /api/info as window.faucetInfo
+func (s *Server) handleWeb() http.Handler {
+	files := http.FileServer(web.Dist())
+	page := web.Index()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			// Vite fingerprints the names of the bundled assets
+			if strings.HasPrefix(r.URL.Path, "/assets/") {
+				w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+			}
+			files.ServeHTTP(w, r)
+			return
+		}
+		if r.Method != "GET" && r.Method != "HEAD" {
+			http.NotFound(w, r)
+			return
+		}
+
+		info := s.info(r)
+		// Marshal escapes <, > and &, so the JSON cannot close the script element
+		data, err := json.Marshal(info)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		title := fmt.Sprintf("<title>%s %s Faucet</title>", html.EscapeString(info.Symbol), html.EscapeString(capitalize(info.Network)))
+		body := titlePattern.ReplaceAllLiteral(page, []byte(title))
+		script := []byte(fmt.Sprintf("<script>window.faucetInfo = %s;</script>", data))
+		if end := bytes.Index(body, []byte("</head>")); end >= 0 {
+			body = append(body[:end:end], append(script, body[end:]...)...)
+		} else {
+			body = append(script, body...)
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write(body)
+	})
+}
+
+// capitalize upper-cases the first letter of the network name like the frontend does
+func capitalize(name string) string {
+	if name == "" {
+		return name
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"math/big"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandleWeb(t *testing.T) {
+	builder := &chainTxBuilder{}
+	s := &Server{
+		TxBuilder: builder,
+		cfg:       &Config{Network: "fuse</script>", Symbol: "FUSE", Payout: 1, Interval: 1440},
+		queue:     NewQueue(builder, 1, 1),
+		github:    NewGithubAuth("", "", "", 0),
+		balance:   NewBalanceMonitor(nil, nil, "FUSE", time.Minute, big.NewInt(0), nil, nil),
+		names:     NewNameResolution(nil, 0, nil),
+		downtime:  &Maintenance{},
+	}
+
+	rec := httptest.NewRecorder()
+	s.handleWeb().ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	body := rec.Body.String()
+	if !strings.Contains(body, `<script>window.faucetInfo = {`) || !strings.Contains(body, `"chain_id":122`) {
+		t.Errorf("page = %s, want the faucet info injected", body)
+	}
+	if strings.Contains(body, "fuse</script>") {
+		t.Errorf("page = %s, the network name closes the script element", body)
+	}
+	if rec.Header().Get("Cache-Control") != "no-cache" {
+		t.Errorf("Cache-Control = %q, the page must be revalidated", rec.Header().Get("Cache-Control"))
+	}
+
+	rec = httptest.NewRecorder()
+	s.handleWeb().ServeHTTP(rec, httptest.NewRequest("GET", "/assets/index.js", nil))
+	if !strings.Contains(rec.Header().Get("Cache-Control"), "immutable") {
+		t.Errorf("Cache-Control = %q, want bundled assets cached", rec.Header().Get("Cache-Control"))
+	}
+}
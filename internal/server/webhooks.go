@@ -0,0 +1,272 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+const (
+	webhookQueueSize   = 256
+	webhookAttempts    = 5
+	webhookBaseBackoff = time.Second
+
+	webhookSignatureHeader = "X-Faucet-Signature"
+	webhookTimestampHeader = "X-Faucet-Timestamp"
+)
+
+const (
+	eventClaimSucceeded = "claim.succeeded"
+	eventClaimFailed    = "claim.failed"
+	eventClaimFlagged   = "claim.flagged"
+)
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+type webhookEvent struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+type claimEventData struct {
+	ClaimID   string `json:"claim_id"`
+	RequestID string `json:"request_id,omitempty"`
+	Address   string `json:"address"`
+	Amount    string `json:"amount"`
+	Status    string `json:"status"`
+	TxHash    string `json:"tx_hash,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+type flaggedEventData struct {
+	RequestID string `json:"request_id,omitempty"`
+	Reason    string `json:"reason"`
+	Address   string `json:"address,omitempty"`
+	ClientIP  string `json:"client_ip"`
+	Country   string `json:"country,omitempty"`
+}
+
+type flagsKey struct{}
+
+// claimFlags collects the abuse the defenses further down the chain rejected a claim for
+type claimFlags struct {
+	mutex   sync.Mutex
+	flagged []flaggedEventData
+}
+
+// flagClaim reports a claim rejected as likely abuse to the webhooks
+func flagClaim(r *http.Request, reason string) {
+	if flags, ok := r.Context().Value(flagsKey{}).(*claimFlags); ok {
+		address, _ := readAddress(r)
+		flags.mutex.Lock()
+		flags.flagged = append(flags.flagged, flaggedEventData{
+			Reason:  reason,
+			Address: address,
+			Country: requestCountry(r.Context()),
+		})
+		flags.mutex.Unlock()
+	}
+}
+
+// Webhooks posts claim lifecycle events to the configured URLs. Each delivery
+// is signed with an HMAC-SHA256 of "<timestamp>.<body>" keyed with the secret,
+// sent as "sha256=<hex>" in X-Faucet-Signature, and retried with an exponential
+// backoff until the receiver answers with a 2xx status. Every URL has its own
+// queue, so that a slow receiver does not hold back the others
+type Webhooks struct {
+	endpoints []*webhookEndpoint
+	secret    []byte
+	proxies   *Proxies
+	backoff   time.Duration
+}
+
+type webhookEndpoint struct {
+	url    string
+	events chan webhookEvent
+}
+
+func NewWebhooks(urls []string, secret string, proxies *Proxies) *Webhooks {
+	endpoints := make([]*webhookEndpoint, len(urls))
+	for i, url := range urls {
+		endpoints[i] = &webhookEndpoint{url: url, events: make(chan webhookEvent, webhookQueueSize)}
+	}
+	return &Webhooks{
+		endpoints: endpoints,
+		secret:    []byte(secret),
+		proxies:   proxies,
+		backoff:   webhookBaseBackoff,
+	}
+}
+
+func (h *Webhooks) Enabled() bool {
+	return len(h.endpoints) > 0
+}
+
+// ClaimFinished emits the success or failure event of a claim in a final status
+func (h *Webhooks) ClaimFinished(claim Claim) {
+	eventType := eventClaimSucceeded
+	if claim.Status == ClaimFailed {
+		eventType = eventClaimFailed
+	}
+	data := claimEventData{
+		ClaimID:   claim.ID,
+		RequestID: claim.RequestID,
+		Address:   claim.Address,
+		Amount:    chain.FormatEther(claim.Amount),
+		Status:    string(claim.Status),
+		Error:     claim.Error,
+	}
+	if claim.Status != ClaimFailed {
+		data.TxHash = claim.TxHash.Hex()
+	}
+	h.emit(eventType, data)
+}
+
+// ServeHTTP emits a flagged event for claims the middlewares after it reject as abuse
+func (h *Webhooks) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	if !h.Enabled() {
+		next.ServeHTTP(w, r)
+		return
+	}
+	flags := &claimFlags{}
+	r = r.WithContext(context.WithValue(r.Context(), flagsKey{}, flags))
+	next.ServeHTTP(w, r)
+
+	flags.mutex.Lock()
+	defer flags.mutex.Unlock()
+	for _, data := range flags.flagged {
+		data.RequestID = requestID(r.Context())
+		data.ClientIP = h.proxies.ClientIP(r)
+		h.emit(eventClaimFlagged, data)
+	}
+}
+
+// emit queues an event for every receiver without blocking the claim, dropping
+// it for the receivers that cannot keep up
+func (h *Webhooks) emit(eventType string, data interface{}) {
+	if !h.Enabled() {
+		return
+	}
+	id, err := newRandomID()
+	if err != nil {
+		log.WithError(err).Error("Failed to create webhook event")
+		return
+	}
+	event := webhookEvent{ID: id, Type: eventType, CreatedAt: time.Now().UTC(), Data: data}
+	for _, endpoint := range h.endpoints {
+		select {
+		case endpoint.events <- event:
+		default:
+			log.WithFields(log.Fields{
+				"event":    eventType,
+				"receiver": webhookHost(endpoint.url),
+			}).Warn("Webhook queue is full, dropping event")
+		}
+	}
+}
+
+// Run delivers queued events to every receiver concurrently until ctx is done
+func (h *Webhooks) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, endpoint := range h.endpoints {
+		wg.Add(1)
+		go func(endpoint *webhookEndpoint) {
+			defer wg.Done()
+			h.serve(ctx, endpoint)
+		}(endpoint)
+	}
+	wg.Wait()
+}
+
+// serve delivers the events queued for endpoint in order until ctx is done
+func (h *Webhooks) serve(ctx context.Context, endpoint *webhookEndpoint) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-endpoint.events:
+			body, err := json.Marshal(event)
+			if err != nil {
+				log.WithError(err).Error("Failed to encode webhook event")
+				continue
+			}
+			h.deliver(ctx, endpoint.url, event, body)
+		}
+	}
+}
+
+func (h *Webhooks) deliver(ctx context.Context, url string, event webhookEvent, body []byte) {
+	backoff := h.backoff
+	var err error
+	for attempt := 1; attempt <= webhookAttempts; attempt++ {
+		if err = h.post(ctx, url, body); err == nil {
+			return
+		}
+		if attempt == webhookAttempts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+	log.WithError(err).WithFields(log.Fields{
+		"event":    event.Type,
+		"eventID":  event.ID,
+		"receiver": webhookHost(url),
+	}).Error("Failed to deliver webhook")
+}
+
+func (h *Webhooks) post(ctx context.Context, url string, body []byte) error {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookTimestampHeader, timestamp)
+	if len(h.secret) > 0 {
+		req.Header.Set(webhookSignatureHeader, "sha256="+signWebhook(h.secret, timestamp, body))
+	}
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook receiver answered with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// webhookHost names a receiver in logs without the path and query, which often carry a token
+func webhookHost(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		return u.Host
+	}
+	return ""
+}
+
+func signWebhook(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
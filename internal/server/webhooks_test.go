@@ -0,0 +1,104 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/urfave/negroni"
+)
+
+func TestWebhooks(t *testing.T) {
+	deliveries := make(chan webhookEvent, 4)
+	attempts := 0
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		var event webhookEvent
+		if err := json.Unmarshal(body, &event); err != nil {
+			t.Errorf("decode event: %v", err)
+		}
+		want := "sha256=" + signWebhook([]byte("secret"), r.Header.Get(webhookTimestampHeader), body)
+		deliveries <- event
+		if got := r.Header.Get(webhookSignatureHeader); got != want {
+			t.Errorf("signature = %q, want %q", got, want)
+		}
+	}))
+	defer receiver.Close()
+
+	hooks := NewWebhooks([]string{receiver.URL}, "secret", nil)
+	hooks.backoff = time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hooks.Run(ctx)
+
+	hooks.ClaimFinished(Claim{ID: "1", Address: "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", Amount: big.NewInt(1e18), Status: ClaimFailed, Error: "out of gas"})
+	select {
+	case event := <-deliveries:
+		if event.Type != eventClaimFailed {
+			t.Errorf("event type = %q, want %q", event.Type, eventClaimFailed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("event not delivered")
+	}
+	if attempts != 2 {
+		t.Errorf("attempts = %d, want 2 after a failed delivery", attempts)
+	}
+
+	handler := negroni.New(hooks, negroni.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flagClaim(r, "score_too_low")
+		w.WriteHeader(http.StatusForbidden)
+	})))
+	body := bytes.NewBufferString(`{"address":"0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"}`)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/claim", body))
+	select {
+	case event := <-deliveries:
+		data := event.Data.(map[string]interface{})
+		if event.Type != eventClaimFlagged || data["reason"] != "score_too_low" {
+			t.Errorf("event = %s %v, want %s for score_too_low", event.Type, data["reason"], eventClaimFlagged)
+		}
+		if data["address"] != "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B" {
+			t.Errorf("address = %v", data["address"])
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("flagged event not delivered")
+	}
+}
+
+func TestWebhooksSlowReceiver(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+	delivered := make(chan struct{}, 2)
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delivered <- struct{}{}
+	}))
+	defer fast.Close()
+
+	hooks := NewWebhooks([]string{slow.URL, fast.URL}, "", nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hooks.Run(ctx)
+
+	for i := 0; i < 2; i++ {
+		hooks.ClaimFinished(Claim{ID: "1", Amount: big.NewInt(1e18), Status: ClaimConfirmed})
+		select {
+		case <-delivered:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("event %d not delivered while another receiver hangs", i)
+		}
+	}
+}
@@ -0,0 +1,315 @@
+// Package client is a typed Go client of the faucet HTTP API, for tools that
+// claim from a faucet or follow their claims until they are paid out
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	apiKeyHeader         = "X-API-Key"
+	claimTokenHeader     = "X-Claim-Token"
+	captchaHeader        = "h-captcha-response"
+
+	// maxResponseSize bounds the responses read from the faucet
+	maxResponseSize = 1 << 20
+)
+
+// ErrClaimFailed is returned by WaitForConfirmation when the payout of the claim failed
+var ErrClaimFailed = errors.New("claim failed")
+
+// Error is an error response of the faucet. Code is the stable error code
+// documented in the README, Field the offending field of the request if any
+type Error struct {
+	StatusCode int
+	Code       string
+	Field      string
+	Message    string
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("faucet: %d %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("faucet: %s (%s)", e.Message, e.Code)
+}
+
+// Client calls the API of the faucet at a base URL such as
+// https://faucet.example.com. Failed calls are retried with an exponential
+// backoff, or after the wait the faucet asked for if it is short enough
+type Client struct {
+	baseURL      string
+	httpClient   *http.Client
+	apiKey       string
+	retries      int
+	backoff      time.Duration
+	maxWait      time.Duration
+	pollInterval time.Duration
+}
+
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client calls are made with
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithAPIKey sets the API key claims are made with, which skips the captcha
+func WithAPIKey(key string) Option {
+	return func(c *Client) {
+		c.apiKey = key
+	}
+}
+
+// WithRetries sets how many times a failed call is retried, the first one
+// after backoff and the next ones after twice as long as the one before
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.backoff = backoff
+	}
+}
+
+// WithMaxRetryWait sets the longest wait before a retry. Calls the faucet
+// asks to retry later than that, such as claims on cooldown, are not retried
+func WithMaxRetryWait(wait time.Duration) Option {
+	return func(c *Client) {
+		c.maxWait = wait
+	}
+}
+
+// WithPollInterval sets how often WaitForConfirmation asks for the status of a claim
+func WithPollInterval(interval time.Duration) Option {
+	return func(c *Client) {
+		c.pollInterval = interval
+	}
+}
+
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:      strings.TrimRight(baseURL, "/"),
+		httpClient:   &http.Client{Timeout: 30 * time.Second},
+		retries:      3,
+		backoff:      500 * time.Millisecond,
+		maxWait:      30 * time.Second,
+		pollInterval: 2 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+type claimOptions struct {
+	idempotencyKey string
+	header         http.Header
+}
+
+type ClaimOption func(*claimOptions)
+
+// WithIdempotencyKey sets the Idempotency-Key of the claim, which is
+// otherwise random. Claims retried with the same key are paid out once
+func WithIdempotencyKey(key string) ClaimOption {
+	return func(o *claimOptions) {
+		o.idempotencyKey = key
+	}
+}
+
+// WithClaimToken makes the claim with a one-time claim token minted by a partner
+func WithClaimToken(token string) ClaimOption {
+	return func(o *claimOptions) {
+		o.header.Set(claimTokenHeader, token)
+	}
+}
+
+// WithCaptcha makes the claim with a solved hCaptcha token
+func WithCaptcha(token string) ClaimOption {
+	return func(o *claimOptions) {
+		o.header.Set(captchaHeader, token)
+	}
+}
+
+// WithHeader sends a header along with the claim, e.g. the pow-seed and pow-nonce of a proof of work
+func WithHeader(name, value string) ClaimOption {
+	return func(o *claimOptions) {
+		o.header.Set(name, value)
+	}
+}
+
+// Claim asks the faucet for a payout. Retries of the claim carry the same
+// Idempotency-Key, so that a claim whose response was lost is not paid twice
+func (c *Client) Claim(ctx context.Context, req ClaimRequest, opts ...ClaimOption) (*ClaimResponse, error) {
+	o := &claimOptions{header: make(http.Header)}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.idempotencyKey == "" {
+		o.idempotencyKey = newIdempotencyKey()
+	}
+	o.header.Set(idempotencyKeyHeader, o.idempotencyKey)
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var resp ClaimResponse
+	if err := c.do(ctx, "POST", "/api/claim", body, o.header, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Status returns the status of the claim with the given ID
+func (c *Client) Status(ctx context.Context, claimID string) (*ClaimStatus, error) {
+	var status ClaimStatus
+	if err := c.do(ctx, "GET", "/api/claim/"+url.PathEscape(claimID), nil, nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Info returns the settings of the faucet, such as its chain, payout and cooldown
+func (c *Client) Info(ctx context.Context) (*Info, error) {
+	var info Info
+	if err := c.do(ctx, "GET", "/api/info", nil, nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// WaitForConfirmation polls the status of the claim until it is final or ctx
+// is done. If the payout failed the status is returned with ErrClaimFailed
+func (c *Client) WaitForConfirmation(ctx context.Context, claimID string) (*ClaimStatus, error) {
+	for {
+		status, err := c.Status(ctx, claimID)
+		if err != nil {
+			return nil, err
+		}
+		if status.Status == StatusFailed {
+			return status, fmt.Errorf("%w: %s", ErrClaimFailed, status.Error)
+		}
+		if status.Final() {
+			return status, nil
+		}
+
+		timer := time.NewTimer(c.pollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return status, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// do calls the API, retrying calls that failed for reasons that may pass
+func (c *Client) do(ctx context.Context, method, path string, body []byte, header http.Header, dst interface{}) error {
+	for attempt := 0; ; attempt++ {
+		wait, err := c.call(ctx, method, path, body, header, dst)
+		if err == nil || wait < 0 || attempt >= c.retries {
+			return err
+		}
+		if wait == 0 {
+			wait = c.backoff << attempt
+		}
+		if wait > c.maxWait {
+			return err
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// call makes a single call to the API, returning how long to wait before
+// retrying it if it failed, zero for the backoff and a negative wait if it
+// must not be retried
+func (c *Client) call(ctx context.Context, method, path string, body []byte, header http.Header, dst interface{}) (time.Duration, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return -1, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.apiKey != "" {
+		req.Header.Set(apiKeyHeader, c.apiKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return -1, err
+		}
+		return 0, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode == http.StatusOK {
+		return -1, json.Unmarshal(data, dst)
+	}
+
+	apiErr := newError(resp, data)
+	switch resp.StatusCode {
+	case http.StatusConflict, http.StatusTooManyRequests, http.StatusInternalServerError,
+		http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return apiErr.RetryAfter, apiErr
+	}
+	return -1, apiErr
+}
+
+func newError(resp *http.Response, data []byte) *Error {
+	apiErr := &Error{StatusCode: resp.StatusCode}
+	var body ClaimResponse
+	if json.Unmarshal(data, &body) == nil {
+		apiErr.Code = body.Code
+		apiErr.Field = body.Field
+		apiErr.Message = body.Message
+		apiErr.RetryAfter = time.Duration(body.RetryAfter) * time.Second
+	}
+	if apiErr.Message == "" {
+		apiErr.Message = http.StatusText(resp.StatusCode)
+	}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		apiErr.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	return apiErr
+}
+
+func newIdempotencyKey() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,100 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClaimRetries(t *testing.T) {
+	var keys []string
+	faucet := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get(idempotencyKeyHeader))
+		if r.Header.Get(apiKeyHeader) != "ci-key" {
+			t.Errorf("API key = %q, want ci-key", r.Header.Get(apiKeyHeader))
+		}
+		var req ClaimRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Address != "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B" || req.Purpose != "ci" {
+			t.Errorf("claim = %+v, want the address and purpose sent", req)
+		}
+		if len(keys) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(ClaimResponse{Message: "The network is unavailable", Code: "network_unavailable"})
+			return
+		}
+		json.NewEncoder(w).Encode(ClaimResponse{Message: "Claim queued: abc", ClaimID: "abc", Progress: &Progress{QueuePosition: 1, QueueLength: 1}})
+	}))
+	defer faucet.Close()
+
+	c := New(faucet.URL+"/", WithAPIKey("ci-key"), WithRetries(3, time.Millisecond))
+	resp, err := c.Claim(context.Background(), ClaimRequest{Address: "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", Purpose: "ci"})
+	if err != nil || resp.ClaimID != "abc" || resp.Progress == nil || resp.QueuePosition != 1 {
+		t.Fatalf("Claim() = %+v, %v, want claim abc queued first", resp, err)
+	}
+	if len(keys) != 3 || keys[0] == "" || keys[1] != keys[0] || keys[2] != keys[0] {
+		t.Errorf("idempotency keys = %q, want the same key on every retry", keys)
+	}
+}
+
+func TestClaimError(t *testing.T) {
+	calls := 0
+	faucet := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.Header.Get(idempotencyKeyHeader) != "my-key" || r.Header.Get(claimTokenHeader) != "token" {
+			t.Errorf("headers = %v, want the idempotency key and claim token given", r.Header)
+		}
+		w.Header().Set("Retry-After", "86400")
+		w.WriteHeader(http.StatusTooManyRequests)
+		json.NewEncoder(w).Encode(ClaimResponse{Message: "You have exceeded the rate limit", Code: "rate_limited", RetryAfter: 86400})
+	}))
+	defer faucet.Close()
+
+	c := New(faucet.URL, WithRetries(3, time.Millisecond))
+	_, err := c.Claim(context.Background(), ClaimRequest{Address: "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"},
+		WithIdempotencyKey("my-key"), WithClaimToken("token"))
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.Code != "rate_limited" || apiErr.StatusCode != http.StatusTooManyRequests || apiErr.RetryAfter != 24*time.Hour {
+		t.Fatalf("Claim() error = %v, want a rate_limited error to retry after 24h", err)
+	}
+	if calls != 1 {
+		t.Errorf("claim made %d times, want 1 since the cooldown is longer than the longest retry wait", calls)
+	}
+}
+
+func TestWaitForConfirmation(t *testing.T) {
+	statuses := []string{StatusQueued, StatusBroadcast, StatusConfirmed}
+	polls := 0
+	faucet := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/claim/abc":
+			status := statuses[polls]
+			polls++
+			json.NewEncoder(w).Encode(ClaimStatus{ClaimID: "abc", Status: status, TxHash: "0x01"})
+		case "/api/claim/def":
+			json.NewEncoder(w).Encode(ClaimStatus{ClaimID: "def", Status: StatusFailed, Error: "insufficient funds"})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(ClaimResponse{Message: "Claim not found", Code: "claim_not_found"})
+		}
+	}))
+	defer faucet.Close()
+
+	c := New(faucet.URL, WithPollInterval(time.Millisecond))
+	ctx := context.Background()
+	status, err := c.WaitForConfirmation(ctx, "abc")
+	if err != nil || status.Status != StatusConfirmed || polls != 3 {
+		t.Errorf("WaitForConfirmation() = %+v, %v after %d polls, want confirmed after 3", status, err, polls)
+	}
+	if status, err := c.WaitForConfirmation(ctx, "def"); !errors.Is(err, ErrClaimFailed) || status.Status != StatusFailed {
+		t.Errorf("WaitForConfirmation() of a failed claim = %+v, %v, want ErrClaimFailed", status, err)
+	}
+	var apiErr *Error
+	if _, err := c.Status(ctx, "ghi"); !errors.As(err, &apiErr) || apiErr.Code != "claim_not_found" {
+		t.Errorf("Status() of an unknown claim error = %v, want claim_not_found", err)
+	}
+}
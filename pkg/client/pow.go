@@ -0,0 +1,69 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"math/bits"
+	"strconv"
+)
+
+const (
+	powSeedHeader  = "pow-seed"
+	powNonceHeader = "pow-nonce"
+)
+
+// Challenge is a proof of work challenge, which claims solve in place of a
+// captcha on faucets that set a proof of work difficulty
+type Challenge struct {
+	Seed       string `json:"seed"`
+	Difficulty int    `json:"difficulty"`
+	ExpiresAt  int64  `json:"expires_at"`
+}
+
+// Challenge fetches a single-use proof of work challenge from the faucet
+func (c *Client) Challenge(ctx context.Context) (*Challenge, error) {
+	var challenge Challenge
+	if err := c.do(ctx, "GET", "/api/pow", nil, nil, &challenge); err != nil {
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+// Solve searches for a nonce solving the challenge for a claim to address
+func (ch *Challenge) Solve(ctx context.Context, address string) (string, error) {
+	for i := uint64(0); ; i++ {
+		if i%100000 == 0 && ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		nonce := strconv.FormatUint(i, 10)
+		if VerifyProofOfWork(ch.Seed, address, nonce, ch.Difficulty) {
+			return nonce, nil
+		}
+	}
+}
+
+// WithProofOfWork makes the claim with the nonce solving the challenge of seed
+func WithProofOfWork(seed, nonce string) ClaimOption {
+	return func(o *claimOptions) {
+		o.header.Set(powSeedHeader, seed)
+		o.header.Set(powNonceHeader, nonce)
+	}
+}
+
+// VerifyProofOfWork reports whether sha256(seed || address || nonce) has at
+// least difficulty leading zero bits
+func VerifyProofOfWork(seed, address, nonce string, difficulty int) bool {
+	hash := sha256.Sum256([]byte(seed + address + nonce))
+	return leadingZeroBits(hash[:]) >= difficulty
+}
+
+func leadingZeroBits(b []byte) int {
+	n := 0
+	for _, v := range b {
+		if v != 0 {
+			return n + bits.LeadingZeros8(v)
+		}
+		n += 8
+	}
+	return n
+}
@@ -0,0 +1,70 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProofOfWork(t *testing.T) {
+	address := "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"
+	faucet := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/pow":
+			json.NewEncoder(w).Encode(Challenge{Seed: "seed", Difficulty: 8})
+		case "/api/claim":
+			if !VerifyProofOfWork(r.Header.Get(powSeedHeader), address, r.Header.Get(powNonceHeader), 8) {
+				w.WriteHeader(http.StatusForbidden)
+				json.NewEncoder(w).Encode(ClaimResponse{Message: "Captcha verification failed", Code: "captcha_failed"})
+				return
+			}
+			json.NewEncoder(w).Encode(ClaimResponse{Message: "Claim queued: abc", ClaimID: "abc"})
+		}
+	}))
+	defer faucet.Close()
+
+	c := New(faucet.URL)
+	ctx := context.Background()
+	challenge, err := c.Challenge(ctx)
+	if err != nil || challenge.Seed != "seed" || challenge.Difficulty != 8 {
+		t.Fatalf("Challenge() = %+v, %v, want seed of difficulty 8", challenge, err)
+	}
+	nonce, err := challenge.Solve(ctx, address)
+	if err != nil {
+		t.Fatalf("Solve() error = %v", err)
+	}
+	if !VerifyProofOfWork(challenge.Seed, address, nonce, challenge.Difficulty) {
+		t.Errorf("VerifyProofOfWork() rejected the solution found by Solve()")
+	}
+	if _, err := c.Claim(ctx, ClaimRequest{Address: address}, WithProofOfWork(challenge.Seed, nonce)); err != nil {
+		t.Errorf("Claim() with the solution error = %v", err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	hard := Challenge{Seed: "seed", Difficulty: 256}
+	if _, err := hard.Solve(cancelled, address); err != context.Canceled {
+		t.Errorf("Solve() with a cancelled context error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestLeadingZeroBits(t *testing.T) {
+	tests := []struct {
+		name string
+		b    []byte
+		want int
+	}{
+		{name: "no zeros", b: []byte{0x80}, want: 0},
+		{name: "partial byte", b: []byte{0x00, 0x10}, want: 11},
+		{name: "all zeros", b: []byte{0x00, 0x00}, want: 16},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := leadingZeroBits(tt.b); got != tt.want {
+				t.Errorf("leadingZeroBits() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package client
+
+import (
+	"math/big"
+	"time"
+)
+
+// Statuses of a claim, of which confirmed, failed and simulated are final
+const (
+	StatusQueued    = "queued"
+	StatusBroadcast = "broadcast"
+	StatusMined     = "mined"
+	StatusConfirmed = "confirmed"
+	StatusFailed    = "failed"
+	// StatusSimulated is the final status of claims to a faucet in dry run mode
+	StatusSimulated = "simulated"
+)
+
+// ClaimRequest is the body of a claim
+type ClaimRequest struct {
+	Address string `json:"address"`
+	// Message and Signature prove ownership of the address when sign in is required
+	Message   string `json:"message,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	// Email optionally asks for a receipt of the payout
+	Email string `json:"email,omitempty"`
+	// Amount picks the payout in Ethers among the configured choices
+	Amount string `json:"amount,omitempty"`
+	// Chain and Token name the chain ID and token symbol the client expects
+	// to be paid out in, so that claims sent to the wrong faucet fail early
+	Chain string `json:"chain,omitempty"`
+	Token string `json:"token,omitempty"`
+	// Purpose tags the claim with the program it is for, one of the configured purposes
+	Purpose string `json:"purpose,omitempty"`
+}
+
+// ClaimResponse is the response to a claim, and the body of every error
+// response of the API along with Code
+type ClaimResponse struct {
+	Message    string     `json:"msg"`
+	Code       string     `json:"code,omitempty"`
+	Field      string     `json:"field,omitempty"`
+	ClaimID    string     `json:"claim_id,omitempty"`
+	Remaining  *Allowance `json:"remaining,omitempty"`
+	RetryAfter int64      `json:"retryAfterSeconds,omitempty"`
+	ResumeAt   *time.Time `json:"resume_at,omitempty"`
+	DryRun     *DryRun    `json:"dry_run,omitempty"`
+	*Progress
+}
+
+// Progress tells where a claim stands until its payout is final
+type Progress struct {
+	QueuePosition  int   `json:"queue_position,omitempty"`
+	QueueLength    int   `json:"queue_length"`
+	PendingPayouts int   `json:"pending_payouts"`
+	ETASeconds     int64 `json:"eta_seconds,omitempty"`
+}
+
+// DryRun describes the payout a claim would have received
+type DryRun struct {
+	Address string `json:"address"`
+	Amount  string `json:"amount"`
+	Funder  string `json:"funder"`
+}
+
+// Allowance is what is left of the claim cap of the address after a claim
+type Allowance struct {
+	Claims *int   `json:"claims,omitempty"`
+	Amount string `json:"amount,omitempty"`
+}
+
+// ClaimStatus is the status of a claim and its payout
+type ClaimStatus struct {
+	ClaimID     string `json:"claim_id"`
+	Address     string `json:"address"`
+	Status      string `json:"status"`
+	TxHash      string `json:"tx_hash,omitempty"`
+	ExplorerURL string `json:"explorer_url,omitempty"`
+	Error       string `json:"error,omitempty"`
+	*Progress
+}
+
+// Final reports whether the claim reached a status it does not leave anymore
+func (s *ClaimStatus) Final() bool {
+	return s.Status == StatusConfirmed || s.Status == StatusFailed || s.Status == StatusSimulated
+}
+
+// Info describes the faucet, for frontends and clients to configure themselves
+type Info struct {
+	Account         string   `json:"account"`
+	Balance         string   `json:"balance,omitempty"`
+	Network         string   `json:"network"`
+	ChainID         *big.Int `json:"chain_id,omitempty"`
+	Payout          string   `json:"payout"`
+	PayoutFiat      string   `json:"payout_fiat,omitempty"`
+	PayoutChoices   []string `json:"payout_choices,omitempty"`
+	Purposes        []string `json:"purposes,omitempty"`
+	Symbol          string   `json:"symbol"`
+	CooldownSeconds int64    `json:"cooldown_seconds"`
+	CaptchaProvider string   `json:"captcha_provider,omitempty"`
+	HcaptchaSiteKey string   `json:"hcaptcha_sitekey,omitempty"`
+	PowDifficulty   int      `json:"pow_difficulty,omitempty"`
+	OAuthLogin      string   `json:"oauth_login,omitempty"`
+	NameResolution  bool     `json:"name_resolution,omitempty"`
+	Paused          bool     `json:"paused"`
+	DryRun          bool     `json:"dry_run,omitempty"`
+	SignIn          bool     `json:"siwe,omitempty"`
+	EmailReceipts   bool     `json:"email_receipts,omitempty"`
+	// Maintenance is the ongoing or next maintenance window
+	Maintenance *MaintenanceWindow `json:"maintenance,omitempty"`
+}
+
+// MaintenanceWindow is a period during which claims are paused
+type MaintenanceWindow struct {
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Message string    `json:"message,omitempty"`
+}
@@ -17,3 +17,13 @@ func Dist() http.FileSystem {
 
 	return http.FS(fsys)
 }
+
+// Index returns the page of the bundled frontend, which the server injects its config into
+func Index() []byte {
+	page, err := static.ReadFile("dist/index.html")
+	if err != nil {
+		panic(err)
+	}
+
+	return page
+}